@@ -71,8 +71,8 @@ func main() {
 		if err := extapi.Run(
 			context.Background(),
 			ext,
+			// Run detects the internal extension and subscribes only to Invoke event, see extapi.IsInternalExtension
 			extapi.WithLogger(ext.logger),
-			extapi.WithEventTypes([]extapi.EventType{extapi.Invoke}), // sam local invoke: ShutdownEventNotSupportedForInternalExtension
 		); err != nil {
 			log.Panic(err)
 		}
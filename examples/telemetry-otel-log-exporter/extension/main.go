@@ -0,0 +1,39 @@
+// Sample extension to demonstrate how to export function logs as OpenTelemetry log records.
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+
+	"github.com/go-logr/stdr"
+	"github.com/zakharovvi/aws-lambda-extensions/extapi"
+	"github.com/zakharovvi/aws-lambda-extensions/telemetryapi"
+	"github.com/zakharovvi/aws-lambda-extensions/telemetryapi/otellog"
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploghttp"
+)
+
+func main() {
+	ctx := context.Background()
+
+	// log library debug messages
+	stdr.SetVerbosity(1)
+	logger := stdr.New(log.New(os.Stdout, "", log.Lshortfile))
+
+	// the endpoint is configured with OTEL_EXPORTER_OTLP_ENDPOINT or OTEL_EXPORTER_OTLP_LOGS_ENDPOINT environment variables
+	exporter, err := otlploghttp.New(ctx)
+	if err != nil {
+		log.Panic(err)
+	}
+	processor := otellog.NewProcessor(ctx, exporter, otellog.WithLogger(logger))
+
+	if err := telemetryapi.Run(
+		ctx,
+		processor,
+		telemetryapi.WithSubscriptionTypes([]extapi.TelemetrySubscriptionType{extapi.TelemetrySubscriptionTypeFunction}),
+		telemetryapi.WithLogger(logger),
+		telemetryapi.WithBufferingCfg(extapi.LowLatencyTelemetryBufferingCfg()),
+	); err != nil {
+		log.Panic(err)
+	}
+}
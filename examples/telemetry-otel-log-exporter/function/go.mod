@@ -0,0 +1,5 @@
+module github.com/zakharovvi/aws-lambda-extensions/examples/telemetry-otel-log-exporter/function
+
+go 1.18
+
+require github.com/aws/aws-lambda-go v1.34.1
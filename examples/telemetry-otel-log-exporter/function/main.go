@@ -0,0 +1,27 @@
+// Sample lambda function to demonstrate how to export function logs as OpenTelemetry log records.
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aws/aws-lambda-go/lambda"
+)
+
+func HandleRequest(ctx context.Context) (string, error) {
+	startedAt := time.Now()
+	log.Printf("INFO function started")
+	for i := 0; i < 3; i++ {
+		log.Printf("DEBUG function is working for %v", time.Since(startedAt))
+		time.Sleep(time.Millisecond)
+	}
+	log.Printf("WARN function is about to stop")
+
+	return fmt.Sprintf("function stopped after %v", time.Since(startedAt)), nil
+}
+
+func main() {
+	lambda.Start(HandleRequest)
+}
@@ -31,7 +31,7 @@ func main() {
 		processor,
 		telemetryapi.WithSubscriptionTypes([]extapi.TelemetrySubscriptionType{extapi.TelemetrySubscriptionTypePlatform}),
 		telemetryapi.WithLogger(logger),
-		telemetryapi.WithBufferingCfg(&extapi.TelemetryBufferingCfg{TimeoutMS: 25, MaxBytes: 262144, MaxItems: 1000}),
+		telemetryapi.WithBufferingCfg(extapi.LowLatencyTelemetryBufferingCfg()),
 	); err != nil {
 		log.Panic(err)
 	}
@@ -7,10 +7,15 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/go-logr/logr"
 	lambdaext "github.com/zakharovvi/aws-lambda-extensions"
@@ -38,6 +43,8 @@ const (
 	Failure ShutdownReason = "failure"
 	// ExtensionError is used when one of Client or Extension methods return error. It is not returned by lambda.
 	ExtensionError ShutdownReason = "extension_error"
+	// ContextCancelled is used when the context passed to Run is cancelled. It is not returned by lambda.
+	ContextCancelled ShutdownReason = "context_cancelled"
 )
 
 type RegisterRequest struct {
@@ -69,6 +76,16 @@ type NextEventResponse struct {
 	ShutdownReason ShutdownReason `json:"shutdownReason"`
 }
 
+// DeadlineOrZero returns the instant the invocation or shutdown times out
+// or zero time if DeadlineMs is not set or equals math.MaxInt64 sentinel meaning there is no deadline.
+func (e *NextEventResponse) DeadlineOrZero() time.Time {
+	if e.DeadlineMs <= 0 || e.DeadlineMs == math.MaxInt64 {
+		return time.Time{}
+	}
+
+	return time.UnixMilli(e.DeadlineMs)
+}
+
 // Tracing is part of the response for /event/next.
 type Tracing struct {
 	Type  lambdaext.TracingType  `json:"type"`
@@ -90,6 +107,16 @@ const (
 	acceptFeatureHeader = "Lambda-Extension-Accept-Feature"
 )
 
+const (
+	// DefaultExtensionAPIVersion is the Extensions API version used in URL paths unless WithExtensionAPIVersion is set.
+	DefaultExtensionAPIVersion = "2020-01-01"
+	// DefaultTelemetryAPIVersion is the Telemetry API version used in URL paths unless WithTelemetryAPIVersion is set.
+	DefaultTelemetryAPIVersion = "2022-07-01"
+)
+
+// ErrClientClosed is returned by Client methods after Client.Close was called.
+var ErrClientClosed = errors.New("client is closed")
+
 type LambdaAPIError struct {
 	Type           string `json:"errorType"`
 	Message        string `json:"errorMessage"`
@@ -100,12 +127,55 @@ func (e LambdaAPIError) Error() string {
 	return fmt.Sprintf("Lambda API http_status_code=%d type=%s, message=%s", e.HTTPStatusCode, e.Type, e.Message)
 }
 
+// IsValidation reports whether Lambda API rejected the request as invalid, e.g. with ValidationError type.
+func (e LambdaAPIError) IsValidation() bool {
+	return e.HTTPStatusCode == http.StatusBadRequest || strings.HasSuffix(e.Type, "ValidationError")
+}
+
+// IsThrottling reports whether Lambda API throttled the request.
+func (e LambdaAPIError) IsThrottling() bool {
+	return e.HTTPStatusCode == http.StatusTooManyRequests ||
+		strings.Contains(e.Type, "Throttl") ||
+		strings.Contains(e.Type, "TooManyRequests")
+}
+
+// Retryable reports whether the request can succeed if retried: the request was throttled or failed with 5xx status code.
+// Validation errors are never retryable.
+func (e LambdaAPIError) Retryable() bool {
+	if e.IsValidation() {
+		return false
+	}
+
+	return e.IsThrottling() || e.HTTPStatusCode >= http.StatusInternalServerError
+}
+
+// httpStatusError is returned for unexpected responses without Lambda API error body.
+type httpStatusError struct {
+	statusCode int
+	msg        string
+}
+
+func (e httpStatusError) Error() string {
+	return e.msg
+}
+
 type options struct {
 	extensionName       lambdaext.ExtensionName
 	awsLambdaRuntimeAPI lambdaext.AWSLambdaRuntimeAPI
 	eventTypes          []EventType
 	httpClient          *http.Client
 	log                 logr.Logger
+	env                 Environment
+	clock               Clock
+	strictExtensionName bool
+	nextEventRetries    int
+	nextEventBackoff    time.Duration
+	extensionAPIVersion string
+	telemetryAPIVersion string
+	userAgent           string
+	errorReporter       ErrorReporter
+	warningOutput       io.Writer
+	requestContext      func(ctx context.Context) context.Context
 }
 type Option interface {
 	apply(*options)
@@ -121,12 +191,29 @@ func WithExtensionName(name lambdaext.ExtensionName) Option {
 	return extensionNameOption(name)
 }
 
+type strictExtensionNameOption bool
+
+func (o strictExtensionNameOption) apply(opts *options) {
+	opts.strictExtensionName = bool(o)
+}
+
+// WithStrictExtensionName configures Register to fail instead of logging a warning
+// if the extension name contains path separators.
+// Lambda API requires the name to match the extension file name in /opt/extensions.
+func WithStrictExtensionName(strict bool) Option {
+	return strictExtensionNameOption(strict)
+}
+
 type awsLambdaRuntimeAPIOption lambdaext.AWSLambdaRuntimeAPI
 
 func (o awsLambdaRuntimeAPIOption) apply(opts *options) {
 	opts.awsLambdaRuntimeAPI = lambdaext.AWSLambdaRuntimeAPI(o)
 }
 
+// WithAWSLambdaRuntimeAPI configures the runtime API endpoint instead of AWS_LAMBDA_RUNTIME_API environment variable.
+// It is either host:port served over http as in Lambda execution environment,
+// or a full URL with https scheme or a path prefix for local emulators, e.g. "https://localhost:9001/prefix".
+// AWS_LAMBDA_RUNTIME_API environment variable accepts the same formats.
 func WithAWSLambdaRuntimeAPI(api string) Option {
 	return awsLambdaRuntimeAPIOption(api)
 }
@@ -165,21 +252,214 @@ func WithLogger(log logr.Logger) Option {
 	return loggerOption{log}
 }
 
+type environmentOption struct {
+	env Environment
+}
+
+func (o environmentOption) apply(opts *options) {
+	opts.env = o.env
+}
+
+// WithEnvironment configures lookup of runtime environment variables used instead of os.Getenv.
+// AWS_LAMBDA_RUNTIME_API is read with the provided Environment unless WithAWSLambdaRuntimeAPI is set.
+func WithEnvironment(env Environment) Option {
+	return environmentOption{env}
+}
+
+type clockOption struct {
+	clock Clock
+}
+
+func (o clockOption) apply(opts *options) {
+	opts.clock = o.clock
+}
+
+// WithClock configures Clock used by Run to compute Invoke and Shutdown event deadlines instead of real time.
+// It allows testing deadline handling deterministically.
+func WithClock(clock Clock) Option {
+	return clockOption{clock}
+}
+
+type nextEventRetriesOption struct {
+	attempts int
+	backoff  time.Duration
+}
+
+func (o nextEventRetriesOption) apply(opts *options) {
+	opts.nextEventRetries = o.attempts
+	opts.nextEventBackoff = o.backoff
+}
+
+// WithNextEventRetries configures Run to retry Client.NextEvent up to attempts times on transient errors
+// (network errors and 5xx responses) before stopping the extension.
+// Delay before each retry grows exponentially starting from backoff, with random jitter.
+// NextEvent is not retried by default.
+func WithNextEventRetries(attempts int, backoff time.Duration) Option {
+	return nextEventRetriesOption{attempts, backoff}
+}
+
+type extensionAPIVersionOption string
+
+func (o extensionAPIVersionOption) apply(opts *options) {
+	opts.extensionAPIVersion = string(o)
+}
+
+// WithExtensionAPIVersion configures Extensions API version used in register, event/next, init/error and exit/error URL paths.
+// Defaults to DefaultExtensionAPIVersion.
+func WithExtensionAPIVersion(version string) Option {
+	return extensionAPIVersionOption(version)
+}
+
+type telemetryAPIVersionOption string
+
+func (o telemetryAPIVersionOption) apply(opts *options) {
+	opts.telemetryAPIVersion = string(o)
+}
+
+// WithTelemetryAPIVersion configures Telemetry API version used in telemetry subscribe URL path.
+// Defaults to DefaultTelemetryAPIVersion.
+// It doesn't change TelemetrySubscribeRequest.SchemaVersion.
+func WithTelemetryAPIVersion(version string) Option {
+	return telemetryAPIVersionOption(version)
+}
+
+type userAgentOption string
+
+func (o userAgentOption) apply(opts *options) {
+	opts.userAgent = string(o)
+}
+
+// WithUserAgent configures User-Agent header sent with all Client requests.
+// Defaults to "aws-lambda-extensions-go/<module version>".
+func WithUserAgent(userAgent string) Option {
+	return userAgentOption(userAgent)
+}
+
+// ErrorPhase is the extension lifecycle phase an error occurred in.
+type ErrorPhase string
+
+const (
+	// ErrorPhaseInit is reported with Client.InitError when Extension.Init fails.
+	ErrorPhaseInit ErrorPhase = "init"
+	// ErrorPhaseExit is reported with Client.ExitError when the extension loop or Extension.Shutdown fails.
+	ErrorPhaseExit ErrorPhase = "exit"
+)
+
+// ErrorReporter decides whether Run reports the error to Lambda API and with which errorType.
+type ErrorReporter func(ctx context.Context, phase ErrorPhase, err error) (errorType string, report bool)
+
+// DefaultErrorReporter reports all errors with "Extension.Init" and "Extension.Exit" error types.
+func DefaultErrorReporter(ctx context.Context, phase ErrorPhase, err error) (string, bool) {
+	if phase == ErrorPhaseInit {
+		return "Extension.Init", true
+	}
+
+	return "Extension.Exit", true
+}
+
+type errorReporterOption ErrorReporter
+
+func (o errorReporterOption) apply(opts *options) {
+	opts.errorReporter = ErrorReporter(o)
+}
+
+// WithErrorReporter configures how Run reports init and exit errors to Lambda API with Client.InitError and Client.ExitError.
+// The reporter returns the errorType sent in Lambda-Extension-Function-Error-Type header
+// and false if the error should not be reported at all. Defaults to DefaultErrorReporter.
+func WithErrorReporter(reporter ErrorReporter) Option {
+	return errorReporterOption(reporter)
+}
+
+type warningOutputOption struct {
+	w io.Writer
+}
+
+func (o warningOutputOption) apply(opts *options) {
+	opts.warningOutput = o.w
+}
+
+// WithWarningOutput configures the writer for Client.ReportWarning log lines. Defaults to os.Stdout.
+func WithWarningOutput(w io.Writer) Option {
+	return warningOutputOption{w}
+}
+
+type requestContextOption func(ctx context.Context) context.Context
+
+func (o requestContextOption) apply(opts *options) {
+	opts.requestContext = o
+}
+
+// WithRequestContext configures a hook deriving the context of every outbound Lambda API request,
+// e.g. to attach a correlation id or OpenTelemetry context for http.RoundTripper of WithHTTPClient.
+// fn is called with the context passed to the Client method and must return a context derived from it,
+// otherwise the request can't be cancelled.
+func WithRequestContext(fn func(ctx context.Context) context.Context) Option {
+	return requestContextOption(fn)
+}
+
 // Client is a Low-level Lambda API client.
 // In most situations it's better to use high-level handlers extapi.Run and logsapi.Run.
+//
+// Every request is made with the context passed to the Client method, so its values are visible
+// to http.RoundTripper of WithHTTPClient. Run passes its context to all Client calls including NextEvent retries,
+// with the values of ContextWithRegisterResponse and ContextWithClient added after Register.
+// Use WithRequestContext to add values to every request regardless of the caller.
 type Client struct {
 	awsLambdaRuntimeAPI lambdaext.AWSLambdaRuntimeAPI
-	httpClient          *http.Client
+	// baseURL is parsed awsLambdaRuntimeAPI, request URLs are built relative to it
+	baseURL    *url.URL
+	httpClient *http.Client
 	// extensionID is a generated unique agent identifier (UUID string) that is required for all subsequent requests after Client.register.
 	extensionID  string
 	registerResp *RegisterResponse
 	log          logr.Logger
+	env          Environment
+	clock        Clock
+	// nextEventRetries and nextEventBackoff configure retries of NextEvent in Run
+	nextEventRetries int
+	nextEventBackoff time.Duration
+	// extensionAPIVersion and telemetryAPIVersion are used to build Lambda API URLs
+	extensionAPIVersion string
+	telemetryAPIVersion string
+	userAgent           string
+	errorReporter       ErrorReporter
+	extensionName       lambdaext.ExtensionName
+	warningOutput       io.Writer
+	requestContext      func(ctx context.Context) context.Context
+	warningMu           sync.Mutex
+	closeOnce           sync.Once
+	closed              chan struct{}
 }
 
+// GetRegisterResponse returns the response of Register call or nil if the extension hasn't been registered.
 func (c *Client) GetRegisterResponse() *RegisterResponse {
+	if c == nil {
+		return nil
+	}
+
 	return c.registerResp
 }
 
+// RegisterInfo returns a copy of all RegisterResponse fields at once
+// and false if the extension hasn't been registered and fields are zero values.
+func (c *Client) RegisterInfo() (RegisterResponse, bool) {
+	resp := c.GetRegisterResponse()
+	if resp == nil {
+		return RegisterResponse{}, false
+	}
+
+	return *resp, true
+}
+
+// Environment returns the lookup of runtime environment variables configured with WithEnvironment.
+func (c *Client) Environment() Environment {
+	if c == nil || c.env == nil {
+		return os.Getenv
+	}
+
+	return c.env
+}
+
 // Register registers the extension with the Lambda Extensions API. This happens
 // during extension Init. Each call must include the list of events in the body
 // and the lambdaext.ExtensionName in the headers.
@@ -187,15 +467,30 @@ func Register(ctx context.Context, opts ...Option) (*Client, error) {
 	extensionName, _ := os.Executable()
 	extensionName = filepath.Base(extensionName)
 	options := options{
-		extensionName:       lambdaext.ExtensionName(extensionName),
-		awsLambdaRuntimeAPI: EnvAWSLambdaRuntimeAPI(),
-		eventTypes:          []EventType{Invoke, Shutdown},
-		httpClient:          http.DefaultClient,
-		log:                 logr.FromContextOrDiscard(ctx),
+		extensionName: lambdaext.ExtensionName(extensionName),
+		eventTypes:    []EventType{Invoke, Shutdown},
+		httpClient:    http.DefaultClient,
+		log:           logr.FromContextOrDiscard(ctx),
+		env:           os.Getenv,
+		clock:         realClock{},
+
+		extensionAPIVersion: DefaultExtensionAPIVersion,
+		telemetryAPIVersion: DefaultTelemetryAPIVersion,
+		userAgent:           defaultUserAgent(),
+		errorReporter:       DefaultErrorReporter,
+		warningOutput:       os.Stdout,
 	}
 	for _, o := range opts {
 		o.apply(&options)
 	}
+	if err := validateExtensionName(options.extensionName, options.strictExtensionName, options.log); err != nil {
+		options.log.Error(err, "")
+
+		return nil, err
+	}
+	if options.awsLambdaRuntimeAPI == "" {
+		options.awsLambdaRuntimeAPI = options.env.AWSLambdaRuntimeAPI()
+	}
 	if options.awsLambdaRuntimeAPI == "" {
 		err := errors.New("could not find environment variable AWS_LAMBDA_RUNTIME_API")
 		options.log.Error(err, "")
@@ -203,13 +498,34 @@ func Register(ctx context.Context, opts ...Option) (*Client, error) {
 		return nil, err
 	}
 	options.log.V(1).Info("using AWS_LAMBDA_RUNTIME_API", "addr", options.awsLambdaRuntimeAPI)
+	baseURL, err := parseRuntimeAPI(options.awsLambdaRuntimeAPI)
+	if err != nil {
+		options.log.Error(err, "")
+
+		return nil, err
+	}
+	if options.errorReporter == nil {
+		options.errorReporter = DefaultErrorReporter
+	}
 
 	client := &Client{
 		awsLambdaRuntimeAPI: options.awsLambdaRuntimeAPI,
+		baseURL:             baseURL,
 		httpClient:          options.httpClient,
 		log:                 options.log,
+		env:                 options.env,
+		clock:               options.clock,
+		nextEventRetries:    options.nextEventRetries,
+		nextEventBackoff:    options.nextEventBackoff,
+		extensionAPIVersion: options.extensionAPIVersion,
+		telemetryAPIVersion: options.telemetryAPIVersion,
+		userAgent:           options.userAgent,
+		errorReporter:       options.errorReporter,
+		extensionName:       options.extensionName,
+		warningOutput:       options.warningOutput,
+		requestContext:      options.requestContext,
+		closed:              make(chan struct{}),
 	}
-	var err error
 	client.registerResp, err = client.register(ctx, options.extensionName, options.eventTypes)
 	if err != nil {
 		err = fmt.Errorf("could not register extension: %w", err)
@@ -223,6 +539,28 @@ func Register(ctx context.Context, opts ...Option) (*Client, error) {
 	return client, nil
 }
 
+// defaultUserAgent returns User-Agent with the version of this module the extension is built with.
+func defaultUserAgent() string {
+	return "aws-lambda-extensions-go/" + BuildInfo()
+}
+
+// validateExtensionName checks that the extension name can be the extension file name in /opt/extensions.
+// Names with path separators are only reported to the log unless strict is set.
+func validateExtensionName(name lambdaext.ExtensionName, strict bool, log logr.Logger) error {
+	if name == "" || name == "." {
+		return errors.New("invalid extension name: extension name is empty, set it with WithExtensionName")
+	}
+	if strings.ContainsAny(string(name), `/\`) {
+		err := fmt.Errorf("invalid extension name: %q contains path separators, it must match the extension file name in /opt/extensions", name)
+		if strict {
+			return err
+		}
+		log.Info("registration may fail", "reason", err.Error())
+	}
+
+	return nil
+}
+
 func (c *Client) register(ctx context.Context, extensionName lambdaext.ExtensionName, eventTypes []EventType) (*RegisterResponse, error) {
 	registerReq := RegisterRequest{eventTypes}
 	body, err := json.Marshal(&registerReq)
@@ -231,8 +569,8 @@ func (c *Client) register(ctx context.Context, extensionName lambdaext.Extension
 	}
 	c.log.V(1).Info("sending register request", "body", string(body))
 
-	url := fmt.Sprintf("http://%s/2020-01-01/extension/register", c.awsLambdaRuntimeAPI)
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	registerURL := c.apiURL(c.extensionAPIVersion, "extension/register")
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, registerURL, bytes.NewReader(body))
 	if err != nil {
 		return nil, fmt.Errorf("could not create register http request: %w", err)
 	}
@@ -260,8 +598,8 @@ func (c *Client) register(ctx context.Context, extensionName lambdaext.Extension
 // the desired behavior to enable long polling of the Extensions API.
 func (c *Client) NextEvent(ctx context.Context) (*NextEventResponse, error) {
 	c.log.V(1).Info("requesting event/next")
-	url := fmt.Sprintf("http://%s/2020-01-01/extension/event/next", c.awsLambdaRuntimeAPI)
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	nextURL := c.apiURL(c.extensionAPIVersion, "extension/event/next")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, nextURL, nil)
 	if err != nil {
 		err = fmt.Errorf("could not create http request for event/next: %w", err)
 		c.log.Error(err, "")
@@ -291,10 +629,61 @@ func (c *Client) ExitError(ctx context.Context, errorType string, err error) (*E
 	return c.reportError(ctx, "/exit/error", errorType, err)
 }
 
+// warningTimeLayout matches the millisecond precision timestamps of Telemetry API events.
+const warningTimeLayout = "2006-01-02T15:04:05.000Z07:00"
+
+// warningLine is a structured log line written by Client.ReportWarning.
+type warningLine struct {
+	Timestamp     string                  `json:"timestamp"`
+	Level         string                  `json:"level"`
+	ExtensionName lambdaext.ExtensionName `json:"extensionName,omitempty"`
+	ErrorType     string                  `json:"errorType"`
+	Message       string                  `json:"message"`
+}
+
+// ReportWarning reports a non-fatal error without exiting.
+// Extensions API doesn't support non-fatal error reporting, so ReportWarning writes a single-line JSON log
+// with WARN level to the extension stdout. Lambda sends it to CloudWatch Logs and delivers it to
+// Telemetry API and Logs API subscribers as an extension event:
+//
+//	{"timestamp":"2022-10-12T00:00:00.000Z","level":"WARN","extensionName":"ext","errorType":"Extension.Flush","message":"text"}
+//
+// Use WithWarningOutput to change the destination. ReportWarning is safe for concurrent use.
+func (c *Client) ReportWarning(errorType string, err error) error {
+	// zero value Client has neither clock nor output set
+	clock := c.clock
+	if clock == nil {
+		clock = realClock{}
+	}
+	line, mErr := json.Marshal(warningLine{
+		Timestamp:     clock.Now().UTC().Format(warningTimeLayout),
+		Level:         "WARN",
+		ExtensionName: c.extensionName,
+		ErrorType:     errorType,
+		Message:       err.Error(),
+	})
+	if mErr != nil {
+		return fmt.Errorf("could not encode warning: %w", mErr)
+	}
+	line = append(line, '\n')
+
+	c.warningMu.Lock()
+	defer c.warningMu.Unlock()
+	output := c.warningOutput
+	if output == nil {
+		output = os.Stdout
+	}
+	if _, err := output.Write(line); err != nil {
+		return fmt.Errorf("could not write warning: %w", err)
+	}
+
+	return nil
+}
+
 func (c *Client) reportError(ctx context.Context, action, errorType string, err error) (*ErrorResponse, error) {
 	c.log.V(1).Info("reporting error", "action", action, "errorType", errorType, "body", err.Error())
-	url := fmt.Sprintf("http://%s/2020-01-01/extension%s", c.awsLambdaRuntimeAPI, action)
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, strings.NewReader(err.Error()))
+	errorURL := c.apiURL(c.extensionAPIVersion, "extension", action)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, errorURL, strings.NewReader(err.Error()))
 	if err != nil {
 		err = fmt.Errorf("could not create http request for error reporting %s: %w", action, err)
 		c.log.Error(err, "")
@@ -315,6 +704,25 @@ func (c *Client) reportError(ctx context.Context, action, errorType string, err
 	return errorResp, nil
 }
 
+// Close cancels all in-flight requests including long polling Client.NextEvent and releases idle connections.
+// All subsequent Client calls fail with ErrClientClosed. Close is safe to call multiple times.
+// Close is useful for internal extensions which should stop polling Extensions API deterministically.
+// Calling Close while Run is in progress stops the Run loop with an error wrapping ErrClientClosed,
+// Extension.Shutdown is still called with ExtensionError reason.
+func (c *Client) Close() error {
+	c.closeOnce.Do(func() {
+		// zero-value Client is never registered and there is nothing to release
+		if c.closed == nil {
+			return
+		}
+		c.log.V(1).Info("closing client")
+		close(c.closed)
+		c.httpClient.CloseIdleConnections()
+	})
+
+	return nil
+}
+
 func (c *Client) doRequest(req *http.Request, wantStatus int, out interface{}) (*http.Response, error) {
 	if req.Method == http.MethodPost || req.Method == http.MethodPut || req.Method == http.MethodPatch {
 		req.Header.Set("Content-Type", "application/json")
@@ -322,9 +730,39 @@ func (c *Client) doRequest(req *http.Request, wantStatus int, out interface{}) (
 	if c.extensionID != "" {
 		req.Header.Set(extensionIDHeader, c.extensionID)
 	}
+	if c.userAgent != "" {
+		req.Header.Set("User-Agent", c.userAgent)
+	}
+
+	select {
+	case <-c.closed:
+		return nil, ErrClientClosed
+	default:
+	}
+	ctx := req.Context()
+	if c.requestContext != nil {
+		ctx = c.requestContext(ctx)
+	}
+	// cancel in-flight request when the client is closed
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-c.closed:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	req = req.WithContext(ctx)
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
+		select {
+		case <-c.closed:
+			return nil, fmt.Errorf("http request failed: %w", ErrClientClosed)
+		default:
+		}
+
 		return nil, fmt.Errorf("http request failed: %w", err)
 	}
 	defer func() {
@@ -340,7 +778,7 @@ func (c *Client) doRequest(req *http.Request, wantStatus int, out interface{}) (
 		apiErr := LambdaAPIError{}
 		apiErr.HTTPStatusCode = resp.StatusCode
 		if err := json.Unmarshal(body, &apiErr); err != nil {
-			return nil, fmt.Errorf("http request failed with status %s and body: %s", resp.Status, body)
+			return nil, httpStatusError{resp.StatusCode, fmt.Sprintf("http request failed with status %s and body: %s", resp.Status, body)}
 		}
 
 		return nil, apiErr
@@ -354,3 +792,32 @@ func (c *Client) doRequest(req *http.Request, wantStatus int, out interface{}) (
 
 	return resp, nil
 }
+
+// parseRuntimeAPI parses AWS_LAMBDA_RUNTIME_API value.
+// A bare host:port is served over http without a path prefix, a full http or https URL is used as is.
+func parseRuntimeAPI(api lambdaext.AWSLambdaRuntimeAPI) (*url.URL, error) {
+	if !strings.Contains(string(api), "://") {
+		return &url.URL{Scheme: "http", Host: string(api)}, nil
+	}
+	u, err := url.Parse(string(api))
+	if err != nil {
+		return nil, fmt.Errorf("could not parse AWS_LAMBDA_RUNTIME_API %q: %w", api, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("AWS_LAMBDA_RUNTIME_API %q must be host:port or http(s) URL with host", api)
+	}
+
+	return u, nil
+}
+
+// apiURL returns URL of the runtime API endpoint with path elements joined to the base URL path.
+func (c *Client) apiURL(elem ...string) string {
+	u := url.URL{Scheme: "http", Host: string(c.awsLambdaRuntimeAPI)}
+	if c.baseURL != nil {
+		u = *c.baseURL
+	}
+	u.Path = path.Join(append([]string{"/", u.Path}, elem...)...)
+	u.RawPath = ""
+
+	return u.String()
+}
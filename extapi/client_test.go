@@ -3,13 +3,16 @@ package extapi_test
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 	"github.com/tonglil/buflogr"
@@ -128,6 +131,37 @@ func TestRegister(t *testing.T) {
 	require.Equal(t, "123456789012", client.GetRegisterResponse().AccountID)
 }
 
+func TestRegister_UserAgent(t *testing.T) {
+	tests := []struct {
+		name       string
+		opts       []extapi.Option
+		wantPrefix string
+	}{
+		{"default", nil, "aws-lambda-extensions-go/"},
+		{"custom", []extapi.Option{extapi.WithUserAgent("my-extension/1.2.3")}, "my-extension/1.2.3"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var userAgent string
+			mux := http.NewServeMux()
+			mux.HandleFunc("/2020-01-01/extension/register", func(w http.ResponseWriter, r *http.Request) {
+				userAgent = r.Header.Get("User-Agent")
+				w.Header().Set("Lambda-Extension-Identifier", testExtensionID)
+				_, err := w.Write(respRegister)
+				require.NoError(t, err)
+			})
+			server := httptest.NewServer(mux)
+			defer server.Close()
+
+			opts := append([]extapi.Option{extapi.WithAWSLambdaRuntimeAPI(server.Listener.Addr().String())}, tt.opts...)
+			_, err := extapi.Register(context.Background(), opts...)
+			require.NoError(t, err)
+			require.True(t, strings.HasPrefix(userAgent, tt.wantPrefix), "unexpected User-Agent %q", userAgent)
+		})
+	}
+}
+
 func TestLambdaAPIError(t *testing.T) {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/2020-01-01/extension/register", func(w http.ResponseWriter, r *http.Request) {
@@ -149,6 +183,53 @@ func TestLambdaAPIError(t *testing.T) {
 	})
 }
 
+func TestLambdaAPIError_Classification(t *testing.T) {
+	tests := []struct {
+		name           string
+		err            extapi.LambdaAPIError
+		wantValidation bool
+		wantThrottling bool
+		wantRetryable  bool
+	}{
+		{
+			"validation",
+			extapi.LambdaAPIError{Type: "ValidationError", HTTPStatusCode: http.StatusBadRequest},
+			true,
+			false,
+			false,
+		},
+		{
+			"throttling",
+			extapi.LambdaAPIError{Type: "TooManyRequestsException", HTTPStatusCode: http.StatusTooManyRequests},
+			false,
+			true,
+			true,
+		},
+		{
+			"internal error",
+			extapi.LambdaAPIError{Type: "ServiceException", HTTPStatusCode: http.StatusInternalServerError},
+			false,
+			false,
+			true,
+		},
+		{
+			"fatal",
+			extapi.LambdaAPIError{Type: "Extension.Unknown", HTTPStatusCode: http.StatusForbidden},
+			false,
+			false,
+			false,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.wantValidation, tt.err.IsValidation())
+			require.Equal(t, tt.wantThrottling, tt.err.IsThrottling())
+			require.Equal(t, tt.wantRetryable, tt.err.Retryable())
+		})
+	}
+}
+
 func TestNextEvent_Invoke(t *testing.T) {
 	client, server, mux, err := register(t)
 	require.NoError(t, err)
@@ -295,7 +376,7 @@ func TestExitError(t *testing.T) {
 	}
 }
 
-func register(t *testing.T) (*extapi.Client, *httptest.Server, *http.ServeMux, error) {
+func register(t *testing.T, opts ...extapi.Option) (*extapi.Client, *httptest.Server, *http.ServeMux, error) {
 	t.Helper()
 	mux := http.NewServeMux()
 	mux.HandleFunc("/2020-01-01/extension/register", func(w http.ResponseWriter, r *http.Request) {
@@ -320,7 +401,256 @@ func register(t *testing.T) (*extapi.Client, *httptest.Server, *http.ServeMux, e
 	server := httptest.NewServer(mux)
 
 	t.Setenv("AWS_LAMBDA_RUNTIME_API", server.Listener.Addr().String())
-	client, err := extapi.Register(context.Background())
+	client, err := extapi.Register(context.Background(), opts...)
 
 	return client, server, mux, err
 }
+
+func TestClient_ReportWarning(t *testing.T) {
+	buf := &bytes.Buffer{}
+	now := time.Date(2022, 10, 12, 0, 0, 0, int(5*time.Millisecond), time.UTC)
+	client, server, _, err := register(t, extapi.WithWarningOutput(buf), extapi.WithClock(fakeClock(now)))
+	require.NoError(t, err)
+	defer server.Close()
+
+	err = client.ReportWarning(testErrorType, errTest)
+	require.NoError(t, err)
+
+	require.True(t, strings.HasSuffix(buf.String(), "\n"))
+	require.Equal(t, 1, strings.Count(buf.String(), "\n"))
+	require.JSONEq(
+		t,
+		`{
+			"timestamp": "2022-10-12T00:00:00.005Z",
+			"level": "WARN",
+			"extensionName": "`+filepath.Base(os.Args[0])+`",
+			"errorType": "extension.TestReason",
+			"message": "text description of the error"
+		}`,
+		buf.String(),
+	)
+}
+
+func TestClose(t *testing.T) {
+	client, server, mux, err := register(t)
+	require.NoError(t, err)
+	defer server.Close()
+	mux.HandleFunc("/2020-01-01/extension/event/next", func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		// block long polling till the client cancels the request
+		<-r.Context().Done()
+	})
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		require.NoError(t, client.Close())
+	}()
+
+	errCh := make(chan error)
+	go func() {
+		_, err := client.NextEvent(context.Background())
+		errCh <- err
+	}()
+
+	select {
+	case err := <-errCh:
+		require.ErrorIs(t, err, extapi.ErrClientClosed)
+	case <-time.After(time.Second):
+		require.Fail(t, "NextEvent did not return after Close")
+	}
+
+	_, err = client.NextEvent(context.Background())
+	require.ErrorIs(t, err, extapi.ErrClientClosed)
+	require.NoError(t, client.Close(), "Close should be idempotent")
+}
+
+func TestWithEnvironment(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	mux.HandleFunc("/2020-01-01/extension/register", func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		w.Header().Set("Lambda-Extension-Identifier", testExtensionID)
+		if _, err := w.Write(respRegister); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	// AWS_LAMBDA_RUNTIME_API env variable should be ignored as WithEnvironment option was set
+	t.Setenv("AWS_LAMBDA_RUNTIME_API", "hostnotfound:80")
+	env := map[string]string{
+		"AWS_LAMBDA_RUNTIME_API":          server.Listener.Addr().String(),
+		"AWS_REGION":                      "eu-west-1",
+		"AWS_LAMBDA_FUNCTION_MEMORY_SIZE": "128",
+	}
+	getenv := func(key string) string {
+		return env[key]
+	}
+
+	client, err := extapi.Register(context.Background(), extapi.WithEnvironment(getenv))
+	require.NoError(t, err)
+	require.Equal(t, "eu-west-1", client.Environment().AWSRegion())
+	require.Equal(t, 128, client.Environment().AWSLambdaFunctionMemorySizeMB())
+	require.Equal(t, lambdaext.AWSLambdaRuntimeAPI(server.Listener.Addr().String()), client.Environment().AWSLambdaRuntimeAPI())
+}
+
+func TestClient_ZeroValue(t *testing.T) {
+	client := &extapi.Client{}
+
+	require.Nil(t, client.GetRegisterResponse())
+	info, ok := client.RegisterInfo()
+	require.False(t, ok)
+	require.Equal(t, extapi.RegisterResponse{}, info)
+	require.NotNil(t, client.Environment())
+	require.NoError(t, client.Close())
+}
+
+func TestClient_ZeroValue_ReportWarning(t *testing.T) {
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	require.NoError(t, (&extapi.Client{}).ReportWarning(testErrorType, errTest))
+	require.NoError(t, w.Close())
+	out, err := io.ReadAll(r)
+	require.NoError(t, err)
+
+	warning := map[string]string{}
+	require.NoError(t, json.Unmarshal(out, &warning))
+	require.Equal(t, "WARN", warning["level"])
+	require.Equal(t, "text description of the error", warning["message"])
+	require.NotEmpty(t, warning["timestamp"])
+}
+
+func TestClient_RegisterInfo(t *testing.T) {
+	client, server, _, err := register(t)
+	require.NoError(t, err)
+	defer server.Close()
+
+	info, ok := client.RegisterInfo()
+	require.True(t, ok)
+	require.Equal(t, *client.GetRegisterResponse(), info)
+	require.Equal(t, "123456789012", info.AccountID)
+}
+
+func TestRegister_InvalidExtensionName(t *testing.T) {
+	emptyEnv := extapi.WithEnvironment(func(string) string { return "" })
+	tests := []struct {
+		name    string
+		opts    []extapi.Option
+		wantErr string
+	}{
+		{
+			"empty",
+			[]extapi.Option{extapi.WithExtensionName("")},
+			"invalid extension name: extension name is empty, set it with WithExtensionName",
+		},
+		{
+			"path separator strict",
+			[]extapi.Option{extapi.WithExtensionName("/opt/extensions/ext"), extapi.WithStrictExtensionName(true)},
+			`invalid extension name: "/opt/extensions/ext" contains path separators, it must match the extension file name in /opt/extensions`,
+		},
+		{
+			"path separator not strict",
+			[]extapi.Option{extapi.WithExtensionName("/opt/extensions/ext")},
+			// validation passed with a warning and Register continued
+			"could not find environment variable AWS_LAMBDA_RUNTIME_API",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := extapi.Register(context.Background(), append(tt.opts, emptyEnv)...)
+			require.EqualError(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestClient_WithAWSLambdaRuntimeAPI_URL(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/prefix/2020-01-01/extension/register", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Lambda-Extension-Identifier", testExtensionID)
+		if _, err := w.Write(respRegister); err != nil {
+			t.Fatal(err)
+		}
+	})
+	mux.HandleFunc("/prefix/2020-01-01/extension/event/next", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Lambda-Extension-Identifier", testExtensionID)
+		if _, err := w.Write(respShutdown); err != nil {
+			t.Fatal(err)
+		}
+	})
+	server := httptest.NewTLSServer(mux)
+	defer server.Close()
+
+	client, err := extapi.Register(
+		context.Background(),
+		extapi.WithAWSLambdaRuntimeAPI(server.URL+"/prefix/"),
+		extapi.WithHTTPClient(server.Client()),
+	)
+	require.NoError(t, err)
+	event, err := client.NextEvent(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, extapi.Shutdown, event.EventType)
+}
+
+func TestClient_WithAWSLambdaRuntimeAPI_Invalid(t *testing.T) {
+	for _, api := range []string{"ftp://localhost:9001", "http://", "http://local host:9001"} {
+		_, err := extapi.Register(context.Background(), extapi.WithAWSLambdaRuntimeAPI(api))
+		require.Error(t, err, api)
+		require.Contains(t, err.Error(), "AWS_LAMBDA_RUNTIME_API", api)
+	}
+}
+
+type contextKey string
+
+func TestClient_WithRequestContext(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	mux.HandleFunc("/2020-01-01/extension/register", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Lambda-Extension-Identifier", testExtensionID)
+		_, err := w.Write(respRegister)
+		require.NoError(t, err)
+	})
+	mux.HandleFunc("/2020-01-01/extension/event/next", func(w http.ResponseWriter, r *http.Request) {
+		_, err := w.Write(respInvoke)
+		require.NoError(t, err)
+	})
+
+	var seen []string
+	httpClient := &http.Client{
+		Transport: RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			callerValue, _ := req.Context().Value(contextKey("caller")).(string)
+			correlationID, _ := req.Context().Value(contextKey("correlationID")).(string)
+			seen = append(seen, req.URL.Path+" "+callerValue+" "+correlationID)
+
+			return http.DefaultTransport.RoundTrip(req)
+		}),
+	}
+	withCorrelationID := func(ctx context.Context) context.Context {
+		return context.WithValue(ctx, contextKey("correlationID"), "correlation-1")
+	}
+
+	ctx := context.WithValue(context.Background(), contextKey("caller"), "register")
+	client, err := extapi.Register(
+		ctx,
+		extapi.WithAWSLambdaRuntimeAPI(server.Listener.Addr().String()),
+		extapi.WithHTTPClient(httpClient),
+		extapi.WithRequestContext(withCorrelationID),
+	)
+	require.NoError(t, err)
+
+	ctx = context.WithValue(context.Background(), contextKey("caller"), "nextEvent")
+	_, err = client.NextEvent(ctx)
+	require.NoError(t, err)
+
+	require.Equal(t, []string{
+		"/2020-01-01/extension/register register correlation-1",
+		"/2020-01-01/extension/event/next nextEvent correlation-1",
+	}, seen)
+}
@@ -0,0 +1,15 @@
+package extapi
+
+import "time"
+
+// Clock provides the current time for event deadline computation.
+// Real time is used by default. Custom Clock can be provided with WithClock option for testing.
+type Clock interface {
+	Now() time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
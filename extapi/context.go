@@ -0,0 +1,37 @@
+package extapi
+
+import "context"
+
+type registerResponseKey struct{}
+
+// ContextWithRegisterResponse returns a copy of ctx carrying RegisterResponse.
+// Run injects RegisterResponse into the context passed to all Extension methods.
+func ContextWithRegisterResponse(ctx context.Context, resp *RegisterResponse) context.Context {
+	return context.WithValue(ctx, registerResponseKey{}, resp)
+}
+
+// RegisterResponseFromContext returns RegisterResponse injected by Run or nil if there is none.
+// It is available in telemetryapi.Processor and logsapi.Processor methods.
+func RegisterResponseFromContext(ctx context.Context) *RegisterResponse {
+	resp, _ := ctx.Value(registerResponseKey{}).(*RegisterResponse)
+
+	return resp
+}
+
+type clientKey struct{}
+
+// ContextWithClient returns a copy of ctx carrying Client.
+// Run injects Client into the context passed to all Extension methods.
+func ContextWithClient(ctx context.Context, client *Client) context.Context {
+	return context.WithValue(ctx, clientKey{}, client)
+}
+
+// ClientFromContext returns Client injected by Run or nil if there is none.
+// It is available in telemetryapi.Processor and logsapi.Processor methods, including Init,
+// so processors can make additional Extensions API calls, e.g. Client.ExitError with custom details.
+// Processor.Init keeps RegisterResponse argument for compatibility with existing processors.
+func ClientFromContext(ctx context.Context) *Client {
+	client, _ := ctx.Value(clientKey{}).(*Client)
+
+	return client
+}
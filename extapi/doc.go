@@ -1,4 +1,10 @@
 // Package extapi implements a client for Lambda Extensions API and Extension handler to abstract interactions with the API.
 // Implement Extension and use Run function in your main package.
 // For more custom use cases you can use low-level Client directly.
+//
+// Several extensions can run in one process, for example an internal extension co-located with the runtime
+// which subscribes to both Logs API and Telemetry API. Call Run concurrently for each of them
+// with distinct WithExtensionName values. Every Run registers its own Client and doesn't share mutable global state.
+// Event receiving servers of logsapi.Run and telemetryapi.Run listen on random ports by default,
+// set distinct addresses if they are configured with WithDestinationAddr.
 package extapi
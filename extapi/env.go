@@ -1,7 +1,9 @@
 package extapi
 
 import (
+	"fmt"
 	"os"
+	"path/filepath"
 	"strconv"
 
 	lambdaext "github.com/zakharovvi/aws-lambda-extensions"
@@ -14,40 +16,148 @@ import (
 // https://docs.aws.amazon.com/lambda/latest/dg/configuration-envvars.html#configuration-envvars-runtime
 // https://docs.aws.amazon.com/lambda/latest/dg/runtimes-extensions-api.html#runtimes-extensions-registration-api-e
 
+const (
+	// lambdaTaskRootEnv is the path to the Lambda function code, it is set only in the execution environment.
+	lambdaTaskRootEnv = "LAMBDA_TASK_ROOT"
+	// externalExtensionsDir is the directory Lambda starts external extensions from.
+	externalExtensionsDir = "/opt/extensions"
+)
+
+// Environment retrieves the value of the environment variable named by the key. os.Getenv is used by default.
+// Custom Environment can be provided with WithEnvironment option for testing or local runs.
+type Environment func(key string) string
+
 // EnvXAmznTraceID returns X-Ray tracing header.
 func EnvXAmznTraceID() lambdaext.TracingValue {
-	return lambdaext.TracingValue(os.Getenv("_X_AMZN_TRACE_ID"))
+	return Environment(os.Getenv).XAmznTraceID()
 }
 
 // EnvAWSRegion returns the AWS Region where the Lambda function is executed.
 func EnvAWSRegion() string {
-	return os.Getenv("AWS_REGION")
+	return Environment(os.Getenv).AWSRegion()
+}
+
+// EnvAWSRegionE returns the AWS Region where the Lambda function is executed or an error if the variable is not set.
+func EnvAWSRegionE() (string, error) {
+	return Environment(os.Getenv).AWSRegionE()
 }
 
 // EnvAWSLambdaFunctionName returns the name of the function.
 func EnvAWSLambdaFunctionName() string {
-	return os.Getenv("AWS_LAMBDA_FUNCTION_NAME")
+	return Environment(os.Getenv).AWSLambdaFunctionName()
 }
 
 // EnvAWSLambdaFunctionMemorySizeMB returns the amount of memory available to the function in MB.
 func EnvAWSLambdaFunctionMemorySizeMB() int {
-	s := os.Getenv("AWS_LAMBDA_FUNCTION_MEMORY_SIZE")
-	n, _ := strconv.Atoi(s)
+	return Environment(os.Getenv).AWSLambdaFunctionMemorySizeMB()
+}
 
-	return n
+// EnvAWSLambdaFunctionMemorySizeMBE returns the amount of memory available to the function in MB
+// or an error if the variable is not set or could not be parsed.
+func EnvAWSLambdaFunctionMemorySizeMBE() (int, error) {
+	return Environment(os.Getenv).AWSLambdaFunctionMemorySizeMBE()
 }
 
 // EnvAWSLambdaFunctionVersion returns the version of the function being executed.
 func EnvAWSLambdaFunctionVersion() lambdaext.FunctionVersion {
-	return lambdaext.FunctionVersion(os.Getenv("AWS_LAMBDA_FUNCTION_VERSION"))
+	return Environment(os.Getenv).AWSLambdaFunctionVersion()
 }
 
 // EnvAWSLambdaInitializationType returns the initialization type of the function, which is either on-demand or provisioned-concurrency. For information, see Configuring provisioned concurrency.
 func EnvAWSLambdaInitializationType() lambdaext.InitType {
-	return lambdaext.InitType(os.Getenv("AWS_LAMBDA_INITIALIZATION_TYPE"))
+	return Environment(os.Getenv).AWSLambdaInitializationType()
 }
 
 // EnvAWSLambdaRuntimeAPI returns the host and port of the runtime API for custom runtime.
 func EnvAWSLambdaRuntimeAPI() lambdaext.AWSLambdaRuntimeAPI {
-	return lambdaext.AWSLambdaRuntimeAPI(os.Getenv("AWS_LAMBDA_RUNTIME_API"))
+	return Environment(os.Getenv).AWSLambdaRuntimeAPI()
+}
+
+// IsInternalExtension reports whether the current process looks like an internal extension.
+// See Environment.IsInternalExtension for the detection mechanism.
+func IsInternalExtension() bool {
+	return Environment(os.Getenv).IsInternalExtension()
+}
+
+// XAmznTraceID returns X-Ray tracing header.
+func (env Environment) XAmznTraceID() lambdaext.TracingValue {
+	return lambdaext.TracingValue(env("_X_AMZN_TRACE_ID"))
+}
+
+// AWSRegion returns the AWS Region where the Lambda function is executed.
+func (env Environment) AWSRegion() string {
+	return env("AWS_REGION")
+}
+
+// AWSRegionE returns the AWS Region where the Lambda function is executed or an error if the variable is not set.
+func (env Environment) AWSRegionE() (string, error) {
+	region := env("AWS_REGION")
+	if region == "" {
+		return "", fmt.Errorf("environment variable AWS_REGION is not set")
+	}
+
+	return region, nil
+}
+
+// AWSLambdaFunctionName returns the name of the function.
+func (env Environment) AWSLambdaFunctionName() string {
+	return env("AWS_LAMBDA_FUNCTION_NAME")
+}
+
+// AWSLambdaFunctionMemorySizeMB returns the amount of memory available to the function in MB.
+func (env Environment) AWSLambdaFunctionMemorySizeMB() int {
+	s := env("AWS_LAMBDA_FUNCTION_MEMORY_SIZE")
+	n, _ := strconv.Atoi(s)
+
+	return n
+}
+
+// AWSLambdaFunctionMemorySizeMBE returns the amount of memory available to the function in MB
+// or an error if the variable is not set or could not be parsed.
+func (env Environment) AWSLambdaFunctionMemorySizeMBE() (int, error) {
+	s := env("AWS_LAMBDA_FUNCTION_MEMORY_SIZE")
+	if s == "" {
+		return 0, fmt.Errorf("environment variable AWS_LAMBDA_FUNCTION_MEMORY_SIZE is not set")
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("could not parse environment variable AWS_LAMBDA_FUNCTION_MEMORY_SIZE: %w", err)
+	}
+
+	return n, nil
+}
+
+// AWSLambdaFunctionVersion returns the version of the function being executed.
+func (env Environment) AWSLambdaFunctionVersion() lambdaext.FunctionVersion {
+	return lambdaext.FunctionVersion(env("AWS_LAMBDA_FUNCTION_VERSION"))
+}
+
+// AWSLambdaInitializationType returns the initialization type of the function.
+func (env Environment) AWSLambdaInitializationType() lambdaext.InitType {
+	return lambdaext.InitType(env("AWS_LAMBDA_INITIALIZATION_TYPE"))
+}
+
+// AWSLambdaRuntimeAPI returns the host and port of the runtime API for custom runtime.
+// Local emulators can set a full URL instead, see WithAWSLambdaRuntimeAPI.
+func (env Environment) AWSLambdaRuntimeAPI() lambdaext.AWSLambdaRuntimeAPI {
+	return lambdaext.AWSLambdaRuntimeAPI(env("AWS_LAMBDA_RUNTIME_API"))
+}
+
+// IsInternalExtension reports whether the current process looks like an internal extension
+// running in the runtime process together with the function rather than an external extension.
+// Lambda starts external extensions as separate processes from executables in /opt/extensions,
+// while internal extensions are started by the function code from the deployment package or a layer.
+// The process is considered an internal extension if LAMBDA_TASK_ROOT is set, meaning it runs in the execution environment,
+// and the executable is not located in /opt/extensions. Local runs outside the execution environment are never internal.
+// Internal extensions can't subscribe to Shutdown event, Run takes it into account unless WithEventTypes is set.
+func (env Environment) IsInternalExtension() bool {
+	if env(lambdaTaskRootEnv) == "" {
+		return false
+	}
+	executable, err := os.Executable()
+	if err != nil {
+		return false
+	}
+
+	return filepath.Dir(executable) != externalExtensionsDir
 }
@@ -0,0 +1,54 @@
+package extapi_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zakharovvi/aws-lambda-extensions/extapi"
+)
+
+func TestEnvAWSRegionE(t *testing.T) {
+	t.Setenv("AWS_REGION", "")
+	_, err := extapi.EnvAWSRegionE()
+	require.Error(t, err)
+
+	t.Setenv("AWS_REGION", "eu-west-1")
+	region, err := extapi.EnvAWSRegionE()
+	require.NoError(t, err)
+	require.Equal(t, "eu-west-1", region)
+}
+
+func TestEnvAWSLambdaFunctionMemorySizeMBE(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    int
+		wantErr bool
+	}{
+		{"unset", "", 0, true},
+		{"garbage", "128MB", 0, true},
+		{"valid", "128", 128, false},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("AWS_LAMBDA_FUNCTION_MEMORY_SIZE", tt.value)
+			got, err := extapi.EnvAWSLambdaFunctionMemorySizeMBE()
+			if tt.wantErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestIsInternalExtension(t *testing.T) {
+	t.Setenv("LAMBDA_TASK_ROOT", "")
+	require.False(t, extapi.IsInternalExtension(), "local run outside the execution environment")
+
+	// test binary is not located in /opt/extensions
+	t.Setenv("LAMBDA_TASK_ROOT", "/var/task")
+	require.True(t, extapi.IsInternalExtension())
+}
@@ -2,8 +2,21 @@ package extapi
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
+
+	"github.com/go-logr/logr"
+
+	"github.com/zakharovvi/aws-lambda-extensions/internal/detached"
 )
 
 // Extension abstracts the extension logic from Lambda Extensions API.
@@ -16,6 +29,7 @@ type Extension interface {
 	// Shutdown event type is handled inside Run internally and not exposed to the Extension.
 	HandleInvokeEvent(ctx context.Context, event *NextEventResponse) error
 	// Shutdown is called when Lambda API signals the extension to stop or in case of an error.
+	// Run calls Shutdown exactly once, including the case of Init failure.
 	// There will be no calls of HandleInvokeEvent after Shutdown was called.
 	// Extension should flush all unsaved changes to persistent storage.
 	// Run will return after calling the Shutdown and handling its result.
@@ -26,20 +40,41 @@ type Extension interface {
 	Err() <-chan error
 }
 
+// RunWithSignals is Run which cancels ctx on SIGINT or SIGTERM to shut down the extension gracefully.
+// Lambda sends Shutdown event to stop the extension, so RunWithSignals is useful for the local development loop
+// when the extension runs outside Lambda against a mock API and is stopped with Ctrl-C.
+// Use signal.NotifyContext the same way with logsapi.Run and telemetryapi.Run.
+func RunWithSignals(ctx context.Context, ext Extension, opts ...Option) error {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	return Run(ctx, ext, opts...)
+}
+
 // Run runs the Extension.
 // Run blocks the current goroutine till extension lifecycle is finished or error occurs.
+// Cancelling ctx after Extension.Init stops polling events and calls Extension.Shutdown with ContextCancelled reason
+// and a context which is not cancelled. Run returns nil in this case if Extension.Shutdown succeeds.
+// Internal extensions can't subscribe to Shutdown event, Run subscribes them only to Invoke unless WithEventTypes is set.
+// See IsInternalExtension for the detection mechanism. If the detection misses an internal extension,
+// Run registers again only for Invoke when Lambda rejects the registration with ShutdownEventNotSupportedForInternalExtension error.
 func Run(ctx context.Context, ext Extension, opts ...Option) error {
-	client, registerErr := Register(ctx, opts...)
+	ext = &shutdownOnce{Extension: ext}
+	client, registerErr := register(ctx, opts)
 	if registerErr != nil {
 		return registerErr
 	}
 	log := client.log
+	ctx = ContextWithRegisterResponse(ctx, client.GetRegisterResponse())
+	ctx = ContextWithClient(ctx, client)
 
 	log.V(1).Info("calling Extension.Init")
 	if initErr := ext.Init(ctx, client); initErr != nil {
 		log.Error(initErr, "Extension.Init failed")
-		if _, err := client.InitError(ctx, "Extension.Init", initErr); err != nil {
-			log.Error(err, "client.InitError failed")
+		if errorType, report := client.errorReporter(ctx, ErrorPhaseInit, initErr); report {
+			if _, err := client.InitError(ctx, errorType, initErr); err != nil {
+				log.Error(err, "client.InitError failed")
+			}
 		}
 		log.V(1).Info("calling Extension.Shutdown")
 		if err := ext.Shutdown(ctx, ExtensionError, initErr); err != nil {
@@ -63,14 +98,73 @@ func Run(ctx context.Context, ext Extension, opts ...Option) error {
 	return shutdownErr
 }
 
+// shutdownNotSupportedError is returned by Lambda when an internal extension registers for Shutdown event.
+const shutdownNotSupportedError = "ShutdownEventNotSupportedForInternalExtension"
+
+// register calls Register adjusting event types for internal extensions which can't subscribe to Shutdown event.
+// Unless WithEventTypes is set, the extension subscribes only to Invoke if Environment.IsInternalExtension detects it,
+// and registration is retried without Shutdown if Lambda rejects it with ShutdownEventNotSupportedForInternalExtension error.
+func register(ctx context.Context, opts []Option) (*Client, error) {
+	options := options{log: logr.FromContextOrDiscard(ctx), env: os.Getenv}
+	for _, o := range opts {
+		o.apply(&options)
+	}
+	if options.eventTypes != nil {
+		return Register(ctx, opts...)
+	}
+	if options.env.IsInternalExtension() {
+		options.log.V(1).Info("internal extension detected, subscribing only to Invoke event")
+
+		return Register(ctx, append(opts, WithEventTypes([]EventType{Invoke}))...)
+	}
+
+	client, err := Register(ctx, opts...)
+	if isShutdownNotSupported(err) {
+		options.log.Info("Shutdown event is not supported for internal extension, registering again only for Invoke event")
+
+		return Register(ctx, append(opts, WithEventTypes([]EventType{Invoke}))...)
+	}
+
+	return client, err
+}
+
+// isShutdownNotSupported reports whether Lambda rejected registration of internal extension subscribed to Shutdown event.
+func isShutdownNotSupported(err error) bool {
+	var apiErr LambdaAPIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+
+	return strings.Contains(apiErr.Type, shutdownNotSupportedError) || strings.Contains(apiErr.Message, shutdownNotSupportedError)
+}
+
+// shutdownOnce guards Extension.Shutdown to be called exactly once. Subsequent calls return the result of the first one.
+type shutdownOnce struct {
+	Extension
+	once sync.Once
+	err  error
+}
+
+func (ext *shutdownOnce) Shutdown(ctx context.Context, reason ShutdownReason, err error) error {
+	ext.once.Do(func() {
+		ext.err = ext.Extension.Shutdown(ctx, reason, err)
+	})
+
+	return ext.err
+}
+
 // shutdown calls Extension.Shutdown and report an error to Client.ExitError if any.
 func shutdown(ctx context.Context, client *Client, ext Extension, event *NextEventResponse, err error) error {
 	reason := ExtensionError
 	if event != nil {
 		reason = event.ShutdownReason
+		if reason == ContextCancelled {
+			// Run context is already cancelled and can't be used to shut down the Extension
+			ctx = detached.Context(ctx)
+		}
 
 		var cancel context.CancelFunc
-		ctx, cancel = context.WithDeadline(ctx, time.UnixMilli(event.DeadlineMs))
+		ctx, cancel = withEventDeadline(ctx, client.clock, event)
 		defer cancel()
 	}
 
@@ -85,9 +179,11 @@ func shutdown(ctx context.Context, client *Client, ext Extension, event *NextEve
 	}
 
 	if err != nil {
-		client.log.V(1).Info("calling Client.ExitError", "err", err)
-		if _, err := client.ExitError(ctx, "Extension.Exit", err); err != nil {
-			client.log.Error(err, "Client.ExitError error failed")
+		if errorType, report := client.errorReporter(ctx, ErrorPhaseExit, err); report {
+			client.log.V(1).Info("calling Client.ExitError", "err", err, "errorType", errorType)
+			if _, err := client.ExitError(ctx, errorType, err); err != nil {
+				client.log.Error(err, "Client.ExitError error failed")
+			}
 		}
 	}
 
@@ -95,10 +191,12 @@ func shutdown(ctx context.Context, client *Client, ext Extension, event *NextEve
 }
 
 // loop polls Client.NextEvent and blocks until Shutdown event received, error occurs, or context cancelled.
+// Context cancellation is reported as Shutdown event with ContextCancelled reason.
 func loop(ctx context.Context, client *Client, ext Extension) (*NextEventResponse, error) {
 	defer client.log.V(1).Info("Client.NextEvent loop stopped")
-	nextEventCh := make(chan *NextEventResponse)
-	nextEventErrCh := make(chan error)
+	// buffered channels let Client.NextEvent goroutine exit if the loop has already stopped
+	nextEventCh := make(chan *NextEventResponse, 1)
+	nextEventErrCh := make(chan error, 1)
 
 	// cleanup Client.NextEvent goroutine in case of external error received
 	ctx, cancel := context.WithCancel(ctx)
@@ -110,7 +208,7 @@ func loop(ctx context.Context, client *Client, ext Extension) (*NextEventRespons
 		// or if extension is subscribed only to Shutdown event
 		go func() {
 			client.log.V(1).Info("calling Client.NextEvent")
-			event, err := client.NextEvent(ctx)
+			event, err := nextEventWithRetries(ctx, client)
 			if err != nil {
 				nextEventErrCh <- err
 			} else {
@@ -127,7 +225,7 @@ func loop(ctx context.Context, client *Client, ext Extension) (*NextEventRespons
 			}
 
 			client.log.V(1).Info("calling Extension.HandleInvokeEvent", "event", event)
-			handleCtx, handleCancel := context.WithDeadline(ctx, time.UnixMilli(event.DeadlineMs))
+			handleCtx, handleCancel := withEventDeadline(ctx, client.clock, event)
 			err := ext.HandleInvokeEvent(handleCtx, event)
 			handleCancel()
 
@@ -135,11 +233,90 @@ func loop(ctx context.Context, client *Client, ext Extension) (*NextEventRespons
 				return nil, fmt.Errorf("Extension.HandleInvokeEvent failed: %w", err)
 			}
 		case err := <-nextEventErrCh:
+			if ctx.Err() != nil {
+				// Client.NextEvent was interrupted by the context cancellation
+				return contextCancelledEvent(client, ctx), nil
+			}
+
 			return nil, fmt.Errorf("Client.NextEvent failed: %w", err)
 		case err := <-ext.Err():
 			return nil, fmt.Errorf("Extension.Err() signaled an error: %w", err)
 		case <-ctx.Done():
-			return nil, fmt.Errorf("context cancelled before calling Client.NextEvent: %w", ctx.Err())
+			return contextCancelledEvent(client, ctx), nil
 		}
 	}
 }
+
+// contextCancelledEvent returns Shutdown event with ContextCancelled reason to stop the extension gracefully.
+func contextCancelledEvent(client *Client, ctx context.Context) *NextEventResponse {
+	client.log.Info("context cancelled, shutting down the extension", "err", ctx.Err().Error())
+
+	return &NextEventResponse{EventType: Shutdown, ShutdownReason: ContextCancelled}
+}
+
+// nextEventWithRetries calls Client.NextEvent and retries it on transient errors if configured with WithNextEventRetries.
+func nextEventWithRetries(ctx context.Context, client *Client) (*NextEventResponse, error) {
+	event, err := client.NextEvent(ctx)
+	for attempt := 0; err != nil && attempt < client.nextEventRetries && isTransientError(err); attempt++ {
+		delay := retryDelay(client.nextEventBackoff, attempt)
+		client.log.Info("Client.NextEvent failed, retrying", "error", err.Error(), "attempt", attempt+1, "delay", delay)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+
+			return nil, err
+		}
+		event, err = client.NextEvent(ctx)
+	}
+
+	return event, err
+}
+
+// isTransientError reports whether the request failed because of network error, throttling or 5xx response.
+func isTransientError(err error) bool {
+	if errors.Is(err, ErrClientClosed) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var apiErr LambdaAPIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Retryable()
+	}
+	var statusErr httpStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.statusCode >= http.StatusInternalServerError
+	}
+	var netErr net.Error
+
+	return errors.As(err, &netErr)
+}
+
+// retryDelay returns exponentially growing delay for the attempt with jitter in range [delay/2, delay].
+func retryDelay(backoff time.Duration, attempt int) time.Duration {
+	if backoff <= 0 {
+		return 0
+	}
+	delay := backoff << attempt
+	if delay <= 0 || delay > time.Minute {
+		delay = time.Minute
+	}
+	half := delay / 2
+
+	return half + time.Duration(rand.Int63n(int64(delay-half)+1)) //nolint:gosec // jitter doesn't need crypto rand
+}
+
+// withEventDeadline returns a copy of the context with the event deadline if it is set.
+// Timeout is computed with the clock, so the deadline is already exceeded if the clock is past the event deadline.
+func withEventDeadline(ctx context.Context, clock Clock, event *NextEventResponse) (context.Context, context.CancelFunc) {
+	deadline := event.DeadlineOrZero()
+	if deadline.IsZero() {
+		return context.WithCancel(ctx)
+	}
+	if clock == nil {
+		clock = realClock{}
+	}
+
+	return context.WithTimeout(ctx, deadline.Sub(clock.Now()))
+}
@@ -2,10 +2,17 @@ package extapi_test
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"math"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 	"github.com/zakharovvi/aws-lambda-extensions/extapi"
@@ -19,6 +26,13 @@ type testExtension struct {
 	shutdownErr           error
 	initCalled            bool
 	shutdownCalled        bool
+	invokeHasDeadline     bool
+	invokeCtxErr          error
+	shutdownHasDeadline   bool
+	shutdownReason        extapi.ShutdownReason
+	shutdownCtxErr        error
+	// cancelOnInvoke is called in HandleInvokeEvent if set
+	cancelOnInvoke context.CancelFunc
 }
 
 func (ext *testExtension) Init(ctx context.Context, client *extapi.Client) error {
@@ -30,6 +44,11 @@ func (ext *testExtension) Init(ctx context.Context, client *extapi.Client) error
 
 func (ext *testExtension) HandleInvokeEvent(ctx context.Context, event *extapi.NextEventResponse) error {
 	ext.events = append(ext.events, event)
+	_, ext.invokeHasDeadline = ctx.Deadline()
+	ext.invokeCtxErr = ctx.Err()
+	if ext.cancelOnInvoke != nil {
+		ext.cancelOnInvoke()
+	}
 
 	res := ext.handleInvokeEventErrs[0]
 	ext.handleInvokeEventErrs = ext.handleInvokeEventErrs[1:]
@@ -40,6 +59,9 @@ func (ext *testExtension) HandleInvokeEvent(ctx context.Context, event *extapi.N
 func (ext *testExtension) Shutdown(ctx context.Context, reason extapi.ShutdownReason, err error) error {
 	require.Falsef(ext.t, ext.shutdownCalled, "Shutdown has already been called")
 	ext.shutdownCalled = true
+	_, ext.shutdownHasDeadline = ctx.Deadline()
+	ext.shutdownReason = reason
+	ext.shutdownCtxErr = ctx.Err()
 
 	return ext.shutdownErr
 }
@@ -48,12 +70,24 @@ func (ext *testExtension) Err() <-chan error {
 	return nil
 }
 
+type fakeClock time.Time
+
+func (c fakeClock) Now() time.Time {
+	return time.Time(c)
+}
+
 type lambdaAPIMock struct {
 	t               *testing.T
 	events          [][]byte
 	registerCalled  bool
 	initErrorCalled bool
 	exitErrorCalled bool
+	// initErrorType and exitErrorType are Lambda-Extension-Function-Error-Type headers of error requests
+	initErrorType string
+	exitErrorType string
+	// nextEventFailures is the number of event/next calls failed with 500 before serving events
+	nextEventFailures int
+	nextEventCalls    int
 }
 
 func (h *lambdaAPIMock) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -66,7 +100,11 @@ func (h *lambdaAPIMock) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			require.NoError(h.t, err, "extension/register")
 		}
 	case "/2020-01-01/extension/event/next":
-		if len(h.events) == 0 {
+		h.nextEventCalls++
+		if h.nextEventFailures > 0 {
+			h.nextEventFailures--
+			w.WriteHeader(http.StatusInternalServerError)
+		} else if len(h.events) == 0 {
 			w.WriteHeader(http.StatusInternalServerError)
 		} else {
 			e := h.events[0]
@@ -78,12 +116,14 @@ func (h *lambdaAPIMock) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	case "/2020-01-01/extension/init/error":
 		require.Falsef(h.t, h.initErrorCalled, "extension/init/error has already been called")
 		h.initErrorCalled = true
+		h.initErrorType = r.Header.Get("Lambda-Extension-Function-Error-Type")
 		if _, err := w.Write(respError); err != nil {
 			require.NoError(h.t, err, "extension/init/error")
 		}
 	case "/2020-01-01/extension/exit/error":
 		require.Falsef(h.t, h.exitErrorCalled, "extension/exit/error has already been called")
 		h.exitErrorCalled = true
+		h.exitErrorType = r.Header.Get("Lambda-Extension-Function-Error-Type")
 		if _, err := w.Write(respError); err != nil {
 			require.NoError(h.t, err, "extension/exit/error")
 		}
@@ -184,3 +224,398 @@ func TestRun(t *testing.T) {
 		})
 	}
 }
+
+func TestRun_MaxDeadline(t *testing.T) {
+	handler := &lambdaAPIMock{
+		t:      t,
+		events: [][]byte{respInvoke, respShutdown},
+	}
+	ext := &testExtension{
+		t:                     t,
+		handleInvokeEventErrs: []error{nil},
+	}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	t.Setenv("AWS_LAMBDA_RUNTIME_API", server.Listener.Addr().String())
+
+	require.NoError(t, extapi.Run(context.Background(), ext))
+	require.False(t, ext.invokeHasDeadline)
+	require.False(t, ext.shutdownHasDeadline)
+}
+
+func TestNextEventResponse_DeadlineOrZero(t *testing.T) {
+	tests := []struct {
+		name       string
+		deadlineMs int64
+		want       time.Time
+	}{
+		{"max sentinel", math.MaxInt64, time.Time{}},
+		{"not set", 0, time.Time{}},
+		{"deadline", 1667000000000, time.UnixMilli(1667000000000)},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			event := &extapi.NextEventResponse{DeadlineMs: tt.deadlineMs}
+			require.Equal(t, tt.want, event.DeadlineOrZero())
+		})
+	}
+}
+
+func TestRun_WithClock(t *testing.T) {
+	deadline := time.UnixMilli(1667000000000)
+	respInvokeWithDeadline := []byte(`{"eventType":"INVOKE","deadlineMs":1667000000000,"requestId":"1.1"}`)
+	tests := []struct {
+		name       string
+		now        time.Time
+		wantCtxErr error
+	}{
+		{"before deadline", deadline.Add(-time.Hour), nil},
+		{"after deadline", deadline.Add(time.Second), context.DeadlineExceeded},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			handler := &lambdaAPIMock{
+				t:      t,
+				events: [][]byte{respInvokeWithDeadline, respShutdown},
+			}
+			ext := &testExtension{
+				t:                     t,
+				handleInvokeEventErrs: []error{nil},
+			}
+			server := httptest.NewServer(handler)
+			defer server.Close()
+			t.Setenv("AWS_LAMBDA_RUNTIME_API", server.Listener.Addr().String())
+
+			require.NoError(t, extapi.Run(context.Background(), ext, extapi.WithClock(fakeClock(tt.now))))
+			require.True(t, ext.invokeHasDeadline)
+			require.ErrorIs(t, ext.invokeCtxErr, tt.wantCtxErr)
+		})
+	}
+}
+
+func TestRun_WithNextEventRetries(t *testing.T) {
+	tests := []struct {
+		name          string
+		failures      int
+		opts          []extapi.Option
+		wantErr       string
+		wantCallCount int
+	}{
+		{
+			"no retries by default",
+			1,
+			nil,
+			"extension loop failed: Client.NextEvent failed: event/next call failed: http request failed with status 500 Internal Server Error and body: ",
+			1,
+		},
+		{
+			"recovered after retries",
+			2,
+			[]extapi.Option{extapi.WithNextEventRetries(3, time.Millisecond)},
+			"",
+			3,
+		},
+		{
+			"retries exhausted",
+			3,
+			[]extapi.Option{extapi.WithNextEventRetries(2, time.Millisecond)},
+			"extension loop failed: Client.NextEvent failed: event/next call failed: http request failed with status 500 Internal Server Error and body: ",
+			3,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			handler := &lambdaAPIMock{
+				t:                 t,
+				events:            [][]byte{respShutdown},
+				nextEventFailures: tt.failures,
+			}
+			ext := &testExtension{t: t}
+			server := httptest.NewServer(handler)
+			defer server.Close()
+			t.Setenv("AWS_LAMBDA_RUNTIME_API", server.Listener.Addr().String())
+
+			err := extapi.Run(context.Background(), ext, tt.opts...)
+			if tt.wantErr == "" {
+				require.NoError(t, err)
+			} else {
+				require.EqualError(t, err, tt.wantErr)
+			}
+			require.Equal(t, tt.wantCallCount, handler.nextEventCalls)
+			require.True(t, ext.shutdownCalled)
+		})
+	}
+}
+
+func TestRun_ContextCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	handler := &lambdaAPIMock{
+		t:      t,
+		events: [][]byte{respInvoke},
+	}
+	ext := &testExtension{
+		t:                     t,
+		handleInvokeEventErrs: []error{nil},
+		cancelOnInvoke:        cancel,
+	}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	t.Setenv("AWS_LAMBDA_RUNTIME_API", server.Listener.Addr().String())
+
+	require.NoError(t, extapi.Run(ctx, ext))
+	require.Len(t, ext.events, 1)
+	require.True(t, ext.shutdownCalled)
+	require.Equal(t, extapi.ContextCancelled, ext.shutdownReason)
+	require.NoError(t, ext.shutdownCtxErr, "Extension.Shutdown must get not cancelled context")
+	require.False(t, handler.exitErrorCalled)
+}
+
+func TestRunWithSignals(t *testing.T) {
+	tests := []struct {
+		name     string
+		onInvoke func(cancel context.CancelFunc) func()
+	}{
+		{
+			"parent context cancelled",
+			func(cancel context.CancelFunc) func() {
+				return cancel
+			},
+		},
+		{
+			"SIGTERM",
+			func(cancel context.CancelFunc) func() {
+				// wait for the signal delivery to make sure RunWithSignals received it
+				received := make(chan os.Signal, 1)
+				signal.Notify(received, syscall.SIGTERM)
+
+				var once sync.Once
+
+				return func() {
+					once.Do(func() {
+						defer signal.Stop(received)
+						require.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGTERM))
+						<-received
+					})
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			handler := &lambdaAPIMock{
+				t:      t,
+				events: [][]byte{respInvoke, respInvoke},
+			}
+			ext := &testExtension{
+				t:                     t,
+				handleInvokeEventErrs: []error{nil, nil},
+				cancelOnInvoke:        tt.onInvoke(cancel),
+			}
+			server := httptest.NewServer(handler)
+			defer server.Close()
+			t.Setenv("AWS_LAMBDA_RUNTIME_API", server.Listener.Addr().String())
+
+			require.NoError(t, extapi.RunWithSignals(ctx, ext))
+			require.True(t, ext.shutdownCalled)
+			require.Equal(t, extapi.ContextCancelled, ext.shutdownReason)
+			require.False(t, handler.exitErrorCalled)
+		})
+	}
+}
+
+func TestRun_WithErrorReporter(t *testing.T) {
+	reporter := func(ctx context.Context, phase extapi.ErrorPhase, err error) (string, bool) {
+		if phase == extapi.ErrorPhaseInit {
+			return "Team.InitFailure", true
+		}
+
+		return "", false
+	}
+
+	t.Run("custom init error type", func(t *testing.T) {
+		handler := &lambdaAPIMock{t: t}
+		ext := &testExtension{t: t, initErr: errors.New("init failed")}
+		server := httptest.NewServer(handler)
+		defer server.Close()
+		t.Setenv("AWS_LAMBDA_RUNTIME_API", server.Listener.Addr().String())
+
+		err := extapi.Run(context.Background(), ext, extapi.WithErrorReporter(reporter))
+		require.EqualError(t, err, "Extension.Init failed: init failed")
+		require.True(t, handler.initErrorCalled)
+		require.Equal(t, "Team.InitFailure", handler.initErrorType)
+	})
+
+	t.Run("exit error not reported", func(t *testing.T) {
+		handler := &lambdaAPIMock{t: t}
+		ext := &testExtension{t: t}
+		server := httptest.NewServer(handler)
+		defer server.Close()
+		t.Setenv("AWS_LAMBDA_RUNTIME_API", server.Listener.Addr().String())
+
+		err := extapi.Run(context.Background(), ext, extapi.WithErrorReporter(reporter))
+		require.Error(t, err)
+		require.True(t, ext.shutdownCalled)
+		require.False(t, handler.exitErrorCalled)
+	})
+
+	t.Run("default error types", func(t *testing.T) {
+		handler := &lambdaAPIMock{t: t}
+		ext := &testExtension{t: t}
+		server := httptest.NewServer(handler)
+		defer server.Close()
+		t.Setenv("AWS_LAMBDA_RUNTIME_API", server.Listener.Addr().String())
+
+		require.Error(t, extapi.Run(context.Background(), ext))
+		require.True(t, handler.exitErrorCalled)
+		require.Equal(t, "Extension.Exit", handler.exitErrorType)
+	})
+}
+
+// shutdownCountingExtension counts Shutdown calls instead of failing on the second one.
+type shutdownCountingExtension struct {
+	testExtension
+	cancel        context.CancelFunc
+	shutdownCalls int
+}
+
+func (ext *shutdownCountingExtension) Init(ctx context.Context, client *extapi.Client) error {
+	ext.cancel()
+
+	return errors.New("init failed")
+}
+
+func (ext *shutdownCountingExtension) Shutdown(ctx context.Context, reason extapi.ShutdownReason, err error) error {
+	ext.shutdownCalls++
+	ext.shutdownReason = reason
+
+	return nil
+}
+
+func TestRun_ShutdownOnce(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	handler := &lambdaAPIMock{t: t}
+	ext := &shutdownCountingExtension{testExtension: testExtension{t: t}, cancel: cancel}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	t.Setenv("AWS_LAMBDA_RUNTIME_API", server.Listener.Addr().String())
+
+	err := extapi.Run(ctx, ext)
+	require.EqualError(t, err, "Extension.Init failed: init failed")
+	require.Equal(t, 1, ext.shutdownCalls)
+	require.Equal(t, extapi.ExtensionError, ext.shutdownReason)
+}
+
+// registerEventsMock records event types of register requests and rejects Shutdown if rejectShutdown is set.
+type registerEventsMock struct {
+	t              *testing.T
+	rejectShutdown bool
+	registered     [][]extapi.EventType
+}
+
+func (h *registerEventsMock) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/2020-01-01/extension/register":
+		req := extapi.RegisterRequest{}
+		require.NoError(h.t, json.NewDecoder(r.Body).Decode(&req))
+		h.registered = append(h.registered, req.EventTypes)
+		if h.rejectShutdown && len(req.EventTypes) > 1 {
+			w.WriteHeader(http.StatusForbidden)
+			_, err := w.Write([]byte(`{"errorMessage":"ShutdownEventNotSupportedForInternalExtension","errorType":"Extension.ShutdownEventNotSupportedForInternalExtension"}`))
+			require.NoError(h.t, err)
+
+			return
+		}
+		w.Header().Set("Lambda-Extension-Identifier", testExtensionID)
+		_, err := w.Write(respRegister)
+		require.NoError(h.t, err)
+	case "/2020-01-01/extension/event/next":
+		_, err := w.Write(respShutdown)
+		require.NoError(h.t, err)
+	default:
+		require.Failf(h.t, "unknown url called: %s", r.URL.String())
+	}
+}
+
+func TestRun_InternalExtension(t *testing.T) {
+	tests := []struct {
+		name           string
+		taskRoot       string
+		rejectShutdown bool
+		opts           []extapi.Option
+		wantErr        bool
+		wantRegistered [][]extapi.EventType
+	}{
+		{
+			"external",
+			"",
+			false,
+			nil,
+			false,
+			[][]extapi.EventType{{extapi.Invoke, extapi.Shutdown}},
+		},
+		{
+			"internal detected",
+			"/var/task",
+			false,
+			nil,
+			false,
+			[][]extapi.EventType{{extapi.Invoke}},
+		},
+		{
+			"internal missed by detection and rejected by Lambda",
+			"",
+			true,
+			nil,
+			false,
+			[][]extapi.EventType{{extapi.Invoke, extapi.Shutdown}, {extapi.Invoke}},
+		},
+		{
+			"WithEventTypes is not adjusted",
+			"/var/task",
+			false,
+			[]extapi.Option{extapi.WithEventTypes([]extapi.EventType{extapi.Invoke, extapi.Shutdown})},
+			false,
+			[][]extapi.EventType{{extapi.Invoke, extapi.Shutdown}},
+		},
+		{
+			"WithEventTypes is not retried",
+			"",
+			true,
+			[]extapi.Option{extapi.WithEventTypes([]extapi.EventType{extapi.Invoke, extapi.Shutdown})},
+			true,
+			[][]extapi.EventType{{extapi.Invoke, extapi.Shutdown}},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			handler := &registerEventsMock{t: t, rejectShutdown: tt.rejectShutdown}
+			server := httptest.NewServer(handler)
+			defer server.Close()
+			env := map[string]string{
+				"AWS_LAMBDA_RUNTIME_API": server.Listener.Addr().String(),
+				"LAMBDA_TASK_ROOT":       tt.taskRoot,
+			}
+			opts := append([]extapi.Option{extapi.WithEnvironment(func(key string) string { return env[key] })}, tt.opts...)
+
+			err := extapi.Run(context.Background(), &testExtension{t: t}, opts...)
+			if tt.wantErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+			require.Equal(t, tt.wantRegistered, handler.registered)
+		})
+	}
+}
@@ -26,10 +26,21 @@ type LogsBufferingCfg struct {
 	MaxItems uint32 `json:"maxItems"`
 	// MaxBytes is the maximum size in bytes of the logs to be buffered in memory. (default: 262144, minimum: 262144, maximum: 1048576)
 	MaxBytes uint32 `json:"maxBytes"`
-	// TimeoutMS is the maximum time (in milliseconds) for a batch to be buffered. (default: 1000, minimum: 100, maximum: 30000)
+	// TimeoutMS is the maximum time (in milliseconds) for a batch to be buffered. (default: 1000, minimum: 25, maximum: 30000)
 	TimeoutMS uint32 `json:"timeoutMs"`
 }
 
+// DefaultLogsBufferingCfg returns the buffering configuration Logs API uses if none is provided.
+func DefaultLogsBufferingCfg() *LogsBufferingCfg {
+	return &LogsBufferingCfg{MaxItems: 10000, MaxBytes: 262144, TimeoutMS: 1000}
+}
+
+// LowLatencyLogsBufferingCfg returns the buffering configuration with minimum batch sizes and timeout
+// to receive logs as soon as possible.
+func LowLatencyLogsBufferingCfg() *LogsBufferingCfg {
+	return &LogsBufferingCfg{MaxItems: 1000, MaxBytes: 262144, TimeoutMS: 25}
+}
+
 // LogsHTTPMethod represents the HTTP method used to receive logs from Logs API.
 type LogsHTTPMethod string
 
@@ -111,8 +122,8 @@ func (c *Client) LogsSubscribe(ctx context.Context, subscribeReq *LogsSubscribeR
 
 		return err
 	}
-	url := fmt.Sprintf("http://%s/2020-08-15/logs", c.awsLambdaRuntimeAPI)
-	req, err := http.NewRequestWithContext(ctx, http.MethodPut, url, bytes.NewReader(body))
+	subscribeURL := c.apiURL("2020-08-15", "logs")
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, subscribeURL, bytes.NewReader(body))
 	if err != nil {
 		err = fmt.Errorf("could not logs subscribe http request: %w", err)
 		c.log.Error(err, "")
@@ -129,3 +140,16 @@ func (c *Client) LogsSubscribe(ctx context.Context, subscribeReq *LogsSubscribeR
 
 	return nil
 }
+
+// SubscribeBoth subscribes to both Logs API and Telemetry API streams, e.g. during migration from Logs API to Telemetry API.
+// Lambda delivers function and extension logs and platform events to both destinations,
+// so every log line is received twice, once in each schema, and counts towards both buffering configurations.
+// Destinations must differ to tell the schemas apart, e.g. by URL path.
+// Use it only for the migration window as Logs API is deprecated.
+func (c *Client) SubscribeBoth(ctx context.Context, logsReq *LogsSubscribeRequest, telemetryReq *TelemetrySubscribeRequest) error {
+	if err := c.LogsSubscribe(ctx, logsReq); err != nil {
+		return err
+	}
+
+	return c.TelemetrySubscribe(ctx, telemetryReq)
+}
@@ -53,3 +53,18 @@ func TestLogsSubscribe(t *testing.T) {
 	err = client.LogsSubscribe(context.Background(), subscribeReq)
 	require.NoError(t, err)
 }
+
+func TestLogsBufferingCfgPresets(t *testing.T) {
+	presets := map[string]*extapi.LogsBufferingCfg{
+		"default":     extapi.DefaultLogsBufferingCfg(),
+		"low latency": extapi.LowLatencyLogsBufferingCfg(),
+	}
+	for name, cfg := range presets {
+		require.GreaterOrEqual(t, cfg.MaxItems, uint32(1000), name)
+		require.LessOrEqual(t, cfg.MaxItems, uint32(10000), name)
+		require.GreaterOrEqual(t, cfg.MaxBytes, uint32(262144), name)
+		require.LessOrEqual(t, cfg.MaxBytes, uint32(1048576), name)
+		require.GreaterOrEqual(t, cfg.TimeoutMS, uint32(25), name)
+		require.LessOrEqual(t, cfg.TimeoutMS, uint32(30000), name)
+	}
+}
@@ -0,0 +1,22 @@
+//go:build go1.21
+
+package extapi
+
+import (
+	"log/slog"
+
+	"github.com/go-logr/logr"
+	"github.com/go-logr/logr/slogr"
+)
+
+// LogrFromSlog converts log/slog logger into logr.Logger accepted by WithLogger options of this module.
+// logr verbosity levels are mapped to slog levels: V(0) is slog.LevelInfo and V(4) is slog.LevelDebug.
+// logsapi.WithSlogLogger and telemetryapi.WithSlogLogger use it as well.
+func LogrFromSlog(log *slog.Logger) logr.Logger {
+	return slogr.NewLogr(log.Handler())
+}
+
+// WithSlogLogger configures log/slog logger. It is a shortcut for WithLogger with LogrFromSlog.
+func WithSlogLogger(log *slog.Logger) Option {
+	return WithLogger(LogrFromSlog(log))
+}
@@ -0,0 +1,22 @@
+//go:build go1.21
+
+package extapi_test
+
+import (
+	"bytes"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zakharovvi/aws-lambda-extensions/extapi"
+)
+
+func TestWithSlogLogger(t *testing.T) {
+	buf := &bytes.Buffer{}
+	handler := slog.NewTextHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug})
+	_, server, _, err := register(t, extapi.WithSlogLogger(slog.New(handler)))
+	require.NoError(t, err)
+	defer server.Close()
+
+	require.Contains(t, buf.String(), `msg="extension registered" extensionID=test-identifier`)
+}
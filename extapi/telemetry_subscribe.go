@@ -4,8 +4,10 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 )
 
 // TelemetrySubscriptionType represents the type of telemetry events in Lambda.
@@ -27,45 +29,156 @@ type TelemetryBufferingCfg struct {
 	MaxItems uint32 `json:"maxItems"`
 	// MaxBytes is the maximum size in bytes of data to be buffered in memory. (default: 262144, minimum: 262144, maximum: 1048576)
 	MaxBytes uint32 `json:"maxBytes"`
-	// TimeoutMS is the maximum time (in milliseconds) for a batch to be buffered. (default: 1000, minimum: 100, maximum: 30000)
+	// TimeoutMS is the maximum time (in milliseconds) for a batch to be buffered. (default: 1000, minimum: 25, maximum: 30000)
 	TimeoutMS uint32 `json:"timeoutMs"`
 }
 
+// DefaultTelemetryBufferingCfg returns the buffering configuration Telemetry API uses if none is provided.
+func DefaultTelemetryBufferingCfg() *TelemetryBufferingCfg {
+	return &TelemetryBufferingCfg{MaxItems: 10000, MaxBytes: 262144, TimeoutMS: 1000}
+}
+
+// HighThroughputTelemetryBufferingCfg returns the buffering configuration with maximum batch sizes
+// to receive events in fewer requests when the function produces a lot of telemetry.
+func HighThroughputTelemetryBufferingCfg() *TelemetryBufferingCfg {
+	return &TelemetryBufferingCfg{MaxItems: 10000, MaxBytes: 1048576, TimeoutMS: 1000}
+}
+
+// LowLatencyTelemetryBufferingCfg returns the buffering configuration with minimum batch sizes and timeout
+// to receive events as soon as possible.
+func LowLatencyTelemetryBufferingCfg() *TelemetryBufferingCfg {
+	return &TelemetryBufferingCfg{MaxItems: 1000, MaxBytes: 262144, TimeoutMS: 25}
+}
+
 // TelemetryDestination is the configuration settings that define the telemetry event destination and the protocol for event delivery.
 type TelemetryDestination struct {
 	Protocol string `json:"protocol"`
 	URI      string `json:"URI"`
 }
 
+const (
+	// TelemetryProtocolHTTP delivers events with HTTP POST requests to http:// destination URI.
+	TelemetryProtocolHTTP = "HTTP"
+	// TelemetryProtocolTCP delivers events as newline delimited JSON over TCP connection to tcp:// destination URI.
+	TelemetryProtocolTCP = "TCP"
+)
+
+// NewTelemetryDestination creates TelemetryDestination and validates that the protocol is supported
+// and the URI scheme matches the protocol.
+func NewTelemetryDestination(protocol, uri string) (*TelemetryDestination, error) {
+	var wantScheme string
+	switch protocol {
+	case TelemetryProtocolHTTP:
+		wantScheme = "http"
+	case TelemetryProtocolTCP:
+		wantScheme = "tcp"
+	default:
+		return nil, fmt.Errorf("unsupported telemetry destination protocol %q, want %s or %s", protocol, TelemetryProtocolHTTP, TelemetryProtocolTCP)
+	}
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse telemetry destination URI: %w", err)
+	}
+	if u.Scheme != wantScheme || u.Host == "" {
+		return nil, fmt.Errorf("telemetry destination URI %q must be %s://host:port for %s protocol", uri, wantScheme, protocol)
+	}
+
+	return &TelemetryDestination{Protocol: protocol, URI: uri}, nil
+}
+
 type TelemetrySchemaVersion string
 
 const (
 	TelemetrySchemaVersion20220701 TelemetrySchemaVersion = "2022-07-01"
+	// TelemetrySchemaVersion20221213 adds platform.restoreStart, platform.restoreRuntimeDone, and platform.restoreReport events for SnapStart.
+	TelemetrySchemaVersion20221213 TelemetrySchemaVersion = "2022-12-13"
+)
+
+// TelemetryLogLevel is the minimum level of function logs delivered to the subscriber.
+type TelemetryLogLevel string
+
+const (
+	TelemetryLogLevelTrace TelemetryLogLevel = "TRACE"
+	TelemetryLogLevelDebug TelemetryLogLevel = "DEBUG"
+	TelemetryLogLevelInfo  TelemetryLogLevel = "INFO"
+	TelemetryLogLevelWarn  TelemetryLogLevel = "WARN"
+	TelemetryLogLevelError TelemetryLogLevel = "ERROR"
+	TelemetryLogLevelFatal TelemetryLogLevel = "FATAL"
+)
+
+// IsValid reports whether the level is one of the levels accepted by Telemetry API.
+func (l TelemetryLogLevel) IsValid() bool {
+	switch l {
+	case TelemetryLogLevelTrace, TelemetryLogLevelDebug, TelemetryLogLevelInfo,
+		TelemetryLogLevelWarn, TelemetryLogLevelError, TelemetryLogLevelFatal:
+		return true
+	default:
+		return false
+	}
+}
+
+// TelemetryLogFormat is the format of function logs delivered to the subscriber.
+type TelemetryLogFormat string
+
+const (
+	TelemetryLogFormatJSON TelemetryLogFormat = "JSON"
+	TelemetryLogFormatText TelemetryLogFormat = "Text"
 )
 
+// IsValid reports whether the format is one of the formats accepted by Telemetry API.
+func (f TelemetryLogFormat) IsValid() bool {
+	return f == TelemetryLogFormatJSON || f == TelemetryLogFormatText
+}
+
 // TelemetrySubscribeRequest is the request body that is sent to Telemetry API on subscribe.
 type TelemetrySubscribeRequest struct {
 	SchemaVersion TelemetrySchemaVersion      `json:"schemaVersion,omitempty"`
 	Types         []TelemetrySubscriptionType `json:"types"`
 	BufferingCfg  *TelemetryBufferingCfg      `json:"buffering,omitempty"`
 	Destination   *TelemetryDestination       `json:"destination"`
+	// LogLevel is the minimum level of function logs to deliver. It is omitted from the request if empty.
+	LogLevel TelemetryLogLevel `json:"logLevel,omitempty"`
+	// LogFormat is the format of function logs to deliver. It is omitted from the request if empty.
+	LogFormat TelemetryLogFormat `json:"logFormat,omitempty"`
 }
 
-// NewTelemetrySubscribeRequest creates TelemetrySubscribeRequest with sensible defaults.
-func NewTelemetrySubscribeRequest(url string, types []TelemetrySubscriptionType, bufferingCfg *TelemetryBufferingCfg) *TelemetrySubscribeRequest {
+// NewTelemetrySubscribeRequest creates TelemetrySubscribeRequest with sensible defaults and HTTP destination.
+// TelemetrySchemaVersion20220701 is used if schemaVersion is empty.
+func NewTelemetrySubscribeRequest(
+	url string,
+	types []TelemetrySubscriptionType,
+	bufferingCfg *TelemetryBufferingCfg,
+	schemaVersion TelemetrySchemaVersion,
+) *TelemetrySubscribeRequest {
+	destination := &TelemetryDestination{
+		Protocol: TelemetryProtocolHTTP,
+		URI:      url,
+	}
+
+	return NewTelemetrySubscribeRequestWithDestination(destination, types, bufferingCfg, schemaVersion)
+}
+
+// NewTelemetrySubscribeRequestWithDestination creates TelemetrySubscribeRequest with a custom destination,
+// e.g. created with NewTelemetryDestination for TCP protocol. Defaults are the same as in NewTelemetrySubscribeRequest.
+func NewTelemetrySubscribeRequestWithDestination(
+	destination *TelemetryDestination,
+	types []TelemetrySubscriptionType,
+	bufferingCfg *TelemetryBufferingCfg,
+	schemaVersion TelemetrySchemaVersion,
+) *TelemetrySubscribeRequest {
 	if len(types) == 0 {
 		// do not subscribe to TelemetrySubscriptionTypeExtension by default to avoid recursion
 		types = append(types, TelemetrySubscriptionTypePlatform, TelemetrySubscriptionTypeFunction)
 	}
+	if schemaVersion == "" {
+		schemaVersion = TelemetrySchemaVersion20220701
+	}
 
 	return &TelemetrySubscribeRequest{
-		SchemaVersion: TelemetrySchemaVersion20220701,
+		SchemaVersion: schemaVersion,
 		Types:         types,
 		BufferingCfg:  bufferingCfg,
-		Destination: &TelemetryDestination{
-			Protocol: "HTTP",
-			URI:      url,
-		},
+		Destination:   destination,
 	}
 }
 
@@ -74,6 +187,12 @@ func NewTelemetrySubscribeRequest(url string, types []TelemetrySubscriptionType,
 // Subscription should occur during the extension initialization phase.
 // https://docs.aws.amazon.com/lambda/latest/dg/telemetry-api-reference.html
 func (c *Client) TelemetrySubscribe(ctx context.Context, subscribeReq *TelemetrySubscribeRequest) error {
+	if subscribeReq.Destination == nil {
+		err := errors.New("telemetry subscribe request has no destination")
+		c.log.Error(err, "")
+
+		return err
+	}
 	body, err := json.Marshal(subscribeReq)
 	if err != nil {
 		err = fmt.Errorf("could not json encode telemetry subscribe request: %w", err)
@@ -81,8 +200,8 @@ func (c *Client) TelemetrySubscribe(ctx context.Context, subscribeReq *Telemetry
 
 		return err
 	}
-	url := fmt.Sprintf("http://%s/2022-07-01/telemetry", c.awsLambdaRuntimeAPI)
-	req, err := http.NewRequestWithContext(ctx, http.MethodPut, url, bytes.NewReader(body))
+	subscribeURL := c.apiURL(c.telemetryAPIVersion, "telemetry")
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, subscribeURL, bytes.NewReader(body))
 	if err != nil {
 		err = fmt.Errorf("could not telemetry subscribe http request: %w", err)
 		c.log.Error(err, "")
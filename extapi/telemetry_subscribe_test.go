@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"io"
 	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -47,7 +48,133 @@ func TestTelemetrySubscribe(t *testing.T) {
 		require.NoError(t, err)
 	})
 
-	subscribeReq := extapi.NewTelemetrySubscribeRequest(telemetryReceiverURL, nil, nil)
+	subscribeReq := extapi.NewTelemetrySubscribeRequest(telemetryReceiverURL, nil, nil, "")
 	err = client.TelemetrySubscribe(context.Background(), subscribeReq)
 	require.NoError(t, err)
 }
+
+func TestTelemetrySubscribe_APIVersion(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/2030-01-01/extension/register", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Lambda-Extension-Identifier", testExtensionID)
+		_, err := w.Write(respRegister)
+		require.NoError(t, err)
+	})
+	telemetryCalled := false
+	mux.HandleFunc("/2030-02-02/telemetry", func(w http.ResponseWriter, r *http.Request) {
+		telemetryCalled = true
+		require.Equal(t, http.MethodPut, r.Method)
+
+		_, err := w.Write([]byte("OK"))
+		require.NoError(t, err)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client, err := extapi.Register(
+		context.Background(),
+		extapi.WithAWSLambdaRuntimeAPI(server.Listener.Addr().String()),
+		extapi.WithExtensionAPIVersion("2030-01-01"),
+		extapi.WithTelemetryAPIVersion("2030-02-02"),
+	)
+	require.NoError(t, err)
+
+	subscribeReq := extapi.NewTelemetrySubscribeRequest(telemetryReceiverURL, nil, nil, "")
+	require.NoError(t, client.TelemetrySubscribe(context.Background(), subscribeReq))
+	require.True(t, telemetryCalled)
+}
+
+func TestTelemetryBufferingCfgPresets(t *testing.T) {
+	presets := map[string]*extapi.TelemetryBufferingCfg{
+		"default":         extapi.DefaultTelemetryBufferingCfg(),
+		"high throughput": extapi.HighThroughputTelemetryBufferingCfg(),
+		"low latency":     extapi.LowLatencyTelemetryBufferingCfg(),
+	}
+	for name, cfg := range presets {
+		require.GreaterOrEqual(t, cfg.MaxItems, uint32(1000), name)
+		require.LessOrEqual(t, cfg.MaxItems, uint32(10000), name)
+		require.GreaterOrEqual(t, cfg.MaxBytes, uint32(262144), name)
+		require.LessOrEqual(t, cfg.MaxBytes, uint32(1048576), name)
+		require.GreaterOrEqual(t, cfg.TimeoutMS, uint32(25), name)
+		require.LessOrEqual(t, cfg.TimeoutMS, uint32(30000), name)
+	}
+	require.NotSame(t, extapi.DefaultTelemetryBufferingCfg(), extapi.DefaultTelemetryBufferingCfg())
+}
+
+func TestTelemetrySubscribe_CustomDestination(t *testing.T) {
+	client, server, mux, err := register(t)
+	require.NoError(t, err)
+	defer server.Close()
+
+	destination, err := extapi.NewTelemetryDestination(extapi.TelemetryProtocolTCP, "tcp://sandbox.localdomain:8080")
+	require.NoError(t, err)
+	subscribeReq := extapi.NewTelemetrySubscribeRequestWithDestination(
+		destination,
+		[]extapi.TelemetrySubscriptionType{extapi.TelemetrySubscriptionTypePlatform},
+		extapi.DefaultTelemetryBufferingCfg(),
+		"",
+	)
+
+	mux.HandleFunc("/2022-07-01/telemetry", func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		got := &extapi.TelemetrySubscribeRequest{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(got))
+		require.Equal(t, subscribeReq, got)
+
+		_, err = w.Write([]byte("OK"))
+		require.NoError(t, err)
+	})
+
+	require.NoError(t, client.TelemetrySubscribe(context.Background(), subscribeReq))
+
+	subscribeReq.Destination = nil
+	require.Error(t, client.TelemetrySubscribe(context.Background(), subscribeReq))
+}
+
+func TestNewTelemetryDestination(t *testing.T) {
+	tests := []struct {
+		protocol string
+		uri      string
+		wantErr  bool
+	}{
+		{extapi.TelemetryProtocolHTTP, "http://sandbox.localdomain:8080/telemetry", false},
+		{extapi.TelemetryProtocolTCP, "tcp://sandbox.localdomain:8080", false},
+		{extapi.TelemetryProtocolHTTP, "tcp://sandbox.localdomain:8080", true},
+		{extapi.TelemetryProtocolTCP, "http://sandbox.localdomain:8080", true},
+		{extapi.TelemetryProtocolHTTP, "http://", true},
+		{"UDP", "udp://sandbox.localdomain:8080", true},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.protocol+" "+tt.uri, func(t *testing.T) {
+			dest, err := extapi.NewTelemetryDestination(tt.protocol, tt.uri)
+			if tt.wantErr {
+				require.Error(t, err)
+
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, &extapi.TelemetryDestination{Protocol: tt.protocol, URI: tt.uri}, dest)
+		})
+	}
+}
+
+func TestTelemetrySubscribeRequest_LogLevelAndFormat(t *testing.T) {
+	req := extapi.NewTelemetrySubscribeRequest(telemetryReceiverURL, nil, nil, "")
+	body, err := json.Marshal(req)
+	require.NoError(t, err)
+	require.NotContains(t, string(body), "logLevel")
+	require.NotContains(t, string(body), "logFormat")
+
+	req.LogLevel = extapi.TelemetryLogLevelDebug
+	req.LogFormat = extapi.TelemetryLogFormatText
+	body, err = json.Marshal(req)
+	require.NoError(t, err)
+	require.Contains(t, string(body), `"logLevel":"DEBUG","logFormat":"Text"`)
+
+	require.True(t, extapi.TelemetryLogLevelFatal.IsValid())
+	require.False(t, extapi.TelemetryLogLevel("info").IsValid())
+	require.True(t, extapi.TelemetryLogFormatJSON.IsValid())
+	require.False(t, extapi.TelemetryLogFormat("XML").IsValid())
+}
@@ -0,0 +1,34 @@
+package extapi
+
+import "runtime/debug"
+
+const modulePath = "github.com/zakharovvi/aws-lambda-extensions"
+
+// Version is the version of this module reported by BuildInfo and in the default User-Agent header.
+// It is empty by default and the version is detected with debug.ReadBuildInfo. Set it at link time if build info is stripped:
+//
+//	go build -ldflags "-X github.com/zakharovvi/aws-lambda-extensions/extapi.Version=v1.2.3"
+var Version string
+
+// BuildInfo returns the version of this module the extension is built with, e.g. "v1.2.3".
+// Version is returned if set, otherwise the module version is read with debug.ReadBuildInfo.
+// "(devel)" is returned when the module is built from a local checkout or build info is not available.
+func BuildInfo() string {
+	if Version != "" {
+		return Version
+	}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "(devel)"
+	}
+	if info.Main.Path == modulePath && info.Main.Version != "" {
+		return info.Main.Version
+	}
+	for _, dep := range info.Deps {
+		if dep.Path == modulePath && dep.Version != "" {
+			return dep.Version
+		}
+	}
+
+	return "(devel)"
+}
@@ -0,0 +1,17 @@
+package extapi_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zakharovvi/aws-lambda-extensions/extapi"
+)
+
+func TestBuildInfo(t *testing.T) {
+	// under go test this module is the main module without a version
+	require.Equal(t, "(devel)", extapi.BuildInfo())
+
+	extapi.Version = "v1.2.3"
+	defer func() { extapi.Version = "" }()
+	require.Equal(t, "v1.2.3", extapi.BuildInfo())
+}
@@ -3,7 +3,8 @@ module github.com/zakharovvi/aws-lambda-extensions
 go 1.18
 
 require (
-	github.com/go-logr/logr v1.2.3
+	github.com/go-logr/logr v1.3.0
+	github.com/go-logr/stdr v1.2.2
 	github.com/stretchr/testify v1.8.0
 	github.com/tonglil/buflogr v1.0.1
 	go.opentelemetry.io/contrib/propagators/aws v1.11.1
@@ -11,11 +12,11 @@ require (
 	go.opentelemetry.io/otel/exporters/stdout/stdouttrace v1.11.1
 	go.opentelemetry.io/otel/sdk v1.11.1
 	go.opentelemetry.io/otel/trace v1.11.1
+	golang.org/x/sync v0.7.0
 )
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
-	github.com/go-logr/stdr v1.2.2 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
 	golang.org/x/sys v0.0.0-20220919091848-fb04ddd9f9c8 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
@@ -1,45 +1,199 @@
 package internal
 
 import (
+	"bufio"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"strings"
+
+	"github.com/go-logr/logr"
 )
 
+// DecodeOptions configures Decode behaviour.
+type DecodeOptions struct {
+	// SkipMalformed makes Decode log and skip array elements which could not be decoded instead of returning an error.
+	SkipMalformed bool
+	Log           logr.Logger
+	// Framer defines how elements are delimited in the input stream. ArrayFramer is used if nil.
+	Framer Framer
+}
+
+// Framer reads the framing of json elements in the input stream,
+// so the same element decoding can be reused with different transports.
+type Framer interface {
+	// Open consumes the framing before the first element.
+	Open(d *json.Decoder) error
+	// More reports whether there is another element in the stream.
+	More(d *json.Decoder) bool
+	// Close consumes the framing after the last element.
+	Close(d *json.Decoder) error
+	// Resync skips the malformed element after json.SyntaxError and creates a new json.Decoder positioned at the next element.
+	// It also returns the reader the new json.Decoder reads from.
+	Resync(d *json.Decoder, r io.Reader) (*json.Decoder, io.Reader, error)
+}
+
+// ArrayFramer reads elements of a single json array as sent in HTTP request bodies by Logs API and Telemetry API.
+type ArrayFramer struct{}
+
+func (ArrayFramer) Open(d *json.Decoder) error {
+	return readBracket(d, "[")
+}
+
+func (ArrayFramer) More(d *json.Decoder) bool {
+	return d.More()
+}
+
+func (ArrayFramer) Close(d *json.Decoder) error {
+	return readBracket(d, "]")
+}
+
+func (ArrayFramer) Resync(d *json.Decoder, r io.Reader) (*json.Decoder, io.Reader, error) {
+	return resync(d, r)
+}
+
+// NDJSONFramer reads newline-delimited json elements till the end of the stream as sent over TCP protocol.
+type NDJSONFramer struct{}
+
+func (NDJSONFramer) Open(d *json.Decoder) error {
+	return nil
+}
+
+func (NDJSONFramer) More(d *json.Decoder) bool {
+	// json.Decoder.More is false at the end of the stream between top-level values
+	return d.More()
+}
+
+func (NDJSONFramer) Close(d *json.Decoder) error {
+	return nil
+}
+
+// Resync skips the rest of the line with the malformed element.
+func (NDJSONFramer) Resync(d *json.Decoder, r io.Reader) (*json.Decoder, io.Reader, error) {
+	br := bufio.NewReader(io.MultiReader(d.Buffered(), r))
+	if _, err := br.ReadBytes('\n'); err != nil && !errors.Is(err, io.EOF) {
+		return nil, nil, fmt.Errorf("malformed ndjson stream, could not find next element: %w", err)
+	}
+
+	return json.NewDecoder(br), br, nil
+}
+
+// Decode decodes json array with DecodeNoDrain, then drains and closes the input stream.
 func Decode[T any](
 	ctx context.Context,
 	r io.ReadCloser,
 	logs chan<- T,
 	decodeNext func(d *json.Decoder) (T, error),
+	opts DecodeOptions,
 ) error {
 	defer func() {
 		_, _ = io.Copy(io.Discard, r)
 		_ = r.Close()
 	}()
 
+	_, err := DecodeNoDrain(ctx, r, logs, decodeNext, opts)
+
+	return err
+}
+
+// DecodeNoDrain decodes json elements framed with DecodeOptions.Framer and returns once the closing framing is consumed.
+// Bytes following the elements are returned as a reader including those already buffered by json.Decoder.
+func DecodeNoDrain[T any](
+	ctx context.Context,
+	r io.Reader,
+	logs chan<- T,
+	decodeNext func(d *json.Decoder) (T, error),
+	opts DecodeOptions,
+) (io.Reader, error) {
+	framer := opts.Framer
+	if framer == nil {
+		framer = ArrayFramer{}
+	}
 	d := json.NewDecoder(r)
-	if err := readBracket(d, "["); err != nil {
-		return err
+	if err := framer.Open(d); err != nil {
+		return nil, err
 	}
-	for d.More() {
+	for framer.More(d) {
 		msg, err := decodeNext(d)
 		if err != nil {
-			return err
+			if !opts.SkipMalformed {
+				return nil, err
+			}
+			opts.Log.Error(err, "skipping malformed record")
+			var syntaxErr *json.SyntaxError
+			if !errors.As(err, &syntaxErr) {
+				// the whole value has been consumed by json.Decoder and it can continue with the next element
+				continue
+			}
+			// json.Decoder can't continue after syntax error
+			if d, r, err = framer.Resync(d, r); err != nil {
+				return nil, err
+			}
+
+			continue
 		}
 
 		select {
 		case <-ctx.Done():
-			return fmt.Errorf("decoding was interrupted with context error: %w", ctx.Err())
+			return nil, fmt.Errorf("decoding was interrupted with context error: %w", ctx.Err())
 		default:
 		}
-		logs <- msg
+		// the consumer can be stuck in a hung EventProcessor.Process after the shutdown deadline
+		select {
+		case logs <- msg:
+		case <-ctx.Done():
+			return nil, fmt.Errorf("decoding was interrupted with context error: %w", ctx.Err())
+		}
 	}
-	if err := readBracket(d, "]"); err != nil {
-		return err
+	if err := framer.Close(d); err != nil {
+		return nil, err
 	}
 
-	return nil
+	return io.MultiReader(d.Buffered(), r), nil
+}
+
+// resync skips the malformed array element and creates a new json.Decoder positioned at the next element.
+// It also returns the reader the new json.Decoder reads from after the opening bracket.
+func resync(d *json.Decoder, r io.Reader) (*json.Decoder, io.Reader, error) {
+	br := bufio.NewReader(io.MultiReader(d.Buffered(), r))
+	depth := 0
+	inString := false
+	escaped := false
+	for {
+		c, err := br.ReadByte()
+		if err != nil {
+			return nil, nil, fmt.Errorf("malformed json array, could not find next element: %w", err)
+		}
+		switch {
+		case escaped:
+			escaped = false
+		case inString && c == '\\':
+			escaped = true
+		case c == '"':
+			inString = !inString
+		case inString:
+		case c == '{' || c == '[':
+			depth++
+		case (c == '}' || c == ']') && depth > 0:
+			depth--
+		case c == ']':
+			// malformed element was the last one, keep closing bracket for readBracket
+			if err := br.UnreadByte(); err != nil {
+				return nil, nil, err
+			}
+
+			fallthrough
+		case c == ',' && depth == 0:
+			d = json.NewDecoder(io.MultiReader(strings.NewReader("["), br))
+			if err := readBracket(d, "["); err != nil {
+				return nil, nil, err
+			}
+
+			return d, br, nil
+		}
+	}
 }
 
 func readBracket(d *json.Decoder, want string) error {
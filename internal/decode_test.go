@@ -0,0 +1,115 @@
+package internal_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/require"
+	"github.com/zakharovvi/aws-lambda-extensions/internal"
+)
+
+type element struct {
+	Type   string `json:"type"`
+	Record string `json:"record"`
+}
+
+func decodeElement(d *json.Decoder) (element, error) {
+	var e element
+	err := d.Decode(&e)
+
+	return e, err
+}
+
+func decodeAll(t *testing.T, input string, opts internal.DecodeOptions) ([]element, string, error) {
+	t.Helper()
+
+	ch := make(chan element, 10)
+	rest, err := internal.DecodeNoDrain(context.Background(), strings.NewReader(input), ch, decodeElement, opts)
+	close(ch)
+	var got []element
+	for e := range ch {
+		got = append(got, e)
+	}
+	if err != nil {
+		return got, "", err
+	}
+	b, readErr := io.ReadAll(rest)
+	require.NoError(t, readErr)
+
+	return got, string(b), nil
+}
+
+func TestDecodeNoDrain_Framers(t *testing.T) {
+	t.Parallel()
+
+	want := []element{
+		{"function", "first"},
+		{"extension", "second\nline"},
+		{"function", "third"},
+	}
+	tests := []struct {
+		name      string
+		framer    internal.Framer
+		input     string
+		malformed string
+		wantRest  string
+	}{
+		{
+			"json array",
+			internal.ArrayFramer{},
+			`[{"type":"function","record":"first"},` + "\n" +
+				`{"type":"extension","record":"second\nline"}, {"type":"function","record":"third"}] trailing`,
+			`[{"type":"function","record":"first"},{"type":"broken",},` +
+				`{"type":"extension","record":"second\nline"},{"type":"function","record":"third"}]`,
+			" trailing",
+		},
+		{
+			"ndjson",
+			internal.NDJSONFramer{},
+			`{"type":"function","record":"first"}` + "\n" +
+				`{"type":"extension","record":"second\nline"}` + "\n" +
+				`{"type":"function","record":"third"}` + "\n",
+			`{"type":"function","record":"first"}` + "\n" +
+				`{"type":"broken",}` + "\n" +
+				`{"type":"extension","record":"second\nline"}` + "\n" +
+				`{"type":"function","record":"third"}`,
+			// whitespace after the last element is not consumed
+			"\n",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, rest, err := decodeAll(t, tt.input, internal.DecodeOptions{Framer: tt.framer})
+			require.NoError(t, err)
+			require.Equal(t, want, got)
+			require.Equal(t, tt.wantRest, rest)
+
+			_, _, err = decodeAll(t, tt.malformed, internal.DecodeOptions{Framer: tt.framer})
+			require.Error(t, err)
+
+			got, _, err = decodeAll(t, tt.malformed, internal.DecodeOptions{Framer: tt.framer, SkipMalformed: true, Log: logr.Discard()})
+			require.NoError(t, err)
+			require.Equal(t, want, got)
+		})
+	}
+}
+
+func TestDecodeNoDrain_BlockedConsumer(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	// nobody receives from the channel like a consumer stuck in EventProcessor.Process
+	ch := make(chan element)
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := internal.DecodeNoDrain(ctx, strings.NewReader(`[{"type":"a","record":"1"}]`), ch, decodeElement, internal.DecodeOptions{})
+		errCh <- err
+	}()
+	cancel()
+	require.ErrorIs(t, <-errCh, context.Canceled)
+}
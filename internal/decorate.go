@@ -0,0 +1,32 @@
+package internal
+
+import "context"
+
+// WithFlush returns decorator of inner EventProcessor which additionally implements Flusher if inner does.
+// Flush calls flush with inner Flusher, nil flush passes Flush calls to inner unchanged.
+// It saves decorators from declaring a Flusher variant of themselves.
+func WithFlush[T any](
+	decorator, inner EventProcessor[T],
+	flush func(ctx context.Context, inner Flusher) error,
+) EventProcessor[T] {
+	innerFlusher, ok := inner.(Flusher)
+	if !ok {
+		return decorator
+	}
+	if flush == nil {
+		return &flushingProcessor[T]{decorator, innerFlusher.Flush}
+	}
+
+	return &flushingProcessor[T]{decorator, func(ctx context.Context) error {
+		return flush(ctx, innerFlusher)
+	}}
+}
+
+type flushingProcessor[T any] struct {
+	EventProcessor[T]
+	flush func(ctx context.Context) error
+}
+
+func (p *flushingProcessor[T]) Flush(ctx context.Context) error {
+	return p.flush(ctx)
+}
@@ -0,0 +1,44 @@
+package internal_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zakharovvi/aws-lambda-extensions/internal"
+)
+
+type flushingTestProcessor struct {
+	testProcessor
+	flushed []context.Context
+}
+
+func (proc *flushingTestProcessor) Flush(ctx context.Context) error {
+	proc.flushed = append(proc.flushed, ctx)
+
+	return nil
+}
+
+type flushKey struct{}
+
+func TestWithFlush(t *testing.T) {
+	t.Parallel()
+
+	decorator := testProcessor{}
+	proc := internal.WithFlush[string](decorator, testProcessor{}, nil)
+	_, ok := proc.(internal.Flusher)
+	require.False(t, ok, "inner doesn't implement Flusher")
+
+	inner := &flushingTestProcessor{}
+	proc = internal.WithFlush[string](decorator, inner, nil)
+	require.Implements(t, (*internal.Flusher)(nil), proc)
+	require.NoError(t, proc.(internal.Flusher).Flush(context.Background()))
+	require.Len(t, inner.flushed, 1)
+
+	proc = internal.WithFlush[string](decorator, inner, func(ctx context.Context, flusher internal.Flusher) error {
+		return flusher.Flush(context.WithValue(ctx, flushKey{}, "decorated"))
+	})
+	require.NoError(t, proc.(internal.Flusher).Flush(context.Background()))
+	require.Len(t, inner.flushed, 2)
+	require.Equal(t, "decorated", inner.flushed[1].Value(flushKey{}))
+}
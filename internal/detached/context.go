@@ -0,0 +1,33 @@
+// Package detached provides a context which keeps values of its parent but not its cancellation and deadline.
+// It is separate from the internal package to be usable from extapi which the internal package depends on.
+package detached
+
+import (
+	"context"
+	"time"
+)
+
+type detachedContext struct {
+	parent context.Context
+}
+
+// Context returns a context which keeps values of the parent but is never cancelled and has no deadline.
+func Context(parent context.Context) context.Context {
+	return detachedContext{parent}
+}
+
+func (ctx detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (ctx detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (ctx detachedContext) Err() error {
+	return nil
+}
+
+func (ctx detachedContext) Value(key any) any {
+	return ctx.parent.Value(key)
+}
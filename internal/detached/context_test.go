@@ -0,0 +1,26 @@
+package detached_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zakharovvi/aws-lambda-extensions/internal/detached"
+)
+
+type testKey struct{}
+
+func TestContext(t *testing.T) {
+	t.Parallel()
+
+	parent, cancel := context.WithTimeout(context.WithValue(context.Background(), testKey{}, "value"), time.Minute)
+	cancel()
+
+	ctx := detached.Context(parent)
+	require.NoError(t, ctx.Err())
+	require.Nil(t, ctx.Done())
+	_, ok := ctx.Deadline()
+	require.False(t, ok)
+	require.Equal(t, "value", ctx.Value(testKey{}))
+}
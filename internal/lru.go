@@ -0,0 +1,49 @@
+package internal
+
+import (
+	"container/list"
+	"sync"
+)
+
+// LRUSet remembers up to size recently added keys, the least recently added key is evicted first.
+// It's safe for concurrent use.
+type LRUSet[K comparable] struct {
+	mu    sync.Mutex
+	size  int
+	order *list.List
+	keys  map[K]*list.Element
+}
+
+// NewLRUSet creates LRUSet bounded by size keys. size less than 1 is treated as 1.
+func NewLRUSet[K comparable](size int) *LRUSet[K] {
+	if size < 1 {
+		size = 1
+	}
+
+	return &LRUSet[K]{
+		size:  size,
+		order: list.New(),
+		keys:  make(map[K]*list.Element, size),
+	}
+}
+
+// Add adds the key and reports whether it was already in the set.
+// A key added again is moved to the front and evicted last.
+func (s *LRUSet[K]) Add(key K) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if el, ok := s.keys[key]; ok {
+		s.order.MoveToFront(el)
+
+		return true
+	}
+	s.keys[key] = s.order.PushFront(key)
+	if s.order.Len() > s.size {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.keys, oldest.Value.(K))
+	}
+
+	return false
+}
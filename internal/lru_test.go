@@ -0,0 +1,21 @@
+package internal_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zakharovvi/aws-lambda-extensions/internal"
+)
+
+func TestLRUSet_Add(t *testing.T) {
+	t.Parallel()
+
+	s := internal.NewLRUSet[string](2)
+	require.False(t, s.Add("a"))
+	require.False(t, s.Add("b"))
+	require.True(t, s.Add("a"))
+	// "b" is the least recently added and is evicted
+	require.False(t, s.Add("c"))
+	require.True(t, s.Add("a"))
+	require.False(t, s.Add("b"))
+}
@@ -1,65 +1,216 @@
 package internal
 
 import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
 	"context"
 	"errors"
 	"fmt"
 	"io"
+	"mime"
 	"net"
 	"net/http"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-logr/logr"
 	"github.com/zakharovvi/aws-lambda-extensions/extapi"
+	"golang.org/x/sync/errgroup"
 )
 
-type eventProcessor[T any] interface {
+// EventProcessor is implemented by logsapi and telemetryapi Processor.
+type EventProcessor[T any] interface {
 	Init(ctx context.Context, registerResp *extapi.RegisterResponse) error
 	Process(ctx context.Context, event T) error
 	Shutdown(ctx context.Context, reason extapi.ShutdownReason, err error) error
 }
 
+// Flusher is implemented by event processors which support periodic flushes.
+type Flusher interface {
+	Flush(ctx context.Context) error
+}
+
 type decoder[T any] func(ctx context.Context, r io.ReadCloser, events chan<- T) error
 
 type subscriber func(ctx context.Context, client *extapi.Client, destinationURL string) error
 
+// SandboxHost is the only host Lambda API accepts in the subscription destination URL.
+const SandboxHost = "sandbox.localdomain"
+
+// CheckDestinationHost returns an error if the host of the destination address is not SandboxHost.
+func CheckDestinationHost(addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("could not parse destination address %q: %w", addr, err)
+	}
+	if host != SandboxHost {
+		return fmt.Errorf("destination host %q is not %s, Lambda API rejects subscriptions to other hosts", host, SandboxHost)
+	}
+
+	return nil
+}
+
+// WarnDestinationHost logs a warning and returns CheckDestinationHost error if Lambda API will likely reject
+// the destination host. The check is skipped if allowNonSandboxHost is set.
+// The error should be passed to WithDestinationHostHint to explain a failed subscription.
+func WarnDestinationHost(log logr.Logger, addr string, allowNonSandboxHost bool) error {
+	if allowNonSandboxHost {
+		return nil
+	}
+	hostErr := CheckDestinationHost(addr)
+	if hostErr != nil {
+		log.Info("Lambda API will likely reject the subscription", "error", hostErr.Error())
+	}
+
+	return hostErr
+}
+
+// WithDestinationHostHint adds the destination host check error to the subscribe validation error to explain it.
+func WithDestinationHostHint(err, hostErr error) error {
+	var apiErr extapi.LambdaAPIError
+	if err == nil || hostErr == nil || !errors.As(err, &apiErr) || !apiErr.IsValidation() {
+		return err
+	}
+
+	return fmt.Errorf("%w, possible cause: %v", err, hostErr)
+}
+
+// ProcessRetry configures retries of event processor Process on errors.
+type ProcessRetry struct {
+	// Attempts is the number of retries after the first failed call. Process is not retried if it is zero.
+	Attempts int
+	// Backoff is the delay before the first retry. It doubles with every next retry.
+	Backoff time.Duration
+}
+
+// AcceptRetry configures retries of the events receiving HTTP server listener Accept on errors.
+// http.Server retries temporary errors itself, AcceptRetry covers other errors, e.g. EMFILE reported as permanent.
+type AcceptRetry struct {
+	// Attempts is the number of consecutive retries after failed Accept. Accept is not retried if it is zero.
+	Attempts int
+	// Backoff is the delay before the first retry. It doubles with every next consecutive retry.
+	Backoff time.Duration
+}
+
+// maxProcessRetryDelay caps the exponential growth of the delay between Process retries.
+const maxProcessRetryDelay = time.Minute
+
+// maxAcceptRetryDelay caps the exponential growth of the delay between Accept retries,
+// the same way http.Server caps the delay between retries of temporary Accept errors.
+const maxAcceptRetryDelay = time.Second
+
+// InvokeHandler is called for every Invoke event if the extension is subscribed to them.
+type InvokeHandler func(ctx context.Context, event *extapi.NextEventResponse) error
+
 type Extension[T any] struct {
-	proc             eventProcessor[T]
+	// inProgress is the number of events received from eventsCh which EventProcessor.Process has not finished yet.
+	// It is accessed atomically and kept first for 64-bit alignment.
+	inProgress int64
+	// shutdownDeadline is the deadline of Shutdown ctx in unix nanoseconds, it is zero till Shutdown is called with a deadline
+	shutdownDeadline int64
+	proc             EventProcessor[T]
 	srv              *http.Server
+	ln               net.Listener
 	eventsCh         chan T
 	errCh            chan error
-	processingDoneCh chan struct{}
-	decodeCancel     context.CancelFunc
-	log              logr.Logger
-	decoder          decoder[T]
-	subscriber       subscriber
-}
-
-func NewExtension[T any](
-	ctx context.Context,
-	proc eventProcessor[T],
-	destinationAddr string,
-	log logr.Logger,
-	decoder decoder[T],
-	subscriber subscriber,
-) *Extension[T] {
+	// group supervises the HTTP server, event processing and asynchronous decoding goroutines started by Init.
+	// The first failed goroutine cancels groupCtx which interrupts in-flight and queued decoding.
+	group    *errgroup.Group
+	groupCtx context.Context
+	// decodeCtx is the base context of events HTTP requests. It is cancelled on Shutdown or the first goroutine failure.
+	decodeCtx     context.Context
+	decodeCancel  context.CancelFunc
+	log           logr.Logger
+	decoder       decoder[T]
+	subscriber    subscriber
+	invokeHandler InvokeHandler
+	// strictContentType rejects requests with Content-Type other than application/json
+	strictContentType bool
+	flushInterval     time.Duration
+	processRetry      ProcessRetry
+	filters           []func(event T) bool
+	// deliveries limits the number of concurrently decoded events HTTP requests. It is nil if unlimited.
+	deliveries chan struct{}
+	// asyncCh queues request bodies read by ServeHTTP for decoding in a background goroutine. It is nil if decoding is synchronous.
+	asyncCh     chan asyncDelivery
+	asyncDoneCh chan struct{}
+	asyncCancel context.CancelFunc
+	// asyncMu guards sends to asyncCh against its close, asyncClosed is set when asyncCh is closed by Shutdown.
+	// Handlers can outlive srv.Shutdown if its ctx is done first, so they check asyncClosed before sending.
+	asyncMu     sync.RWMutex
+	asyncClosed bool
+	// destinationURLCallback is called with the destination URL before subscription if set
+	destinationURLCallback func(url string)
+	acceptRetry            AcceptRetry
+	errsMu                 sync.Mutex
+	errs                   []error
+	stats                  statsTracker
+}
+
+// Config configures Extension created with NewExtension. Zero values disable the optional features.
+type Config[T any] struct {
+	Processor       EventProcessor[T]
+	DestinationAddr string
+	// Listener is a pre-bound listener of the events receiving HTTP server. DestinationAddr is listened if it is nil.
+	Listener   net.Listener
+	Log        logr.Logger
+	Decoder    decoder[T]
+	Subscriber subscriber
+	// InvokeHandler is required only if the extension is subscribed to Invoke events.
+	InvokeHandler InvokeHandler
+	// StrictContentType rejects requests with Content-Type other than application/json
+	StrictContentType bool
+	// FlushInterval enables periodic flushes of event processors implementing Flush.
+	FlushInterval time.Duration
+	ProcessRetry  ProcessRetry
+	// Filters are called once for every received event before EventProcessor.Process and its retries.
+	// The event is dropped if any of them returns false.
+	Filters []func(event T) bool
+	// MaxConcurrentDeliveries limits the number of concurrently decoded events HTTP requests if it is positive.
+	MaxConcurrentDeliveries int
+	// AsyncDecode responds to events HTTP requests before decoding the read request bodies in a background goroutine.
+	AsyncDecode bool
+	// DestinationURLCallback is called with the destination URL before subscription if set.
+	DestinationURLCallback func(url string)
+	AcceptRetry            AcceptRetry
+}
+
+func NewExtension[T any](ctx context.Context, cfg Config[T]) *Extension[T] {
 	decodeCtx, decodeCancel := context.WithCancel(ctx)
 	ext := &Extension[T]{
-		proc,
-		&http.Server{
-			Addr: destinationAddr,
+		proc: cfg.Processor,
+		srv: &http.Server{
+			Addr: cfg.DestinationAddr,
 			BaseContext: func(_ net.Listener) context.Context {
 				return decodeCtx
 			},
 			ReadHeaderTimeout: time.Second,
 		},
-		make(chan T),
-		make(chan error, 1),
-		make(chan struct{}),
-		decodeCancel,
-		log,
-		decoder,
-		subscriber,
+		ln:                cfg.Listener,
+		eventsCh:          make(chan T),
+		errCh:             make(chan error, 1),
+		decodeCtx:         decodeCtx,
+		decodeCancel:      decodeCancel,
+		log:               cfg.Log,
+		decoder:           cfg.Decoder,
+		subscriber:        cfg.Subscriber,
+		invokeHandler:     cfg.InvokeHandler,
+		strictContentType: cfg.StrictContentType,
+		flushInterval:     cfg.FlushInterval,
+		processRetry:      cfg.ProcessRetry,
+		filters:           cfg.Filters,
+
+		destinationURLCallback: cfg.DestinationURLCallback,
+		acceptRetry:            cfg.AcceptRetry,
+	}
+	if cfg.MaxConcurrentDeliveries > 0 {
+		ext.deliveries = make(chan struct{}, cfg.MaxConcurrentDeliveries)
+	}
+	if cfg.AsyncDecode {
+		ext.asyncCh = make(chan asyncDelivery, asyncQueueSize)
+		ext.asyncDoneCh = make(chan struct{})
 	}
 	ext.srv.Handler = ext
 
@@ -67,39 +218,75 @@ func NewExtension[T any](
 }
 
 func (ext *Extension[T]) Init(ctx context.Context, client *extapi.Client) error {
+	ext.group, ext.groupCtx = errgroup.WithContext(ctx)
+	// the first failed goroutine interrupts in-flight decoding requests as they can't be processed anymore
+	go func() {
+		select {
+		case <-ext.groupCtx.Done():
+			ext.decodeCancel()
+		case <-ext.decodeCtx.Done():
+		}
+	}()
 	// start log processing goroutine before EventProcessor.Init().
-	// in case of Init error ext.Shutdown is called and waits for ext.processingDoneCh to be closed in ext.startEventProcessing
-	go ext.startEventProcessing(ctx)
+	// in case of Init error ext.Shutdown is called and waits for the group including ext.startEventProcessing
+	ext.group.Go(func() error {
+		return ext.startEventProcessing(ctx)
+	})
+	if ext.asyncCh != nil {
+		var asyncCtx context.Context
+		asyncCtx, ext.asyncCancel = context.WithCancel(ext.groupCtx)
+		ext.group.Go(func() error {
+			ext.startAsyncDecoding(asyncCtx)
+
+			return nil
+		})
+	}
 
 	if err := ext.proc.Init(ctx, client.GetRegisterResponse()); err != nil {
+		if ext.ln != nil {
+			_ = ext.ln.Close()
+		}
+
 		return fmt.Errorf("EventProcessor.Init failed: %w", err)
 	}
 
 	ext.log.V(1).Info("starting event receiving HTTP server")
-	ln, err := net.Listen("tcp", ext.srv.Addr)
-	if err != nil {
-		return fmt.Errorf("could not start event receiving HTTP server: %w", err)
+	// use pre-bound listener if provided. It is closed by srv.Shutdown
+	ln := ext.ln
+	if ln == nil {
+		var err error
+		ln, err = net.Listen("tcp", ext.srv.Addr)
+		if err != nil {
+			return fmt.Errorf("could not start event receiving HTTP server: %w", err)
+		}
 	}
 
-	go func() {
+	if ext.acceptRetry.Attempts > 0 {
+		ln = newRetryListener(ln, ext.acceptRetry, ext.log)
+	}
+
+	ext.group.Go(func() error {
 		err := ext.srv.Serve(ln)
 		if !errors.Is(err, http.ErrServerClosed) {
 			err = fmt.Errorf("event receiving HTTP server failed: %w", err)
 			ext.log.Error(err, "")
-			select {
-			case ext.errCh <- err:
-			default:
-			}
-		} else {
-			ext.log.V(1).Info("event receiving HTTP server stopped")
+			ext.reportError(err)
+
+			return err
 		}
-	}()
+		ext.log.V(1).Info("event receiving HTTP server stopped")
+
+		return nil
+	})
 
 	// subscribe to lambda event
 	url, err := ext.destinationURL(ln.Addr())
 	if err != nil {
 		return fmt.Errorf("could not build url for subscribe API call: %w", err)
 	}
+	if ext.destinationURLCallback != nil {
+		ext.destinationURLCallback(url)
+	}
 
 	return ext.subscriber(ctx, client, url)
 }
@@ -122,10 +309,19 @@ func (ext *Extension[T]) destinationURL(listenerAddr net.Addr) (string, error) {
 }
 
 func (ext *Extension[T]) HandleInvokeEvent(ctx context.Context, event *extapi.NextEventResponse) error {
-	panic("unexpected HandleInvokeEvent call. Events subscriber extension supports only Shutdown events")
+	if ext.invokeHandler == nil {
+		panic("unexpected HandleInvokeEvent call. Events subscriber extension without InvokeHandler supports only Shutdown events")
+	}
+
+	return ext.invokeHandler(ctx, event)
 }
 
 func (ext *Extension[T]) Shutdown(ctx context.Context, reason extapi.ShutdownReason, err error) error {
+	// events drained after this point are processed with the shutdown deadline
+	if deadline, ok := ctx.Deadline(); ok {
+		atomic.StoreInt64(&ext.shutdownDeadline, deadline.UnixNano())
+	}
+
 	// cancel Decode context to make all in-flight and new handlers exit
 	// to prevent srv.Shutdown indefinitely waiting
 	ext.log.V(1).Info("signaling in-flight decode requests to stop")
@@ -137,7 +333,25 @@ func (ext *Extension[T]) Shutdown(ctx context.Context, reason extapi.ShutdownRea
 	srvErr := ext.srv.Shutdown(ctx)
 	if srvErr != nil {
 		srvErr = fmt.Errorf("could not gravefully shut down events receiving HTTP server: %w", srvErr)
-		ext.log.Error(err, "")
+		ext.log.Error(srvErr, "")
+	}
+
+	if ext.asyncCh != nil {
+		// handlers still running after failed srv.Shutdown see asyncClosed and don't write to asyncCh.
+		// They don't hold asyncMu for long as their request context is already cancelled with decodeCancel
+		ext.log.V(1).Info("waiting for asynchronous decoding to finish")
+		ext.asyncMu.Lock()
+		ext.asyncClosed = true
+		close(ext.asyncCh)
+		ext.asyncMu.Unlock()
+		select {
+		case <-ext.asyncDoneCh:
+		case <-ext.groupCtx.Done():
+			// event processing or HTTP server failed and queued events can't be consumed
+		case <-ctx.Done():
+		}
+		ext.asyncCancel()
+		<-ext.asyncDoneCh
 	}
 
 	// after srv.Shutdown finished there are no more writers to eventsCh and it can be safely closed
@@ -145,11 +359,18 @@ func (ext *Extension[T]) Shutdown(ctx context.Context, reason extapi.ShutdownRea
 	ext.log.V(1).Info("signaling event processing to stop")
 	close(ext.eventsCh)
 
-	// wait EventProcessor.Process to finish
-	<-ext.processingDoneCh
+	// wait EventProcessor.Process and the rest of supervised goroutines to finish, but not past the shutdown deadline.
+	// the first error has already been signaled with Err
+	if ext.group != nil {
+		ext.waitProcessing(ctx)
+	}
+
+	if errs := ext.Errors(); len(errs) > 1 {
+		ext.log.Info("multiple errors occurred, only the first one was signaled", "errors", errs)
+	}
 
 	ext.log.V(1).Info("calling EventProcessor.Shutdown")
-	procErr := ext.proc.Shutdown(ctx, reason, err)
+	procErr := ext.proc.Shutdown(contextWithStats(ctx, &ext.stats), reason, err)
 	if procErr != nil {
 		procErr = fmt.Errorf("EventProcessor.Shutdown failed: %w", procErr)
 		ext.log.Error(procErr, "")
@@ -164,6 +385,72 @@ func (ext *Extension[T]) Err() <-chan error {
 	return ext.errCh
 }
 
+// keep reports whether the event passes all filters.
+func (ext *Extension[T]) keep(event T) bool {
+	for _, filter := range ext.filters {
+		if !filter(event) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// process calls event processor Process and retries it according to ProcessRetry.
+// Retries stop early if ctx is done or its deadline is sooner than the next retry.
+func (ext *Extension[T]) process(ctx context.Context, event T) error {
+	err := ext.proc.Process(ctx, event)
+	delay := ext.processRetry.Backoff
+	for attempt := 1; err != nil && attempt <= ext.processRetry.Attempts; attempt++ {
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			return err
+		}
+		ext.log.Info("EventProcessor.Process failed, retrying", "error", err.Error(), "attempt", attempt, "delay", delay)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+
+			return err
+		}
+		err = ext.proc.Process(ctx, event)
+		if delay *= 2; delay > maxProcessRetryDelay {
+			delay = maxProcessRetryDelay
+		}
+	}
+
+	return err
+}
+
+// Stats returns counters of received events HTTP requests.
+func (ext *Extension[T]) Stats() Stats {
+	return ext.stats.get()
+}
+
+// Errors returns all errors occurred during event receiving and processing in order of occurrence.
+// Only the first one is signaled with Err to stop the extension.
+// Later errors can be more informative in case of cascading failures.
+func (ext *Extension[T]) Errors() []error {
+	ext.errsMu.Lock()
+	defer ext.errsMu.Unlock()
+
+	return append([]error(nil), ext.errs...)
+}
+
+// reportError records the error and signals it with Err if no other error has been signaled yet.
+func (ext *Extension[T]) reportError(err error) {
+	ext.errsMu.Lock()
+	ext.errs = append(ext.errs, err)
+	ext.errsMu.Unlock()
+
+	select {
+	case ext.errCh <- err:
+	default:
+	}
+}
+
 func (ext *Extension[T]) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	sequenceID := r.Header.Get("Sequence-Id")
 
@@ -171,48 +458,314 @@ func (ext *Extension[T]) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		err := fmt.Errorf("got unexpected HTTP request method %s, want POST", r.Method)
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		ext.log.Error(err, "", "sequenceID", sequenceID)
+		ext.reportError(err)
+
+		return
+	}
+
+	if ext.strictContentType {
+		if err := checkContentType(r); err != nil {
+			// requests not from Lambda API are rejected without stopping the extension
+			http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+			ext.log.Info("rejected events HTTP request", "error", err.Error(), "sequenceID", sequenceID)
+
+			return
+		}
+	}
+
+	if ext.deliveries != nil {
 		select {
-		case ext.errCh <- err:
+		case ext.deliveries <- struct{}{}:
+			defer func() { <-ext.deliveries }()
 		default:
+			// Lambda API retries the delivery later, the request is rejected without stopping the extension
+			http.Error(w, "too many concurrent events HTTP requests", http.StatusTooManyRequests)
+			ext.log.Info("rejected events HTTP request, too many concurrent deliveries", "limit", cap(ext.deliveries), "sequenceID", sequenceID)
+
+			return
 		}
+	}
 
-		return
+	if missed := ext.stats.track(sequenceID); missed > 0 {
+		ext.log.Info("detected Sequence-Id gap, Lambda dropped events as the consumer fell behind", "sequenceID", sequenceID, "missed", missed)
 	}
 
 	ext.log.V(1).Info(
 		"received events HTTP request. Starting decoding",
 		"bytes", r.Header.Get("Content-Length"),
+		"contentEncoding", r.Header.Get("Content-Encoding"),
 		"sequenceID", sequenceID,
 	)
-	if err := ext.decoder(r.Context(), r.Body, ext.eventsCh); err != nil {
+	body, err := decompressBody(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		err = fmt.Errorf("could not decompress events HTTP request body: %w", err)
+		ext.log.Error(err, "", "sequenceID", sequenceID)
+		ext.reportError(err)
+
+		return
+	}
+	if ext.asyncCh != nil {
+		ext.enqueueAsync(w, r, body, sequenceID)
+
+		return
+	}
+	ctx := context.WithValue(r.Context(), requestPathKey{}, r.URL.Path)
+	if err := ext.decoder(ctx, body, ext.eventsCh); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		err = fmt.Errorf("decoding failed or interrupted: %w", err)
 		ext.log.Error(err, "", "sequenceID", sequenceID)
-		select {
-		case ext.errCh <- err:
-		default:
-		}
+		ext.reportError(err)
 
 		return
 	}
 	ext.log.V(1).Info("events decoding finished", "sequenceID", sequenceID)
 }
 
-func (ext *Extension[T]) startEventProcessing(ctx context.Context) {
-	for event := range ext.eventsCh {
-		ext.log.V(1).Info("calling EventProcessor.Process", "event", event)
-		if err := ext.proc.Process(ctx, event); err != nil {
-			err = fmt.Errorf("EventProcessor.Process failed: %w", err)
-			ext.log.Error(err, "")
-			select {
-			case ext.errCh <- err:
-			default:
-			}
+// asyncQueueSize is the number of read request bodies waiting for asynchronous decoding before ServeHTTP blocks.
+const asyncQueueSize = 10
+
+// asyncDelivery is a request body read into memory for asynchronous decoding.
+type asyncDelivery struct {
+	body       []byte
+	path       string
+	sequenceID string
+}
+
+// enqueueAsync reads the request body into memory and queues it for decoding after the response is sent.
+func (ext *Extension[T]) enqueueAsync(w http.ResponseWriter, r *http.Request, body io.ReadCloser, sequenceID string) {
+	b, err := io.ReadAll(body)
+	_ = body.Close()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		err = fmt.Errorf("could not read events HTTP request body: %w", err)
+		ext.log.Error(err, "", "sequenceID", sequenceID)
+		ext.reportError(err)
 
-			break
+		return
+	}
+	ext.asyncMu.RLock()
+	defer ext.asyncMu.RUnlock()
+	if ext.asyncClosed {
+		http.Error(w, "events receiving HTTP server is shut down", http.StatusServiceUnavailable)
+		ext.log.Info("events HTTP request received after asynchronous decoding stopped", "sequenceID", sequenceID)
+
+		return
+	}
+	select {
+	case ext.asyncCh <- asyncDelivery{b, r.URL.Path, sequenceID}:
+		ext.log.V(1).Info("events queued for asynchronous decoding", "sequenceID", sequenceID)
+	case <-r.Context().Done():
+		http.Error(w, r.Context().Err().Error(), http.StatusServiceUnavailable)
+		ext.log.Info("events HTTP request interrupted while waiting for asynchronous decoding queue", "sequenceID", sequenceID)
+	}
+}
+
+// startAsyncDecoding decodes queued request bodies one by one to keep events in order of delivery.
+func (ext *Extension[T]) startAsyncDecoding(ctx context.Context) {
+	defer close(ext.asyncDoneCh)
+	for delivery := range ext.asyncCh {
+		decodeCtx := context.WithValue(ctx, requestPathKey{}, delivery.path)
+		if err := ext.decoder(decodeCtx, io.NopCloser(bytes.NewReader(delivery.body)), ext.eventsCh); err != nil {
+			err = fmt.Errorf("asynchronous decoding failed or interrupted: %w", err)
+			ext.log.Error(err, "", "sequenceID", delivery.sequenceID)
+			ext.reportError(err)
+
+			continue
+		}
+		ext.log.V(1).Info("events decoding finished", "sequenceID", delivery.sequenceID)
+	}
+}
+
+// retryListener retries failed Accept calls with exponential backoff according to AcceptRetry.
+// Close interrupts the backoff, so shutdown doesn't wait for it.
+type retryListener struct {
+	net.Listener
+	retry     AcceptRetry
+	log       logr.Logger
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func newRetryListener(ln net.Listener, retry AcceptRetry, log logr.Logger) *retryListener {
+	return &retryListener{Listener: ln, retry: retry, log: log, closed: make(chan struct{})}
+}
+
+func (ln *retryListener) Accept() (net.Conn, error) {
+	delay := ln.retry.Backoff
+	for attempt := 1; ; attempt++ {
+		conn, err := ln.Listener.Accept()
+		if err == nil || errors.Is(err, net.ErrClosed) || attempt > ln.retry.Attempts {
+			return conn, err
+		}
+		ln.log.Info("events receiving HTTP server accept failed, retrying", "error", err.Error(), "attempt", attempt, "delay", delay)
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ln.closed:
+			timer.Stop()
+
+			return nil, net.ErrClosed
+		}
+		if delay *= 2; delay > maxAcceptRetryDelay {
+			delay = maxAcceptRetryDelay
 		}
 	}
+}
+
+func (ln *retryListener) Close() error {
+	ln.closeOnce.Do(func() { close(ln.closed) })
 
-	ext.log.V(1).Info("event processing stopped")
-	close(ext.processingDoneCh)
+	return ln.Listener.Close()
+}
+
+type requestPathKey struct{}
+
+// RequestPath returns URL path of the events HTTP request from the ctx passed into decoder.
+// It allows a single server to receive events of different schemas on different paths.
+func RequestPath(ctx context.Context) string {
+	path, _ := ctx.Value(requestPathKey{}).(string)
+
+	return path
+}
+
+// checkContentType returns an error if request Content-Type is not application/json sent by Lambda API.
+func checkContentType(r *http.Request) error {
+	contentType := r.Header.Get("Content-Type")
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType != "application/json" {
+		return fmt.Errorf("unsupported Content-Type %q, want application/json", contentType)
+	}
+
+	return nil
+}
+
+// decompressBody wraps request body with a decompressing reader according to Content-Encoding header.
+func decompressBody(r *http.Request) (io.ReadCloser, error) {
+	var (
+		zr  io.ReadCloser
+		err error
+	)
+	switch encoding := r.Header.Get("Content-Encoding"); encoding {
+	case "", "identity":
+		return r.Body, nil
+	case "gzip", "x-gzip":
+		zr, err = gzip.NewReader(r.Body)
+	case "deflate":
+		// "deflate" content coding is zlib format according to RFC 9110
+		zr, err = zlib.NewReader(r.Body)
+	default:
+		return nil, fmt.Errorf("unsupported Content-Encoding %s", encoding)
+	}
+	if err != nil {
+		_ = r.Body.Close()
+
+		return nil, err
+	}
+
+	return &decompressedBody{zr, r.Body}, nil
+}
+
+// decompressedBody reads decompressed data and closes both decompressing reader and underlying request body.
+type decompressedBody struct {
+	io.ReadCloser
+	body io.ReadCloser
+}
+
+func (b *decompressedBody) Close() error {
+	err := b.ReadCloser.Close()
+	if bodyErr := b.body.Close(); err == nil {
+		err = bodyErr
+	}
+
+	return err
+}
+
+// waitProcessing waits for the supervised goroutines to finish till ctx is done.
+// A hung EventProcessor.Process must not block the shutdown past Lambda deadline,
+// in this case EventProcessor.Shutdown is called while Process or Flush is still in progress.
+// logsapi and telemetryapi Processor docs describe this exception to the sequential calls contract.
+func (ext *Extension[T]) waitProcessing(ctx context.Context) {
+	done := make(chan struct{})
+	go func() {
+		_ = ext.group.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		ext.log.Info(
+			"event processing did not finish before shutdown deadline, proceeding to EventProcessor.Shutdown",
+			"unprocessedEvents", atomic.LoadInt64(&ext.inProgress),
+			"error", ctx.Err().Error(),
+		)
+	}
+}
+
+// processContext returns ctx with the shutdown deadline once Shutdown is called with a deadline,
+// so EventProcessor.Process and Flush can budget I/O while draining the remaining events.
+// The returned ctx is cancelled right after the call, processors queueing events must detach it.
+func (ext *Extension[T]) processContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if deadline := atomic.LoadInt64(&ext.shutdownDeadline); deadline != 0 {
+		return context.WithDeadline(ctx, time.Unix(0, deadline))
+	}
+
+	return ctx, func() {}
+}
+
+// startEventProcessing calls EventProcessor.Process for every received event till eventsCh is closed.
+// It returns the first Process or Flush error.
+func (ext *Extension[T]) startEventProcessing(ctx context.Context) error {
+	ctx = contextWithStats(ctx, &ext.stats)
+	// periodic flushes are enabled only for processors implementing flusher
+	var tick <-chan time.Time
+	flusher, ok := ext.proc.(Flusher)
+	if ok && ext.flushInterval > 0 {
+		ticker := time.NewTicker(ext.flushInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case event, ok := <-ext.eventsCh:
+			if !ok {
+				ext.log.V(1).Info("event processing stopped")
+
+				return nil
+			}
+			if !ext.keep(event) {
+				ext.log.V(1).Info("event filtered out", "event", event)
+
+				continue
+			}
+			ext.log.V(1).Info("calling EventProcessor.Process", "event", event)
+			atomic.AddInt64(&ext.inProgress, 1)
+			processCtx, cancel := ext.processContext(ctx)
+			err := ext.process(processCtx, event)
+			cancel()
+			atomic.AddInt64(&ext.inProgress, -1)
+			if err != nil {
+				err = fmt.Errorf("EventProcessor.Process failed: %w", err)
+				ext.log.Error(err, "")
+				ext.reportError(err)
+				ext.log.V(1).Info("event processing stopped")
+
+				return err
+			}
+		case <-tick:
+			ext.log.V(1).Info("calling EventProcessor.Flush")
+			flushCtx, cancel := ext.processContext(ctx)
+			err := flusher.Flush(flushCtx)
+			cancel()
+			if err != nil {
+				err = fmt.Errorf("EventProcessor.Flush failed: %w", err)
+				ext.log.Error(err, "")
+				ext.reportError(err)
+				ext.log.V(1).Info("event processing stopped")
+
+				return err
+			}
+		}
+	}
 }
@@ -0,0 +1,643 @@
+package internal_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/require"
+	"github.com/tonglil/buflogr"
+	"github.com/zakharovvi/aws-lambda-extensions/extapi"
+	"github.com/zakharovvi/aws-lambda-extensions/internal"
+)
+
+type testProcessor struct{}
+
+func (testProcessor) Init(ctx context.Context, registerResp *extapi.RegisterResponse) error {
+	return nil
+}
+
+func (testProcessor) Process(ctx context.Context, event string) error {
+	return nil
+}
+
+func (testProcessor) Shutdown(ctx context.Context, reason extapi.ShutdownReason, err error) error {
+	return nil
+}
+
+func TestExtension_Errors(t *testing.T) {
+	decoder := func(ctx context.Context, r io.ReadCloser, events chan<- string) error {
+		defer r.Close()
+		b, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+
+		return errors.New(string(b))
+	}
+	ext := internal.NewExtension(context.Background(), internal.Config[string]{
+		Processor:         testProcessor{},
+		DestinationAddr:   "localhost:0",
+		Log:               logr.Discard(),
+		Decoder:           decoder,
+		StrictContentType: true,
+	})
+
+	for _, body := range []string{"first", "second"} {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		ext.ServeHTTP(w, req)
+		require.Equal(t, http.StatusInternalServerError, w.Code)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	w := httptest.NewRecorder()
+	ext.ServeHTTP(w, req)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+
+	errs := ext.Errors()
+	require.Len(t, errs, 3)
+	require.EqualError(t, errs[0], "decoding failed or interrupted: first")
+	require.EqualError(t, errs[1], "decoding failed or interrupted: second")
+	require.EqualError(t, errs[2], "got unexpected HTTP request method GET, want POST")
+
+	// only the first error is signaled
+	require.Equal(t, errs[0], <-ext.Err())
+	select {
+	case err := <-ext.Err():
+		require.Failf(t, "unexpected error signaled", "%v", err)
+	default:
+	}
+}
+
+func TestCheckDestinationHost(t *testing.T) {
+	require.NoError(t, internal.CheckDestinationHost("sandbox.localdomain:0"))
+	require.EqualError(
+		t,
+		internal.CheckDestinationHost("localhost:8080"),
+		`destination host "localhost" is not sandbox.localdomain, Lambda API rejects subscriptions to other hosts`,
+	)
+	require.Error(t, internal.CheckDestinationHost("sandbox.localdomain"))
+}
+
+func TestWarnDestinationHost(t *testing.T) {
+	require.NoError(t, internal.WarnDestinationHost(logr.Discard(), "sandbox.localdomain:0", false))
+	require.Equal(t, internal.CheckDestinationHost("localhost:8080"), internal.WarnDestinationHost(logr.Discard(), "localhost:8080", false))
+	require.NoError(t, internal.WarnDestinationHost(logr.Discard(), "localhost:8080", true))
+}
+
+func TestWithDestinationHostHint(t *testing.T) {
+	hostErr := internal.CheckDestinationHost("localhost:8080")
+	validationErr := fmt.Errorf("subscribe failed: %w", extapi.LambdaAPIError{Type: "ValidationError", HTTPStatusCode: http.StatusBadRequest})
+	serverErr := extapi.LambdaAPIError{HTTPStatusCode: http.StatusInternalServerError}
+
+	require.ErrorContains(t, internal.WithDestinationHostHint(validationErr, hostErr), "possible cause: destination host")
+	require.ErrorIs(t, internal.WithDestinationHostHint(validationErr, hostErr), validationErr)
+	require.Equal(t, validationErr, internal.WithDestinationHostHint(validationErr, nil))
+	require.Equal(t, error(serverErr), internal.WithDestinationHostHint(serverErr, hostErr))
+	require.NoError(t, internal.WithDestinationHostHint(nil, hostErr))
+}
+
+func TestExtension_SequenceGaps(t *testing.T) {
+	decoder := func(ctx context.Context, r io.ReadCloser, events chan<- string) error {
+		return r.Close()
+	}
+	var buf bytes.Buffer
+	ext := internal.NewExtension(context.Background(), internal.Config[string]{
+		Processor:         testProcessor{},
+		DestinationAddr:   "localhost:0",
+		Log:               buflogr.NewWithBuffer(&buf),
+		Decoder:           decoder,
+		StrictContentType: true,
+	})
+
+	for _, sequenceID := range []string{"1", "2", "5", "4", "abc", "", "6", "9"} {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("[]"))
+		req.Header.Set("Content-Type", "application/json")
+		if sequenceID != "" {
+			req.Header.Set("Sequence-Id", sequenceID)
+		}
+		w := httptest.NewRecorder()
+		ext.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+	}
+
+	require.Equal(
+		t,
+		internal.Stats{Requests: 8, LastSequenceID: 9, SequenceGaps: 2, MissedSequences: 4},
+		ext.Stats(),
+	)
+	require.Contains(t, buf.String(), "detected Sequence-Id gap, Lambda dropped events as the consumer fell behind sequenceID 5 missed 2")
+	require.Contains(t, buf.String(), "sequenceID 9 missed 2")
+
+	_, ok := internal.StatsFromContext(context.Background())
+	require.False(t, ok)
+}
+
+func TestExtension_MaxConcurrentDeliveries(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	decoder := func(ctx context.Context, r io.ReadCloser, events chan<- string) error {
+		defer r.Close()
+		started <- struct{}{}
+		<-release
+
+		return nil
+	}
+	ext := internal.NewExtension(context.Background(), internal.Config[string]{
+		Processor:               testProcessor{},
+		DestinationAddr:         "localhost:0",
+		Log:                     logr.Discard(),
+		Decoder:                 decoder,
+		StrictContentType:       true,
+		MaxConcurrentDeliveries: 2,
+	})
+	serve := func() int {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("[]"))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		ext.ServeHTTP(w, req)
+
+		return w.Code
+	}
+
+	var wg sync.WaitGroup
+	codes := make(chan int, 2)
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes <- serve()
+		}()
+	}
+	<-started
+	<-started
+
+	// the limit is reached while both in-flight requests are being decoded
+	for i := 0; i < 3; i++ {
+		require.Equal(t, http.StatusTooManyRequests, serve())
+	}
+
+	close(release)
+	wg.Wait()
+	close(codes)
+	for code := range codes {
+		require.Equal(t, http.StatusOK, code)
+	}
+
+	// slots are released after decoding
+	go func() { <-started }()
+	require.Equal(t, http.StatusOK, serve())
+	require.Empty(t, ext.Errors())
+}
+
+type blockingProcessor struct {
+	testProcessor
+	release chan struct{}
+	mu      sync.Mutex
+	events  []string
+}
+
+func (proc *blockingProcessor) Process(ctx context.Context, event string) error {
+	<-proc.release
+	proc.mu.Lock()
+	defer proc.mu.Unlock()
+	proc.events = append(proc.events, event)
+
+	return nil
+}
+
+func TestExtension_AsyncDecode(t *testing.T) {
+	decoder := func(ctx context.Context, r io.ReadCloser, events chan<- string) error {
+		defer r.Close()
+		b, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		for _, event := range strings.Fields(string(b)) {
+			select {
+			case events <- event:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		return nil
+	}
+	proc := &blockingProcessor{release: make(chan struct{})}
+	subscriber := func(ctx context.Context, client *extapi.Client, destinationURL string) error {
+		return nil
+	}
+	ext := internal.NewExtension(context.Background(), internal.Config[string]{
+		Processor:         proc,
+		DestinationAddr:   "localhost:0",
+		Log:               logr.Discard(),
+		Decoder:           decoder,
+		Subscriber:        subscriber,
+		StrictContentType: true,
+		AsyncDecode:       true,
+	})
+	require.NoError(t, ext.Init(context.Background(), nil))
+
+	for _, body := range []string{"1 2", "3", "4 5"} {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		// the handler returns while Process is blocked
+		ext.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+	}
+	require.Empty(t, proc.events)
+
+	close(proc.release)
+	require.NoError(t, ext.Shutdown(context.Background(), extapi.Spindown, nil))
+	require.Equal(t, []string{"1", "2", "3", "4", "5"}, proc.events)
+	require.Empty(t, ext.Errors())
+}
+
+func TestExtension_AsyncDecode_HandlerAfterShutdown(t *testing.T) {
+	proc := &blockingProcessor{release: make(chan struct{})}
+	close(proc.release)
+	subscriber := func(ctx context.Context, client *extapi.Client, destinationURL string) error {
+		return nil
+	}
+	ext := internal.NewExtension(context.Background(), internal.Config[string]{
+		Processor:         proc,
+		DestinationAddr:   "localhost:0",
+		Log:               logr.Discard(),
+		Decoder:           fieldsDecoder,
+		Subscriber:        subscriber,
+		StrictContentType: true,
+		AsyncDecode:       true,
+	})
+	require.NoError(t, ext.Init(context.Background(), nil))
+	require.NoError(t, ext.Shutdown(context.Background(), extapi.Spindown, nil))
+
+	// a handler which outlived srv.Shutdown, e.g. after the shutdown deadline, must not write to the closed queue
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("1"))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	require.NotPanics(t, func() { ext.ServeHTTP(w, req) })
+	require.Equal(t, http.StatusServiceUnavailable, w.Code)
+	require.Empty(t, proc.events)
+}
+
+// failingListener fails the first failures Accept calls.
+type failingListener struct {
+	net.Listener
+	mu       sync.Mutex
+	failures int
+}
+
+func (ln *failingListener) Accept() (net.Conn, error) {
+	ln.mu.Lock()
+	if ln.failures > 0 {
+		ln.failures--
+		ln.mu.Unlock()
+
+		return nil, errors.New("accept: too many open files")
+	}
+	ln.mu.Unlock()
+
+	return ln.Listener.Accept()
+}
+
+func TestExtension_AcceptRetry(t *testing.T) {
+	tests := []struct {
+		name     string
+		failures int
+		wantErr  bool
+	}{
+		{"transient failures", 2, false},
+		{"retries exhausted", 4, true},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			decoder := func(ctx context.Context, r io.ReadCloser, events chan<- string) error {
+				return r.Close()
+			}
+			subscriber := func(ctx context.Context, client *extapi.Client, destinationURL string) error {
+				return nil
+			}
+			ln, err := net.Listen("tcp", "localhost:0")
+			require.NoError(t, err)
+			ext := internal.NewExtension(context.Background(), internal.Config[string]{
+				Processor:         testProcessor{},
+				DestinationAddr:   "localhost:0",
+				Listener:          &failingListener{Listener: ln, failures: tt.failures},
+				Log:               logr.Discard(),
+				Decoder:           decoder,
+				Subscriber:        subscriber,
+				StrictContentType: true,
+				AcceptRetry:       internal.AcceptRetry{Attempts: 3, Backoff: time.Millisecond},
+			})
+			require.NoError(t, ext.Init(context.Background(), nil))
+			defer func() {
+				_ = ext.Shutdown(context.Background(), extapi.Spindown, nil)
+			}()
+
+			if tt.wantErr {
+				require.ErrorContains(t, <-ext.Err(), "accept: too many open files")
+
+				return
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://"+ln.Addr().String(), strings.NewReader("[]"))
+			require.NoError(t, err)
+			req.Header.Set("Content-Type", "application/json")
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			require.NoError(t, resp.Body.Close())
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+		})
+	}
+}
+
+func TestExtension_AcceptRetry_ShutdownDuringBackoff(t *testing.T) {
+	subscriber := func(ctx context.Context, client *extapi.Client, destinationURL string) error {
+		return nil
+	}
+	ln, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	failing := &failingListener{Listener: ln, failures: 1}
+	ext := internal.NewExtension(context.Background(), internal.Config[string]{
+		Processor:         testProcessor{},
+		DestinationAddr:   "localhost:0",
+		Listener:          failing,
+		Log:               logr.Discard(),
+		Decoder:           fieldsDecoder,
+		Subscriber:        subscriber,
+		StrictContentType: true,
+		AcceptRetry:       internal.AcceptRetry{Attempts: 1, Backoff: time.Hour},
+	})
+	require.NoError(t, ext.Init(context.Background(), nil))
+	require.Eventually(t, func() bool {
+		failing.mu.Lock()
+		defer failing.mu.Unlock()
+
+		return failing.failures == 0
+	}, 5*time.Second, time.Millisecond, "Accept must fail before Shutdown")
+
+	// Shutdown must not wait for the Accept retry backoff
+	done := make(chan error, 1)
+	go func() {
+		done <- ext.Shutdown(context.Background(), extapi.Spindown, nil)
+	}()
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "Shutdown is blocked by Accept retry backoff")
+	}
+}
+
+type failingProcessor struct {
+	testProcessor
+}
+
+func (failingProcessor) Process(ctx context.Context, event string) error {
+	return fmt.Errorf("could not process %s", event)
+}
+
+// fieldsDecoder sends every whitespace separated field of the body as an event.
+func fieldsDecoder(ctx context.Context, r io.ReadCloser, events chan<- string) error {
+	defer r.Close()
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	for _, event := range strings.Fields(string(b)) {
+		select {
+		case events <- event:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	return nil
+}
+
+func startExtension(t *testing.T, proc interface {
+	Init(ctx context.Context, registerResp *extapi.RegisterResponse) error
+	Process(ctx context.Context, event string) error
+	Shutdown(ctx context.Context, reason extapi.ShutdownReason, err error) error
+},
+) (*internal.Extension[string], string) {
+	t.Helper()
+
+	var url string
+	subscriber := func(ctx context.Context, client *extapi.Client, destinationURL string) error {
+		return nil
+	}
+	ext := internal.NewExtension(context.Background(), internal.Config[string]{
+		Processor:              proc,
+		DestinationAddr:        "localhost:0",
+		Log:                    logr.Discard(),
+		Decoder:                fieldsDecoder,
+		Subscriber:             subscriber,
+		StrictContentType:      true,
+		DestinationURLCallback: func(u string) { url = u },
+	})
+	require.NoError(t, ext.Init(context.Background(), nil))
+
+	return ext, url
+}
+
+func postEvents(url, body string) (int, error) {
+	resp, err := http.Post(url, "application/json", strings.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	return resp.StatusCode, nil
+}
+
+func TestExtension_Shutdown(t *testing.T) {
+	proc := &blockingProcessor{release: make(chan struct{})}
+	close(proc.release)
+	ext, url := startExtension(t, proc)
+
+	for _, body := range []string{"1 2", "3"} {
+		code, err := postEvents(url, body)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, code)
+	}
+
+	require.NoError(t, ext.Shutdown(context.Background(), extapi.Spindown, nil))
+	require.Equal(t, []string{"1", "2", "3"}, proc.events)
+	require.Empty(t, ext.Errors())
+	select {
+	case err := <-ext.Err():
+		require.Failf(t, "unexpected error signaled", "%v", err)
+	default:
+	}
+
+	// the server is stopped
+	_, err := postEvents(url, "4")
+	require.Error(t, err)
+}
+
+func TestExtension_ConcurrentErrors(t *testing.T) {
+	ext, url := startExtension(t, failingProcessor{})
+
+	// Process error interrupts all in-flight requests instead of blocking them till Shutdown
+	var wg sync.WaitGroup
+	codes := make([]int, 3)
+	for i := range codes {
+		i := i
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			code, err := postEvents(url, fmt.Sprintf("%d.1 %d.2", i, i))
+			require.NoError(t, err)
+			codes[i] = code
+		}()
+	}
+	wg.Wait()
+	require.Equal(t, []int{http.StatusInternalServerError, http.StatusInternalServerError, http.StatusInternalServerError}, codes)
+
+	err := <-ext.Err()
+	require.ErrorContains(t, err, "EventProcessor.Process failed: could not process")
+	require.NoError(t, ext.Shutdown(context.Background(), extapi.Spindown, nil))
+
+	errs := ext.Errors()
+	require.Equal(t, err, errs[0])
+	for _, err := range errs[1:] {
+		require.ErrorIs(t, err, context.Canceled)
+	}
+}
+
+type hangingProcessor struct {
+	testProcessor
+	release        chan struct{}
+	shutdownCalled chan struct{}
+}
+
+func (proc *hangingProcessor) Process(ctx context.Context, event string) error {
+	<-proc.release
+
+	return nil
+}
+
+func (proc *hangingProcessor) Shutdown(ctx context.Context, reason extapi.ShutdownReason, err error) error {
+	close(proc.shutdownCalled)
+
+	return nil
+}
+
+func TestExtension_ShutdownDrainDeadline(t *testing.T) {
+	var buf bytes.Buffer
+	proc := &hangingProcessor{release: make(chan struct{}), shutdownCalled: make(chan struct{})}
+	defer close(proc.release)
+	var url string
+	ext := internal.NewExtension(context.Background(), internal.Config[string]{
+		Processor:              proc,
+		DestinationAddr:        "localhost:0",
+		Log:                    buflogr.NewWithBuffer(&buf),
+		Decoder:                fieldsDecoder,
+		Subscriber:             func(ctx context.Context, client *extapi.Client, destinationURL string) error { return nil },
+		StrictContentType:      true,
+		DestinationURLCallback: func(u string) { url = u },
+	})
+	require.NoError(t, ext.Init(context.Background(), nil))
+
+	// the first event hangs in Process, the request returns after the event is received
+	code, err := postEvents(url, "1")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, code)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	done := make(chan error)
+	go func() {
+		done <- ext.Shutdown(ctx, extapi.Spindown, nil)
+	}()
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "Shutdown hangs on Process past the shutdown deadline")
+	}
+	<-proc.shutdownCalled
+	require.Contains(t, buf.String(), "event processing did not finish before shutdown deadline")
+	require.Contains(t, buf.String(), "unprocessedEvents 1")
+}
+
+// deadlineProcessor blocks Process of the first event till release and records whether events had a ctx deadline.
+type deadlineProcessor struct {
+	testProcessor
+	release     chan struct{}
+	mu          sync.Mutex
+	hasDeadline map[string]bool
+}
+
+func (proc *deadlineProcessor) Process(ctx context.Context, event string) error {
+	if event == "1" {
+		<-proc.release
+	}
+	proc.mu.Lock()
+	defer proc.mu.Unlock()
+	_, proc.hasDeadline[event] = ctx.Deadline()
+
+	return nil
+}
+
+func TestExtension_ShutdownDeadlineInProcess(t *testing.T) {
+	proc := &deadlineProcessor{release: make(chan struct{}), hasDeadline: map[string]bool{}}
+	var destinationURL string
+	ext := internal.NewExtension(context.Background(), internal.Config[string]{
+		Processor:              proc,
+		DestinationAddr:        "localhost:0",
+		Log:                    logr.Discard(),
+		Decoder:                fieldsDecoder,
+		Subscriber:             func(ctx context.Context, client *extapi.Client, destinationURL string) error { return nil },
+		StrictContentType:      true,
+		AsyncDecode:            true,
+		DestinationURLCallback: func(u string) { destinationURL = u },
+	})
+	require.NoError(t, ext.Init(context.Background(), nil))
+
+	// the first event blocks Process, the rest are queued for asynchronous decoding
+	for _, body := range []string{"1", "2 3"} {
+		code, err := postEvents(destinationURL, body)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, code)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	done := make(chan error)
+	go func() {
+		done <- ext.Shutdown(ctx, extapi.Spindown, nil)
+	}()
+	// the listener is closed after Shutdown has seen the deadline
+	u, err := url.Parse(destinationURL)
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		conn, err := net.Dial("tcp", u.Host)
+		if err == nil {
+			conn.Close()
+		}
+
+		return err != nil
+	}, 5*time.Second, time.Millisecond)
+	close(proc.release)
+	require.NoError(t, <-done)
+
+	// events drained during Shutdown see its deadline
+	require.Equal(t, map[string]bool{"1": false, "2": true, "3": true}, proc.hasDeadline)
+}
@@ -0,0 +1,129 @@
+package internal
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Stats contains counters of events HTTP requests received from Lambda API.
+type Stats struct {
+	// Requests is the number of accepted events HTTP requests.
+	Requests uint64
+	// LastSequenceID is the largest numeric Sequence-Id header value received.
+	LastSequenceID uint64
+	// SequenceGaps is the number of detected gaps between Sequence-Id headers of consecutive requests.
+	// A gap means Lambda dropped batches because the consumer fell behind.
+	SequenceGaps uint64
+	// MissedSequences is the total number of Sequence-Id values skipped in all the gaps.
+	MissedSequences uint64
+	// ProcessTimings contains aggregated durations of event processor Process calls by event type.
+	// It is populated only if process timing is enabled, e.g. with telemetryapi.WithProcessTiming.
+	ProcessTimings map[string]ProcessTiming
+}
+
+// ProcessTiming aggregates durations of event processor Process calls.
+type ProcessTiming struct {
+	// Count is the number of Process calls.
+	Count uint64
+	// Total is the sum of Process call durations.
+	Total time.Duration
+	// Max is the longest Process call duration.
+	Max time.Duration
+}
+
+// statsTracker counts requests and detects Sequence-Id gaps. It's safe for concurrent use.
+type statsTracker struct {
+	mu    sync.Mutex
+	stats Stats
+	// seen is false till the first numeric Sequence-Id is received
+	seen bool
+}
+
+// track records the request and returns the number of Sequence-Id values skipped before it.
+// Absent and non-numeric Sequence-Id values are not tracked. Repeated and out-of-order values are not gaps.
+func (t *statsTracker) track(sequenceID string) uint64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.stats.Requests++
+	id, err := strconv.ParseUint(sequenceID, 10, 64)
+	if err != nil {
+		return 0
+	}
+	if !t.seen {
+		t.seen = true
+		t.stats.LastSequenceID = id
+
+		return 0
+	}
+	if id <= t.stats.LastSequenceID {
+		return 0
+	}
+	missed := id - t.stats.LastSequenceID - 1
+	if missed > 0 {
+		t.stats.SequenceGaps++
+		t.stats.MissedSequences += missed
+	}
+	t.stats.LastSequenceID = id
+
+	return missed
+}
+
+// trackProcess adds the Process call duration to the timing of the event type.
+func (t *statsTracker) trackProcess(eventType string, d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.stats.ProcessTimings == nil {
+		t.stats.ProcessTimings = make(map[string]ProcessTiming)
+	}
+	timing := t.stats.ProcessTimings[eventType]
+	timing.Count++
+	timing.Total += d
+	if d > timing.Max {
+		timing.Max = d
+	}
+	t.stats.ProcessTimings[eventType] = timing
+}
+
+func (t *statsTracker) get() Stats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	stats := t.stats
+	if t.stats.ProcessTimings != nil {
+		stats.ProcessTimings = make(map[string]ProcessTiming, len(t.stats.ProcessTimings))
+		for eventType, timing := range t.stats.ProcessTimings {
+			stats.ProcessTimings[eventType] = timing
+		}
+	}
+
+	return stats
+}
+
+type statsKey struct{}
+
+func contextWithStats(ctx context.Context, t *statsTracker) context.Context {
+	return context.WithValue(ctx, statsKey{}, t)
+}
+
+// StatsFromContext returns Stats of the events receiving server from the ctx passed into event processor methods.
+// It returns false if the ctx doesn't carry Stats.
+func StatsFromContext(ctx context.Context) (Stats, bool) {
+	t, ok := ctx.Value(statsKey{}).(*statsTracker)
+	if !ok {
+		return Stats{}, false
+	}
+
+	return t.get(), true
+}
+
+// TrackProcessTiming adds the Process call duration of the event type to Stats carried by ctx.
+// It does nothing if the ctx doesn't carry Stats.
+func TrackProcessTiming(ctx context.Context, eventType string, d time.Duration) {
+	if t, ok := ctx.Value(statsKey{}).(*statsTracker); ok {
+		t.trackProcess(eventType, d)
+	}
+}
@@ -0,0 +1,9 @@
+// Package cwlogs implements logsapi.Processor to forward function logs into Amazon CloudWatch Logs.
+// https://docs.aws.amazon.com/AmazonCloudWatchLogs/latest/APIReference/API_PutLogEvents.html
+//
+// Processor batches logsapi.RecordFunction and logsapi.RecordExtension logs and sends them with PutLogEvents calls
+// into a single log group and log stream, for example in a central account.
+// Log.Time is used as the event timestamp and the log line as the event message. Platform logs are skipped.
+// Sequence token returned by PutLogEvents is passed into the next call.
+// The call is retried with the expected sequence token if Client returns InvalidSequenceTokenError.
+package cwlogs
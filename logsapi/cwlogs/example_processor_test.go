@@ -0,0 +1,36 @@
+package cwlogs_test
+
+import (
+	"context"
+	"log"
+
+	"github.com/zakharovvi/aws-lambda-extensions/extapi"
+	"github.com/zakharovvi/aws-lambda-extensions/logsapi"
+	"github.com/zakharovvi/aws-lambda-extensions/logsapi/cwlogs"
+)
+
+// stdoutClient prints log events instead of sending them to CloudWatch Logs.
+// Wrap cloudwatchlogs.Client from AWS SDK in the same way and convert
+// types.InvalidSequenceTokenException into cwlogs.InvalidSequenceTokenError.
+type stdoutClient struct{}
+
+func (stdoutClient) PutLogEvents(ctx context.Context, logGroupName, logStreamName string, events []cwlogs.InputLogEvent, sequenceToken string) (string, error) {
+	for _, event := range events {
+		log.Printf("%s/%s %s %s\n", logGroupName, logStreamName, event.Timestamp, event.Message)
+	}
+
+	return sequenceToken, nil
+}
+
+func ExampleNewProcessor() {
+	ctx := context.Background()
+	proc := cwlogs.NewProcessor(ctx, stdoutClient{}, "/central/lambda-logs", "my-function")
+
+	if err := logsapi.Run(
+		ctx,
+		proc,
+		logsapi.WithLogTypes([]extapi.LogSubscriptionType{extapi.LogSubscriptionTypeFunction}),
+	); err != nil {
+		log.Panic(err)
+	}
+}
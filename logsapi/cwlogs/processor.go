@@ -0,0 +1,254 @@
+package cwlogs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/zakharovvi/aws-lambda-extensions/extapi"
+	"github.com/zakharovvi/aws-lambda-extensions/logsapi"
+)
+
+// CloudWatch Logs PutLogEvents quotas.
+// https://docs.aws.amazon.com/AmazonCloudWatchLogs/latest/APIReference/API_PutLogEvents.html
+const (
+	// MaxBatchEvents is the maximum number of log events in a single PutLogEvents call.
+	MaxBatchEvents = 10000
+	// MaxBatchBytes is the maximum size of a single PutLogEvents call.
+	// The size is calculated as the sum of all event messages in UTF-8, plus EventOverheadBytes for each log event.
+	MaxBatchBytes = 1024 * 1024
+	// EventOverheadBytes is added to the message size of each log event.
+	EventOverheadBytes = 26
+	// MaxEventBytes is the maximum size of a single log event message. Longer messages are truncated.
+	MaxEventBytes = 256*1024 - EventOverheadBytes
+	// MaxBatchSpan is the maximum time span between log events in a single PutLogEvents call.
+	MaxBatchSpan = 24 * time.Hour
+)
+
+// InputLogEvent represents a log event sent to CloudWatch Logs.
+type InputLogEvent struct {
+	Timestamp time.Time
+	Message   string
+}
+
+// Client is a minimal subset of CloudWatch Logs API used by Processor.
+// Wrap cloudwatchlogs.Client from AWS SDK to implement it.
+type Client interface {
+	// PutLogEvents uploads a batch of log events in chronological order into the log stream.
+	// sequenceToken is empty for the first call. It returns the sequence token for the next call.
+	// InvalidSequenceTokenError should be returned for InvalidSequenceTokenException.
+	PutLogEvents(ctx context.Context, logGroupName, logStreamName string, events []InputLogEvent, sequenceToken string) (nextSequenceToken string, err error)
+}
+
+// InvalidSequenceTokenError is returned by Client if the sequence token is not valid.
+type InvalidSequenceTokenError struct {
+	// ExpectedSequenceToken is the sequence token to retry the call with.
+	ExpectedSequenceToken string
+}
+
+func (e *InvalidSequenceTokenError) Error() string {
+	return fmt.Sprintf("invalid sequence token, expected sequence token %q", e.ExpectedSequenceToken)
+}
+
+type Option interface {
+	apply(*options)
+}
+
+type options struct {
+	log            logr.Logger
+	maxBatchEvents int
+	maxBatchBytes  int
+	maxRetries     int
+}
+
+type loggerOption struct {
+	log logr.Logger
+}
+
+func (o loggerOption) apply(opts *options) {
+	opts.log = o.log
+}
+
+func WithLogger(log logr.Logger) Option {
+	return loggerOption{log}
+}
+
+type maxBatchEventsOption int
+
+func (o maxBatchEventsOption) apply(opts *options) {
+	opts.maxBatchEvents = int(o)
+}
+
+// WithMaxBatchEvents configures the number of buffered log events to trigger a flush. It can't exceed MaxBatchEvents.
+func WithMaxBatchEvents(n int) Option {
+	return maxBatchEventsOption(n)
+}
+
+type maxBatchBytesOption int
+
+func (o maxBatchBytesOption) apply(opts *options) {
+	opts.maxBatchBytes = int(o)
+}
+
+// WithMaxBatchBytes configures the size of buffered log events to trigger a flush. It can't exceed MaxBatchBytes.
+func WithMaxBatchBytes(n int) Option {
+	return maxBatchBytesOption(n)
+}
+
+type maxRetriesOption int
+
+func (o maxRetriesOption) apply(opts *options) {
+	opts.maxRetries = int(o)
+}
+
+// WithMaxRetries configures how many times PutLogEvents call is retried after InvalidSequenceTokenError. Default is 3.
+func WithMaxRetries(n int) Option {
+	return maxRetriesOption(n)
+}
+
+// Processor implements logsapi.Processor interface to forward function logs into CloudWatch Logs.
+// Processor should be passed into logsapi.Run instead of direct usage.
+type Processor struct {
+	client         Client
+	logGroupName   string
+	logStreamName  string
+	log            logr.Logger
+	maxBatchEvents int
+	maxBatchBytes  int
+	maxRetries     int
+	sequenceToken  string
+	batch          []InputLogEvent
+	batchBytes     int
+	// first and last are the earliest and the latest timestamps in the batch
+	first, last time.Time
+}
+
+// NewProcessor creates Processor with provided Client, log group and log stream names.
+// The log group and the log stream should exist.
+func NewProcessor(ctx context.Context, client Client, logGroupName, logStreamName string, opts ...Option) *Processor {
+	options := options{
+		log:            logr.FromContextOrDiscard(ctx),
+		maxBatchEvents: MaxBatchEvents,
+		maxBatchBytes:  MaxBatchBytes,
+		maxRetries:     3,
+	}
+	for _, o := range opts {
+		o.apply(&options)
+	}
+	if options.maxBatchEvents <= 0 || options.maxBatchEvents > MaxBatchEvents {
+		options.maxBatchEvents = MaxBatchEvents
+	}
+	if options.maxBatchBytes <= 0 || options.maxBatchBytes > MaxBatchBytes {
+		options.maxBatchBytes = MaxBatchBytes
+	}
+
+	return &Processor{
+		client:         client,
+		logGroupName:   logGroupName,
+		logStreamName:  logStreamName,
+		log:            options.log,
+		maxBatchEvents: options.maxBatchEvents,
+		maxBatchBytes:  options.maxBatchBytes,
+		maxRetries:     options.maxRetries,
+	}
+}
+
+func (proc *Processor) Init(ctx context.Context, registerResp *extapi.RegisterResponse) error {
+	return nil
+}
+
+func (proc *Processor) Process(ctx context.Context, msg logsapi.Log) error {
+	var message string
+	switch record := msg.Record.(type) {
+	case logsapi.RecordFunction:
+		message = string(record)
+	case logsapi.RecordExtension:
+		message = string(record)
+	default:
+		return nil
+	}
+	// CloudWatch Logs doesn't accept empty messages
+	if message == "" {
+		return nil
+	}
+	if len(message) > MaxEventBytes {
+		proc.log.Info("truncating log line exceeding CloudWatch Logs event size limit", "bytes", len(message))
+		message = strings.ToValidUTF8(message[:MaxEventBytes], "")
+	}
+	event := InputLogEvent{msg.Time, message}
+	size := len(message) + EventOverheadBytes
+
+	if len(proc.batch)+1 > proc.maxBatchEvents || proc.batchBytes+size > proc.maxBatchBytes || proc.exceedsSpan(event.Timestamp) {
+		if err := proc.flush(ctx); err != nil {
+			return err
+		}
+	}
+	proc.batch = append(proc.batch, event)
+	proc.batchBytes += size
+	if proc.first.IsZero() || event.Timestamp.Before(proc.first) {
+		proc.first = event.Timestamp
+	}
+	if event.Timestamp.After(proc.last) {
+		proc.last = event.Timestamp
+	}
+
+	if len(proc.batch) >= proc.maxBatchEvents {
+		return proc.flush(ctx)
+	}
+
+	return nil
+}
+
+func (proc *Processor) Shutdown(ctx context.Context, reason extapi.ShutdownReason, err error) error {
+	proc.log.V(1).Info("flushing buffered log events before shutdown", "count", len(proc.batch))
+
+	return proc.flush(ctx)
+}
+
+// exceedsSpan reports whether adding the timestamp to the batch makes it span more than MaxBatchSpan.
+func (proc *Processor) exceedsSpan(ts time.Time) bool {
+	if len(proc.batch) == 0 {
+		return false
+	}
+
+	return ts.Sub(proc.first) > MaxBatchSpan || proc.last.Sub(ts) > MaxBatchSpan
+}
+
+// flush sends buffered log events to CloudWatch Logs. Buffer is kept if the call failed to retry it on the next flush.
+func (proc *Processor) flush(ctx context.Context) error {
+	if len(proc.batch) == 0 {
+		return nil
+	}
+	// PutLogEvents requires log events in chronological order
+	sort.SliceStable(proc.batch, func(i, j int) bool {
+		return proc.batch[i].Timestamp.Before(proc.batch[j].Timestamp)
+	})
+
+	for attempt := 0; ; attempt++ {
+		proc.log.V(1).Info("sending log events to CloudWatch Logs", "count", len(proc.batch), "attempt", attempt)
+		nextToken, err := proc.client.PutLogEvents(ctx, proc.logGroupName, proc.logStreamName, proc.batch, proc.sequenceToken)
+		var tokenErr *InvalidSequenceTokenError
+		if errors.As(err, &tokenErr) && attempt < proc.maxRetries {
+			proc.log.V(1).Info("retrying with expected sequence token", "sequenceToken", tokenErr.ExpectedSequenceToken)
+			proc.sequenceToken = tokenErr.ExpectedSequenceToken
+
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("CloudWatch Logs PutLogEvents failed: %w", err)
+		}
+		proc.sequenceToken = nextToken
+
+		break
+	}
+
+	proc.batch = proc.batch[:0]
+	proc.batchBytes = 0
+	proc.first, proc.last = time.Time{}, time.Time{}
+
+	return nil
+}
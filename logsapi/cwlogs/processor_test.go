@@ -0,0 +1,173 @@
+package cwlogs_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zakharovvi/aws-lambda-extensions/extapi"
+	"github.com/zakharovvi/aws-lambda-extensions/logsapi"
+	"github.com/zakharovvi/aws-lambda-extensions/logsapi/cwlogs"
+)
+
+type putCall struct {
+	logGroupName  string
+	logStreamName string
+	events        []cwlogs.InputLogEvent
+	sequenceToken string
+}
+
+type testClient struct {
+	calls []putCall
+	errs  []error
+}
+
+func (c *testClient) PutLogEvents(ctx context.Context, logGroupName, logStreamName string, events []cwlogs.InputLogEvent, sequenceToken string) (string, error) {
+	c.calls = append(c.calls, putCall{
+		logGroupName,
+		logStreamName,
+		append([]cwlogs.InputLogEvent(nil), events...),
+		sequenceToken,
+	})
+
+	if len(c.errs) > 0 {
+		err := c.errs[0]
+		c.errs = c.errs[1:]
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return fmt.Sprintf("token-%d", len(c.calls)), nil
+}
+
+var start = time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func newLog(line string, offset time.Duration) logsapi.Log {
+	return logsapi.Log{
+		LogType: logsapi.LogFunction,
+		Time:    start.Add(offset),
+		Record:  logsapi.RecordFunction(line),
+	}
+}
+
+func TestProcessor_FlushOnShutdown(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	client := &testClient{}
+	proc := cwlogs.NewProcessor(ctx, client, "group", "stream")
+	require.NoError(t, proc.Init(ctx, &extapi.RegisterResponse{}))
+
+	require.NoError(t, proc.Process(ctx, newLog("second", time.Second)))
+	require.NoError(t, proc.Process(ctx, logsapi.Log{
+		LogType: logsapi.LogPlatformStart,
+		Time:    start,
+		Record:  logsapi.RecordPlatformStart{RequestID: "1"},
+	}))
+	require.NoError(t, proc.Process(ctx, newLog("", 0)))
+	require.NoError(t, proc.Process(ctx, logsapi.Log{
+		LogType: logsapi.LogExtension,
+		Time:    start,
+		Record:  logsapi.RecordExtension("first"),
+	}))
+	require.Empty(t, client.calls)
+
+	require.NoError(t, proc.Shutdown(ctx, extapi.Spindown, nil))
+	require.Equal(
+		t,
+		[]putCall{{
+			"group",
+			"stream",
+			[]cwlogs.InputLogEvent{{start, "first"}, {start.Add(time.Second), "second"}},
+			"",
+		}},
+		client.calls,
+		"platform and empty logs are skipped, events are sorted by time",
+	)
+}
+
+func TestProcessor_SequenceToken(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	client := &testClient{
+		errs: []error{nil, &cwlogs.InvalidSequenceTokenError{ExpectedSequenceToken: "expected"}},
+	}
+	proc := cwlogs.NewProcessor(ctx, client, "group", "stream", cwlogs.WithMaxBatchEvents(1))
+
+	require.NoError(t, proc.Process(ctx, newLog("1", 0)))
+	require.NoError(t, proc.Process(ctx, newLog("2", 0)))
+
+	require.Len(t, client.calls, 3)
+	require.Equal(t, "", client.calls[0].sequenceToken)
+	require.Equal(t, "token-1", client.calls[1].sequenceToken)
+	require.Equal(t, "expected", client.calls[2].sequenceToken, "call should be retried with expected sequence token")
+	require.Equal(t, client.calls[1].events, client.calls[2].events)
+
+	require.NoError(t, proc.Process(ctx, newLog("3", 0)))
+	require.Equal(t, "token-3", client.calls[3].sequenceToken)
+}
+
+func TestProcessor_FlushOnLimits(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		opts    []cwlogs.Option
+		offsets []time.Duration
+	}{
+		{"max batch events", []cwlogs.Option{cwlogs.WithMaxBatchEvents(2)}, []time.Duration{0, 0, 0}},
+		{"max batch bytes", []cwlogs.Option{cwlogs.WithMaxBatchBytes(2 * (1 + cwlogs.EventOverheadBytes))}, []time.Duration{0, 0, 0}},
+		{"max batch span", nil, []time.Duration{0, time.Hour, 25 * time.Hour}},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			client := &testClient{}
+			proc := cwlogs.NewProcessor(ctx, client, "group", "stream", tt.opts...)
+			for i, offset := range tt.offsets {
+				require.NoError(t, proc.Process(ctx, newLog(fmt.Sprint(i), offset)))
+			}
+			require.Len(t, client.calls, 1)
+			require.Len(t, client.calls[0].events, 2)
+		})
+	}
+}
+
+func TestProcessor_TruncateLongMessage(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	client := &testClient{}
+	proc := cwlogs.NewProcessor(ctx, client, "group", "stream")
+
+	require.NoError(t, proc.Process(ctx, newLog(strings.Repeat("a", cwlogs.MaxEventBytes+10), 0)))
+	require.NoError(t, proc.Shutdown(ctx, extapi.Spindown, nil))
+	require.Len(t, client.calls[0].events[0].Message, cwlogs.MaxEventBytes)
+}
+
+func TestProcessor_CallFailure(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	client := &testClient{
+		errs: []error{errors.New("throttled")},
+	}
+	proc := cwlogs.NewProcessor(ctx, client, "group", "stream")
+
+	require.NoError(t, proc.Process(ctx, newLog("1", 0)))
+	require.EqualError(t, proc.Shutdown(ctx, extapi.Spindown, nil), "CloudWatch Logs PutLogEvents failed: throttled")
+
+	// log events are kept in the buffer and resent on the next flush
+	require.NoError(t, proc.Shutdown(ctx, extapi.Spindown, nil))
+	require.Len(t, client.calls, 2)
+	require.Equal(t, client.calls[0].events, client.calls[1].events)
+}
@@ -1,12 +1,14 @@
 package logsapi
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"time"
 
+	"github.com/go-logr/logr"
 	lambdaext "github.com/zakharovvi/aws-lambda-extensions"
 	"github.com/zakharovvi/aws-lambda-extensions/extapi"
 	"github.com/zakharovvi/aws-lambda-extensions/internal"
@@ -56,6 +58,9 @@ type Log struct {
 	// Record property defines a struct that contains the telemetry data.
 	// The type of the struct depends on the Log.LogType
 	Record any `json:"decodedRecord,omitempty"` // tag for printing the field with json.Marshal
+	// Level is a severity of LogFunction log detected from the record content with DetectLevel.
+	// It is populated only if WithLevelDetection option is set and is empty if the level could not be detected.
+	Level Level `json:"level,omitempty"`
 }
 
 // RecordPlatformStart is the invocation start time.
@@ -74,7 +79,15 @@ type RecordPlatformReport struct {
 	Metrics   Metrics             `json:"metrics"`
 	RequestID lambdaext.RequestID `json:"requestId"`
 	// Tracing field is included if AWS X-Ray tracing is active, the log includes X-Ray metadata.
-	Tracing extapi.Tracing `json:"tracing,omitempty"`
+	Tracing TraceContext `json:"tracing,omitempty"`
+}
+
+// TraceContext describes the properties of a trace.
+// It has the same schema as telemetryapi.TraceContext.
+type TraceContext struct {
+	SpanID string                 `json:"spanId,omitempty"`
+	Type   lambdaext.TracingType  `json:"type"`
+	Value  lambdaext.TracingValue `json:"value"`
 }
 
 type Metrics struct {
@@ -135,62 +148,150 @@ type RecordExtension string
 // DecodeLogs is low-level function. Consider using Run instead and implement Processor.
 // DecodeLogs drains and closes the input stream afterwards.
 func DecodeLogs(ctx context.Context, r io.ReadCloser, logs chan<- Log) error {
-	return internal.Decode(ctx, r, logs, decodeNext)
+	return decoder{log: logr.Discard()}.decode(ctx, r, logs)
+}
+
+// DecodeLogsReader is a variant of DecodeLogs for io.Reader, e.g. bytes.Reader with a recorded payload.
+// DecodeLogsReader drains the input stream afterwards but doesn't close it.
+func DecodeLogsReader(ctx context.Context, r io.Reader, logs chan<- Log) error {
+	return DecodeLogs(ctx, io.NopCloser(r), logs)
+}
+
+// DecodeLogsNoDrain is a variant of DecodeLogs which doesn't drain and close the input stream.
+// It returns once the json array is consumed with a reader of the remaining bytes following the array,
+// as some of them can already be buffered. The remaining bytes are never read from r by DecodeLogsNoDrain itself.
+// When r is an HTTP request body, the caller is responsible to drain and close it.
+// Otherwise, the connection can't be reused for the next request with HTTP keep-alive.
+func DecodeLogsNoDrain(ctx context.Context, r io.Reader, logs chan<- Log) (io.Reader, error) {
+	dec := decoder{log: logr.Discard()}
+
+	return internal.DecodeNoDrain(ctx, r, logs, dec.decodeNext, internal.DecodeOptions{Log: dec.log})
+}
+
+// decoder holds decoding options configured with Run.
+type decoder struct {
+	dropRawRecord         bool
+	ignoreUnknownTypes    bool
+	skipMalformedRecords  bool
+	disallowUnknownFields bool
+	detectLevel           bool
+	redactor              func(Log) Log
+	log                   logr.Logger
+}
+
+func (dec decoder) decode(ctx context.Context, r io.ReadCloser, logs chan<- Log) error {
+	opts := internal.DecodeOptions{
+		SkipMalformed: dec.skipMalformedRecords,
+		Log:           dec.log,
+	}
+
+	return internal.Decode(ctx, r, logs, dec.decodeNext, opts)
 }
 
-func decodeNext(d *json.Decoder) (Log, error) {
+// unmarshalRecord decodes raw record into typed one.
+// Unknown fields in the record are reported as errors if disallowUnknownFields is set.
+func (dec decoder) unmarshalRecord(raw json.RawMessage, record any) error {
+	if !dec.disallowUnknownFields {
+		return json.Unmarshal(raw, record)
+	}
+	d := json.NewDecoder(bytes.NewReader(raw))
+	d.DisallowUnknownFields()
+
+	return d.Decode(record)
+}
+
+// rawLog has no UnmarshalJSON method to decode Log fields without Record.
+type rawLog Log
+
+// UnmarshalJSON decodes Log and its Record according to the type the same way as DecodeLogs does with default options.
+func (msg *Log) UnmarshalJSON(b []byte) error {
+	if err := json.Unmarshal(b, (*rawLog)(msg)); err != nil {
+		return err
+	}
+	decoded, err := decoder{log: logr.Discard()}.decodeRecord(*msg)
+	*msg = decoded
+
+	return err
+}
+
+func (dec decoder) decodeNext(d *json.Decoder) (Log, error) {
 	msg := Log{}
-	if err := d.Decode(&msg); err != nil {
+	if err := d.Decode((*rawLog)(&msg)); err != nil {
 		return msg, fmt.Errorf("could not decode log message from json array: %w", err)
 	}
+
+	return dec.decodeRecord(msg)
+}
+
+// decodeRecord decodes RawRecord into typed Record according to the log type.
+func (dec decoder) decodeRecord(msg Log) (Log, error) {
+	// Record is always derived from RawRecord and never decoded from json directly
+	msg.Record = nil
 	var unmarshalErr error
 	switch msg.LogType {
 	case LogPlatformStart:
 		record := RecordPlatformStart{}
-		unmarshalErr = json.Unmarshal(msg.RawRecord, &record)
+		unmarshalErr = dec.unmarshalRecord(msg.RawRecord, &record)
 		msg.Record = record
 	case LogPlatformEnd:
 		record := RecordPlatformEnd{}
-		unmarshalErr = json.Unmarshal(msg.RawRecord, &record)
+		unmarshalErr = dec.unmarshalRecord(msg.RawRecord, &record)
 		msg.Record = record
 	case LogPlatformReport:
 		record := RecordPlatformReport{}
-		unmarshalErr = json.Unmarshal(msg.RawRecord, &record)
+		unmarshalErr = dec.unmarshalRecord(msg.RawRecord, &record)
 		msg.Record = record
 	case LogPlatformExtension:
 		record := RecordPlatformExtension{}
-		unmarshalErr = json.Unmarshal(msg.RawRecord, &record)
+		unmarshalErr = dec.unmarshalRecord(msg.RawRecord, &record)
 		msg.Record = record
 	case LogPlatformLogsSubscription:
 		record := RecordPlatformLogsSubscription{}
-		unmarshalErr = json.Unmarshal(msg.RawRecord, &record)
+		unmarshalErr = dec.unmarshalRecord(msg.RawRecord, &record)
 		msg.Record = record
 	case LogPlatformLogsDropped:
 		record := RecordPlatformLogsDropped{}
-		unmarshalErr = json.Unmarshal(msg.RawRecord, &record)
+		unmarshalErr = dec.unmarshalRecord(msg.RawRecord, &record)
 		msg.Record = record
 	case LogPlatformFault:
 		record := RecordPlatformFault("")
-		unmarshalErr = json.Unmarshal(msg.RawRecord, &record)
+		unmarshalErr = dec.unmarshalRecord(msg.RawRecord, &record)
 		msg.Record = record
 	case LogPlatformRuntimeDone:
 		record := RecordPlatformRuntimeDone{}
-		unmarshalErr = json.Unmarshal(msg.RawRecord, &record)
+		unmarshalErr = dec.unmarshalRecord(msg.RawRecord, &record)
 		msg.Record = record
 	case LogFunction:
 		record := RecordFunction("")
-		unmarshalErr = json.Unmarshal(msg.RawRecord, &record)
+		unmarshalErr = dec.unmarshalRecord(msg.RawRecord, &record)
 		msg.Record = record
 	case LogExtension:
 		record := RecordExtension("")
-		unmarshalErr = json.Unmarshal(msg.RawRecord, &record)
+		unmarshalErr = dec.unmarshalRecord(msg.RawRecord, &record)
 		msg.Record = record
 	default:
+		if dec.ignoreUnknownTypes {
+			// keep RawRecord as it is the only representation of unknown log type
+			dec.log.Info("could not decode unknown log type, leaving Record empty", "type", msg.LogType, "record", string(msg.RawRecord))
+
+			return msg, nil
+		}
+
 		return msg, fmt.Errorf(`could not decode unknown log type "%s" and record "%s"`, msg.LogType, msg.RawRecord)
 	}
 	if unmarshalErr != nil {
 		return msg, fmt.Errorf("could not decode log record %s for log type %s with error: %w", msg.RawRecord, msg.LogType, unmarshalErr)
 	}
 
+	if record, ok := msg.Record.(RecordFunction); ok && dec.detectLevel {
+		msg.Level = DetectLevel(string(record))
+	}
+	if dec.redactor != nil {
+		msg = dec.redactor(msg)
+	}
+	if dec.dropRawRecord {
+		msg.RawRecord = nil
+	}
+
 	return msg, nil
 }
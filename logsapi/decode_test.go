@@ -1,6 +1,7 @@
 package logsapi_test
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"io"
@@ -58,6 +59,18 @@ func TestDecodeLogs(t *testing.T) {
 				},
 			},
 		},
+		{
+			name:              "empty array",
+			response:          `[]`,
+			wantErrorContains: "",
+			want:              nil,
+		},
+		{
+			name:              "empty array with whitespace",
+			response:          "\n[ \t\n]\n",
+			wantErrorContains: "",
+			want:              nil,
+		},
 		{
 			name: "unknown log event",
 			response: `[
@@ -211,6 +224,61 @@ func TestDecodeLogs_LogTypes(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "platform.report with tracing",
+			response: `[
+				{
+					"time": "2020-08-20T12:31:32.0Z",
+					"type": "platform.report",
+					"record": {
+						"requestId": "6f7f0961f83442118a7af6fe80b88d56",
+						"metrics": {
+							"durationMs": 101.51,
+							"billedDurationMs": 300,
+							"memorySizeMB": 512,
+							"maxMemoryUsedMB": 33
+						},
+						"tracing": {
+							"spanId": "54565fb41ac79632",
+							"type": "X-Amzn-Trace-Id",
+							"value": "Root=1-62e900b2-710d76f009d6e7785905449a;Parent=0efbd19962d95b05;Sampled=1"
+						}
+					}
+				}
+			]`,
+			want: logsapi.Log{
+				LogType: logsapi.LogPlatformReport,
+				Time:    time.Date(2020, 8, 20, 12, 31, 32, 0, time.UTC),
+				RawRecord: json.RawMessage(`{
+					"requestId": "6f7f0961f83442118a7af6fe80b88d56",
+					"metrics": {
+						"durationMs": 101.51,
+						"billedDurationMs": 300,
+						"memorySizeMB": 512,
+						"maxMemoryUsedMB": 33
+					},
+					"tracing": {
+						"spanId": "54565fb41ac79632",
+						"type": "X-Amzn-Trace-Id",
+						"value": "Root=1-62e900b2-710d76f009d6e7785905449a;Parent=0efbd19962d95b05;Sampled=1"
+					}
+				}`),
+				Record: logsapi.RecordPlatformReport{
+					RequestID: "6f7f0961f83442118a7af6fe80b88d56",
+					Metrics: logsapi.Metrics{
+						Duration:        lambdaext.DurationMs(101510 * time.Microsecond),
+						BilledDuration:  lambdaext.DurationMs(300 * time.Millisecond),
+						MemorySizeMB:    512,
+						MaxMemoryUsedMB: 33,
+					},
+					Tracing: logsapi.TraceContext{
+						SpanID: "54565fb41ac79632",
+						Type:   lambdaext.TracingTypeAWSXRay,
+						Value:  "Root=1-62e900b2-710d76f009d6e7785905449a;Parent=0efbd19962d95b05;Sampled=1",
+					},
+				},
+			},
+		},
 		{
 			name: "platform.fault",
 			response: `[
@@ -387,3 +455,49 @@ func TestDecodeLogs_LogTypes(t *testing.T) {
 		})
 	}
 }
+
+func TestLog_UnmarshalJSON(t *testing.T) {
+	data := []byte(`{
+		"time": "2020-08-20T12:31:32.123Z",
+		"type": "platform.start",
+		"record": {"requestId": "6f7f0961f83442118a7af6fe80b88d56", "version": "$LATEST"}
+	}`)
+
+	log := logsapi.Log{}
+	require.NoError(t, json.Unmarshal(data, &log))
+	require.Equal(t, logsapi.LogPlatformStart, log.LogType)
+	require.Equal(t, time.Date(2020, 8, 20, 12, 31, 32, 123000000, time.UTC), log.Time)
+	require.Equal(
+		t,
+		logsapi.RecordPlatformStart{RequestID: "6f7f0961f83442118a7af6fe80b88d56", Version: "$LATEST"},
+		log.Record,
+	)
+
+	err := json.Unmarshal([]byte(`{"time":"2020-08-20T12:31:32.123Z","type":"platform.unknown","record":{}}`), &log)
+	require.ErrorContains(t, err, `could not decode unknown log type "platform.unknown"`)
+}
+
+func TestDecodeLogsNoDrain(t *testing.T) {
+	trailer := strings.Repeat("x", 64*1024)
+	r := strings.NewReader(`[{"time":"2020-08-20T12:31:32.0Z","type":"function","record":"Hello world"}]` + trailer)
+	logs := make(chan logsapi.Log, 1)
+
+	rest, err := logsapi.DecodeLogsNoDrain(context.Background(), r, logs)
+	require.NoError(t, err)
+	require.Equal(t, logsapi.RecordFunction("Hello world"), (<-logs).Record)
+	require.NotZero(t, r.Len(), "trailing bytes must be left unread")
+
+	got, err := io.ReadAll(rest)
+	require.NoError(t, err)
+	require.Equal(t, trailer, string(got))
+}
+
+func TestDecodeLogsReader(t *testing.T) {
+	r := bytes.NewReader([]byte(`[{"time":"2020-08-20T12:31:32.0Z","type":"function","record":"Hello world"}]` + "\n"))
+	logs := make(chan logsapi.Log, 1)
+
+	err := logsapi.DecodeLogsReader(context.Background(), r, logs)
+	require.NoError(t, err)
+	require.Equal(t, logsapi.RecordFunction("Hello world"), (<-logs).Record)
+	require.Zero(t, r.Len(), "input must be drained")
+}
@@ -0,0 +1,39 @@
+package logsapi
+
+import (
+	lambdaext "github.com/zakharovvi/aws-lambda-extensions"
+	"github.com/zakharovvi/aws-lambda-extensions/internal"
+)
+
+type dedupKey struct {
+	requestID lambdaext.RequestID
+	logType   LogType
+}
+
+// newDedupFilter returns a filter dropping logs with recently seen request id and type pair.
+// Logs without request id, e.g. function and extension log lines, are always passed.
+// The filter is called once per received log before Processor.Process, so retries of a failed log are not dropped.
+func newDedupFilter(window int) func(Log) bool {
+	seen := internal.NewLRUSet[dedupKey](window)
+
+	return func(msg Log) bool {
+		requestID := logRequestID(msg)
+
+		return requestID == "" || !seen.Add(dedupKey{requestID, msg.LogType})
+	}
+}
+
+func logRequestID(msg Log) lambdaext.RequestID {
+	switch record := msg.Record.(type) {
+	case RecordPlatformStart:
+		return record.RequestID
+	case RecordPlatformEnd:
+		return record.RequestID
+	case RecordPlatformReport:
+		return record.RequestID
+	case RecordPlatformRuntimeDone:
+		return record.RequestID
+	default:
+		return ""
+	}
+}
@@ -4,7 +4,7 @@
 //
 // Deprecated: The Lambda Telemetry API supersedes the Lambda Logs API.
 // While the Logs API remains fully functional, we recommend using only the Telemetry API going forward.
-// Use telemetryapi.Run instead.
+// Use telemetryapi.Run instead. Existing Processor implementations can be run with telemetryapi.FromLogsProcessor adapter.
 // https://docs.aws.amazon.com/lambda/latest/dg/runtimes-logs-api.html
 // https://aws.amazon.com/blogs/compute/introducing-the-aws-lambda-telemetry-api/
 package logsapi
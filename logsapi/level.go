@@ -0,0 +1,84 @@
+package logsapi
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// Level is a severity of LogFunction log detected with WithLevelDetection option.
+type Level string
+
+const (
+	LevelError Level = "ERROR"
+	LevelWarn  Level = "WARN"
+	LevelInfo  Level = "INFO"
+	LevelDebug Level = "DEBUG"
+)
+
+// maxLevelTokens limits the number of leading tokens of a plain text log line inspected by DetectLevel.
+// Lambda runtimes put the level after the timestamp and the request id, e.g. "2022-10-12T00:00:00.000Z\t<requestId>\tERROR\tmessage".
+const maxLevelTokens = 4
+
+// DetectLevel returns a severity of the function log line with heuristics:
+//   - "level", "severity", "levelname" or "log.level" field of JSON structured logs, e.g. {"level":"error","msg":"failed"};
+//   - logfmt level field, e.g. level=warn msg=retrying;
+//   - one of the first upper case tokens, optionally in brackets or followed by colon,
+//     e.g. "[ERROR]\t2022-10-12T00:00:00.000Z\t<requestId>\tfailed", "WARN: retrying" or "2022-10-12T00:00:00.000Z\t<requestId>\tINFO\tstarted".
+//
+// Aliases like WARNING, FATAL, CRITICAL and TRACE are mapped to the closest Level.
+// An empty Level is returned if the level could not be detected.
+func DetectLevel(line string) Level {
+	line = strings.TrimSpace(line)
+	if strings.HasPrefix(line, "{") {
+		return detectJSONLevel(line)
+	}
+
+	for i, token := range strings.Fields(line) {
+		if i >= maxLevelTokens {
+			break
+		}
+		if value := strings.TrimPrefix(token, "level="); value != token {
+			return parseLevel(strings.ToUpper(strings.Trim(value, `"`)))
+		}
+		token = strings.TrimRight(strings.Trim(token, "[]"), ":")
+		if token != strings.ToUpper(token) {
+			continue
+		}
+		if level := parseLevel(token); level != "" {
+			return level
+		}
+	}
+
+	return ""
+}
+
+func detectJSONLevel(line string) Level {
+	fields := map[string]any{}
+	if err := json.Unmarshal([]byte(line), &fields); err != nil {
+		return ""
+	}
+	// keys are checked in order of popularity across logging libraries
+	for _, key := range []string{"level", "severity", "levelname", "log.level"} {
+		if value, ok := fields[key].(string); ok {
+			return parseLevel(strings.ToUpper(value))
+		}
+	}
+
+	return ""
+}
+
+// parseLevel maps upper case level name or its alias to Level.
+func parseLevel(name string) Level {
+	switch name {
+	case "ERROR", "ERR", "FATAL", "CRITICAL", "PANIC":
+		return LevelError
+	case "WARN", "WARNING":
+		return LevelWarn
+	case "INFO", "NOTICE":
+		return LevelInfo
+	case "DEBUG", "TRACE":
+		return LevelDebug
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,40 @@
+package logsapi_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zakharovvi/aws-lambda-extensions/logsapi"
+)
+
+func TestDetectLevel(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		line string
+		want logsapi.Level
+	}{
+		{"[ERROR]\t2022-10-12T00:00:00.000Z\t6f7f0961f83442118a7af6fe80b88d56\tsomething failed\n", logsapi.LevelError},
+		{"2022-10-12T00:00:00.000Z\t6f7f0961f83442118a7af6fe80b88d56\tINFO\tstarted\n", logsapi.LevelInfo},
+		{"WARNING: retrying", logsapi.LevelWarn},
+		{"DEBUG connection opened", logsapi.LevelDebug},
+		{"2022/10/12 00:00:00 FATAL: could not start", logsapi.LevelError},
+		{`time=2022-10-12T00:00:00Z level=warn msg="retrying"`, logsapi.LevelWarn},
+		{`{"level":"error","msg":"failed"}`, logsapi.LevelError},
+		{`{"severity":"Info","message":"started"}`, logsapi.LevelInfo},
+		{`{"levelname":"DEBUG","message":"details"}`, logsapi.LevelDebug},
+		{`{"msg":"no level"}`, ""},
+		{`{"level":"error"`, ""},
+		{"Error opening file", ""},
+		{"hello world", ""},
+		{"a b c d ERROR after too many tokens", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.line, func(t *testing.T) {
+			t.Parallel()
+			require.Equal(t, tt.want, logsapi.DetectLevel(tt.line))
+		})
+	}
+}
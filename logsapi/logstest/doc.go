@@ -0,0 +1,4 @@
+// Package logstest provides utilities for testing logsapi.Run wiring and code consuming logsapi.Processor.
+//
+// InMemoryProcessor records all received logs and allows injecting Init, Process and Shutdown errors.
+package logstest
@@ -0,0 +1,93 @@
+package logstest
+
+import (
+	"context"
+	"sync"
+
+	"github.com/zakharovvi/aws-lambda-extensions/extapi"
+	"github.com/zakharovvi/aws-lambda-extensions/logsapi"
+)
+
+// InMemoryProcessor implements logsapi.Processor which records received logs in memory.
+// Exported error fields are returned from the corresponding methods and must be set before passing the processor to Run.
+// InMemoryProcessor is safe for concurrent use.
+type InMemoryProcessor struct {
+	// InitErr is returned from Init.
+	InitErr error
+	// ProcessErrs are returned from consecutive Process calls, nil is returned after they are exhausted.
+	// The log is recorded even if an error is returned.
+	ProcessErrs []error
+	// ShutdownErr is returned from Shutdown.
+	ShutdownErr error
+
+	mu             sync.Mutex
+	registerResp   *extapi.RegisterResponse
+	logs           []logsapi.Log
+	shutdownCalled bool
+	shutdownReason extapi.ShutdownReason
+	shutdownErr    error
+}
+
+func (p *InMemoryProcessor) Init(ctx context.Context, registerResp *extapi.RegisterResponse) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.registerResp = registerResp
+
+	return p.InitErr
+}
+
+func (p *InMemoryProcessor) Process(ctx context.Context, log logsapi.Log) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.logs = append(p.logs, log)
+	if n := len(p.logs); n <= len(p.ProcessErrs) {
+		return p.ProcessErrs[n-1]
+	}
+
+	return nil
+}
+
+func (p *InMemoryProcessor) Shutdown(ctx context.Context, reason extapi.ShutdownReason, err error) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.shutdownCalled = true
+	p.shutdownReason = reason
+	p.shutdownErr = err
+
+	return p.ShutdownErr
+}
+
+// Logs returns a copy of all logs received by Process in order of arrival.
+func (p *InMemoryProcessor) Logs() []logsapi.Log {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]logsapi.Log(nil), p.logs...)
+}
+
+// RegisterResponse returns RegisterResponse passed into Init or nil if Init hasn't been called.
+func (p *InMemoryProcessor) RegisterResponse() *extapi.RegisterResponse {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.registerResp
+}
+
+// ShutdownReason returns the reason passed into Shutdown and false if Shutdown hasn't been called.
+func (p *InMemoryProcessor) ShutdownReason() (extapi.ShutdownReason, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.shutdownReason, p.shutdownCalled
+}
+
+// ShutdownError returns the error passed into Shutdown.
+func (p *InMemoryProcessor) ShutdownError() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.shutdownErr
+}
@@ -0,0 +1,30 @@
+package logstest_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zakharovvi/aws-lambda-extensions/extapi"
+	"github.com/zakharovvi/aws-lambda-extensions/logsapi"
+	"github.com/zakharovvi/aws-lambda-extensions/logsapi/logstest"
+)
+
+func TestInMemoryProcessor(t *testing.T) {
+	initErr := errors.New("init failed")
+	proc := &logstest.InMemoryProcessor{InitErr: initErr, ShutdownErr: errors.New("shutdown failed")}
+	var _ logsapi.Processor = proc
+
+	require.ErrorIs(t, proc.Init(context.Background(), nil), initErr)
+
+	log := logsapi.Log{LogType: logsapi.LogFunction, Record: logsapi.RecordFunction("hello")}
+	require.NoError(t, proc.Process(context.Background(), log))
+	require.Equal(t, []logsapi.Log{log}, proc.Logs())
+
+	require.EqualError(t, proc.Shutdown(context.Background(), extapi.Spindown, nil), "shutdown failed")
+	reason, called := proc.ShutdownReason()
+	require.True(t, called)
+	require.Equal(t, extapi.Spindown, reason)
+	require.NoError(t, proc.ShutdownError())
+}
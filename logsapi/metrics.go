@@ -0,0 +1,149 @@
+package logsapi
+
+import "context"
+
+// MetricName is the name of a metric derived from platform logs.
+type MetricName string
+
+const (
+	MetricDuration           MetricName = "lambda_duration_ms"
+	MetricBilledDuration     MetricName = "lambda_duration_billed_ms"
+	MetricInitDuration       MetricName = "lambda_duration_init_ms"
+	MetricMemorySize         MetricName = "lambda_memory_size_bytes"
+	MetricMaxMemoryUsed      MetricName = "lambda_max_memory_used_bytes"
+	MetricPlatformFaults     MetricName = "lambda_platform_faults"
+	MetricRuntimeDone        MetricName = "lambda_runtime_done"
+	MetricLogsDroppedBytes   MetricName = "lambda_logs_dropped_bytes"
+	MetricLogsDroppedRecords MetricName = "lambda_logs_dropped_records"
+)
+
+// Attribute keys of Measurement.Attributes. Values are bounded to known enum values to keep metrics cardinality low.
+const (
+	// MetricAttributeType is the LogType of the platform log the measurement is derived from.
+	MetricAttributeType = "type"
+	// MetricAttributeStatus is the RuntimeDoneStatus of MetricRuntimeDone. Unknown statuses are reported as "unknown".
+	MetricAttributeStatus = "status"
+)
+
+// MetricKind defines how measurements of the metric are aggregated.
+type MetricKind string
+
+const (
+	// MetricKindHistogram measurements are distributions of values.
+	MetricKindHistogram MetricKind = "histogram"
+	// MetricKindCounter measurements are increments of a monotonic sum.
+	MetricKindCounter MetricKind = "counter"
+)
+
+// MetricDescriptor describes a metric to create an instrument before receiving any logs.
+// Unit follows UCUM case-sensitive codes used by OpenTelemetry.
+type MetricDescriptor struct {
+	Name        MetricName
+	Kind        MetricKind
+	Unit        string
+	Description string
+}
+
+// Measurement is a single value of the metric derived from Log.
+type Measurement struct {
+	Name  MetricName
+	Value int64
+	// Attributes are labels for breaking down the metric.
+	// All measurements have MetricAttributeType, MetricRuntimeDone also has MetricAttributeStatus.
+	Attributes map[string]string
+}
+
+// MetricDescriptors returns descriptors of all metrics which can be returned by Measurements.
+func MetricDescriptors() []MetricDescriptor {
+	return []MetricDescriptor{
+		{MetricDuration, MetricKindHistogram, "ms", "the amount of time that your function's handler method spent processing the event"},
+		{MetricBilledDuration, MetricKindHistogram, "ms", "the amount of time billed for the invocation"},
+		{MetricInitDuration, MetricKindHistogram, "ms", "for the first request served, the amount of time it took the runtime to load the function and run code outside of the handler method"},
+		{MetricMemorySize, MetricKindHistogram, "By", "the amount of memory allocated to the function"},
+		{MetricMaxMemoryUsed, MetricKindHistogram, "By", "the amount of memory used by the function"},
+		{MetricPlatformFaults, MetricKindCounter, "1", "runtime or execution environment errors"},
+		{MetricRuntimeDone, MetricKindCounter, "1", "function invocation completes either successfully or with an error"},
+		{MetricLogsDroppedBytes, MetricKindCounter, "By", "dropped bytes when an extension is not able to process the number of logs that it is receiving"},
+		{MetricLogsDroppedRecords, MetricKindCounter, "1", "dropped records when an extension is not able to process the number of logs that it is receiving"},
+	}
+}
+
+// Measurements maps platform logs into metric measurements. Every metric is measured at most once per Log.
+// Durations are in milliseconds and memory sizes are in bytes. Nil is returned for logs without metrics.
+func Measurements(msg Log) []Measurement {
+	switch record := msg.Record.(type) {
+	case RecordPlatformReport:
+		const mb = 1024 * 1024
+		attrs := metricAttributes(LogPlatformReport)
+
+		return []Measurement{
+			{MetricDuration, record.Metrics.Duration.Duration().Milliseconds(), attrs},
+			{MetricBilledDuration, record.Metrics.BilledDuration.Duration().Milliseconds(), attrs},
+			{MetricInitDuration, record.Metrics.InitDuration.Duration().Milliseconds(), attrs},
+			{MetricMemorySize, int64(record.Metrics.MemorySizeMB * mb), attrs},
+			{MetricMaxMemoryUsed, int64(record.Metrics.MaxMemoryUsedMB * mb), attrs},
+		}
+	case RecordPlatformFault:
+		return []Measurement{{MetricPlatformFaults, 1, metricAttributes(LogPlatformFault)}}
+	case RecordPlatformRuntimeDone:
+		attrs := metricAttributes(LogPlatformRuntimeDone)
+		attrs[MetricAttributeStatus] = metricStatus(record.Status)
+
+		return []Measurement{{MetricRuntimeDone, 1, attrs}}
+	case RecordPlatformLogsDropped:
+		attrs := metricAttributes(LogPlatformLogsDropped)
+
+		return []Measurement{
+			{MetricLogsDroppedBytes, int64(record.DroppedBytes), attrs},
+			{MetricLogsDroppedRecords, int64(record.DroppedRecords), attrs},
+		}
+	default:
+		return nil
+	}
+}
+
+// IsInvocationEnd reports whether msg is the boundary of the function invocation to flush metrics collected for it.
+// platform.end is sent by Logs API after every invocation completes either successfully or with an error.
+// It plays the role of platform.runtimeDone of Telemetry API, log types map as follows:
+//
+//	Logs API             Telemetry API
+//	platform.start       platform.start
+//	platform.end         platform.runtimeDone
+//	platform.report      platform.report
+//
+// platform.runtimeDone of Logs API is not a boundary to flush only once per invocation.
+func IsInvocationEnd(msg Log) bool {
+	return msg.LogType == LogPlatformEnd
+}
+
+// RecordMeasurements calls record for every Measurement of msg and flush once msg is the invocation end.
+// It is a building block for metrics exporting Processor, see IsInvocationEnd.
+func RecordMeasurements(
+	ctx context.Context,
+	msg Log,
+	record func(ctx context.Context, m Measurement),
+	flush func(ctx context.Context) error,
+) error {
+	for _, m := range Measurements(msg) {
+		record(ctx, m)
+	}
+	if IsInvocationEnd(msg) {
+		return flush(ctx)
+	}
+
+	return nil
+}
+
+func metricAttributes(logType LogType) map[string]string {
+	return map[string]string{MetricAttributeType: string(logType)}
+}
+
+// metricStatus returns the status attribute value bounded to known statuses.
+func metricStatus(status RuntimeDoneStatus) string {
+	switch status {
+	case RuntimeDoneSuccess, RuntimeDoneFailure, RuntimeDoneTimeout:
+		return string(status)
+	default:
+		return "unknown"
+	}
+}
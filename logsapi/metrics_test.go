@@ -0,0 +1,121 @@
+package logsapi_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	lambdaext "github.com/zakharovvi/aws-lambda-extensions"
+	"github.com/zakharovvi/aws-lambda-extensions/logsapi"
+)
+
+func TestMeasurements(t *testing.T) {
+	tests := []struct {
+		name string
+		log  logsapi.Log
+		want []logsapi.Measurement
+	}{
+		{
+			"platform.report",
+			logsapi.Log{
+				LogType: logsapi.LogPlatformReport,
+				Record: logsapi.RecordPlatformReport{
+					Metrics: logsapi.Metrics{
+						Duration:        lambdaext.DurationMs(1.09 * float64(time.Millisecond)),
+						BilledDuration:  lambdaext.DurationMs(100 * time.Millisecond),
+						InitDuration:    lambdaext.DurationMs(87 * time.Millisecond),
+						MemorySizeMB:    128,
+						MaxMemoryUsedMB: 56,
+					},
+				},
+			},
+			[]logsapi.Measurement{
+				{Name: logsapi.MetricDuration, Value: 1, Attributes: map[string]string{"type": "platform.report"}},
+				{Name: logsapi.MetricBilledDuration, Value: 100, Attributes: map[string]string{"type": "platform.report"}},
+				{Name: logsapi.MetricInitDuration, Value: 87, Attributes: map[string]string{"type": "platform.report"}},
+				{Name: logsapi.MetricMemorySize, Value: 128 * 1024 * 1024, Attributes: map[string]string{"type": "platform.report"}},
+				{Name: logsapi.MetricMaxMemoryUsed, Value: 56 * 1024 * 1024, Attributes: map[string]string{"type": "platform.report"}},
+			},
+		},
+		{
+			"platform.fault",
+			logsapi.Log{LogType: logsapi.LogPlatformFault, Record: logsapi.RecordPlatformFault("RequestId: d783b35e Process exited")},
+			[]logsapi.Measurement{{Name: logsapi.MetricPlatformFaults, Value: 1, Attributes: map[string]string{"type": "platform.fault"}}},
+		},
+		{
+			"platform.runtimeDone",
+			logsapi.Log{LogType: logsapi.LogPlatformRuntimeDone, Record: logsapi.RecordPlatformRuntimeDone{Status: logsapi.RuntimeDoneTimeout}},
+			[]logsapi.Measurement{{Name: logsapi.MetricRuntimeDone, Value: 1, Attributes: map[string]string{"type": "platform.runtimeDone", "status": "timeout"}}},
+		},
+		{
+			"platform.runtimeDone with unknown status",
+			logsapi.Log{LogType: logsapi.LogPlatformRuntimeDone, Record: logsapi.RecordPlatformRuntimeDone{Status: "throttled"}},
+			[]logsapi.Measurement{{Name: logsapi.MetricRuntimeDone, Value: 1, Attributes: map[string]string{"type": "platform.runtimeDone", "status": "unknown"}}},
+		},
+		{
+			"platform.logsDropped",
+			logsapi.Log{LogType: logsapi.LogPlatformLogsDropped, Record: logsapi.RecordPlatformLogsDropped{DroppedBytes: 98586, DroppedRecords: 14}},
+			[]logsapi.Measurement{
+				{Name: logsapi.MetricLogsDroppedBytes, Value: 98586, Attributes: map[string]string{"type": "platform.logsDropped"}},
+				{Name: logsapi.MetricLogsDroppedRecords, Value: 14, Attributes: map[string]string{"type": "platform.logsDropped"}},
+			},
+		},
+		{
+			"function",
+			logsapi.Log{LogType: logsapi.LogFunction, Record: logsapi.RecordFunction("Hello world")},
+			nil,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, logsapi.Measurements(tt.log))
+		})
+	}
+}
+
+func TestMetricDescriptors(t *testing.T) {
+	seen := map[logsapi.MetricName]bool{}
+	for _, desc := range logsapi.MetricDescriptors() {
+		require.False(t, seen[desc.Name], "duplicated metric %s", desc.Name)
+		seen[desc.Name] = true
+		require.NotEmpty(t, desc.Unit)
+		require.NotEmpty(t, desc.Description)
+	}
+	require.Len(t, seen, 9)
+}
+
+func TestRecordMeasurements(t *testing.T) {
+	ctx := context.Background()
+	var recorded []logsapi.MetricName
+	var flushedAfter [][]logsapi.MetricName
+	record := func(ctx context.Context, m logsapi.Measurement) {
+		recorded = append(recorded, m.Name)
+	}
+	flush := func(ctx context.Context) error {
+		flushedAfter = append(flushedAfter, recorded)
+
+		return nil
+	}
+
+	logs := []logsapi.Log{
+		{LogType: logsapi.LogPlatformStart, Record: logsapi.RecordPlatformStart{RequestID: "1"}},
+		{LogType: logsapi.LogPlatformFault, Record: logsapi.RecordPlatformFault("fault")},
+		{LogType: logsapi.LogPlatformRuntimeDone, Record: logsapi.RecordPlatformRuntimeDone{RequestID: "1", Status: logsapi.RuntimeDoneSuccess}},
+		{LogType: logsapi.LogPlatformEnd, Record: logsapi.RecordPlatformEnd{RequestID: "1"}},
+		{LogType: logsapi.LogPlatformReport, Record: logsapi.RecordPlatformReport{RequestID: "1"}},
+	}
+	for _, msg := range logs {
+		require.NoError(t, logsapi.RecordMeasurements(ctx, msg, record, flush))
+	}
+
+	// platform.end flushes measurements of the invocation once, platform.runtimeDone is not a boundary
+	require.Equal(t, [][]logsapi.MetricName{{logsapi.MetricPlatformFaults, logsapi.MetricRuntimeDone}}, flushedAfter)
+	require.Len(t, recorded, 7)
+
+	flushErr := errors.New("flush failed")
+	err := logsapi.RecordMeasurements(ctx, logs[3], record, func(context.Context) error { return flushErr })
+	require.ErrorIs(t, err, flushErr)
+}
@@ -0,0 +1,31 @@
+package logsapi
+
+// RecordType returns a stable name of the Log.Record type, e.g. "RecordPlatformStart" or "RecordFunction".
+// It makes test assertions, logging and metric labels independent of the Log.LogType string.
+// An empty string is returned if the Record is nil, e.g. for unknown log types decoded with WithIgnoreUnknownTypes.
+func RecordType(log Log) string {
+	switch log.Record.(type) {
+	case RecordPlatformStart:
+		return "RecordPlatformStart"
+	case RecordPlatformEnd:
+		return "RecordPlatformEnd"
+	case RecordPlatformReport:
+		return "RecordPlatformReport"
+	case RecordPlatformExtension:
+		return "RecordPlatformExtension"
+	case RecordPlatformLogsSubscription:
+		return "RecordPlatformLogsSubscription"
+	case RecordPlatformLogsDropped:
+		return "RecordPlatformLogsDropped"
+	case RecordPlatformFault:
+		return "RecordPlatformFault"
+	case RecordPlatformRuntimeDone:
+		return "RecordPlatformRuntimeDone"
+	case RecordFunction:
+		return "RecordFunction"
+	case RecordExtension:
+		return "RecordExtension"
+	default:
+		return ""
+	}
+}
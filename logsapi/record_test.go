@@ -0,0 +1,31 @@
+package logsapi_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zakharovvi/aws-lambda-extensions/logsapi"
+)
+
+func TestRecordType(t *testing.T) {
+	tests := []struct {
+		record any
+		want   string
+	}{
+		{logsapi.RecordPlatformStart{}, "RecordPlatformStart"},
+		{logsapi.RecordPlatformEnd{}, "RecordPlatformEnd"},
+		{logsapi.RecordPlatformReport{}, "RecordPlatformReport"},
+		{logsapi.RecordPlatformExtension{}, "RecordPlatformExtension"},
+		{logsapi.RecordPlatformLogsSubscription{}, "RecordPlatformLogsSubscription"},
+		{logsapi.RecordPlatformLogsDropped{}, "RecordPlatformLogsDropped"},
+		{logsapi.RecordPlatformFault("fault"), "RecordPlatformFault"},
+		{logsapi.RecordPlatformRuntimeDone{}, "RecordPlatformRuntimeDone"},
+		{logsapi.RecordFunction("hello"), "RecordFunction"},
+		{logsapi.RecordExtension("hello"), "RecordExtension"},
+		{"plain string", ""},
+		{nil, ""},
+	}
+	for _, tt := range tests {
+		require.Equal(t, tt.want, logsapi.RecordType(logsapi.Log{Record: tt.record}))
+	}
+}
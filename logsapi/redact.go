@@ -0,0 +1,43 @@
+package logsapi
+
+import (
+	"encoding/json"
+	"regexp"
+)
+
+// RedactedMask replaces sensitive data matched by RegexRedactor.
+const RedactedMask = "****"
+
+// RegexRedactor creates a redactor for WithRecordRedactor option.
+// It replaces all matches of the provided patterns with RedactedMask in RecordFunction and RecordExtension records.
+// Log.RawRecord is updated accordingly if it's present.
+func RegexRedactor(patterns ...*regexp.Regexp) func(Log) Log {
+	return func(log Log) Log {
+		var line string
+		switch record := log.Record.(type) {
+		case RecordFunction:
+			line = redact(string(record), patterns)
+			log.Record = RecordFunction(line)
+		case RecordExtension:
+			line = redact(string(record), patterns)
+			log.Record = RecordExtension(line)
+		default:
+			return log
+		}
+
+		if log.RawRecord != nil {
+			// json.Marshal never fails for a string
+			log.RawRecord, _ = json.Marshal(line)
+		}
+
+		return log
+	}
+}
+
+func redact(line string, patterns []*regexp.Regexp) string {
+	for _, pattern := range patterns {
+		line = pattern.ReplaceAllLiteralString(line, RedactedMask)
+	}
+
+	return line
+}
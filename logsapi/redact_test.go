@@ -0,0 +1,68 @@
+package logsapi_test
+
+import (
+	"encoding/json"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zakharovvi/aws-lambda-extensions/logsapi"
+)
+
+var creditCardPattern = regexp.MustCompile(`\b\d(?:[ -]?\d){12,15}\b`)
+
+func TestRegexRedactor(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		log  logsapi.Log
+		want logsapi.Log
+	}{
+		{
+			"function",
+			logsapi.Log{
+				LogType:   logsapi.LogFunction,
+				RawRecord: json.RawMessage(`"payment with card 4111 1111 1111 1111 accepted"`),
+				Record:    logsapi.RecordFunction("payment with card 4111 1111 1111 1111 accepted"),
+			},
+			logsapi.Log{
+				LogType:   logsapi.LogFunction,
+				RawRecord: json.RawMessage(`"payment with card **** accepted"`),
+				Record:    logsapi.RecordFunction("payment with card **** accepted"),
+			},
+		},
+		{
+			"extension without raw record",
+			logsapi.Log{
+				LogType: logsapi.LogExtension,
+				Record:  logsapi.RecordExtension("card=4111111111111111"),
+			},
+			logsapi.Log{
+				LogType: logsapi.LogExtension,
+				Record:  logsapi.RecordExtension("card=****"),
+			},
+		},
+		{
+			"platform record is not changed",
+			logsapi.Log{
+				LogType:   logsapi.LogPlatformEnd,
+				RawRecord: json.RawMessage(`{"requestId":"4111111111111111"}`),
+				Record:    logsapi.RecordPlatformEnd{RequestID: "4111111111111111"},
+			},
+			logsapi.Log{
+				LogType:   logsapi.LogPlatformEnd,
+				RawRecord: json.RawMessage(`{"requestId":"4111111111111111"}`),
+				Record:    logsapi.RecordPlatformEnd{RequestID: "4111111111111111"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			redactor := logsapi.RegexRedactor(creditCardPattern)
+			require.Equal(t, tt.want, redactor(tt.log))
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package logsapi
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// OneInNSampler creates a sampler for WithFunctionLogSampler option which passes the first of every n logs.
+// All logs are passed if n is less than 2.
+func OneInNSampler(n int) func(Log) bool {
+	if n < 2 {
+		return func(Log) bool { return true }
+	}
+	var counter uint64
+
+	return func(Log) bool {
+		return (atomic.AddUint64(&counter, 1)-1)%uint64(n) == 0
+	}
+}
+
+// RateSampler creates a sampler for WithFunctionLogSampler option which passes up to perSecond logs per second
+// with bursts of at most burst logs.
+// Rate is measured by Log.Time instead of wall clock, so batches delivered with a delay are sampled the same way.
+func RateSampler(perSecond float64, burst int) func(Log) bool {
+	var (
+		mu     sync.Mutex
+		tokens = float64(burst)
+		last   time.Time
+	)
+
+	return func(log Log) bool {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if !last.IsZero() && log.Time.After(last) {
+			tokens += log.Time.Sub(last).Seconds() * perSecond
+			if tokens > float64(burst) {
+				tokens = float64(burst)
+			}
+		}
+		if last.IsZero() || log.Time.After(last) {
+			last = log.Time
+		}
+		if tokens < 1 {
+			return false
+		}
+		tokens--
+
+		return true
+	}
+}
+
+// newFunctionLogFilter returns a filter applying sampler to LogFunction and LogExtension logs.
+// Platform logs are always passed. The filter is called once per received log before Processor.Process,
+// so retries of a failed log don't ask the sampler again.
+func newFunctionLogFilter(sampler func(Log) bool) func(Log) bool {
+	return func(msg Log) bool {
+		return (msg.LogType != LogFunction && msg.LogType != LogExtension) || sampler(msg)
+	}
+}
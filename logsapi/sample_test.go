@@ -0,0 +1,42 @@
+package logsapi_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zakharovvi/aws-lambda-extensions/logsapi"
+)
+
+func TestOneInNSampler(t *testing.T) {
+	sampler := logsapi.OneInNSampler(3)
+	var got []bool
+	for i := 0; i < 7; i++ {
+		got = append(got, sampler(logsapi.Log{}))
+	}
+	require.Equal(t, []bool{true, false, false, true, false, false, true}, got)
+
+	sampler = logsapi.OneInNSampler(0)
+	require.True(t, sampler(logsapi.Log{}))
+	require.True(t, sampler(logsapi.Log{}))
+}
+
+func TestRateSampler(t *testing.T) {
+	sampler := logsapi.RateSampler(2, 2)
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) logsapi.Log {
+		return logsapi.Log{Time: start.Add(d)}
+	}
+
+	// burst
+	require.True(t, sampler(at(0)))
+	require.True(t, sampler(at(0)))
+	require.False(t, sampler(at(100*time.Millisecond)))
+	// one token is refilled after 500ms
+	require.True(t, sampler(at(500*time.Millisecond)))
+	require.False(t, sampler(at(500*time.Millisecond)))
+	// tokens are capped by burst
+	require.True(t, sampler(at(10*time.Second)))
+	require.True(t, sampler(at(10*time.Second)))
+	require.False(t, sampler(at(10*time.Second)))
+}
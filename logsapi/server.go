@@ -2,6 +2,8 @@ package logsapi
 
 import (
 	"context"
+	"net"
+	"time"
 
 	"github.com/go-logr/logr"
 	"github.com/zakharovvi/aws-lambda-extensions/extapi"
@@ -9,23 +11,61 @@ import (
 )
 
 // Processor implements client logic to process and store log messages.
+//
+// Run calls all Processor methods sequentially from a single goroutine. The only exception is the shutdown deadline:
+// if Process is still in progress when it passes, Shutdown is called concurrently with it
+// not to be killed by Lambda before Shutdown runs.
 type Processor interface {
 	// Init is called before starting receiving logs and Process.
 	// It's the best place to make network connections, warmup caches, preallocate buffers, etc.
+	// extapi.ClientFromContext returns extapi.Client from the ctx passed into all Processor methods
+	// to make additional Extensions API calls.
 	Init(ctx context.Context, registerResp *extapi.RegisterResponse) error
 	// Process stores log message in persistent storage or accumulate in a buffer and flush periodically.
+	// extapi.RegisterResponseFromContext returns RegisterResponse from the ctx passed into Process and Shutdown.
+	// The ctx has no deadline until the shutdown starts. Events still queued when the shutdown starts are processed
+	// with the Shutdown deadline, so Process can budget I/O with ctx.Deadline.
+	// The ctx is cancelled once Process returns, it must not be used by work continued asynchronously.
 	Process(ctx context.Context, event Log) error
-	// Shutdown is called before exiting the extension.
+	// Shutdown is called before exiting the extension after processing the received events or the shutdown deadline.
+	// In the latter case, Shutdown can run concurrently with the in-flight Process.
 	// Processor should flush all the buffered data to persistent storage if any and cleanup all used resources.
 	Shutdown(ctx context.Context, reason extapi.ShutdownReason, err error) error
 }
 
+// Stats contains counters of events HTTP requests received by Run.
+// Sequence-Id gaps indicate that Lambda dropped batches because the Processor fell behind.
+type Stats = internal.Stats
+
+// StatsFromContext returns Stats from the ctx passed into Processor.Process and Processor.Shutdown.
+// It returns false if the ctx doesn't carry Stats.
+func StatsFromContext(ctx context.Context) (Stats, bool) {
+	return internal.StatsFromContext(ctx)
+}
+
 type options struct {
-	log             logr.Logger
-	logTypes        []extapi.LogSubscriptionType
-	bufferingCfg    *extapi.LogsBufferingCfg
-	clientOptions   []extapi.Option
-	destinationAddr string
+	log                   logr.Logger
+	logTypes              []extapi.LogSubscriptionType
+	bufferingCfg          *extapi.LogsBufferingCfg
+	clientOptions         []extapi.Option
+	destinationAddr       string
+	allowNonSandboxHost   bool
+	destinationListener   net.Listener
+	dropRawRecord         bool
+	ignoreUnknownTypes    bool
+	skipMalformedRecords  bool
+	disallowUnknownFields bool
+	strictContentType     bool
+	recordRedactor        func(Log) Log
+	functionLogSampler    func(Log) bool
+	levelDetection        bool
+	processRetry          internal.ProcessRetry
+	// maxConcurrentDeliveries limits concurrently decoded events HTTP requests, zero means unlimited
+	maxConcurrentDeliveries int
+	asyncDecode             bool
+	destinationURLCallback  func(url string)
+	acceptRetry             internal.AcceptRetry
+	dedupWindow             int
 }
 
 type loggerOption struct {
@@ -85,22 +125,237 @@ func (o destinationAddrOption) apply(opts *options) {
 }
 
 // WithDestinationAddr configures host and port for logs receiving HTTP server to listen
-// Lambda API accepts only "sandbox.localdomain" host.
+// Lambda API accepts only "sandbox.localdomain" host. Run logs a warning for other hosts unless WithAllowNonSandboxHost is set.
 func WithDestinationAddr(addr string) Option {
 	return destinationAddrOption(addr)
 }
 
+type allowNonSandboxHostOption bool
+
+func (o allowNonSandboxHostOption) apply(opts *options) {
+	opts.allowNonSandboxHost = bool(o)
+}
+
+// WithAllowNonSandboxHost disables the warning logged by Run if WithDestinationAddr host is not "sandbox.localdomain".
+// Useful in tests and local environments which accept other hosts.
+func WithAllowNonSandboxHost(allow bool) Option {
+	return allowNonSandboxHostOption(allow)
+}
+
+type destinationListenerOption struct {
+	ln net.Listener
+}
+
+func (o destinationListenerOption) apply(opts *options) {
+	opts.destinationListener = o.ln
+}
+
+// WithDestinationListener configures pre-bound listener for logs receiving HTTP server to use instead of binding WithDestinationAddr.
+// Host from WithDestinationAddr and port from the listener are used to build the destination URL for the subscription.
+// Run takes ownership of the listener and closes it on shutdown.
+func WithDestinationListener(ln net.Listener) Option {
+	return destinationListenerOption{ln}
+}
+
+type destinationURLCallbackOption func(url string)
+
+func (o destinationURLCallbackOption) apply(opts *options) {
+	opts.destinationURLCallback = o
+}
+
+// WithDestinationURLCallback configures a callback receiving the destination URL of the subscription
+// after the logs receiving HTTP server starts listening, e.g. http://sandbox.localdomain:41837.
+// It reports the actual port if WithDestinationAddr port is 0. Useful for diagnostics and tests.
+func WithDestinationURLCallback(fn func(url string)) Option {
+	return destinationURLCallbackOption(fn)
+}
+
+type dropRawRecordOption bool
+
+func (o dropRawRecordOption) apply(opts *options) {
+	opts.dropRawRecord = bool(o)
+}
+
+// WithDropRawRecord configures Run to clear Log.RawRecord after decoding the typed Log.Record.
+// It reduces memory usage for processors which don't need raw json. RawRecord is kept by default.
+func WithDropRawRecord(drop bool) Option {
+	return dropRawRecordOption(drop)
+}
+
+type ignoreUnknownTypesOption bool
+
+func (o ignoreUnknownTypesOption) apply(opts *options) {
+	opts.ignoreUnknownTypes = bool(o)
+}
+
+// WithIgnoreUnknownTypes enables lenient decoding mode.
+// Logs of unknown types are passed to Processor with nil Record and preserved RawRecord instead of failing the extension.
+// It protects deployed extensions from new log types introduced by AWS. Decoding is strict by default.
+func WithIgnoreUnknownTypes(ignore bool) Option {
+	return ignoreUnknownTypesOption(ignore)
+}
+
+type skipMalformedRecordsOption bool
+
+func (o skipMalformedRecordsOption) apply(opts *options) {
+	opts.skipMalformedRecords = bool(o)
+}
+
+// WithSkipMalformedRecords configures decoding to log and skip logs which could not be decoded
+// and continue with the next log in the batch instead of failing the extension.
+func WithSkipMalformedRecords(skip bool) Option {
+	return skipMalformedRecordsOption(skip)
+}
+
+type strictContentTypeOption bool
+
+func (o strictContentTypeOption) apply(opts *options) {
+	opts.strictContentType = bool(o)
+}
+
+// WithStrictContentType configures logs receiving HTTP server to reject requests with Content-Type other than application/json
+// with 415 Unsupported Media Type status without decoding them and failing the extension.
+// It protects from unrelated requests like health checks. The check is enabled by default.
+func WithStrictContentType(strict bool) Option {
+	return strictContentTypeOption(strict)
+}
+
+type disallowUnknownFieldsOption bool
+
+func (o disallowUnknownFieldsOption) apply(opts *options) {
+	opts.disallowUnknownFields = bool(o)
+}
+
+// WithDisallowUnknownFields enables strict decoding mode of records with json.Decoder.DisallowUnknownFields.
+// Fields not defined in the typed Record struct are reported as decoding errors naming the log type and the field.
+// It helps to catch AWS schema changes early in tests. Unknown fields are ignored by default.
+func WithDisallowUnknownFields(disallow bool) Option {
+	return disallowUnknownFieldsOption(disallow)
+}
+
+type recordRedactorOption func(Log) Log
+
+func (o recordRedactorOption) apply(opts *options) {
+	opts.recordRedactor = o
+}
+
+// WithRecordRedactor configures a function applied to every Log after decoding and before Processor.Process.
+// It can mutate Log.Record and Log.RawRecord to scrub sensitive data before it leaves the sandbox.
+// See RegexRedactor for a ready to use implementation.
+func WithRecordRedactor(redactor func(Log) Log) Option {
+	return recordRedactorOption(redactor)
+}
+
+type dedupOption int
+
+func (o dedupOption) apply(opts *options) {
+	opts.dedupWindow = int(o)
+}
+
+// WithDedup configures Run to drop platform logs with the same request id and type as one of window
+// recently seen logs before Processor.Process, e.g. when Lambda redelivers a batch.
+// Memory is bounded by window pairs, the least recently seen pair is forgotten first.
+// Logs without request id, e.g. function and extension log lines, are never dropped. Dedup is disabled by default.
+func WithDedup(window int) Option {
+	return dedupOption(window)
+}
+
+type functionLogSamplerOption func(Log) bool
+
+func (o functionLogSamplerOption) apply(opts *options) {
+	opts.functionLogSampler = o
+}
+
+// WithFunctionLogSampler configures a sampler applied to LogFunction and LogExtension logs before Processor.Process.
+// Logs for which the sampler returns false never reach the Processor. Platform logs are always passed through.
+// The sampler is called once per log, retries with WithProcessRetry don't ask it again.
+// See OneInNSampler and RateSampler for ready to use implementations.
+func WithFunctionLogSampler(sampler func(Log) bool) Option {
+	return functionLogSamplerOption(sampler)
+}
+
+type levelDetectionOption bool
+
+func (o levelDetectionOption) apply(opts *options) {
+	opts.levelDetection = bool(o)
+}
+
+// WithLevelDetection configures Run to populate Log.Level of LogFunction logs with DetectLevel.
+// Detection is heuristic and based on common log line formats, so Log.Level is left empty if the level is not recognized.
+// It is disabled by default.
+func WithLevelDetection(detect bool) Option {
+	return levelDetectionOption(detect)
+}
+
+type processRetryOption internal.ProcessRetry
+
+func (o processRetryOption) apply(opts *options) {
+	opts.processRetry = internal.ProcessRetry(o)
+}
+
+// WithProcessRetry configures Run to retry Processor.Process up to attempts times if it returns an error,
+// e.g. to recover from transient failures of the downstream sink.
+// Delay before each retry doubles starting from backoff. Retries stop early if the delay exceeds the context deadline.
+// Run fails with the last error after retries are exhausted. Process is not retried by default.
+func WithProcessRetry(attempts int, backoff time.Duration) Option {
+	return processRetryOption{Attempts: attempts, Backoff: backoff}
+}
+
+type maxConcurrentDeliveriesOption int
+
+func (o maxConcurrentDeliveriesOption) apply(opts *options) {
+	opts.maxConcurrentDeliveries = int(o)
+}
+
+// WithMaxConcurrentDeliveries limits the number of events HTTP requests decoded concurrently.
+// Requests over the limit are rejected with 429 Too Many Requests status code and retried by Lambda API later.
+// Lambda API delivers events sequentially, so the limit protects the extension from unbounded goroutine growth
+// caused by misbehaving clients. The number of concurrent deliveries is unlimited by default.
+func WithMaxConcurrentDeliveries(n int) Option {
+	return maxConcurrentDeliveriesOption(n)
+}
+
+type serverAcceptRetriesOption internal.AcceptRetry
+
+func (o serverAcceptRetriesOption) apply(opts *options) {
+	opts.acceptRetry = internal.AcceptRetry(o)
+}
+
+// WithServerAcceptRetries configures the receiving HTTP server to retry accepting connections up to attempts times
+// after consecutive failures, e.g. when the process runs out of file descriptors. The delay between attempts starts
+// with backoff and doubles after every failed attempt. The server stops and Run fails on the first error by default.
+func WithServerAcceptRetries(attempts int, backoff time.Duration) Option {
+	return serverAcceptRetriesOption{Attempts: attempts, Backoff: backoff}
+}
+
+type asyncDecodeOption bool
+
+func (o asyncDecodeOption) apply(opts *options) {
+	opts.asyncDecode = bool(o)
+}
+
+// WithAsyncDecode configures the events HTTP server to read the request body into memory and respond
+// before decoding to minimize the time Lambda API delivery request is held open. It trades memory for faster ack.
+// Deliveries are decoded in order of arrival and all of them are processed before Processor.Shutdown call.
+// Decoding errors can't be returned to Lambda API and stop the extension. Decoding is synchronous by default.
+func WithAsyncDecode(enable bool) Option {
+	return asyncDecodeOption(enable)
+}
+
 // Run runs the Processor.
 // Run blocks the current goroutine till extension lifecycle is finished or error occurs.
 func Run(ctx context.Context, proc Processor, opts ...Option) error {
 	options := options{
-		destinationAddr: "sandbox.localdomain:0",
-		log:             logr.FromContextOrDiscard(ctx),
+		destinationAddr:   "sandbox.localdomain:0",
+		strictContentType: true,
+		log:               logr.FromContextOrDiscard(ctx),
 	}
 	for _, o := range opts {
 		o.apply(&options)
 	}
 
+	hostErr := internal.WarnDestinationHost(options.log, options.destinationAddr, options.allowNonSandboxHost)
+
 	subscriber := func(ctx context.Context, client *extapi.Client, destinationURL string) error {
 		options.log.V(1).Info(
 			"calling Client.LogsSubscribe",
@@ -110,17 +365,40 @@ func Run(ctx context.Context, proc Processor, opts ...Option) error {
 		)
 		req := extapi.NewLogsSubscribeRequest(destinationURL, options.logTypes, options.bufferingCfg)
 
-		return client.LogsSubscribe(ctx, req)
+		return internal.WithDestinationHostHint(client.LogsSubscribe(ctx, req), hostErr)
+	}
+
+	var filters []func(Log) bool
+	if options.functionLogSampler != nil {
+		filters = append(filters, newFunctionLogFilter(options.functionLogSampler))
+	}
+	if options.dedupWindow > 0 {
+		filters = append(filters, newDedupFilter(options.dedupWindow))
 	}
 
-	ext := internal.NewExtension[Log](
-		ctx,
-		proc,
-		options.destinationAddr,
-		options.log,
-		DecodeLogs,
-		subscriber,
-	)
+	ext := internal.NewExtension(ctx, internal.Config[Log]{
+		Processor:       proc,
+		DestinationAddr: options.destinationAddr,
+		Listener:        options.destinationListener,
+		Log:             options.log,
+		Decoder: decoder{
+			dropRawRecord:         options.dropRawRecord,
+			ignoreUnknownTypes:    options.ignoreUnknownTypes,
+			skipMalformedRecords:  options.skipMalformedRecords,
+			disallowUnknownFields: options.disallowUnknownFields,
+			detectLevel:           options.levelDetection,
+			redactor:              options.recordRedactor,
+			log:                   options.log,
+		}.decode,
+		Subscriber:              subscriber,
+		StrictContentType:       options.strictContentType,
+		ProcessRetry:            options.processRetry,
+		Filters:                 filters,
+		MaxConcurrentDeliveries: options.maxConcurrentDeliveries,
+		AsyncDecode:             options.asyncDecode,
+		DestinationURLCallback:  options.destinationURLCallback,
+		AcceptRetry:             options.acceptRetry,
+	})
 
 	// subscribe only to shutdown events
 	options.clientOptions = append(options.clientOptions, extapi.WithEventTypes([]extapi.EventType{extapi.Shutdown}))
@@ -5,8 +5,10 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"regexp"
 	"testing"
 	"time"
 
@@ -71,6 +73,7 @@ func (proc *testProcessor) Shutdown(ctx context.Context, reason extapi.ShutdownR
 type lambdaAPIMock struct {
 	t                   *testing.T
 	wantDestinationURI  string
+	contentType         string
 	logsRequests        [][]byte
 	wantLogsResponses   []int
 	logsSubscribeStatus int
@@ -93,6 +96,11 @@ func (h *lambdaAPIMock) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		for _, logs := range h.logsRequests {
 			req, err := http.NewRequestWithContext(r.Context(), http.MethodPost, h.wantDestinationURI, bytes.NewReader(logs))
 			require.NoError(h.t, err)
+			contentType := "application/json"
+			if h.contentType != "" {
+				contentType = h.contentType
+			}
+			req.Header.Set("Content-Type", contentType)
 
 			resp, err := http.DefaultClient.Do(req)
 			// request context can be cancelled for test cases with injected failures
@@ -209,24 +217,28 @@ func TestRun(t *testing.T) {
 					time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
 					json.RawMessage(`{"requestId":"1.1"}`),
 					logsapi.RecordPlatformEnd{"1.1"},
+					"",
 				},
 				{
 					logsapi.LogPlatformEnd,
 					time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
 					json.RawMessage(`{"requestId":"1.2"}`),
 					logsapi.RecordPlatformEnd{"1.2"},
+					"",
 				},
 				{
 					logsapi.LogPlatformEnd,
 					time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
 					json.RawMessage(`{"requestId":"2.1"}`),
 					logsapi.RecordPlatformEnd{"2.1"},
+					"",
 				},
 				{
 					logsapi.LogPlatformEnd,
 					time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
 					json.RawMessage(`{"requestId":"2.2"}`),
 					logsapi.RecordPlatformEnd{"2.2"},
+					"",
 				},
 			},
 			nil,
@@ -252,6 +264,7 @@ func TestRun(t *testing.T) {
 					time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
 					json.RawMessage(`{"requestId":"1.1"}`),
 					logsapi.RecordPlatformEnd{"1.1"},
+					"",
 				},
 			},
 			errors.New("extension loop failed: Extension.Err() signaled an error: decoding failed or interrupted: could not decode log message from json array: invalid character 'I' looking for beginning of value"),
@@ -277,12 +290,14 @@ func TestRun(t *testing.T) {
 					time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
 					json.RawMessage(`{"requestId":"1.1"}`),
 					logsapi.RecordPlatformEnd{"1.1"},
+					"",
 				},
 				{
 					logsapi.LogPlatformEnd,
 					time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
 					json.RawMessage(`{"requestId":"1.2"}`),
 					logsapi.RecordPlatformEnd{"1.2"},
+					"",
 				},
 			},
 			errors.New("extension loop failed: Extension.Err() signaled an error: EventProcessor.Process failed: test_error"),
@@ -309,6 +324,7 @@ func TestRun(t *testing.T) {
 					time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
 					json.RawMessage(`{"requestId":"1.1"}`),
 					logsapi.RecordPlatformEnd{"1.1"},
+					"",
 				},
 			},
 			errors.New("Extension.Shutdown failed: EventProcessor.Shutdown failed: shutdown_failed"),
@@ -355,3 +371,478 @@ func TestRun(t *testing.T) {
 		})
 	}
 }
+
+func TestRun_WithDropRawRecord(t *testing.T) {
+	destinationAddr := "localhost:10000"
+	apiMock := &lambdaAPIMock{
+		t:                  t,
+		wantDestinationURI: "http://" + destinationAddr,
+		logsRequests: [][]byte{
+			[]byte(`[{"type":"platform.end","time":"2022-01-01T00:00:00Z","record":{"requestId":"1.1"}}]`),
+		},
+		wantLogsResponses: []int{http.StatusOK},
+	}
+	proc := &testProcessor{
+		processErrors: []error{nil},
+	}
+	server := httptest.NewServer(apiMock)
+	defer server.Close()
+	t.Setenv("AWS_LAMBDA_RUNTIME_API", server.Listener.Addr().String())
+
+	err := logsapi.Run(
+		context.Background(),
+		proc,
+		logsapi.WithDestinationAddr(destinationAddr),
+		logsapi.WithDropRawRecord(true),
+	)
+	require.NoError(t, err)
+	require.Len(t, proc.receivedLogs, 1)
+	require.Nil(t, proc.receivedLogs[0].RawRecord)
+	require.Equal(t, logsapi.RecordPlatformEnd{RequestID: "1.1"}, proc.receivedLogs[0].Record)
+}
+
+func TestRun_WithIgnoreUnknownTypes(t *testing.T) {
+	destinationAddr := "localhost:10000"
+	apiMock := &lambdaAPIMock{
+		t:                  t,
+		wantDestinationURI: "http://" + destinationAddr,
+		logsRequests: [][]byte{
+			[]byte(`[{"type":"platform.unknown","time":"2022-01-01T00:00:00Z","record":{"requestId":"1.1"}},{"type":"platform.end","time":"2022-01-01T00:00:00Z","record":{"requestId":"1.2"}}]`),
+		},
+		wantLogsResponses: []int{http.StatusOK},
+	}
+	proc := &testProcessor{
+		processErrors: []error{nil, nil},
+	}
+	server := httptest.NewServer(apiMock)
+	defer server.Close()
+	t.Setenv("AWS_LAMBDA_RUNTIME_API", server.Listener.Addr().String())
+
+	err := logsapi.Run(
+		context.Background(),
+		proc,
+		logsapi.WithDestinationAddr(destinationAddr),
+		logsapi.WithIgnoreUnknownTypes(true),
+	)
+	require.NoError(t, err)
+	require.Equal(
+		t,
+		[]logsapi.Log{
+			{
+				LogType:   "platform.unknown",
+				Time:      time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+				RawRecord: json.RawMessage(`{"requestId":"1.1"}`),
+			},
+			{
+				LogType:   logsapi.LogPlatformEnd,
+				Time:      time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+				RawRecord: json.RawMessage(`{"requestId":"1.2"}`),
+				Record:    logsapi.RecordPlatformEnd{RequestID: "1.2"},
+			},
+		},
+		proc.receivedLogs,
+	)
+}
+
+func TestRun_WithSkipMalformedRecords(t *testing.T) {
+	destinationAddr := "localhost:10000"
+	apiMock := &lambdaAPIMock{
+		t:                  t,
+		wantDestinationURI: "http://" + destinationAddr,
+		logsRequests: [][]byte{
+			[]byte(`[{"type":"platform.end","time":"2022-01-01T00:00:00Z","record":{"requestId":"1.1"}}, INVALID_JSON, {"type":"platform.end","time":"2022-01-01T00:00:00Z","record":{"requestId":"1.2"}}]`),
+			[]byte(`[{"type":"platform.end","time":"2022-01-01T00:00:00Z","record":{"requestId":"2.1"}},{"type":"platform.end","time":"invalid","record":{"requestId":"[,]"}},{"type":"platform.end","time":"2022-01-01T00:00:00Z","record":{"requestId":"2.2"}}]`),
+		},
+		wantLogsResponses: []int{http.StatusOK, http.StatusOK},
+	}
+	proc := &testProcessor{
+		processErrors: []error{nil, nil, nil, nil},
+	}
+	server := httptest.NewServer(apiMock)
+	defer server.Close()
+	t.Setenv("AWS_LAMBDA_RUNTIME_API", server.Listener.Addr().String())
+
+	err := logsapi.Run(
+		context.Background(),
+		proc,
+		logsapi.WithDestinationAddr(destinationAddr),
+		logsapi.WithSkipMalformedRecords(true),
+	)
+	require.NoError(t, err)
+	var gotRequestIDs []string
+	for _, log := range proc.receivedLogs {
+		gotRequestIDs = append(gotRequestIDs, string(log.Record.(logsapi.RecordPlatformEnd).RequestID))
+	}
+	require.Equal(t, []string{"1.1", "1.2", "2.1", "2.2"}, gotRequestIDs)
+}
+
+func TestRun_WithRecordRedactor(t *testing.T) {
+	destinationAddr := "localhost:10000"
+	apiMock := &lambdaAPIMock{
+		t:                  t,
+		wantDestinationURI: "http://" + destinationAddr,
+		logsRequests: [][]byte{
+			[]byte(`[{"type":"function","time":"2022-01-01T00:00:00Z","record":"card 4111-1111-1111-1111"}]`),
+		},
+		wantLogsResponses: []int{http.StatusOK},
+	}
+	proc := &testProcessor{
+		processErrors: []error{nil},
+	}
+	server := httptest.NewServer(apiMock)
+	defer server.Close()
+	t.Setenv("AWS_LAMBDA_RUNTIME_API", server.Listener.Addr().String())
+
+	err := logsapi.Run(
+		context.Background(),
+		proc,
+		logsapi.WithDestinationAddr(destinationAddr),
+		logsapi.WithRecordRedactor(logsapi.RegexRedactor(regexp.MustCompile(`\b\d(?:[ -]?\d){12,15}\b`))),
+	)
+	require.NoError(t, err)
+	require.Len(t, proc.receivedLogs, 1)
+	require.Equal(t, logsapi.RecordFunction("card ****"), proc.receivedLogs[0].Record)
+	require.JSONEq(t, `"card ****"`, string(proc.receivedLogs[0].RawRecord))
+}
+
+func TestRun_WithDestinationListener(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	_, port, err := net.SplitHostPort(ln.Addr().String())
+	require.NoError(t, err)
+
+	apiMock := &lambdaAPIMock{
+		t:                  t,
+		wantDestinationURI: "http://localhost:" + port,
+		logsRequests: [][]byte{
+			[]byte(`[{"type":"platform.end","time":"2022-01-01T00:00:00Z","record":{"requestId":"1.1"}}]`),
+		},
+		wantLogsResponses: []int{http.StatusOK},
+	}
+	proc := &testProcessor{
+		processErrors: []error{nil},
+	}
+	server := httptest.NewServer(apiMock)
+	defer server.Close()
+	t.Setenv("AWS_LAMBDA_RUNTIME_API", server.Listener.Addr().String())
+
+	err = logsapi.Run(
+		context.Background(),
+		proc,
+		logsapi.WithDestinationAddr("localhost:0"),
+		logsapi.WithDestinationListener(ln),
+	)
+	require.NoError(t, err)
+	require.Len(t, proc.receivedLogs, 1)
+	require.Equal(t, logsapi.RecordPlatformEnd{RequestID: "1.1"}, proc.receivedLogs[0].Record)
+	// listener is closed on shutdown
+	_, err = ln.Accept()
+	require.ErrorIs(t, err, net.ErrClosed)
+}
+
+func TestRun_WithDisallowUnknownFields(t *testing.T) {
+	destinationAddr := "localhost:10000"
+	apiMock := &lambdaAPIMock{
+		t:                  t,
+		wantDestinationURI: "http://" + destinationAddr,
+		logsRequests: [][]byte{
+			[]byte(`[{"type":"platform.report","time":"2022-01-01T00:00:00Z","record":{"requestId":"1.1","metrics":{"durationMs":1}}},{"type":"platform.report","time":"2022-01-01T00:00:00Z","record":{"requestId":"1.2","metrics":{"durationMs":1},"newField":"value"}}]`),
+		},
+		wantLogsResponses: []int{http.StatusInternalServerError},
+	}
+	proc := &testProcessor{
+		processErrors: []error{nil},
+	}
+	server := httptest.NewServer(apiMock)
+	defer server.Close()
+	t.Setenv("AWS_LAMBDA_RUNTIME_API", server.Listener.Addr().String())
+
+	err := logsapi.Run(
+		context.Background(),
+		proc,
+		logsapi.WithDestinationAddr(destinationAddr),
+		logsapi.WithDisallowUnknownFields(true),
+	)
+	require.ErrorContains(t, err, `platform.report with error: json: unknown field "newField"`)
+	require.Len(t, proc.receivedLogs, 1)
+	require.True(t, apiMock.exitErrorCalled)
+}
+
+func TestRun_WithStrictContentType(t *testing.T) {
+	tests := []struct {
+		name         string
+		strict       bool
+		wantResponse int
+		wantReceived int
+	}{
+		{"strict", true, http.StatusUnsupportedMediaType, 0},
+		{"not strict", false, http.StatusOK, 1},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			destinationAddr := "localhost:10000"
+			apiMock := &lambdaAPIMock{
+				t:                  t,
+				wantDestinationURI: "http://" + destinationAddr,
+				contentType:        "text/plain",
+				logsRequests: [][]byte{
+					[]byte(`[{"type":"platform.end","time":"2022-01-01T00:00:00Z","record":{"requestId":"1.1"}}]`),
+				},
+				wantLogsResponses: []int{tt.wantResponse},
+			}
+			proc := &testProcessor{
+				processErrors: []error{nil},
+			}
+			server := httptest.NewServer(apiMock)
+			defer server.Close()
+			t.Setenv("AWS_LAMBDA_RUNTIME_API", server.Listener.Addr().String())
+
+			err := logsapi.Run(
+				context.Background(),
+				proc,
+				logsapi.WithDestinationAddr(destinationAddr),
+				logsapi.WithStrictContentType(tt.strict),
+			)
+			require.NoError(t, err)
+			require.Len(t, proc.receivedLogs, tt.wantReceived)
+			require.False(t, apiMock.exitErrorCalled)
+		})
+	}
+}
+
+func TestRun_WithFunctionLogSampler(t *testing.T) {
+	destinationAddr := "localhost:10000"
+	apiMock := &lambdaAPIMock{
+		t:                  t,
+		wantDestinationURI: "http://" + destinationAddr,
+		logsRequests: [][]byte{
+			[]byte(`[
+				{"type":"platform.start","time":"2022-01-01T00:00:00Z","record":{"requestId":"1.1"}},
+				{"type":"function","time":"2022-01-01T00:00:00Z","record":"line 1"},
+				{"type":"function","time":"2022-01-01T00:00:00Z","record":"line 2"},
+				{"type":"extension","time":"2022-01-01T00:00:00Z","record":"line 3"},
+				{"type":"function","time":"2022-01-01T00:00:00Z","record":"line 4"},
+				{"type":"platform.end","time":"2022-01-01T00:00:00Z","record":{"requestId":"1.1"}},
+				{"type":"function","time":"2022-01-01T00:00:00Z","record":"line 5"},
+				{"type":"function","time":"2022-01-01T00:00:00Z","record":"line 6"},
+				{"type":"platform.end","time":"2022-01-01T00:00:00Z","record":{"requestId":"1.2"}}
+			]`),
+		},
+		wantLogsResponses: []int{http.StatusOK},
+	}
+	proc := &testProcessor{
+		processErrors: []error{nil, nil, nil, nil, nil},
+	}
+	server := httptest.NewServer(apiMock)
+	defer server.Close()
+	t.Setenv("AWS_LAMBDA_RUNTIME_API", server.Listener.Addr().String())
+
+	err := logsapi.Run(
+		context.Background(),
+		proc,
+		logsapi.WithDestinationAddr(destinationAddr),
+		logsapi.WithFunctionLogSampler(logsapi.OneInNSampler(3)),
+	)
+	require.NoError(t, err)
+	var got []any
+	for _, log := range proc.receivedLogs {
+		got = append(got, log.Record)
+	}
+	require.Equal(
+		t,
+		[]any{
+			logsapi.RecordPlatformStart{RequestID: "1.1"},
+			logsapi.RecordFunction("line 1"),
+			logsapi.RecordFunction("line 4"),
+			logsapi.RecordPlatformEnd{RequestID: "1.1"},
+			logsapi.RecordPlatformEnd{RequestID: "1.2"},
+		},
+		got,
+	)
+}
+
+func TestRun_WithFunctionLogSampler_ProcessRetry(t *testing.T) {
+	destinationAddr := "localhost:10000"
+	apiMock := &lambdaAPIMock{
+		t:                  t,
+		wantDestinationURI: "http://" + destinationAddr,
+		logsRequests: [][]byte{
+			[]byte(`[
+				{"type":"function","time":"2022-01-01T00:00:00Z","record":"line 1"},
+				{"type":"function","time":"2022-01-01T00:00:00Z","record":"line 2"},
+				{"type":"function","time":"2022-01-01T00:00:00Z","record":"line 3"}
+			]`),
+		},
+		wantLogsResponses: []int{http.StatusOK},
+	}
+	proc := &testProcessor{
+		processErrors: []error{errors.New("test_error"), nil, nil},
+	}
+	server := httptest.NewServer(apiMock)
+	defer server.Close()
+	t.Setenv("AWS_LAMBDA_RUNTIME_API", server.Listener.Addr().String())
+
+	err := logsapi.Run(
+		context.Background(),
+		proc,
+		logsapi.WithDestinationAddr(destinationAddr),
+		logsapi.WithFunctionLogSampler(logsapi.OneInNSampler(2)),
+		logsapi.WithProcessRetry(1, time.Millisecond),
+	)
+	require.NoError(t, err)
+	var got []any
+	for _, log := range proc.receivedLogs {
+		got = append(got, log.Record)
+	}
+	// the sampler is asked once per log, so the retry doesn't shift sampling
+	require.Equal(
+		t,
+		[]any{
+			logsapi.RecordFunction("line 1"),
+			logsapi.RecordFunction("line 1"),
+			logsapi.RecordFunction("line 3"),
+		},
+		got,
+	)
+}
+
+func TestRun_WithDedup(t *testing.T) {
+	destinationAddr := "localhost:10000"
+	batch := []byte(`[
+		{"type":"platform.start","time":"2022-01-01T00:00:00Z","record":{"requestId":"1.1"}},
+		{"type":"function","time":"2022-01-01T00:00:00Z","record":"line 1"},
+		{"type":"platform.end","time":"2022-01-01T00:00:00Z","record":{"requestId":"1.1"}}
+	]`)
+	apiMock := &lambdaAPIMock{
+		t:                  t,
+		wantDestinationURI: "http://" + destinationAddr,
+		logsRequests:       [][]byte{batch, batch},
+		wantLogsResponses:  []int{http.StatusOK, http.StatusOK},
+	}
+	proc := &testProcessor{
+		processErrors: []error{nil, nil, nil, nil},
+	}
+	server := httptest.NewServer(apiMock)
+	defer server.Close()
+	t.Setenv("AWS_LAMBDA_RUNTIME_API", server.Listener.Addr().String())
+
+	err := logsapi.Run(
+		context.Background(),
+		proc,
+		logsapi.WithDestinationAddr(destinationAddr),
+		logsapi.WithDedup(10),
+	)
+	require.NoError(t, err)
+	var got []any
+	for _, log := range proc.receivedLogs {
+		got = append(got, log.Record)
+	}
+	require.Equal(
+		t,
+		[]any{
+			logsapi.RecordPlatformStart{RequestID: "1.1"},
+			logsapi.RecordFunction("line 1"),
+			logsapi.RecordPlatformEnd{RequestID: "1.1"},
+			logsapi.RecordFunction("line 1"),
+		},
+		got,
+	)
+}
+
+func TestRun_WithDedup_ProcessRetry(t *testing.T) {
+	destinationAddr := "localhost:10000"
+	batch := []byte(`[
+		{"type":"platform.start","time":"2022-01-01T00:00:00Z","record":{"requestId":"1.1"}}
+	]`)
+	apiMock := &lambdaAPIMock{
+		t:                  t,
+		wantDestinationURI: "http://" + destinationAddr,
+		logsRequests:       [][]byte{batch, batch},
+		wantLogsResponses:  []int{http.StatusOK, http.StatusOK},
+	}
+	proc := &testProcessor{
+		processErrors: []error{errors.New("test_error"), nil},
+	}
+	server := httptest.NewServer(apiMock)
+	defer server.Close()
+	t.Setenv("AWS_LAMBDA_RUNTIME_API", server.Listener.Addr().String())
+
+	err := logsapi.Run(
+		context.Background(),
+		proc,
+		logsapi.WithDestinationAddr(destinationAddr),
+		logsapi.WithDedup(10),
+		logsapi.WithProcessRetry(1, time.Millisecond),
+	)
+	require.NoError(t, err)
+	// the failed log is retried once and the redelivered batch is dropped
+	require.Len(t, proc.receivedLogs, 2)
+	require.Equal(t, proc.receivedLogs[0], proc.receivedLogs[1])
+	require.Empty(t, proc.processErrors)
+}
+
+func TestRun_WithLevelDetection(t *testing.T) {
+	destinationAddr := "localhost:10000"
+	apiMock := &lambdaAPIMock{
+		t:                  t,
+		wantDestinationURI: "http://" + destinationAddr,
+		logsRequests: [][]byte{
+			[]byte(`[
+				{"type":"function","time":"2022-01-01T00:00:00Z","record":"[ERROR] failed"},
+				{"type":"function","time":"2022-01-01T00:00:00Z","record":"{\"level\":\"warn\",\"msg\":\"retrying\"}"},
+				{"type":"function","time":"2022-01-01T00:00:00Z","record":"plain line"},
+				{"type":"extension","time":"2022-01-01T00:00:00Z","record":"ERROR extension logs are not classified"}
+			]`),
+		},
+		wantLogsResponses: []int{http.StatusOK},
+	}
+	proc := &testProcessor{
+		processErrors: []error{nil, nil, nil, nil},
+	}
+	server := httptest.NewServer(apiMock)
+	defer server.Close()
+	t.Setenv("AWS_LAMBDA_RUNTIME_API", server.Listener.Addr().String())
+
+	err := logsapi.Run(
+		context.Background(),
+		proc,
+		logsapi.WithDestinationAddr(destinationAddr),
+		logsapi.WithLevelDetection(true),
+	)
+	require.NoError(t, err)
+	var got []logsapi.Level
+	for _, log := range proc.receivedLogs {
+		got = append(got, log.Level)
+	}
+	require.Equal(t, []logsapi.Level{logsapi.LevelError, logsapi.LevelWarn, "", ""}, got)
+}
+
+func TestRun_WithProcessRetry(t *testing.T) {
+	destinationAddr := "localhost:10000"
+	apiMock := &lambdaAPIMock{
+		t:                  t,
+		wantDestinationURI: "http://" + destinationAddr,
+		logsRequests: [][]byte{
+			[]byte(`[{"type":"platform.end","time":"2022-01-01T00:00:00Z","record":{"requestId":"1.1"}}]`),
+		},
+		wantLogsResponses: []int{http.StatusOK},
+	}
+	proc := &testProcessor{
+		processErrors: []error{errors.New("first attempt failed"), errors.New("second attempt failed"), nil},
+	}
+	server := httptest.NewServer(apiMock)
+	defer server.Close()
+	t.Setenv("AWS_LAMBDA_RUNTIME_API", server.Listener.Addr().String())
+
+	err := logsapi.Run(
+		context.Background(),
+		proc,
+		logsapi.WithDestinationAddr(destinationAddr),
+		logsapi.WithProcessRetry(2, time.Millisecond),
+	)
+	require.NoError(t, err)
+	require.Len(t, proc.receivedLogs, 3)
+	require.Empty(t, proc.processErrors)
+	require.False(t, apiMock.exitErrorCalled)
+}
@@ -0,0 +1,14 @@
+//go:build go1.21
+
+package logsapi
+
+import (
+	"log/slog"
+
+	"github.com/zakharovvi/aws-lambda-extensions/extapi"
+)
+
+// WithSlogLogger configures log/slog logger. It is a shortcut for WithLogger with extapi.LogrFromSlog.
+func WithSlogLogger(log *slog.Logger) Option {
+	return WithLogger(extapi.LogrFromSlog(log))
+}
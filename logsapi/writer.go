@@ -0,0 +1,59 @@
+package logsapi
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/zakharovvi/aws-lambda-extensions/extapi"
+)
+
+// NewWriterProcessor creates a Processor writing every Log to w as one JSON object per line (NDJSON)
+// in the wire form received from Logs API: {"time":...,"type":...,"record":...}.
+// Writes are buffered and flushed on Shutdown.
+// Record is used if the Log has no RawRecord.
+func NewWriterProcessor(w io.Writer) Processor {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	enc.SetEscapeHTML(false)
+
+	return &writerProcessor{bw, enc}
+}
+
+type writerProcessor struct {
+	w   *bufio.Writer
+	enc *json.Encoder
+}
+
+// wireLog is Log in the form sent by Logs API.
+type wireLog struct {
+	Time   time.Time       `json:"time"`
+	Type   LogType         `json:"type"`
+	Record json.RawMessage `json:"record"`
+}
+
+func (p *writerProcessor) Init(ctx context.Context, registerResp *extapi.RegisterResponse) error {
+	return nil
+}
+
+func (p *writerProcessor) Process(ctx context.Context, msg Log) error {
+	record := msg.RawRecord
+	if len(record) == 0 && msg.Record != nil {
+		var err error
+		if record, err = json.Marshal(msg.Record); err != nil {
+			return fmt.Errorf("could not json encode log record: %w", err)
+		}
+	}
+	if err := p.enc.Encode(wireLog{msg.Time, msg.LogType, record}); err != nil {
+		return fmt.Errorf("could not write log: %w", err)
+	}
+
+	return nil
+}
+
+func (p *writerProcessor) Shutdown(ctx context.Context, reason extapi.ShutdownReason, err error) error {
+	return p.w.Flush()
+}
@@ -0,0 +1,39 @@
+package logsapi_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zakharovvi/aws-lambda-extensions/extapi"
+	"github.com/zakharovvi/aws-lambda-extensions/logsapi"
+)
+
+func TestNewWriterProcessor(t *testing.T) {
+	ts := time.Date(2022, 10, 12, 0, 0, 0, 0, time.UTC)
+	buf := &bytes.Buffer{}
+	proc := logsapi.NewWriterProcessor(buf)
+
+	require.NoError(t, proc.Init(context.Background(), nil))
+	require.NoError(t, proc.Process(context.Background(), logsapi.Log{
+		LogType:   logsapi.LogFunction,
+		Time:      ts,
+		RawRecord: json.RawMessage(`"Hello <world>"`),
+		Record:    logsapi.RecordFunction("Hello <world>"),
+	}))
+	require.NoError(t, proc.Process(context.Background(), logsapi.Log{
+		LogType: logsapi.LogPlatformStart,
+		Time:    ts,
+		Record:  logsapi.RecordPlatformStart{RequestID: "1.1", Version: "$LATEST"},
+	}))
+	require.Empty(t, buf.String(), "writes must be buffered till Shutdown")
+
+	require.NoError(t, proc.Shutdown(context.Background(), extapi.Spindown, nil))
+	want := `{"time":"2022-10-12T00:00:00Z","type":"function","record":"Hello <world>"}
+{"time":"2022-10-12T00:00:00Z","type":"platform.start","record":{"requestId":"1.1","version":"$LATEST"}}
+`
+	require.Equal(t, want, buf.String())
+}
@@ -0,0 +1,173 @@
+package telemetryapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/zakharovvi/aws-lambda-extensions/extapi"
+	"github.com/zakharovvi/aws-lambda-extensions/internal"
+	"github.com/zakharovvi/aws-lambda-extensions/logsapi"
+)
+
+const (
+	// BothTelemetryPath is URL path of RunBoth destination for Telemetry API events.
+	BothTelemetryPath = "/telemetry"
+	// BothLogsPath is URL path of RunBoth destination for Logs API logs.
+	BothLogsPath = "/logs"
+)
+
+// BothProcessor processes Telemetry API events with Processor methods and Logs API logs with ProcessLog.
+// RunBoth calls all the methods sequentially from a single goroutine the same way as Run does.
+type BothProcessor interface {
+	Processor
+	// ProcessLog stores Logs API log message the same way as logsapi.Processor.Process does.
+	ProcessLog(ctx context.Context, log logsapi.Log) error
+}
+
+// RunBoth runs the BothProcessor subscribed to both Telemetry API and deprecated Logs API with a single receiving server
+// to compare or migrate processors during the migration window.
+// Lambda delivers the same data to both subscriptions, so every function log line and platform event is processed twice,
+// once with Processor.Process in Telemetry API schema and once with ProcessLog in Logs API schema.
+//
+// Telemetry API events are received on BothTelemetryPath and Logs API logs on BothLogsPath of the destination.
+// WithSubscriptionTypes and WithBufferingCfg configure both subscriptions. Decoding options apply only to Telemetry API events,
+// logs are decoded the same way as logsapi.DecodeLogs does.
+// RunBoth blocks the current goroutine till extension lifecycle is finished or error occurs.
+func RunBoth(ctx context.Context, proc BothProcessor, opts ...Option) error {
+	options := newOptions(ctx, opts)
+	hostErr := internal.WarnDestinationHost(options.log, options.destinationAddr, options.allowNonSandboxHost)
+
+	subscriber := func(ctx context.Context, client *extapi.Client, destinationURL string) error {
+		if err := options.validateSubscription(); err != nil {
+			return err
+		}
+		logTypes := make([]extapi.LogSubscriptionType, 0, len(options.subscriptionTypes))
+		for _, t := range options.subscriptionTypes {
+			logTypes = append(logTypes, extapi.LogSubscriptionType(t))
+		}
+		var logsBufferingCfg *extapi.LogsBufferingCfg
+		if options.bufferingCfg != nil {
+			logsBufferingCfg = (*extapi.LogsBufferingCfg)(options.bufferingCfg)
+		}
+		options.log.V(1).Info(
+			"calling Client.SubscribeBoth",
+			"url", destinationURL,
+			"subscriptionTypes", options.subscriptionTypes,
+			"bufferingCfg", options.bufferingCfg,
+			"schemaVersion", options.schemaVersion,
+		)
+		logsReq := extapi.NewLogsSubscribeRequest(destinationURL+BothLogsPath, logTypes, logsBufferingCfg)
+		telemetryReq := options.subscribeRequest(destinationURL + BothTelemetryPath)
+
+		return internal.WithDestinationHostHint(client.SubscribeBoth(ctx, logsReq, telemetryReq), hostErr)
+	}
+
+	adapter := &bothAdapter{proc: proc}
+	invokeHandler := options.invokeHandler
+	if options.invokeDeadline {
+		adapter.deadline = &invokeDeadline{}
+		invokeHandler = adapter.deadline.wrapHandler(invokeHandler)
+	}
+
+	ext := internal.NewExtension(ctx, internal.Config[bothMessage]{
+		Processor:               adapter,
+		DestinationAddr:         options.destinationAddr,
+		Listener:                options.destinationListener,
+		Log:                     options.log,
+		Decoder:                 bothDecoder{options.decoder()}.decode,
+		Subscriber:              subscriber,
+		InvokeHandler:           invokeHandler,
+		StrictContentType:       options.strictContentType,
+		FlushInterval:           options.flushInterval,
+		ProcessRetry:            options.processRetry,
+		MaxConcurrentDeliveries: options.maxConcurrentDeliveries,
+		AsyncDecode:             options.asyncDecode,
+		DestinationURLCallback:  options.destinationURLCallback,
+		AcceptRetry:             options.acceptRetry,
+	})
+
+	return options.run(ctx, ext, invokeHandler != nil)
+}
+
+// bothMessage carries either Telemetry API Event or Logs API Log.
+type bothMessage struct {
+	event *Event
+	log   *logsapi.Log
+}
+
+// bothDecoder decodes the request body according to the schema of the destination path.
+type bothDecoder struct {
+	dec decoder
+}
+
+func (bd bothDecoder) decode(ctx context.Context, r io.ReadCloser, messages chan<- bothMessage) error {
+	opts := internal.DecodeOptions{
+		SkipMalformed: bd.dec.skipMalformedRecords,
+		Log:           bd.dec.log,
+	}
+	switch path := internal.RequestPath(ctx); path {
+	case BothTelemetryPath:
+		return internal.Decode(ctx, r, messages, bd.decodeNextEvent, opts)
+	case BothLogsPath:
+		return internal.Decode(ctx, r, messages, decodeNextLog, opts)
+	default:
+		_ = r.Close()
+
+		return fmt.Errorf("unexpected events HTTP request path %q, want %s or %s", path, BothTelemetryPath, BothLogsPath)
+	}
+}
+
+func (bd bothDecoder) decodeNextEvent(d *json.Decoder) (bothMessage, error) {
+	event, err := bd.dec.decodeNext(d)
+
+	return bothMessage{event: &event}, err
+}
+
+func decodeNextLog(d *json.Decoder) (bothMessage, error) {
+	log := logsapi.Log{}
+	if err := d.Decode(&log); err != nil {
+		return bothMessage{}, fmt.Errorf("could not decode log message from json array: %w", err)
+	}
+
+	return bothMessage{log: &log}, nil
+}
+
+// bothAdapter dispatches bothMessage to BothProcessor methods.
+type bothAdapter struct {
+	proc     BothProcessor
+	deadline *invokeDeadline
+}
+
+func (a *bothAdapter) Init(ctx context.Context, registerResp *extapi.RegisterResponse) error {
+	return a.proc.Init(ctx, registerResp)
+}
+
+func (a *bothAdapter) Process(ctx context.Context, msg bothMessage) error {
+	if a.deadline != nil {
+		ctx = a.deadline.withContext(ctx)
+	}
+	if msg.log != nil {
+		return a.proc.ProcessLog(ctx, *msg.log)
+	}
+
+	return a.proc.Process(ctx, *msg.event)
+}
+
+// Flush is a no-op if BothProcessor doesn't implement Flusher.
+func (a *bothAdapter) Flush(ctx context.Context) error {
+	flusher, ok := a.proc.(Flusher)
+	if !ok {
+		return nil
+	}
+	if a.deadline != nil {
+		ctx = a.deadline.withContext(ctx)
+	}
+
+	return flusher.Flush(ctx)
+}
+
+func (a *bothAdapter) Shutdown(ctx context.Context, reason extapi.ShutdownReason, err error) error {
+	return a.proc.Shutdown(ctx, reason, err)
+}
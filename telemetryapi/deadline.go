@@ -0,0 +1,77 @@
+package telemetryapi
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/zakharovvi/aws-lambda-extensions/extapi"
+	"github.com/zakharovvi/aws-lambda-extensions/internal"
+)
+
+type invokeDeadlineKey struct{}
+
+// InvokeDeadlineFromContext returns the deadline of the last Invoke event received by Run with WithInvokeDeadline option.
+// It is available in the ctx passed into Processor.Process and Flusher.Flush.
+// Use time.Until to get the time remaining till the invocation times out, e.g. to flush buffered events in time.
+// The second return value is false if the option is not set, no Invoke event has been received yet or the event has no deadline.
+func InvokeDeadlineFromContext(ctx context.Context) (time.Time, bool) {
+	deadline, ok := ctx.Value(invokeDeadlineKey{}).(time.Time)
+
+	return deadline, ok
+}
+
+// invokeDeadline keeps the deadline of the last Invoke event.
+// It is updated from the extension events loop goroutine and read from the event processing goroutine.
+type invokeDeadline struct {
+	unixMilli int64
+}
+
+func (d *invokeDeadline) set(event *extapi.NextEventResponse) {
+	var ms int64
+	if deadline := event.DeadlineOrZero(); !deadline.IsZero() {
+		ms = deadline.UnixMilli()
+	}
+	atomic.StoreInt64(&d.unixMilli, ms)
+}
+
+// wrapHandler returns invoke handler capturing the deadline before calling the handler if any.
+func (d *invokeDeadline) wrapHandler(handler internal.InvokeHandler) internal.InvokeHandler {
+	return func(ctx context.Context, event *extapi.NextEventResponse) error {
+		d.set(event)
+		if handler == nil {
+			return nil
+		}
+
+		return handler(ctx, event)
+	}
+}
+
+func (d *invokeDeadline) withContext(ctx context.Context) context.Context {
+	ms := atomic.LoadInt64(&d.unixMilli)
+	if ms == 0 {
+		return ctx
+	}
+
+	return context.WithValue(ctx, invokeDeadlineKey{}, time.UnixMilli(ms))
+}
+
+// deadlineProcessor injects the last invoke deadline into the ctx passed into Process.
+type deadlineProcessor struct {
+	Processor
+	deadline *invokeDeadline
+}
+
+func (p *deadlineProcessor) Process(ctx context.Context, event Event) error {
+	return p.Processor.Process(p.deadline.withContext(ctx), event)
+}
+
+func withInvokeDeadline(proc Processor, deadline *invokeDeadline) Processor {
+	return internal.WithFlush[Event](
+		&deadlineProcessor{proc, deadline},
+		proc,
+		func(ctx context.Context, flusher internal.Flusher) error {
+			return flusher.Flush(deadline.withContext(ctx))
+		},
+	)
+}
@@ -1,12 +1,14 @@
 package telemetryapi
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"time"
 
+	"github.com/go-logr/logr"
 	lambdaext "github.com/zakharovvi/aws-lambda-extensions"
 	"github.com/zakharovvi/aws-lambda-extensions/extapi"
 	"github.com/zakharovvi/aws-lambda-extensions/internal"
@@ -29,6 +31,12 @@ const (
 	TypePlatformRuntimeDone Type = "platform.runtimeDone"
 	// TypePlatformReport event is a report of function invocation.
 	TypePlatformReport Type = "platform.report"
+	// TypePlatformRestoreStart event is emitted when function environment restoration started for SnapStart.
+	TypePlatformRestoreStart Type = "platform.restoreStart"
+	// TypePlatformRestoreRuntimeDone event is emitted when function environment restoration completed for SnapStart.
+	TypePlatformRestoreRuntimeDone Type = "platform.restoreRuntimeDone"
+	// TypePlatformRestoreReport event is a report of function environment restoration for SnapStart.
+	TypePlatformRestoreReport Type = "platform.restoreReport"
 	// TypePlatformExtension event is emitted when an extension registers with the extensions API.
 	TypePlatformExtension = "platform.extension"
 	// TypePlatformTelemetrySubscription event is emitted when an extension subscribed to the Telemetry API.
@@ -57,6 +65,9 @@ type Event struct {
 	// Record property defines a struct that contains the telemetry data.
 	// The type of the struct depends on the Event.Type
 	Record any `json:"decodedRecord,omitempty"` // tag for printing the field with json.Marshal
+	// RawTime property is the time value as received from Telemetry API including quotes.
+	// It is used by Event.RawEvent to keep the original timestamp format.
+	RawTime json.RawMessage `json:"-"`
 }
 
 // RecordPlatformInitStart event indicates that the function initialization phase has started.
@@ -76,6 +87,7 @@ type RecordPlatformInitRuntimeDone struct {
 	Status   Status             `json:"status"`
 	// If the status is either failure or error, then the Status object also contains an errorType field describing the error.
 	ErrorType string `json:"errorType"`
+	Spans     []Span `json:"spans,omitempty"`
 }
 
 // RecordPlatformInitReport event contains an overall report of the function initialization phase.
@@ -84,6 +96,7 @@ type RecordPlatformInitReport struct {
 	InitType lambdaext.InitType `json:"initializationType"`
 	Phase    Phase              `json:"phase"`
 	Metrics  InitReportMetrics  `json:"metrics"`
+	Spans    []Span             `json:"spans,omitempty"`
 }
 
 // RecordPlatformStart event indicates that the function invocation phase has started.
@@ -111,8 +124,43 @@ type RecordPlatformRuntimeDone struct {
 type RecordPlatformReport struct {
 	RequestID lambdaext.RequestID `json:"requestId"`
 	Status    Status              `json:"status"`
-	Metrics   ReportMetrics       `json:"metrics"`
-	Tracing   TraceContext        `json:"tracing,omitempty"`
+	// If the status is either failure or error, then the Status object also contains an errorType field describing the error.
+	ErrorType string        `json:"errorType,omitempty"`
+	Metrics   ReportMetrics `json:"metrics"`
+	Tracing   TraceContext  `json:"tracing,omitempty"`
+}
+
+// RecordPlatformRestoreStart event indicates that the function environment restoration phase has started.
+// The event is emitted only for functions with SnapStart enabled.
+// https://docs.aws.amazon.com/lambda/latest/dg/telemetry-schema-reference.html#platform-restoreStart
+type RecordPlatformRestoreStart struct {
+	RuntimeVersion    string                    `json:"runtimeVersion,omitempty"`
+	RuntimeVersionARN string                    `json:"runtimeVersionArn,omitempty"`
+	FunctionName      string                    `json:"functionName,omitempty"`
+	FunctionVersion   lambdaext.FunctionVersion `json:"functionVersion,omitempty"`
+	InstanceID        string                    `json:"instanceId,omitempty"`
+	InstanceMaxMemory lambdaext.Int64           `json:"instanceMaxMemory,omitempty"`
+}
+
+// RecordPlatformRestoreRuntimeDone event indicates that the function environment restoration phase has completed.
+// The event is emitted only for functions with SnapStart enabled.
+// https://docs.aws.amazon.com/lambda/latest/dg/telemetry-schema-reference.html#platform-restoreRuntimeDone
+type RecordPlatformRestoreRuntimeDone struct {
+	Status Status `json:"status"`
+	// If the status is either failure or error, then the Status object also contains an errorType field describing the error.
+	ErrorType string `json:"errorType,omitempty"`
+	Spans     []Span `json:"spans,omitempty"`
+}
+
+// RecordPlatformRestoreReport event contains an overall report of the function environment restoration phase.
+// The event is emitted only for functions with SnapStart enabled.
+// https://docs.aws.amazon.com/lambda/latest/dg/telemetry-schema-reference.html#platform-restoreReport
+type RecordPlatformRestoreReport struct {
+	Status Status `json:"status"`
+	// If the status is either failure or error, then the Status object also contains an errorType field describing the error.
+	ErrorType string               `json:"errorType,omitempty"`
+	Metrics   RestoreReportMetrics `json:"metrics,omitempty"`
+	Spans     []Span               `json:"spans,omitempty"`
 }
 
 // RecordPlatformExtension is generated when an extension registers with the extensions API.
@@ -135,9 +183,9 @@ type RecordPlatformTelemetrySubscription struct {
 // Lambda emits the platform.logsDropped event when an extension can't process one or more events.
 // https://docs.aws.amazon.com/lambda/latest/dg/telemetry-schema-reference.html#platform-logsDropped
 type RecordPlatformLogsDropped struct {
-	DroppedBytes   int    `json:"droppedBytes"`
-	DroppedRecords int    `json:"droppedRecords"`
-	Reason         string `json:"reason"`
+	DroppedBytes   lambdaext.Int64 `json:"droppedBytes"`
+	DroppedRecords lambdaext.Int64 `json:"droppedRecords"`
+	Reason         string          `json:"reason"`
 }
 
 // RecordFunction event contains logs from the function code.
@@ -159,6 +207,11 @@ const (
 	PhaseInvoke Phase = "invoke"
 )
 
+// IsValid reports whether p is a phase defined in the Telemetry API schema.
+func (p Phase) IsValid() bool {
+	return p == PhaseInit || p == PhaseInvoke
+}
+
 // Status describes the status of an initialization or invocation phase.
 // https://docs.aws.amazon.com/lambda/latest/dg/telemetry-schema-reference.html#Status
 type Status string
@@ -167,8 +220,21 @@ const (
 	StatusSuccess Status = "success"
 	StatusFailure Status = "failure"
 	StatusError   Status = "error"
+	StatusTimeout Status = "timeout"
 )
 
+// IsValid reports whether s is a status defined in the Telemetry API schema.
+func (s Status) IsValid() bool {
+	switch s {
+	case StatusSuccess, StatusFailure, StatusError, StatusTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// SpanName is the name of a Span. Lambda can emit span names other than the defined constants,
+// they are decoded as is and must not be treated as errors.
 type SpanName string
 
 const (
@@ -192,6 +258,12 @@ type InitReportMetrics struct {
 	Duration lambdaext.DurationMs `json:"durationMs"`
 }
 
+// RestoreReportMetrics contains metrics about a restoration phase.
+// https://docs.aws.amazon.com/lambda/latest/dg/telemetry-schema-reference.html#RestoreReportMetrics
+type RestoreReportMetrics struct {
+	Duration lambdaext.DurationMs `json:"durationMs"`
+}
+
 // TraceContext describes the properties of a trace.
 // https://docs.aws.amazon.com/lambda/latest/dg/telemetry-schema-reference.html#TraceContext
 type TraceContext struct {
@@ -204,7 +276,7 @@ type TraceContext struct {
 // https://docs.aws.amazon.com/lambda/latest/dg/telemetry-schema-reference.html#RuntimeDoneMetrics
 type RuntimeDoneMetrics struct {
 	Duration      lambdaext.DurationMs `json:"durationMs"`
-	ProducedBytes int                  `json:"producedBytes,omitempty"`
+	ProducedBytes lambdaext.Int64      `json:"producedBytes,omitempty"`
 }
 
 // ReportMetrics contains metrics about a completed phase.
@@ -213,8 +285,8 @@ type ReportMetrics struct {
 	BilledDuration  lambdaext.DurationMs `json:"billedDurationMs"`
 	Duration        lambdaext.DurationMs `json:"durationMs"`
 	InitDuration    lambdaext.DurationMs `json:"initDurationMs,omitempty"`
-	MaxMemoryUsedMB int                  `json:"maxMemoryUsedMB"`
-	MemorySizeMB    int                  `json:"memorySizeMB"`
+	MaxMemoryUsedMB lambdaext.Int64      `json:"maxMemoryUsedMB"`
+	MemorySizeMB    lambdaext.Int64      `json:"memorySizeMB"`
 	RestoreDuration lambdaext.DurationMs `json:"restoreDurationMs,omitempty"`
 }
 
@@ -222,66 +294,226 @@ type ReportMetrics struct {
 // Decode is low-level function. Consider using Run instead and implement Processor.
 // Decode drains and closes the input stream afterwards.
 func Decode(ctx context.Context, r io.ReadCloser, logs chan<- Event) error {
-	return internal.Decode(ctx, r, logs, decodeNext)
+	return decoder{log: logr.Discard()}.decode(ctx, r, logs)
+}
+
+// DecodeReader is a variant of Decode for io.Reader, e.g. bytes.Reader with a recorded payload.
+// DecodeReader drains the input stream afterwards but doesn't close it.
+func DecodeReader(ctx context.Context, r io.Reader, logs chan<- Event) error {
+	return Decode(ctx, io.NopCloser(r), logs)
+}
+
+// DecodeNoDrain is a variant of Decode which doesn't drain and close the input stream.
+// It returns once the json array is consumed with a reader of the remaining bytes following the array,
+// as some of them can already be buffered. The remaining bytes are never read from r by DecodeNoDrain itself.
+// When r is an HTTP request body, the caller is responsible to drain and close it.
+// Otherwise, the connection can't be reused for the next request with HTTP keep-alive.
+func DecodeNoDrain(ctx context.Context, r io.Reader, logs chan<- Event) (io.Reader, error) {
+	dec := decoder{log: logr.Discard()}
+
+	return internal.DecodeNoDrain(ctx, r, logs, dec.decodeNext, internal.DecodeOptions{Log: dec.log})
+}
+
+// decoder holds decoding options configured with Run.
+type decoder struct {
+	dropRawRecord         bool
+	ignoreUnknownTypes    bool
+	skipMalformedRecords  bool
+	disallowUnknownFields bool
+	validateEnums         bool
+	log                   logr.Logger
+}
+
+func (dec decoder) decode(ctx context.Context, r io.ReadCloser, logs chan<- Event) error {
+	opts := internal.DecodeOptions{
+		SkipMalformed: dec.skipMalformedRecords,
+		Log:           dec.log,
+	}
+
+	return internal.Decode(ctx, r, logs, dec.decodeNext, opts)
+}
+
+// unmarshalRecord decodes raw record into typed one.
+// Unknown fields in the record are reported as errors if disallowUnknownFields is set.
+func (dec decoder) unmarshalRecord(raw json.RawMessage, record any) error {
+	if !dec.disallowUnknownFields {
+		return json.Unmarshal(raw, record)
+	}
+	d := json.NewDecoder(bytes.NewReader(raw))
+	d.DisallowUnknownFields()
+
+	return d.Decode(record)
+}
+
+// validateEnums returns an error if Status or Phase fields of the record have values not defined in the schema.
+func validateEnums(record any) error {
+	var (
+		phases   []Phase
+		statuses []Status
+	)
+	switch record := record.(type) {
+	case RecordPlatformInitStart:
+		phases = []Phase{record.Phase}
+	case RecordPlatformInitRuntimeDone:
+		phases = []Phase{record.Phase}
+		statuses = []Status{record.Status}
+	case RecordPlatformInitReport:
+		phases = []Phase{record.Phase}
+	case RecordPlatformRuntimeDone:
+		statuses = []Status{record.Status}
+	case RecordPlatformReport:
+		statuses = []Status{record.Status}
+	case RecordPlatformRestoreRuntimeDone:
+		statuses = []Status{record.Status}
+	case RecordPlatformRestoreReport:
+		statuses = []Status{record.Status}
+	}
+	for _, phase := range phases {
+		if !phase.IsValid() {
+			return fmt.Errorf("unknown phase %q, want %q or %q", phase, PhaseInit, PhaseInvoke)
+		}
+	}
+	for _, status := range statuses {
+		if !status.IsValid() {
+			return fmt.Errorf("unknown status %q, want one of %q, %q, %q, %q", status, StatusSuccess, StatusFailure, StatusError, StatusTimeout)
+		}
+	}
+
+	return nil
+}
+
+// rawEvent has no UnmarshalJSON method to decode Event fields without Record.
+type rawEvent Event
+
+// wireEvent decodes Event fields without Record and keeps the original time value in RawTime.
+// Its time field shadows rawEvent.Time.
+type wireEvent struct {
+	*rawEvent
+	RawTime json.RawMessage `json:"time"`
+}
+
+// setTime decodes RawTime into Event.Time.
+func (w wireEvent) setTime() error {
+	w.rawEvent.RawTime = w.RawTime
+	if len(w.RawTime) == 0 {
+		return nil
+	}
+
+	return w.rawEvent.Time.UnmarshalJSON(w.RawTime)
+}
+
+// UnmarshalJSON decodes Event and its Record according to the type the same way as Decode does with default options.
+func (msg *Event) UnmarshalJSON(b []byte) error {
+	w := wireEvent{rawEvent: (*rawEvent)(msg)}
+	if err := json.Unmarshal(b, &w); err != nil {
+		return err
+	}
+	if err := w.setTime(); err != nil {
+		return err
+	}
+	decoded, err := decoder{log: logr.Discard()}.decodeRecord(*msg)
+	*msg = decoded
+
+	return err
 }
 
-func decodeNext(d *json.Decoder) (Event, error) {
+func (dec decoder) decodeNext(d *json.Decoder) (Event, error) {
 	msg := Event{}
-	if err := d.Decode(&msg); err != nil {
+	w := wireEvent{rawEvent: (*rawEvent)(&msg)}
+	if err := d.Decode(&w); err != nil {
+		return msg, fmt.Errorf("could not decode log message from json array: %w", err)
+	}
+	if err := w.setTime(); err != nil {
 		return msg, fmt.Errorf("could not decode log message from json array: %w", err)
 	}
+
+	return dec.decodeRecord(msg)
+}
+
+// decodeRecord decodes RawRecord into typed Record according to the event type.
+func (dec decoder) decodeRecord(msg Event) (Event, error) {
+	// Record is always derived from RawRecord and never decoded from json directly
+	msg.Record = nil
 	var unmarshalErr error
 	switch msg.Type {
 	case TypePlatformInitStart:
 		record := RecordPlatformInitStart{}
-		unmarshalErr = json.Unmarshal(msg.RawRecord, &record)
+		unmarshalErr = dec.unmarshalRecord(msg.RawRecord, &record)
 		msg.Record = record
 	case TypePlatformInitRuntimeDone:
 		record := RecordPlatformInitRuntimeDone{}
-		unmarshalErr = json.Unmarshal(msg.RawRecord, &record)
+		unmarshalErr = dec.unmarshalRecord(msg.RawRecord, &record)
 		msg.Record = record
 	case TypePlatformInitReport:
 		record := RecordPlatformInitReport{}
-		unmarshalErr = json.Unmarshal(msg.RawRecord, &record)
+		unmarshalErr = dec.unmarshalRecord(msg.RawRecord, &record)
 		msg.Record = record
 	case TypePlatformStart:
 		record := RecordPlatformStart{}
-		unmarshalErr = json.Unmarshal(msg.RawRecord, &record)
+		unmarshalErr = dec.unmarshalRecord(msg.RawRecord, &record)
 		msg.Record = record
 	case TypePlatformRuntimeDone:
 		record := RecordPlatformRuntimeDone{}
-		unmarshalErr = json.Unmarshal(msg.RawRecord, &record)
+		unmarshalErr = dec.unmarshalRecord(msg.RawRecord, &record)
 		msg.Record = record
 	case TypePlatformReport:
 		record := RecordPlatformReport{}
-		unmarshalErr = json.Unmarshal(msg.RawRecord, &record)
+		unmarshalErr = dec.unmarshalRecord(msg.RawRecord, &record)
+		msg.Record = record
+	case TypePlatformRestoreStart:
+		record := RecordPlatformRestoreStart{}
+		unmarshalErr = dec.unmarshalRecord(msg.RawRecord, &record)
+		msg.Record = record
+	case TypePlatformRestoreRuntimeDone:
+		record := RecordPlatformRestoreRuntimeDone{}
+		unmarshalErr = dec.unmarshalRecord(msg.RawRecord, &record)
+		msg.Record = record
+	case TypePlatformRestoreReport:
+		record := RecordPlatformRestoreReport{}
+		unmarshalErr = dec.unmarshalRecord(msg.RawRecord, &record)
 		msg.Record = record
 	case TypePlatformExtension:
 		record := RecordPlatformExtension{}
-		unmarshalErr = json.Unmarshal(msg.RawRecord, &record)
+		unmarshalErr = dec.unmarshalRecord(msg.RawRecord, &record)
 		msg.Record = record
 	case TypePlatformTelemetrySubscription:
 		record := RecordPlatformTelemetrySubscription{}
-		unmarshalErr = json.Unmarshal(msg.RawRecord, &record)
+		unmarshalErr = dec.unmarshalRecord(msg.RawRecord, &record)
 		msg.Record = record
 	case TypePlatformLogsDropped:
 		record := RecordPlatformLogsDropped{}
-		unmarshalErr = json.Unmarshal(msg.RawRecord, &record)
+		unmarshalErr = dec.unmarshalRecord(msg.RawRecord, &record)
 		msg.Record = record
 	case TypeFunction:
 		record := RecordFunction("")
-		unmarshalErr = json.Unmarshal(msg.RawRecord, &record)
+		unmarshalErr = dec.unmarshalRecord(msg.RawRecord, &record)
 		msg.Record = record
 	case TypeExtension:
 		record := RecordExtension("")
-		unmarshalErr = json.Unmarshal(msg.RawRecord, &record)
+		unmarshalErr = dec.unmarshalRecord(msg.RawRecord, &record)
 		msg.Record = record
 	default:
+		if dec.ignoreUnknownTypes {
+			// keep RawRecord as it is the only representation of unknown event type
+			dec.log.Info("could not decode unknown event type, leaving Record empty", "type", msg.Type, "record", string(msg.RawRecord))
+
+			return msg, nil
+		}
+
 		return msg, fmt.Errorf(`could not decode unknown event type "%s" and record "%s"`, msg.Type, msg.RawRecord)
 	}
 	if unmarshalErr != nil {
 		return msg, fmt.Errorf("could not decode log record %s for event type %s with error: %w", msg.RawRecord, msg.Type, unmarshalErr)
 	}
+	if dec.validateEnums {
+		if err := validateEnums(msg.Record); err != nil {
+			return msg, fmt.Errorf("invalid log record %s for event type %s: %w", msg.RawRecord, msg.Type, err)
+		}
+	}
+
+	if dec.dropRawRecord {
+		msg.RawRecord = nil
+	}
 
 	return msg, nil
 }
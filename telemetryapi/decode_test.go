@@ -1,6 +1,7 @@
 package telemetryapi_test
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"io"
@@ -42,6 +43,7 @@ func TestDecode(t *testing.T) {
 				{
 					Type:      telemetryapi.TypePlatformStart,
 					Time:      time.Date(2020, 8, 20, 12, 31, 32, 0, time.UTC),
+					RawTime:   json.RawMessage(`"2020-08-20T12:31:32.0Z"`),
 					RawRecord: json.RawMessage(`{"requestId": "6f7f0961f83442118a7af6fe80b88d56"}`),
 					Record: telemetryapi.RecordPlatformStart{
 						RequestID: "6f7f0961f83442118a7af6fe80b88d56",
@@ -51,6 +53,7 @@ func TestDecode(t *testing.T) {
 				{
 					Type:      telemetryapi.TypePlatformLogsDropped,
 					Time:      time.Date(2020, 8, 20, 12, 31, 32, 0, time.UTC),
+					RawTime:   json.RawMessage(`"2020-08-20T12:31:32.0Z"`),
 					RawRecord: json.RawMessage(`{"droppedBytes": 2, "droppedRecords": 3, "reason": "error"}`),
 					Record: telemetryapi.RecordPlatformLogsDropped{
 						DroppedBytes:   2,
@@ -60,6 +63,18 @@ func TestDecode(t *testing.T) {
 				},
 			},
 		},
+		{
+			name:              "empty array",
+			response:          `[]`,
+			wantErrorContains: "",
+			want:              nil,
+		},
+		{
+			name:              "empty array with whitespace",
+			response:          "\n[ \t\n]\n",
+			wantErrorContains: "",
+			want:              nil,
+		},
 		{
 			name: "unknown event type",
 			response: `[
@@ -87,6 +102,7 @@ func TestDecode(t *testing.T) {
 				{
 					Type:      telemetryapi.TypePlatformStart,
 					Time:      time.Date(2020, 8, 20, 12, 31, 32, 0, time.UTC),
+					RawTime:   json.RawMessage(`"2020-08-20T12:31:32.0Z"`),
 					RawRecord: json.RawMessage(`{"requestId": "6f7f0961f83442118a7af6fe80b88d56"}`),
 					Record: telemetryapi.RecordPlatformStart{
 						RequestID: "6f7f0961f83442118a7af6fe80b88d56",
@@ -402,6 +418,102 @@ func TestDecode_EventTypes(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "platform.restoreStart",
+			response: `[
+				{
+					"time": "2022-10-12T00:00:15.064Z",
+					"type": "platform.restoreStart",
+					"record": {
+						"runtimeVersion": "java-11.v15",
+						"runtimeVersionArn": "arn:aws:lambda:us-east-1::runtime:5a8ec0cb45cdc3d9c1fcfc4d3a9a4eb4f5c1e4c8e4b1b2d3e4f5a6b7c8d9e0f1",
+						"functionName": "my-snapstart-function",
+						"functionVersion": "3",
+						"instanceId": "2023/01/01/[3]4b1a0e7d6c5b4a3f2e1d0c9b8a7f6e5d",
+						"instanceMaxMemory": 3008
+					}
+				}
+			]`,
+			want: telemetryapi.Event{
+				Type: telemetryapi.TypePlatformRestoreStart,
+				Time: time.Date(2022, 10, 12, 0, 0, 15, 64000000, time.UTC),
+				RawRecord: json.RawMessage(`{
+						"runtimeVersion": "java-11.v15",
+						"runtimeVersionArn": "arn:aws:lambda:us-east-1::runtime:5a8ec0cb45cdc3d9c1fcfc4d3a9a4eb4f5c1e4c8e4b1b2d3e4f5a6b7c8d9e0f1",
+						"functionName": "my-snapstart-function",
+						"functionVersion": "3",
+						"instanceId": "2023/01/01/[3]4b1a0e7d6c5b4a3f2e1d0c9b8a7f6e5d",
+						"instanceMaxMemory": 3008
+				}`),
+				Record: telemetryapi.RecordPlatformRestoreStart{
+					RuntimeVersion:    "java-11.v15",
+					RuntimeVersionARN: "arn:aws:lambda:us-east-1::runtime:5a8ec0cb45cdc3d9c1fcfc4d3a9a4eb4f5c1e4c8e4b1b2d3e4f5a6b7c8d9e0f1",
+					FunctionName:      "my-snapstart-function",
+					FunctionVersion:   "3",
+					InstanceID:        "2023/01/01/[3]4b1a0e7d6c5b4a3f2e1d0c9b8a7f6e5d",
+					InstanceMaxMemory: 3008,
+				},
+			},
+		},
+		{
+			name: "platform.restoreRuntimeDone",
+			response: `[
+				{
+					"time": "2022-10-12T00:00:15.064Z",
+					"type": "platform.restoreRuntimeDone",
+					"record": {
+						"status": "success",
+						"spans": []
+					}
+				}
+			]`,
+			want: telemetryapi.Event{
+				Type: telemetryapi.TypePlatformRestoreRuntimeDone,
+				Time: time.Date(2022, 10, 12, 0, 0, 15, 64000000, time.UTC),
+				RawRecord: json.RawMessage(`{
+						"status": "success",
+						"spans": []
+				}`),
+				Record: telemetryapi.RecordPlatformRestoreRuntimeDone{
+					Status: telemetryapi.StatusSuccess,
+					Spans:  []telemetryapi.Span{},
+				},
+			},
+		},
+		{
+			name: "platform.restoreReport",
+			response: `[
+				{
+					"time": "2022-10-12T00:00:15.064Z",
+					"type": "platform.restoreReport",
+					"record": {
+						"status": "success",
+						"metrics": {
+							"durationMs": 15.19
+						},
+						"spans": []
+					}
+				}
+			]`,
+			want: telemetryapi.Event{
+				Type: telemetryapi.TypePlatformRestoreReport,
+				Time: time.Date(2022, 10, 12, 0, 0, 15, 64000000, time.UTC),
+				RawRecord: json.RawMessage(`{
+						"status": "success",
+						"metrics": {
+							"durationMs": 15.19
+						},
+						"spans": []
+				}`),
+				Record: telemetryapi.RecordPlatformRestoreReport{
+					Status: telemetryapi.StatusSuccess,
+					Metrics: telemetryapi.RestoreReportMetrics{
+						Duration: lambdaext.DurationMs(15190 * time.Microsecond),
+					},
+					Spans: []telemetryapi.Span{},
+				},
+			},
+		},
 		{
 			name: "platform.extension",
 			response: `[
@@ -498,6 +610,7 @@ func TestDecode_EventTypes(t *testing.T) {
 			want: telemetryapi.Event{
 				Type:      telemetryapi.TypeFunction,
 				Time:      time.Date(2020, 8, 20, 12, 31, 32, 0, time.UTC),
+				RawTime:   json.RawMessage(`"2020-08-20T12:31:32.0Z"`),
 				RawRecord: json.RawMessage(`"Hello from function"`),
 				Record:    telemetryapi.RecordFunction("Hello from function"),
 			},
@@ -514,6 +627,7 @@ func TestDecode_EventTypes(t *testing.T) {
 			want: telemetryapi.Event{
 				Type:      telemetryapi.TypeExtension,
 				Time:      time.Date(2020, 8, 20, 12, 31, 32, 0, time.UTC),
+				RawTime:   json.RawMessage(`"2020-08-20T12:31:32.0Z"`),
 				RawRecord: json.RawMessage(`"Hello from extension"`),
 				Record:    telemetryapi.RecordExtension("Hello from extension"),
 			},
@@ -537,3 +651,167 @@ func TestDecode_EventTypes(t *testing.T) {
 		})
 	}
 }
+
+func TestEvent_UnmarshalJSON(t *testing.T) {
+	data := []byte(`{
+		"time": "2022-10-12T00:03:50.000Z",
+		"type": "platform.report",
+		"record": {
+			"requestId": "6f7f0961f83442118a7af6fe80b88d56",
+			"status": "success",
+			"metrics": {
+				"durationMs": 693.92,
+				"billedDurationMs": 694,
+				"memorySizeMB": 128,
+				"maxMemoryUsedMB": 76
+			}
+		}
+	}`)
+	want := telemetryapi.RecordPlatformReport{
+		RequestID: "6f7f0961f83442118a7af6fe80b88d56",
+		Status:    telemetryapi.StatusSuccess,
+		Metrics: telemetryapi.ReportMetrics{
+			BilledDuration:  lambdaext.DurationMs(694 * time.Millisecond),
+			Duration:        lambdaext.DurationMs(693920 * time.Microsecond),
+			MaxMemoryUsedMB: 76,
+			MemorySizeMB:    128,
+		},
+	}
+
+	event := telemetryapi.Event{}
+	require.NoError(t, json.Unmarshal(data, &event))
+	require.Equal(t, telemetryapi.TypePlatformReport, event.Type)
+	require.Equal(t, time.Date(2022, 10, 12, 0, 3, 50, 0, time.UTC), event.Time)
+	require.Equal(t, want, event.Record)
+
+	// round trip through json.Marshal
+	b, err := json.Marshal(event)
+	require.NoError(t, err)
+	roundTrip := telemetryapi.Event{}
+	require.NoError(t, json.Unmarshal(b, &roundTrip))
+	require.Equal(t, want, roundTrip.Record)
+
+	err = json.Unmarshal([]byte(`{"time":"2022-10-12T00:03:50.000Z","type":"platform.unknown","record":{}}`), &event)
+	require.ErrorContains(t, err, `could not decode unknown event type "platform.unknown"`)
+}
+
+func TestEvent_UnmarshalJSON_LargeNumbers(t *testing.T) {
+	data := []byte(`{
+		"time": "2022-10-12T00:03:50.000Z",
+		"type": "platform.runtimeDone",
+		"record": {
+			"requestId": "6f7f0961f83442118a7af6fe80b88d56",
+			"status": "success",
+			"metrics": {
+				"durationMs": 140.0,
+				"producedBytes": 6442450944
+			}
+		}
+	}`)
+	event := telemetryapi.Event{}
+	require.NoError(t, json.Unmarshal(data, &event))
+	record := event.Record.(telemetryapi.RecordPlatformRuntimeDone)
+	require.Equal(t, lambdaext.Int64(6442450944), record.Metrics.ProducedBytes)
+
+	data = []byte(`{
+		"time": "2022-10-12T00:03:50.000Z",
+		"type": "platform.logsDropped",
+		"record": {
+			"droppedBytes": 1.5e10,
+			"droppedRecords": 2E3,
+			"reason": "Consumer seems to have fallen behind as it has not acknowledged receipt of logs."
+		}
+	}`)
+	require.NoError(t, json.Unmarshal(data, &event))
+	dropped := event.Record.(telemetryapi.RecordPlatformLogsDropped)
+	require.Equal(t, lambdaext.Int64(15000000000), dropped.DroppedBytes)
+	require.Equal(t, lambdaext.Int64(2000), dropped.DroppedRecords)
+}
+
+func TestDecodeNoDrain(t *testing.T) {
+	trailer := strings.Repeat("x", 64*1024)
+	r := strings.NewReader(`[{"time":"2020-08-20T12:31:32.0Z","type":"function","record":"Hello world"}]` + trailer)
+	events := make(chan telemetryapi.Event, 1)
+
+	rest, err := telemetryapi.DecodeNoDrain(context.Background(), r, events)
+	require.NoError(t, err)
+	require.Equal(t, telemetryapi.RecordFunction("Hello world"), (<-events).Record)
+	require.NotZero(t, r.Len(), "trailing bytes must be left unread")
+
+	got, err := io.ReadAll(rest)
+	require.NoError(t, err)
+	require.Equal(t, trailer, string(got))
+}
+
+func TestDecodeReader(t *testing.T) {
+	r := bytes.NewReader([]byte(`[{"time":"2020-08-20T12:31:32.0Z","type":"function","record":"Hello world"}]` + "\n"))
+	events := make(chan telemetryapi.Event, 1)
+
+	err := telemetryapi.DecodeReader(context.Background(), r, events)
+	require.NoError(t, err)
+	require.Equal(t, telemetryapi.RecordFunction("Hello world"), (<-events).Record)
+	require.Zero(t, r.Len(), "input must be drained")
+}
+
+func TestStatusAndPhase_IsValid(t *testing.T) {
+	require.True(t, telemetryapi.StatusTimeout.IsValid())
+	require.False(t, telemetryapi.Status("throttled").IsValid())
+	require.False(t, telemetryapi.Status("").IsValid())
+	require.True(t, telemetryapi.PhaseInvoke.IsValid())
+	require.False(t, telemetryapi.Phase("restore").IsValid())
+}
+
+func TestDecode_TimePrecision(t *testing.T) {
+	t.Parallel()
+
+	plus2 := time.FixedZone("", 2*60*60)
+	tests := []struct {
+		value string
+		want  time.Time
+	}{
+		{"2020-08-20T12:31:32Z", time.Date(2020, 8, 20, 12, 31, 32, 0, time.UTC)},
+		{"2020-08-20T12:31:32.0Z", time.Date(2020, 8, 20, 12, 31, 32, 0, time.UTC)},
+		{"2020-08-20T12:31:32.123Z", time.Date(2020, 8, 20, 12, 31, 32, 123000000, time.UTC)},
+		{"2020-08-20T12:31:32.123456Z", time.Date(2020, 8, 20, 12, 31, 32, 123456000, time.UTC)},
+		{"2020-08-20T12:31:32.123456789Z", time.Date(2020, 8, 20, 12, 31, 32, 123456789, time.UTC)},
+		{"2020-08-20T12:31:32.123456+00:00", time.Date(2020, 8, 20, 12, 31, 32, 123456000, time.UTC)},
+		{"2020-08-20T14:31:32.123+02:00", time.Date(2020, 8, 20, 14, 31, 32, 123000000, plus2)},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.value, func(t *testing.T) {
+			t.Parallel()
+
+			input := `[{
+				"time": "` + tt.value + `",
+				"type": "platform.runtimeDone",
+				"record": {
+					"requestId": "6d68ca91-49c9-448d-89b8-7ca3e6dc66aa",
+					"status": "success",
+					"spans": [{"name": "responseLatency", "start": "` + tt.value + `", "durationMs": 70.5}]
+				}
+			}]`
+			eventsCh := make(chan telemetryapi.Event, 1)
+			require.NoError(t, telemetryapi.Decode(context.Background(), io.NopCloser(strings.NewReader(input)), eventsCh))
+			event := <-eventsCh
+
+			require.True(t, tt.want.Equal(event.Time), "Event.Time %s", event.Time)
+			record, ok := event.AsPlatformRuntimeDone()
+			require.True(t, ok)
+			require.True(t, tt.want.Equal(record.Spans[0].Start), "Span.Start %s", record.Spans[0].Start)
+
+			// round trip through json.Marshal
+			b, err := json.Marshal(event)
+			require.NoError(t, err)
+			roundTrip := telemetryapi.Event{}
+			require.NoError(t, json.Unmarshal(b, &roundTrip))
+			require.True(t, tt.want.Equal(roundTrip.Time))
+			require.True(t, tt.want.Equal(roundTrip.Record.(telemetryapi.RecordPlatformRuntimeDone).Spans[0].Start))
+
+			// round trip through RawEvent
+			rawRoundTrip := telemetryapi.Event{}
+			require.NoError(t, json.Unmarshal(event.RawEvent(), &rawRoundTrip))
+			require.True(t, tt.want.Equal(rawRoundTrip.Time), "RawEvent %s", event.RawEvent())
+		})
+	}
+}
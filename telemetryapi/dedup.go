@@ -0,0 +1,24 @@
+package telemetryapi
+
+import (
+	lambdaext "github.com/zakharovvi/aws-lambda-extensions"
+	"github.com/zakharovvi/aws-lambda-extensions/internal"
+)
+
+type dedupKey struct {
+	requestID lambdaext.RequestID
+	eventType Type
+}
+
+// newDedupFilter returns a filter dropping events with recently seen request id and type pair.
+// Events without request id, e.g. function and extension log lines, are always passed.
+// The filter is called once per received event before Processor.Process, so retries of a failed event are not dropped.
+func newDedupFilter(window int) func(Event) bool {
+	seen := internal.NewLRUSet[dedupKey](window)
+
+	return func(event Event) bool {
+		requestID := RequestIDKey(event)
+
+		return requestID == "" || !seen.Add(dedupKey{lambdaext.RequestID(requestID), event.Type})
+	}
+}
@@ -0,0 +1,8 @@
+// Package firehose implements telemetryapi.Processor to deliver Telemetry API events into Amazon Kinesis Data Firehose.
+// https://docs.aws.amazon.com/firehose/latest/APIReference/API_PutRecordBatch.html
+//
+// Processor batches events and sends them with PutRecordBatch calls.
+// Each event is serialized into its original Telemetry API JSON representation with telemetryapi.Event.RawEvent followed by a newline.
+// Delivery is at-least-once: records failed within a partially successful batch are retried
+// and can be delivered more than once when Firehose reported a failure for a record which was actually persisted.
+package firehose
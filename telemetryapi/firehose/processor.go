@@ -0,0 +1,204 @@
+package firehose
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	"github.com/zakharovvi/aws-lambda-extensions/extapi"
+	"github.com/zakharovvi/aws-lambda-extensions/telemetryapi"
+)
+
+// Kinesis Data Firehose PutRecordBatch quotas.
+// https://docs.aws.amazon.com/firehose/latest/dev/limits.html
+const (
+	// MaxBatchRecords is the maximum number of records in a single PutRecordBatch call.
+	MaxBatchRecords = 500
+	// MaxBatchBytes is the maximum size of all records in a single PutRecordBatch call.
+	MaxBatchBytes = 4 * 1024 * 1024
+	// MaxRecordBytes is the maximum size of a single record.
+	MaxRecordBytes = 1000 * 1024
+)
+
+// Client is a minimal subset of Kinesis Data Firehose API used by Processor.
+// Wrap firehose.Client from AWS SDK to implement it.
+type Client interface {
+	// PutRecordBatch writes multiple records into a delivery stream in a single call.
+	// It returns indexes of the records which were not delivered in a partially successful call.
+	// Error should be returned only if the whole call failed.
+	PutRecordBatch(ctx context.Context, deliveryStreamName string, records [][]byte) (failedIndexes []int, err error)
+}
+
+type Option interface {
+	apply(*options)
+}
+
+type options struct {
+	log             logr.Logger
+	maxBatchRecords int
+	maxBatchBytes   int
+	maxRetries      int
+}
+
+type loggerOption struct {
+	log logr.Logger
+}
+
+func (o loggerOption) apply(opts *options) {
+	opts.log = o.log
+}
+
+func WithLogger(log logr.Logger) Option {
+	return loggerOption{log}
+}
+
+type maxBatchRecordsOption int
+
+func (o maxBatchRecordsOption) apply(opts *options) {
+	opts.maxBatchRecords = int(o)
+}
+
+// WithMaxBatchRecords configures the number of buffered records to trigger a flush. It can't exceed MaxBatchRecords.
+func WithMaxBatchRecords(n int) Option {
+	return maxBatchRecordsOption(n)
+}
+
+type maxBatchBytesOption int
+
+func (o maxBatchBytesOption) apply(opts *options) {
+	opts.maxBatchBytes = int(o)
+}
+
+// WithMaxBatchBytes configures the size of buffered records to trigger a flush. It can't exceed MaxBatchBytes.
+func WithMaxBatchBytes(n int) Option {
+	return maxBatchBytesOption(n)
+}
+
+type maxRetriesOption int
+
+func (o maxRetriesOption) apply(opts *options) {
+	opts.maxRetries = int(o)
+}
+
+// WithMaxRetries configures how many times records failed in a partially successful batch are resent.
+// Records which are still failing after all retries are dropped and logged. Default is 3.
+func WithMaxRetries(n int) Option {
+	return maxRetriesOption(n)
+}
+
+// Processor implements telemetryapi.Processor interface to deliver Telemetry API events into Kinesis Data Firehose.
+// Processor should be passed into telemetryapi.Run instead of direct usage.
+type Processor struct {
+	client             Client
+	deliveryStreamName string
+	log                logr.Logger
+	maxBatchRecords    int
+	maxBatchBytes      int
+	maxRetries         int
+	batch              [][]byte
+	batchBytes         int
+}
+
+// NewProcessor creates Processor with provided Client and delivery stream name.
+func NewProcessor(ctx context.Context, client Client, deliveryStreamName string, opts ...Option) *Processor {
+	options := options{
+		log:             logr.FromContextOrDiscard(ctx),
+		maxBatchRecords: MaxBatchRecords,
+		maxBatchBytes:   MaxBatchBytes,
+		maxRetries:      3,
+	}
+	for _, o := range opts {
+		o.apply(&options)
+	}
+	if options.maxBatchRecords <= 0 || options.maxBatchRecords > MaxBatchRecords {
+		options.maxBatchRecords = MaxBatchRecords
+	}
+	if options.maxBatchBytes <= 0 || options.maxBatchBytes > MaxBatchBytes {
+		options.maxBatchBytes = MaxBatchBytes
+	}
+
+	return &Processor{
+		client:             client,
+		deliveryStreamName: deliveryStreamName,
+		log:                options.log,
+		maxBatchRecords:    options.maxBatchRecords,
+		maxBatchBytes:      options.maxBatchBytes,
+		maxRetries:         options.maxRetries,
+		batch:              make([][]byte, 0, options.maxBatchRecords),
+	}
+}
+
+func (proc *Processor) Init(ctx context.Context, registerResp *extapi.RegisterResponse) error {
+	return nil
+}
+
+func (proc *Processor) Process(ctx context.Context, event telemetryapi.Event) error {
+	// records are newline delimited for the destination to split concatenated records
+	record := append(event.RawEvent(), '\n')
+	if len(record) > MaxRecordBytes {
+		proc.log.Info("dropping event exceeding Firehose record size limit", "type", event.Type, "bytes", len(record))
+
+		return nil
+	}
+
+	if len(proc.batch)+1 > proc.maxBatchRecords || proc.batchBytes+len(record) > proc.maxBatchBytes {
+		if err := proc.flush(ctx); err != nil {
+			return err
+		}
+	}
+	proc.batch = append(proc.batch, record)
+	proc.batchBytes += len(record)
+
+	if len(proc.batch) >= proc.maxBatchRecords {
+		return proc.flush(ctx)
+	}
+
+	return nil
+}
+
+func (proc *Processor) Shutdown(ctx context.Context, reason extapi.ShutdownReason, err error) error {
+	proc.log.V(1).Info("flushing buffered records before shutdown", "count", len(proc.batch))
+
+	return proc.flush(ctx)
+}
+
+// flush sends buffered records to Firehose. Buffer is kept if the whole call failed to retry it on the next flush.
+func (proc *Processor) flush(ctx context.Context) error {
+	records := proc.batch
+	for attempt := 0; len(records) > 0; attempt++ {
+		proc.log.V(1).Info("sending records to Firehose", "count", len(records), "attempt", attempt)
+		failedIndexes, err := proc.client.PutRecordBatch(ctx, proc.deliveryStreamName, records)
+		if err != nil {
+			proc.batch = records
+			proc.batchBytes = batchBytes(records)
+
+			return fmt.Errorf("Firehose PutRecordBatch failed: %w", err)
+		}
+
+		failed := make([][]byte, 0, len(failedIndexes))
+		for _, i := range failedIndexes {
+			failed = append(failed, records[i])
+		}
+		records = failed
+
+		if len(records) > 0 && attempt >= proc.maxRetries {
+			proc.log.Info("dropping records failed after all retries", "count", len(records), "attempts", attempt+1)
+
+			break
+		}
+	}
+
+	proc.batch = proc.batch[:0]
+	proc.batchBytes = 0
+
+	return nil
+}
+
+func batchBytes(records [][]byte) int {
+	n := 0
+	for _, r := range records {
+		n += len(r)
+	}
+
+	return n
+}
@@ -0,0 +1,143 @@
+package firehose_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zakharovvi/aws-lambda-extensions/extapi"
+	"github.com/zakharovvi/aws-lambda-extensions/telemetryapi"
+	"github.com/zakharovvi/aws-lambda-extensions/telemetryapi/firehose"
+)
+
+type putCall struct {
+	streamName string
+	records    []string
+}
+
+type testClient struct {
+	calls         []putCall
+	failedIndexes [][]int
+	errs          []error
+}
+
+func (c *testClient) PutRecordBatch(ctx context.Context, deliveryStreamName string, records [][]byte) ([]int, error) {
+	call := putCall{streamName: deliveryStreamName}
+	for _, r := range records {
+		call.records = append(call.records, string(r))
+	}
+	c.calls = append(c.calls, call)
+
+	var failed []int
+	if len(c.failedIndexes) > 0 {
+		failed = c.failedIndexes[0]
+		c.failedIndexes = c.failedIndexes[1:]
+	}
+	var err error
+	if len(c.errs) > 0 {
+		err = c.errs[0]
+		c.errs = c.errs[1:]
+	}
+
+	return failed, err
+}
+
+func newEvent(requestID string) telemetryapi.Event {
+	return telemetryapi.Event{
+		Type:      telemetryapi.TypePlatformStart,
+		Time:      time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+		RawRecord: json.RawMessage(fmt.Sprintf(`{"requestId":"%s"}`, requestID)),
+		Record:    telemetryapi.RecordPlatformStart{RequestID: "1"},
+	}
+}
+
+func wireJSON(requestID string) string {
+	return fmt.Sprintf(`{"time":"2022-01-01T00:00:00.000Z","type":"platform.start","record":{"requestId":"%s"}}`+"\n", requestID)
+}
+
+func TestProcessor_FlushOnShutdown(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	client := &testClient{}
+	proc := firehose.NewProcessor(ctx, client, "test-stream")
+	require.NoError(t, proc.Init(ctx, &extapi.RegisterResponse{}))
+
+	require.NoError(t, proc.Process(ctx, newEvent("1")))
+	require.NoError(t, proc.Process(ctx, newEvent("2")))
+	require.Empty(t, client.calls)
+
+	require.NoError(t, proc.Shutdown(ctx, extapi.Spindown, nil))
+	require.Equal(t, []putCall{{"test-stream", []string{wireJSON("1"), wireJSON("2")}}}, client.calls)
+}
+
+func TestProcessor_FlushOnMaxBatchRecords(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	client := &testClient{}
+	proc := firehose.NewProcessor(ctx, client, "test-stream", firehose.WithMaxBatchRecords(2))
+
+	for i := 1; i <= 3; i++ {
+		require.NoError(t, proc.Process(ctx, newEvent(fmt.Sprint(i))))
+	}
+	require.Equal(t, []putCall{{"test-stream", []string{wireJSON("1"), wireJSON("2")}}}, client.calls)
+
+	require.NoError(t, proc.Shutdown(ctx, extapi.Spindown, nil))
+	require.Len(t, client.calls, 2)
+	require.Equal(t, []string{wireJSON("3")}, client.calls[1].records)
+}
+
+func TestProcessor_FlushOnMaxBatchBytes(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	client := &testClient{}
+	proc := firehose.NewProcessor(ctx, client, "test-stream", firehose.WithMaxBatchBytes(len(wireJSON("1"))*2))
+
+	for i := 1; i <= 3; i++ {
+		require.NoError(t, proc.Process(ctx, newEvent(fmt.Sprint(i))))
+	}
+	require.Equal(t, []putCall{{"test-stream", []string{wireJSON("1"), wireJSON("2")}}}, client.calls)
+}
+
+func TestProcessor_PartialFailure(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	client := &testClient{
+		failedIndexes: [][]int{{1, 2}, {0}, {0}},
+	}
+	proc := firehose.NewProcessor(ctx, client, "test-stream", firehose.WithMaxRetries(2))
+
+	for i := 1; i <= 3; i++ {
+		require.NoError(t, proc.Process(ctx, newEvent(fmt.Sprint(i))))
+	}
+	require.NoError(t, proc.Shutdown(ctx, extapi.Spindown, nil))
+
+	require.Len(t, client.calls, 3)
+	require.Equal(t, []string{wireJSON("2"), wireJSON("3")}, client.calls[1].records, "failed records should be retried")
+	require.Equal(t, []string{wireJSON("2")}, client.calls[2].records, "record should be dropped after all retries")
+}
+
+func TestProcessor_CallFailure(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	client := &testClient{
+		errs: []error{errors.New("throttled")},
+	}
+	proc := firehose.NewProcessor(ctx, client, "test-stream")
+
+	require.NoError(t, proc.Process(ctx, newEvent("1")))
+	require.EqualError(t, proc.Shutdown(ctx, extapi.Spindown, nil), "Firehose PutRecordBatch failed: throttled")
+
+	// records are kept in the buffer and resent on the next flush
+	require.NoError(t, proc.Shutdown(ctx, extapi.Spindown, nil))
+	require.Len(t, client.calls, 2)
+	require.Equal(t, []string{wireJSON("1")}, client.calls[1].records)
+}
@@ -0,0 +1,244 @@
+package telemetryapi
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/zakharovvi/aws-lambda-extensions/extapi"
+)
+
+// maxForwardBatches is the number of batches kept buffered while the forwarding target is unavailable.
+const maxForwardBatches = 10
+
+// ForwardOption configures NewHTTPForwardProcessor.
+type ForwardOption interface {
+	applyForward(*forwardOptions)
+}
+
+type forwardOptions struct {
+	log       logr.Logger
+	batchSize int
+	attempts  int
+	backoff   time.Duration
+}
+
+type forwardLoggerOption struct {
+	log logr.Logger
+}
+
+func (o forwardLoggerOption) applyForward(opts *forwardOptions) {
+	opts.log = o.log
+}
+
+// WithForwardLogger configures the logger of the forwarding Processor.
+func WithForwardLogger(log logr.Logger) ForwardOption {
+	return forwardLoggerOption{log}
+}
+
+type forwardBatchSizeOption int
+
+func (o forwardBatchSizeOption) applyForward(opts *forwardOptions) {
+	opts.batchSize = int(o)
+}
+
+// WithForwardBatchSize configures the number of buffered events to trigger a POST request. Default is 100.
+func WithForwardBatchSize(n int) ForwardOption {
+	return forwardBatchSizeOption(n)
+}
+
+type forwardRetryOption struct {
+	attempts int
+	backoff  time.Duration
+}
+
+func (o forwardRetryOption) applyForward(opts *forwardOptions) {
+	opts.attempts = o.attempts
+	opts.backoff = o.backoff
+}
+
+// WithForwardRetry configures the forwarding Processor to POST a batch up to attempts times on network errors,
+// 429 and 5xx responses. The delay between attempts starts with backoff and doubles after every failed attempt.
+// By default, a batch is sent 3 times with 100ms initial backoff.
+func WithForwardRetry(attempts int, backoff time.Duration) ForwardOption {
+	return forwardRetryOption{attempts, backoff}
+}
+
+// NewHTTPForwardProcessor creates a Processor re-POSTing received events to url for fan-out to another extension
+// or a collector. Events are batched and sent as a JSON array in the original form received from Telemetry API,
+// see Event.RawEvent, so the target can decode them with Decode.
+//
+// Buffered events are sent once the batch is full, by Flush and on Shutdown, so it can be combined with WithFlushInterval.
+// If the target is temporarily unavailable, failed batches are kept and resent with the next request.
+// Batches rejected with other 4xx responses are dropped and logged.
+// At most 10 batches are kept, the oldest events are dropped and logged when the limit is exceeded.
+// Only the failure to forward buffered events on Shutdown is returned as an error not to stop the extension.
+// http.DefaultClient is used if httpClient is nil.
+func NewHTTPForwardProcessor(url string, httpClient *http.Client, opts ...ForwardOption) Processor {
+	options := forwardOptions{
+		log:       logr.Discard(),
+		batchSize: 100,
+		attempts:  3,
+		backoff:   100 * time.Millisecond,
+	}
+	for _, o := range opts {
+		o.applyForward(&options)
+	}
+	if options.batchSize < 1 {
+		options.batchSize = 1
+	}
+	if options.attempts < 1 {
+		options.attempts = 1
+	}
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	return &forwardProcessor{
+		url:        url,
+		httpClient: httpClient,
+		log:        options.log,
+		batchSize:  options.batchSize,
+		attempts:   options.attempts,
+		backoff:    options.backoff,
+	}
+}
+
+type forwardProcessor struct {
+	url        string
+	httpClient *http.Client
+	log        logr.Logger
+	batchSize  int
+	attempts   int
+	backoff    time.Duration
+	// events are encoded events waiting to be sent
+	events [][]byte
+}
+
+func (p *forwardProcessor) Init(ctx context.Context, registerResp *extapi.RegisterResponse) error {
+	return nil
+}
+
+func (p *forwardProcessor) Process(ctx context.Context, event Event) error {
+	p.events = append(p.events, event.RawEvent())
+	if len(p.events) < p.batchSize {
+		return nil
+	}
+
+	return p.Flush(ctx)
+}
+
+func (p *forwardProcessor) Flush(ctx context.Context) error {
+	if err := p.flush(ctx); err != nil {
+		p.log.Error(err, "could not forward events, keeping them buffered", "count", len(p.events))
+		p.dropOverflow()
+	}
+
+	return nil
+}
+
+func (p *forwardProcessor) Shutdown(ctx context.Context, reason extapi.ShutdownReason, err error) error {
+	p.log.V(1).Info("forwarding buffered events before shutdown", "count", len(p.events))
+
+	return p.flush(ctx)
+}
+
+// flush sends all buffered events in batches. Events of the failed batch and the following ones are kept buffered.
+func (p *forwardProcessor) flush(ctx context.Context) error {
+	for len(p.events) > 0 {
+		n := len(p.events)
+		if n > p.batchSize {
+			n = p.batchSize
+		}
+		if err := p.post(ctx, p.events[:n]); err != nil {
+			return err
+		}
+		p.events = p.events[n:]
+	}
+	p.events = nil
+
+	return nil
+}
+
+// dropOverflow drops the oldest events exceeding maxForwardBatches batches.
+func (p *forwardProcessor) dropOverflow() {
+	overflow := len(p.events) - maxForwardBatches*p.batchSize
+	if overflow <= 0 {
+		return
+	}
+	p.log.Info("dropping the oldest events, forwarding buffer is full", "count", overflow)
+	p.events = p.events[overflow:]
+}
+
+// post sends the batch as a JSON array with retries and exponential backoff.
+func (p *forwardProcessor) post(ctx context.Context, batch [][]byte) error {
+	body := make([]byte, 0, 2+len(batch)+batchBytes(batch))
+	body = append(body, '[')
+	body = append(body, bytes.Join(batch, []byte{','})...)
+	body = append(body, ']')
+
+	backoff := p.backoff
+	var err error
+	for attempt := 1; ; attempt++ {
+		var retryable bool
+		if retryable, err = p.postOnce(ctx, body); err == nil {
+			return nil
+		}
+		if !retryable {
+			// the target rejected the batch, resending it won't help
+			p.log.Error(err, "dropping events rejected by the forwarding target", "count", len(batch))
+
+			return nil
+		}
+		if attempt >= p.attempts {
+			return fmt.Errorf("could not forward events to %s, attempts made %d: %w", p.url, attempt, err)
+		}
+		p.log.V(1).Info("forwarding events failed, retrying", "error", err.Error(), "attempt", attempt, "backoff", backoff)
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+
+			return fmt.Errorf("forwarding retry interrupted with context error: %w, last error: %v", ctx.Err(), err)
+		case <-timer.C:
+		}
+		backoff *= 2
+	}
+}
+
+// postOnce makes a single POST request and reports whether the failure is retryable.
+func (p *forwardProcessor) postOnce(ctx context.Context, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("could not create forward http request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return true, fmt.Errorf("forward http request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= http.StatusOK && resp.StatusCode < http.StatusMultipleChoices {
+		return false, nil
+	}
+	retryable := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError
+
+	return retryable, fmt.Errorf("forward http request failed with status %s", resp.Status)
+}
+
+func batchBytes(batch [][]byte) int {
+	n := 0
+	for _, b := range batch {
+		n += len(b)
+	}
+
+	return n
+}
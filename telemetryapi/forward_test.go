@@ -0,0 +1,133 @@
+package telemetryapi_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zakharovvi/aws-lambda-extensions/extapi"
+	"github.com/zakharovvi/aws-lambda-extensions/telemetryapi"
+)
+
+// forwardTarget receives forwarded batches and fails the first failures requests with 503.
+type forwardTarget struct {
+	mu       sync.Mutex
+	failures int
+	batches  [][]telemetryapi.Event
+}
+
+func (h *forwardTarget) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.failures > 0 {
+		h.failures--
+		w.WriteHeader(http.StatusServiceUnavailable)
+
+		return
+	}
+	ch := make(chan telemetryapi.Event, 10)
+	if err := telemetryapi.Decode(r.Context(), r.Body, ch); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+
+		return
+	}
+	close(ch)
+	var batch []telemetryapi.Event
+	for event := range ch {
+		batch = append(batch, event)
+	}
+	h.batches = append(h.batches, batch)
+}
+
+func (h *forwardTarget) requestIDs() [][]string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var res [][]string
+	for _, batch := range h.batches {
+		var ids []string
+		for _, event := range batch {
+			ids = append(ids, telemetryapi.RequestIDKey(event))
+		}
+		res = append(res, ids)
+	}
+
+	return res
+}
+
+func forwardEvents(t *testing.T, requestIDs ...string) []telemetryapi.Event {
+	t.Helper()
+
+	var input []string
+	for _, id := range requestIDs {
+		input = append(input, `{"time":"2022-10-12T00:03:50.000Z","type":"platform.start","record":{"requestId":"`+id+`","version":"$LATEST"}}`)
+	}
+	ch := make(chan telemetryapi.Event, len(requestIDs))
+	require.NoError(t, telemetryapi.Decode(context.Background(), io.NopCloser(strings.NewReader("["+strings.Join(input, ",")+"]")), ch))
+	close(ch)
+	var events []telemetryapi.Event
+	for event := range ch {
+		events = append(events, event)
+	}
+
+	return events
+}
+
+func TestNewHTTPForwardProcessor(t *testing.T) {
+	target := &forwardTarget{}
+	server := httptest.NewServer(target)
+	defer server.Close()
+
+	ctx := context.Background()
+	proc := telemetryapi.NewHTTPForwardProcessor(
+		server.URL,
+		server.Client(),
+		telemetryapi.WithForwardBatchSize(2),
+		telemetryapi.WithForwardRetry(2, time.Millisecond),
+	)
+	require.NoError(t, proc.Init(ctx, &extapi.RegisterResponse{}))
+
+	for _, event := range forwardEvents(t, "1", "2", "3") {
+		require.NoError(t, proc.Process(ctx, event))
+	}
+	// the full batch is forwarded immediately
+	require.Equal(t, [][]string{{"1", "2"}}, target.requestIDs())
+
+	require.NoError(t, proc.Shutdown(ctx, extapi.Spindown, nil))
+	require.Equal(t, [][]string{{"1", "2"}, {"3"}}, target.requestIDs())
+	require.JSONEq(t, string(forwardEvents(t, "3")[0].RawEvent()), string(target.batches[1][0].RawEvent()))
+}
+
+func TestNewHTTPForwardProcessor_TargetUnavailable(t *testing.T) {
+	// the first batch fails both attempts, the second one is sent after a retry
+	target := &forwardTarget{failures: 3}
+	server := httptest.NewServer(target)
+	defer server.Close()
+
+	ctx := context.Background()
+	proc := telemetryapi.NewHTTPForwardProcessor(
+		server.URL,
+		server.Client(),
+		telemetryapi.WithForwardBatchSize(2),
+		telemetryapi.WithForwardRetry(2, time.Millisecond),
+	)
+	require.NoError(t, proc.Init(ctx, &extapi.RegisterResponse{}))
+
+	for _, event := range forwardEvents(t, "1", "2") {
+		require.NoError(t, proc.Process(ctx, event), "unavailable target doesn't stop the extension")
+	}
+	require.Empty(t, target.requestIDs())
+
+	flusher, ok := proc.(telemetryapi.Flusher)
+	require.True(t, ok)
+	require.NoError(t, flusher.Flush(ctx))
+	require.Equal(t, [][]string{{"1", "2"}}, target.requestIDs(), "buffered events are resent")
+	require.NoError(t, proc.Shutdown(ctx, extapi.Spindown, nil))
+}
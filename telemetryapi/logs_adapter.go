@@ -0,0 +1,123 @@
+package telemetryapi
+
+import (
+	"context"
+
+	"github.com/zakharovvi/aws-lambda-extensions/extapi"
+	"github.com/zakharovvi/aws-lambda-extensions/logsapi"
+)
+
+// FromLogsProcessor adapts deprecated logsapi.Processor to Processor to migrate to Telemetry API without rewriting processors.
+// Every Event is translated into the closest logsapi.Log and forwarded to logsapi.Processor.Process.
+// Log.Time is copied from the Event and Log.RawRecord keeps the original record in Telemetry API schema.
+//
+// Supported mappings and fields which can't be mapped:
+//   - platform.start is mapped to platform.start. Tracing is dropped.
+//   - platform.runtimeDone is mapped to platform.runtimeDone. ErrorType, Metrics, Tracing and Spans are dropped.
+//     Telemetry API doesn't emit platform.end, so it is never forwarded.
+//   - platform.report is mapped to platform.report. Status and RestoreDuration are dropped.
+//   - platform.extension is mapped to platform.extension.
+//   - platform.telemetrySubscription is mapped to platform.logsSubscription.
+//   - platform.logsDropped is mapped to platform.logsDropped.
+//   - function and extension are mapped to function and extension.
+//
+// platform.init* and platform.restore* events have no counterpart in Logs API and are skipped
+// as well as events of unknown types. logsapi.LogPlatformFault is never forwarded.
+func FromLogsProcessor(proc logsapi.Processor) Processor {
+	return &logsProcessor{proc}
+}
+
+type logsProcessor struct {
+	proc logsapi.Processor
+}
+
+func (p *logsProcessor) Init(ctx context.Context, registerResp *extapi.RegisterResponse) error {
+	return p.proc.Init(ctx, registerResp)
+}
+
+func (p *logsProcessor) Process(ctx context.Context, event Event) error {
+	log, ok := toLog(event)
+	if !ok {
+		return nil
+	}
+
+	return p.proc.Process(ctx, log)
+}
+
+func (p *logsProcessor) Shutdown(ctx context.Context, reason extapi.ShutdownReason, err error) error {
+	return p.proc.Shutdown(ctx, reason, err)
+}
+
+// toLog translates Event into logsapi.Log and returns false if the Event has no Logs API counterpart.
+func toLog(event Event) (logsapi.Log, bool) {
+	log := logsapi.Log{
+		Time:      event.Time,
+		RawRecord: event.RawRecord,
+	}
+	switch record := event.Record.(type) {
+	case RecordPlatformStart:
+		log.LogType = logsapi.LogPlatformStart
+		log.Record = logsapi.RecordPlatformStart{
+			RequestID: record.RequestID,
+			Version:   record.Version,
+		}
+	case RecordPlatformRuntimeDone:
+		log.LogType = logsapi.LogPlatformRuntimeDone
+		log.Record = logsapi.RecordPlatformRuntimeDone{
+			RequestID: record.RequestID,
+			Status:    logsapi.RuntimeDoneStatus(record.Status),
+		}
+	case RecordPlatformReport:
+		log.LogType = logsapi.LogPlatformReport
+		log.Record = logsapi.RecordPlatformReport{
+			Metrics: logsapi.Metrics{
+				Duration:        record.Metrics.Duration,
+				BilledDuration:  record.Metrics.BilledDuration,
+				InitDuration:    record.Metrics.InitDuration,
+				MemorySizeMB:    uint64(record.Metrics.MemorySizeMB),
+				MaxMemoryUsedMB: uint64(record.Metrics.MaxMemoryUsedMB),
+			},
+			RequestID: record.RequestID,
+			Tracing: logsapi.TraceContext{
+				SpanID: record.Tracing.SpanID,
+				Type:   record.Tracing.Type,
+				Value:  record.Tracing.Value,
+			},
+		}
+	case RecordPlatformExtension:
+		log.LogType = logsapi.LogPlatformExtension
+		log.Record = logsapi.RecordPlatformExtension{
+			Events: record.Events,
+			Name:   record.Name,
+			State:  record.State,
+		}
+	case RecordPlatformTelemetrySubscription:
+		types := make([]extapi.LogSubscriptionType, 0, len(record.Types))
+		for _, t := range record.Types {
+			types = append(types, extapi.LogSubscriptionType(t))
+		}
+		log.LogType = logsapi.LogPlatformLogsSubscription
+		log.Record = logsapi.RecordPlatformLogsSubscription{
+			Name:  record.Name,
+			State: record.State,
+			Types: types,
+		}
+	case RecordPlatformLogsDropped:
+		log.LogType = logsapi.LogPlatformLogsDropped
+		log.Record = logsapi.RecordPlatformLogsDropped{
+			DroppedBytes:   uint64(record.DroppedBytes),
+			DroppedRecords: uint64(record.DroppedRecords),
+			Reason:         record.Reason,
+		}
+	case RecordFunction:
+		log.LogType = logsapi.LogFunction
+		log.Record = logsapi.RecordFunction(record)
+	case RecordExtension:
+		log.LogType = logsapi.LogExtension
+		log.Record = logsapi.RecordExtension(record)
+	default:
+		return log, false
+	}
+
+	return log, true
+}
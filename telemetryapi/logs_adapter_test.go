@@ -0,0 +1,183 @@
+package telemetryapi_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	lambdaext "github.com/zakharovvi/aws-lambda-extensions"
+	"github.com/zakharovvi/aws-lambda-extensions/extapi"
+	"github.com/zakharovvi/aws-lambda-extensions/logsapi"
+	"github.com/zakharovvi/aws-lambda-extensions/telemetryapi"
+)
+
+type logsProcessor struct {
+	logs           []logsapi.Log
+	initCalled     bool
+	shutdownReason extapi.ShutdownReason
+}
+
+func (proc *logsProcessor) Init(ctx context.Context, registerResp *extapi.RegisterResponse) error {
+	proc.initCalled = true
+
+	return nil
+}
+
+func (proc *logsProcessor) Process(ctx context.Context, msg logsapi.Log) error {
+	proc.logs = append(proc.logs, msg)
+
+	return nil
+}
+
+func (proc *logsProcessor) Shutdown(ctx context.Context, reason extapi.ShutdownReason, err error) error {
+	proc.shutdownReason = reason
+
+	return nil
+}
+
+func TestFromLogsProcessor(t *testing.T) {
+	ts := time.Date(2022, 10, 12, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		event   telemetryapi.Event
+		wantLog *logsapi.Log
+	}{
+		{
+			"platform.start",
+			telemetryapi.Event{
+				Type:      telemetryapi.TypePlatformStart,
+				Time:      ts,
+				RawRecord: json.RawMessage(`{"requestId":"6f7f0961f83442118a7af6fe80b88d56","version":"$LATEST"}`),
+				Record: telemetryapi.RecordPlatformStart{
+					RequestID: "6f7f0961f83442118a7af6fe80b88d56",
+					Version:   "$LATEST",
+					Tracing: telemetryapi.TraceContext{
+						SpanID: "54565fb41ac79632",
+						Type:   lambdaext.TracingTypeAWSXRay,
+						Value:  "Root=1-62e900b2-710d76f009d6e7785905449a;Parent=0efbd19962d95b05;Sampled=1",
+					},
+				},
+			},
+			&logsapi.Log{
+				LogType:   logsapi.LogPlatformStart,
+				Time:      ts,
+				RawRecord: json.RawMessage(`{"requestId":"6f7f0961f83442118a7af6fe80b88d56","version":"$LATEST"}`),
+				Record: logsapi.RecordPlatformStart{
+					RequestID: "6f7f0961f83442118a7af6fe80b88d56",
+					Version:   "$LATEST",
+				},
+			},
+		},
+		{
+			"platform.report",
+			telemetryapi.Event{
+				Type: telemetryapi.TypePlatformReport,
+				Time: ts,
+				Record: telemetryapi.RecordPlatformReport{
+					RequestID: "6f7f0961f83442118a7af6fe80b88d56",
+					Status:    telemetryapi.StatusSuccess,
+					Metrics: telemetryapi.ReportMetrics{
+						BilledDuration:  lambdaext.DurationMs(694 * time.Millisecond),
+						Duration:        lambdaext.DurationMs(693920 * time.Microsecond),
+						InitDuration:    lambdaext.DurationMs(11 * time.Millisecond),
+						MaxMemoryUsedMB: 76,
+						MemorySizeMB:    128,
+					},
+					Tracing: telemetryapi.TraceContext{
+						SpanID: "54565fb41ac79632",
+						Type:   lambdaext.TracingTypeAWSXRay,
+						Value:  "Root=1-62e900b2-710d76f009d6e7785905449a;Parent=0efbd19962d95b05;Sampled=1",
+					},
+				},
+			},
+			&logsapi.Log{
+				LogType: logsapi.LogPlatformReport,
+				Time:    ts,
+				Record: logsapi.RecordPlatformReport{
+					Metrics: logsapi.Metrics{
+						Duration:        lambdaext.DurationMs(693920 * time.Microsecond),
+						BilledDuration:  lambdaext.DurationMs(694 * time.Millisecond),
+						InitDuration:    lambdaext.DurationMs(11 * time.Millisecond),
+						MemorySizeMB:    128,
+						MaxMemoryUsedMB: 76,
+					},
+					RequestID: "6f7f0961f83442118a7af6fe80b88d56",
+					Tracing: logsapi.TraceContext{
+						SpanID: "54565fb41ac79632",
+						Type:   lambdaext.TracingTypeAWSXRay,
+						Value:  "Root=1-62e900b2-710d76f009d6e7785905449a;Parent=0efbd19962d95b05;Sampled=1",
+					},
+				},
+			},
+		},
+		{
+			"function",
+			telemetryapi.Event{
+				Type:      telemetryapi.TypeFunction,
+				Time:      ts,
+				RawRecord: json.RawMessage(`"Hello world"`),
+				Record:    telemetryapi.RecordFunction("Hello world"),
+			},
+			&logsapi.Log{
+				LogType:   logsapi.LogFunction,
+				Time:      ts,
+				RawRecord: json.RawMessage(`"Hello world"`),
+				Record:    logsapi.RecordFunction("Hello world"),
+			},
+		},
+		{
+			"extension",
+			telemetryapi.Event{
+				Type:   telemetryapi.TypeExtension,
+				Time:   ts,
+				Record: telemetryapi.RecordExtension("Hello extension"),
+			},
+			&logsapi.Log{
+				LogType: logsapi.LogExtension,
+				Time:    ts,
+				Record:  logsapi.RecordExtension("Hello extension"),
+			},
+		},
+		{
+			"platform.initStart is skipped",
+			telemetryapi.Event{
+				Type: telemetryapi.TypePlatformInitStart,
+				Time: ts,
+				Record: telemetryapi.RecordPlatformInitStart{
+					InitType: lambdaext.InitTypeOnDemand,
+					Phase:    telemetryapi.PhaseInit,
+				},
+			},
+			nil,
+		},
+		{
+			"unknown type is skipped",
+			telemetryapi.Event{
+				Type: "platform.unknown",
+				Time: ts,
+			},
+			nil,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			logsProc := &logsProcessor{}
+			proc := telemetryapi.FromLogsProcessor(logsProc)
+
+			require.NoError(t, proc.Init(context.Background(), nil))
+			require.NoError(t, proc.Process(context.Background(), tt.event))
+			require.NoError(t, proc.Shutdown(context.Background(), extapi.Spindown, nil))
+
+			require.True(t, logsProc.initCalled)
+			require.Equal(t, extapi.Spindown, logsProc.shutdownReason)
+			if tt.wantLog == nil {
+				require.Empty(t, logsProc.logs)
+			} else {
+				require.Equal(t, []logsapi.Log{*tt.wantLog}, logsProc.logs)
+			}
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"log"
 
+	"github.com/zakharovvi/aws-lambda-extensions/extapi"
 	"github.com/zakharovvi/aws-lambda-extensions/telemetryapi"
 	"github.com/zakharovvi/aws-lambda-extensions/telemetryapi/otel"
 	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
@@ -22,3 +23,23 @@ func ExampleProcessor() {
 		log.Panic(err)
 	}
 }
+
+func ExampleProcessor_SetInvokeContext() {
+	exporter, err := stdouttrace.New(stdouttrace.WithPrettyPrint())
+	if err != nil {
+		log.Panic(err)
+	}
+
+	ctx := context.Background()
+	processor := otel.NewProcessor(ctx, exporter)
+
+	// use Invoke event tracing as the parent of invocation spans
+	invokeHandler := func(ctx context.Context, event *extapi.NextEventResponse) error {
+		processor.SetInvokeContext(event)
+
+		return nil
+	}
+	if err := telemetryapi.Run(ctx, processor, telemetryapi.WithInvokeHandler(invokeHandler)); err != nil {
+		log.Panic(err)
+	}
+}
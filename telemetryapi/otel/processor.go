@@ -1,11 +1,18 @@
 package otel
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
 
 	"github.com/go-logr/logr"
+	lambdaext "github.com/zakharovvi/aws-lambda-extensions"
 	"github.com/zakharovvi/aws-lambda-extensions/extapi"
 	"github.com/zakharovvi/aws-lambda-extensions/telemetryapi"
+	"go.opentelemetry.io/otel/attribute"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	"go.opentelemetry.io/otel/trace"
 )
@@ -14,23 +21,133 @@ import (
 // through a given exporter.
 // Processor should be passed into telemetryapi.Run instead of direct usage.
 type Processor struct {
-	exporter      sdktrace.SpanExporter
-	log           logr.Logger
-	spanConverter *SpanConverter
-	opts          []Option
-	curTriplet    EventTriplet
+	exporter       sdktrace.SpanExporter
+	log            logr.Logger
+	spanConverter  *SpanConverter
+	opts           []Option
+	curTriplet     EventTriplet
+	exportAttempts int
+	exportBackoff  time.Duration
+	dropOnExport   bool
+	logsAsEvents   bool
+	// functionLogAttributes extracts attributes of the invoke span from JSON function logs if set
+	functionLogAttributes func(record json.RawMessage) []attribute.KeyValue
+	// invokeTracing holds Invoke event tracing by request ID till platform.start, runtimeDone or report event is received.
+	// functionARN is InvokedFunctionArn of the last Invoke event
+	invokeTracingMu sync.Mutex
+	invokeTracing   map[lambdaext.RequestID]extapi.Tracing
+	functionARN     string
+}
+
+// maxInvokeTracing bounds invokeTracing entries left by requests which platform events were lost or processed
+// before SetInvokeContext.
+const maxInvokeTracing = 100
+
+type exportRetryOption struct {
+	attempts int
+	backoff  time.Duration
+}
+
+func (o exportRetryOption) apply(opts *options) {
+	opts.exportAttempts = o.attempts
+	opts.exportBackoff = o.backoff
+}
+
+// WithExportRetry configures Processor to call sdktrace.SpanExporter.ExportSpans up to attempts times on errors.
+// The delay between attempts starts with backoff and doubles after every failed attempt.
+// By default, ExportSpans is called only once.
+func WithExportRetry(attempts int, backoff time.Duration) Option {
+	return exportRetryOption{attempts, backoff}
+}
+
+type dropOnExportErrorOption bool
+
+func (o dropOnExportErrorOption) apply(opts *options) {
+	opts.dropOnExport = bool(o)
+}
+
+// WithDropOnExportError configures Processor to log and drop spans which could not be exported after all attempts
+// instead of returning an error and stopping the extension.
+func WithDropOnExportError(drop bool) Option {
+	return dropOnExportErrorOption(drop)
 }
 
 // NewProcessor creates Processor with provided sdktrace.SpanExporter.
 func NewProcessor(ctx context.Context, exporter sdktrace.SpanExporter, opts ...Option) *Processor {
 	options := options{
-		log: logr.FromContextOrDiscard(ctx),
+		log:            logr.FromContextOrDiscard(ctx),
+		exportAttempts: 1,
 	}
 	for _, o := range opts {
 		o.apply(&options)
 	}
+	if options.exportAttempts < 1 {
+		options.exportAttempts = 1
+	}
 
-	return &Processor{exporter: exporter, log: options.log, opts: opts}
+	return &Processor{
+		exporter:       exporter,
+		log:            options.log,
+		opts:           opts,
+		exportAttempts: options.exportAttempts,
+		exportBackoff:  options.exportBackoff,
+		dropOnExport:   options.dropOnExport,
+		logsAsEvents:   options.logsAsEvents,
+
+		functionLogAttributes: options.functionLogAttributes,
+	}
+}
+
+// SetInvokeContext feeds tracing of the Invoke event to use it as the parent of the invocation span
+// instead of platform.start tracing. Invoke event is the authoritative source of the invocation trace context.
+// SetInvokeContext is safe to call concurrently with Process, e.g. from telemetryapi.WithInvokeHandler.
+// Invoke event must be set before platform.start event of the same request is processed, otherwise it is ignored
+// and forgotten with the request runtimeDone or report event.
+// InvokedFunctionArn of the event is added to the resource of subsequent spans, see SpanConverter.SetInvokedFunctionARN.
+func (proc *Processor) SetInvokeContext(event *extapi.NextEventResponse) {
+	if event == nil || event.EventType != extapi.Invoke {
+		return
+	}
+	proc.invokeTracingMu.Lock()
+	defer proc.invokeTracingMu.Unlock()
+
+	if event.InvokedFunctionArn != "" {
+		proc.functionARN = event.InvokedFunctionArn
+	}
+	if event.Tracing.Value == "" {
+		return
+	}
+	if proc.invokeTracing == nil {
+		proc.invokeTracing = make(map[lambdaext.RequestID]extapi.Tracing)
+	}
+	if len(proc.invokeTracing) >= maxInvokeTracing {
+		// entries of the current requests are removed by their events, so the map is full of stale entries
+		for requestID := range proc.invokeTracing {
+			delete(proc.invokeTracing, requestID)
+
+			break
+		}
+	}
+	proc.invokeTracing[event.RequestID] = event.Tracing
+}
+
+// takeInvokeTracing returns and forgets Invoke event tracing set with SetInvokeContext for the request.
+func (proc *Processor) takeInvokeTracing(requestID lambdaext.RequestID) extapi.Tracing {
+	proc.invokeTracingMu.Lock()
+	defer proc.invokeTracingMu.Unlock()
+
+	tracing := proc.invokeTracing[requestID]
+	delete(proc.invokeTracing, requestID)
+
+	return tracing
+}
+
+// invokedFunctionARN returns the function ARN of the last Invoke event set with SetInvokeContext.
+func (proc *Processor) invokedFunctionARN() string {
+	proc.invokeTracingMu.Lock()
+	defer proc.invokeTracingMu.Unlock()
+
+	return proc.functionARN
 }
 
 func (proc *Processor) Init(ctx context.Context, registerResp *extapi.RegisterResponse) error {
@@ -40,7 +157,7 @@ func (proc *Processor) Init(ctx context.Context, registerResp *extapi.RegisterRe
 }
 
 func (proc *Processor) Process(ctx context.Context, event telemetryapi.Event) error {
-	switch event.Record.(type) {
+	switch record := event.Record.(type) {
 	case telemetryapi.RecordPlatformInitStart:
 		proc.curTriplet.Type = telemetryapi.PhaseInit
 		proc.curTriplet.Start = event
@@ -56,33 +173,94 @@ func (proc *Processor) Process(ctx context.Context, event telemetryapi.Event) er
 	case telemetryapi.RecordPlatformStart:
 		proc.curTriplet.Type = telemetryapi.PhaseInvoke
 		proc.curTriplet.Start = event
+		proc.curTriplet.InvokeTracing = proc.takeInvokeTracing(record.RequestID)
+		proc.spanConverter.SetInvokedFunctionARN(proc.invokedFunctionARN())
 	case telemetryapi.RecordPlatformRuntimeDone:
 		proc.curTriplet.RuntimeDone = event
+		// forget Invoke event tracing set after platform.start was processed
+		proc.takeInvokeTracing(record.RequestID)
 	case telemetryapi.RecordPlatformReport:
 		proc.curTriplet.Report = event
+		proc.takeInvokeTracing(record.RequestID)
 		spanContext, err := proc.exportTriplet(ctx)
 		if err != nil {
 			return err
 		}
-		proc.curTriplet = EventTriplet{PrevSC: spanContext}
+		proc.curTriplet = EventTriplet{PrevSC: spanContext, PrevRequestID: record.RequestID}
+	case telemetryapi.RecordFunction:
+		proc.extractFunctionLogAttributes(record)
+		// log lines outside of init or invoke phase can't be attributed to a span
+		if proc.logsAsEvents && proc.curTriplet.Start.Type != "" {
+			proc.curTriplet.Logs = append(proc.curTriplet.Logs, event)
+		}
+	case telemetryapi.RecordExtension:
+		// log lines outside of init or invoke phase can't be attributed to a span
+		if proc.logsAsEvents && proc.curTriplet.Start.Type != "" {
+			proc.curTriplet.Logs = append(proc.curTriplet.Logs, event)
+		}
 	}
 
 	return nil
 }
 
+// extractFunctionLogAttributes adds attributes extracted from JSON function log line to the current invoke span.
+func (proc *Processor) extractFunctionLogAttributes(record telemetryapi.RecordFunction) {
+	if proc.functionLogAttributes == nil || proc.curTriplet.Type != telemetryapi.PhaseInvoke {
+		return
+	}
+	raw := json.RawMessage(bytes.TrimSpace([]byte(record)))
+	if len(raw) == 0 || raw[0] != '{' || !json.Valid(raw) {
+		return
+	}
+	proc.curTriplet.Attributes = append(proc.curTriplet.Attributes, proc.functionLogAttributes(raw)...)
+}
+
 func (proc *Processor) exportTriplet(ctx context.Context) (trace.SpanContext, error) {
 	spans, spanContext, err := proc.spanConverter.ConvertIntoSpans(proc.curTriplet)
 	if err != nil {
 		return spanContext, err
 	}
 
+	if len(spans) == 0 {
+		return spanContext, nil
+	}
+
 	proc.log.V(1).Info(
 		"sending spans to exporter",
 		"traceID", spanContext.TraceID(),
 		"count", len(spans),
 	)
 
-	return spanContext, proc.exporter.ExportSpans(ctx, spans)
+	if err := proc.exportSpans(ctx, spans); err != nil {
+		if !proc.dropOnExport {
+			return spanContext, err
+		}
+		proc.log.Error(err, "dropping spans", "traceID", spanContext.TraceID(), "count", len(spans))
+	}
+
+	return spanContext, nil
+}
+
+// exportSpans calls sdktrace.SpanExporter.ExportSpans with retries and exponential backoff.
+func (proc *Processor) exportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	backoff := proc.exportBackoff
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = proc.exporter.ExportSpans(ctx, spans); err == nil {
+			return nil
+		}
+		if attempt >= proc.exportAttempts {
+			return fmt.Errorf("could not export spans, attempts made %d: %w", attempt, err)
+		}
+		proc.log.Error(err, "span export failed, retrying", "attempt", attempt, "backoff", backoff)
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("span export retry interrupted with context error: %w, last export error: %v", ctx.Err(), err)
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
 }
 
 func (proc *Processor) Shutdown(ctx context.Context, reason extapi.ShutdownReason, err error) error {
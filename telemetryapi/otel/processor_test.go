@@ -2,11 +2,18 @@ package otel_test
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 	"github.com/zakharovvi/aws-lambda-extensions/extapi"
+	"github.com/zakharovvi/aws-lambda-extensions/telemetryapi"
 	"github.com/zakharovvi/aws-lambda-extensions/telemetryapi/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 	"go.opentelemetry.io/otel/trace"
 )
@@ -69,3 +76,378 @@ func TestProcessor_Process_OutOfOrder(t *testing.T) {
 	err = proc.Process(ctx, initTriplet.Report)
 	require.Error(t, err)
 }
+
+func TestProcessor_Process_LinkPreviousRequestID(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	exporter := tracetest.NewInMemoryExporter()
+	proc := otel.NewProcessor(
+		ctx,
+		exporter,
+		otel.WithLinkAttributes(func(triplet otel.EventTriplet) []attribute.KeyValue {
+			return []attribute.KeyValue{attribute.String("test.link", "custom")}
+		}),
+	)
+
+	err := proc.Init(ctx, registerResp)
+	require.NoError(t, err)
+
+	for _, triplet := range []otel.EventTriplet{getInvokeTriplet(), getInvokeTriplet()} {
+		err = proc.Process(ctx, triplet.Start)
+		require.NoError(t, err)
+		err = proc.Process(ctx, triplet.RuntimeDone)
+		require.NoError(t, err)
+		err = proc.Process(ctx, triplet.Report)
+		require.NoError(t, err)
+	}
+
+	var links [][]attribute.KeyValue
+	for _, span := range exporter.GetSpans() {
+		if span.Name != "test-name/invoke" {
+			continue
+		}
+		for _, link := range span.Links {
+			links = append(links, link.Attributes)
+		}
+	}
+	require.Equal(
+		t,
+		[][]attribute.KeyValue{
+			{
+				attribute.String("aws.lambda.link_type", "previous-trace"),
+				attribute.String("aws.lambda.previous_request_id", "cfa3c5e3-4441-42cc-86d0-404768d42e1b"),
+				attribute.String("test.link", "custom"),
+			},
+		},
+		links,
+	)
+}
+
+type flakyExporter struct {
+	*tracetest.InMemoryExporter
+	failures int
+	calls    int
+}
+
+func (e *flakyExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	e.calls++
+	if e.calls <= e.failures {
+		return errors.New("transient error")
+	}
+
+	return e.InMemoryExporter.ExportSpans(ctx, spans)
+}
+
+func processTriplet(ctx context.Context, t *testing.T, proc *otel.Processor, triplet otel.EventTriplet) error {
+	t.Helper()
+
+	require.NoError(t, proc.Process(ctx, triplet.Start))
+	require.NoError(t, proc.Process(ctx, triplet.RuntimeDone))
+
+	return proc.Process(ctx, triplet.Report)
+}
+
+func TestProcessor_Process_ExportRetry(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name          string
+		failures      int
+		opts          []otel.Option
+		wantErr       string
+		wantCalls     int
+		wantSpanCount int
+	}{
+		{
+			name:          "no retry by default",
+			failures:      1,
+			wantErr:       "could not export spans, attempts made 1: transient error",
+			wantCalls:     1,
+			wantSpanCount: 0,
+		},
+		{
+			name:          "eventual success",
+			failures:      2,
+			opts:          []otel.Option{otel.WithExportRetry(3, time.Millisecond)},
+			wantCalls:     3,
+			wantSpanCount: 3,
+		},
+		{
+			name:          "failure after all attempts",
+			failures:      5,
+			opts:          []otel.Option{otel.WithExportRetry(2, time.Millisecond)},
+			wantErr:       "could not export spans, attempts made 2: transient error",
+			wantCalls:     2,
+			wantSpanCount: 0,
+		},
+		{
+			name:          "drop on failure",
+			failures:      5,
+			opts:          []otel.Option{otel.WithExportRetry(2, time.Millisecond), otel.WithDropOnExportError(true)},
+			wantCalls:     2,
+			wantSpanCount: 0,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			exporter := &flakyExporter{InMemoryExporter: tracetest.NewInMemoryExporter(), failures: tt.failures}
+			proc := otel.NewProcessor(ctx, exporter, tt.opts...)
+			require.NoError(t, proc.Init(ctx, registerResp))
+
+			err := processTriplet(ctx, t, proc, getInvokeTriplet())
+			if tt.wantErr == "" {
+				require.NoError(t, err)
+			} else {
+				require.EqualError(t, err, tt.wantErr)
+			}
+			require.Equal(t, tt.wantCalls, exporter.calls)
+			require.Len(t, exporter.GetSpans(), tt.wantSpanCount)
+		})
+	}
+}
+
+func TestProcessor_SetInvokeContext(t *testing.T) {
+	t.Parallel()
+
+	invokeTraceID, err := trace.TraceIDFromHex("637e16f0aaaaaaaaaaaaaaaaaaaaaaaa")
+	require.NoError(t, err)
+	invokeParentID, err := trace.SpanIDFromHex("1111111111111111")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name         string
+		invokeEvent  *extapi.NextEventResponse
+		wantTraceID  string
+		wantParentID string
+	}{
+		{
+			"platform.start tracing without invoke event",
+			nil,
+			"637e16f01fbed7cb2ea0e5d7537a6258",
+			"5ac36eec7a279fc5",
+		},
+		{
+			"invoke event tracing takes precedence",
+			&extapi.NextEventResponse{
+				EventType: extapi.Invoke,
+				RequestID: "cfa3c5e3-4441-42cc-86d0-404768d42e1b",
+				Tracing: extapi.Tracing{
+					Type:  "X-Amzn-Trace-Id",
+					Value: "Root=1-637e16f0-aaaaaaaaaaaaaaaaaaaaaaaa;Parent=1111111111111111;Sampled=1",
+				},
+			},
+			invokeTraceID.String(),
+			invokeParentID.String(),
+		},
+		{
+			"invoke event of another request is ignored",
+			&extapi.NextEventResponse{
+				EventType: extapi.Invoke,
+				RequestID: "another-request",
+				Tracing: extapi.Tracing{
+					Type:  "X-Amzn-Trace-Id",
+					Value: "Root=1-637e16f0-aaaaaaaaaaaaaaaaaaaaaaaa;Parent=1111111111111111;Sampled=1",
+				},
+			},
+			"637e16f01fbed7cb2ea0e5d7537a6258",
+			"5ac36eec7a279fc5",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			exporter := tracetest.NewInMemoryExporter()
+			proc := otel.NewProcessor(ctx, exporter)
+			require.NoError(t, proc.Init(ctx, registerResp))
+
+			proc.SetInvokeContext(tt.invokeEvent)
+			invokeTriplet := getInvokeTriplet()
+			require.NoError(t, proc.Process(ctx, invokeTriplet.Start))
+			require.NoError(t, proc.Process(ctx, invokeTriplet.RuntimeDone))
+			require.NoError(t, proc.Process(ctx, invokeTriplet.Report))
+
+			var found bool
+			for _, span := range exporter.GetSpans() {
+				if span.Name == "test-name/invoke" {
+					found = true
+					require.Equal(t, tt.wantTraceID, span.Parent.TraceID().String())
+					require.Equal(t, tt.wantParentID, span.Parent.SpanID().String())
+					require.Equal(t, tt.wantTraceID, span.SpanContext.TraceID().String())
+				}
+			}
+			require.True(t, found)
+		})
+	}
+}
+
+func TestProcessor_SetInvokeContext_AfterPlatformStart(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	exporter := tracetest.NewInMemoryExporter()
+	proc := otel.NewProcessor(ctx, exporter)
+	require.NoError(t, proc.Init(ctx, registerResp))
+
+	invokeTriplet := getInvokeTriplet()
+	require.NoError(t, proc.Process(ctx, invokeTriplet.Start))
+	// Invoke event tracing arrived too late to be used and must be forgotten with the request events
+	proc.SetInvokeContext(&extapi.NextEventResponse{
+		EventType: extapi.Invoke,
+		RequestID: "cfa3c5e3-4441-42cc-86d0-404768d42e1b",
+		Tracing: extapi.Tracing{
+			Type:  "X-Amzn-Trace-Id",
+			Value: "Root=1-637e16f0-aaaaaaaaaaaaaaaaaaaaaaaa;Parent=1111111111111111;Sampled=1",
+		},
+	})
+	require.NoError(t, proc.Process(ctx, invokeTriplet.RuntimeDone))
+	require.NoError(t, proc.Process(ctx, invokeTriplet.Report))
+
+	// the same events again must not pick up the stale Invoke event tracing
+	require.NoError(t, proc.Process(ctx, invokeTriplet.Start))
+	require.NoError(t, proc.Process(ctx, invokeTriplet.RuntimeDone))
+	require.NoError(t, proc.Process(ctx, invokeTriplet.Report))
+
+	var found int
+	for _, span := range exporter.GetSpans() {
+		if span.Name == "test-name/invoke" {
+			found++
+			require.Equal(t, "637e16f01fbed7cb2ea0e5d7537a6258", span.Parent.TraceID().String())
+			require.Equal(t, "5ac36eec7a279fc5", span.Parent.SpanID().String())
+		}
+	}
+	require.Equal(t, 2, found)
+}
+
+func TestProcessor_SetInvokeContext_FunctionARN(t *testing.T) {
+	t.Parallel()
+
+	const arn = "arn:aws:lambda:us-east-1:123456789012:function:test-name:prod"
+	ctx := context.Background()
+	exporter := tracetest.NewInMemoryExporter()
+	proc := otel.NewProcessor(ctx, exporter)
+	require.NoError(t, proc.Init(ctx, registerResp))
+
+	initTriplet := getInitTriplet()
+	require.NoError(t, proc.Process(ctx, initTriplet.Start))
+	require.NoError(t, proc.Process(ctx, initTriplet.RuntimeDone))
+	require.NoError(t, proc.Process(ctx, initTriplet.Report))
+
+	invokeTriplet := getInvokeTriplet()
+	proc.SetInvokeContext(&extapi.NextEventResponse{
+		EventType:          extapi.Invoke,
+		RequestID:          invokeTriplet.Start.Record.(telemetryapi.RecordPlatformStart).RequestID,
+		InvokedFunctionArn: arn,
+	})
+	require.NoError(t, proc.Process(ctx, invokeTriplet.Start))
+	require.NoError(t, proc.Process(ctx, invokeTriplet.RuntimeDone))
+	require.NoError(t, proc.Process(ctx, invokeTriplet.Report))
+
+	faasID := attribute.String("faas.id", arn)
+	require.NotEmpty(t, exporter.GetSpans())
+	for _, span := range exporter.GetSpans() {
+		if strings.HasPrefix(span.Name, "test-name/init") {
+			require.NotContains(t, span.Resource.Attributes(), faasID, span.Name)
+		} else {
+			require.Contains(t, span.Resource.Attributes(), faasID, span.Name)
+		}
+	}
+}
+
+func TestProcessor_Process_WithLogsAsSpanEvents(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	exporter := tracetest.NewInMemoryExporter()
+	proc := otel.NewProcessor(ctx, exporter, otel.WithLogsAsSpanEvents(true))
+
+	err := proc.Init(ctx, registerResp)
+	require.NoError(t, err)
+
+	invokeTriplet := getInvokeTriplet()
+	logTime := invokeTriplet.Start.Time.Add(time.Millisecond)
+	events := []telemetryapi.Event{
+		{Type: telemetryapi.TypeFunction, Time: logTime, Record: telemetryapi.RecordFunction("before start")},
+		invokeTriplet.Start,
+		{Type: telemetryapi.TypeFunction, Time: logTime, Record: telemetryapi.RecordFunction("hello from function")},
+		{Type: telemetryapi.TypeExtension, Time: logTime, Record: telemetryapi.RecordExtension("hello from extension")},
+		invokeTriplet.RuntimeDone,
+		invokeTriplet.Report,
+	}
+	for _, event := range events {
+		err = proc.Process(ctx, event)
+		require.NoError(t, err)
+	}
+
+	var invokeSpan tracetest.SpanStub
+	for _, span := range exporter.GetSpans() {
+		if span.Name == "test-name/invoke" {
+			invokeSpan = span
+		}
+	}
+	require.Equal(t, []sdktrace.Event{
+		{
+			Name:       "function",
+			Attributes: []attribute.KeyValue{attribute.String("log.message", "hello from function")},
+			Time:       logTime,
+		},
+		{
+			Name:       "extension",
+			Attributes: []attribute.KeyValue{attribute.String("log.message", "hello from extension")},
+			Time:       logTime,
+		},
+	}, invokeSpan.Events)
+}
+
+func TestProcessor_Process_WithFunctionLogAttributeExtractor(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	exporter := tracetest.NewInMemoryExporter()
+	extractor := func(record json.RawMessage) []attribute.KeyValue {
+		var fields struct {
+			OrderID string `json:"orderId"`
+		}
+		if err := json.Unmarshal(record, &fields); err != nil || fields.OrderID == "" {
+			return nil
+		}
+
+		return []attribute.KeyValue{attribute.String("app.order_id", fields.OrderID)}
+	}
+	proc := otel.NewProcessor(ctx, exporter, otel.WithFunctionLogAttributeExtractor(extractor))
+
+	err := proc.Init(ctx, registerResp)
+	require.NoError(t, err)
+
+	invokeTriplet := getInvokeTriplet()
+	events := []telemetryapi.Event{
+		{Type: telemetryapi.TypeFunction, Record: telemetryapi.RecordFunction(`{"orderId":"before-start"}`)},
+		invokeTriplet.Start,
+		{Type: telemetryapi.TypeFunction, Record: telemetryapi.RecordFunction("plain text line")},
+		{Type: telemetryapi.TypeFunction, Record: telemetryapi.RecordFunction(`{"level":"INFO","orderId":"order-1"}` + "\n")},
+		{Type: telemetryapi.TypeExtension, Record: telemetryapi.RecordExtension(`{"orderId":"from-extension"}`)},
+		invokeTriplet.RuntimeDone,
+		invokeTriplet.Report,
+	}
+	for _, event := range events {
+		err = proc.Process(ctx, event)
+		require.NoError(t, err)
+	}
+
+	var invokeSpan tracetest.SpanStub
+	for _, span := range exporter.GetSpans() {
+		if span.Name == "test-name/invoke" {
+			invokeSpan = span
+		}
+	}
+	require.Contains(t, invokeSpan.Attributes, attribute.String("app.order_id", "order-1"))
+	require.NotContains(t, invokeSpan.Attributes, attribute.String("app.order_id", "before-start"))
+	require.NotContains(t, invokeSpan.Attributes, attribute.String("app.order_id", "from-extension"))
+}
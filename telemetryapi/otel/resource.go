@@ -0,0 +1,49 @@
+package otel
+
+import (
+	"context"
+	"os"
+
+	"github.com/go-logr/logr"
+	"github.com/zakharovvi/aws-lambda-extensions/extapi"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/resource"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+)
+
+// NewResource creates OpenTelemetry resource describing the Lambda function with cloud and faas attributes.
+// SpanConverter uses the same resource, reuse it with other exporters to keep resource attributes consistent.
+// WithLogger and WithEnvironment options are applied, other options are ignored.
+func NewResource(ctx context.Context, registerResp *extapi.RegisterResponse, opts ...Option) *resource.Resource {
+	options := options{
+		log: logr.FromContextOrDiscard(ctx),
+		env: os.Getenv,
+	}
+	for _, o := range opts {
+		o.apply(&options)
+	}
+
+	return newResource(registerResp, options)
+}
+
+func newResource(registerResp *extapi.RegisterResponse, options options) *resource.Resource {
+	attrs := []attribute.KeyValue{
+		semconv.CloudProviderAWS,
+		semconv.CloudPlatformAWSLambda,
+		semconv.CloudAccountIDKey.String(registerResp.AccountID),
+		semconv.FaaSNameKey.String(registerResp.FunctionName),
+		semconv.FaaSVersionKey.String(string(registerResp.FunctionVersion)),
+	}
+	if region, err := options.env.AWSRegionE(); err != nil {
+		options.log.Info("could not get AWS region, skipping cloud.region resource attribute", "error", err.Error())
+	} else {
+		attrs = append(attrs, semconv.CloudRegionKey.String(region))
+	}
+	if memorySizeMB, err := options.env.AWSLambdaFunctionMemorySizeMBE(); err != nil {
+		options.log.Info("could not get function memory size, skipping faas.max_memory resource attribute", "error", err.Error())
+	} else {
+		attrs = append(attrs, semconv.FaaSMaxMemoryKey.Int(memorySizeMB))
+	}
+
+	return resource.NewWithAttributes(semconv.SchemaURL, attrs...)
+}
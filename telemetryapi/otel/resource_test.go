@@ -0,0 +1,44 @@
+package otel_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zakharovvi/aws-lambda-extensions/telemetryapi/otel"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+)
+
+func TestNewResource(t *testing.T) {
+	t.Parallel()
+
+	env := map[string]string{
+		"AWS_REGION":                      "ap-south-1",
+		"AWS_LAMBDA_FUNCTION_MEMORY_SIZE": "256",
+	}
+	getenv := func(key string) string {
+		return env[key]
+	}
+	res := otel.NewResource(context.Background(), registerResp, otel.WithEnvironment(getenv))
+
+	require.Equal(t, semconv.SchemaURL, res.SchemaURL())
+	want := map[string]string{
+		string(semconv.CloudProviderKey):  "aws",
+		string(semconv.CloudPlatformKey):  "aws_lambda",
+		string(semconv.CloudAccountIDKey): "0123456789",
+		string(semconv.CloudRegionKey):    "ap-south-1",
+		string(semconv.FaaSNameKey):       "test-name",
+		string(semconv.FaaSVersionKey):    "$LATEST",
+		string(semconv.FaaSMaxMemoryKey):  "256",
+	}
+	got := make(map[string]string)
+	for _, attr := range res.Attributes() {
+		got[string(attr.Key)] = attr.Value.Emit()
+	}
+	require.Equal(t, want, got)
+
+	sc := otel.NewSpanConverter(context.Background(), registerResp, otel.WithEnvironment(getenv))
+	spans, _, err := sc.ConvertIntoSpans(getInitTriplet())
+	require.NoError(t, err)
+	require.Equal(t, res.Equivalent(), spans[0].Resource().Equivalent())
+}
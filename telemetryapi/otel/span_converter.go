@@ -2,7 +2,9 @@ package otel
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"os"
 	"time"
 
 	"github.com/go-logr/logr"
@@ -24,10 +26,20 @@ import (
 // SpanConverter creates OpenTelemetry spans from Telemetry API events.
 // SpanConverter is low-level, consider using Processor instead.
 type SpanConverter struct {
-	tracer       trace.Tracer
-	gen          *internal.IDGenerator
-	log          logr.Logger
-	functionName string
+	tracer         trace.Tracer
+	gen            *internal.IDGenerator
+	log            logr.Logger
+	functionName   string
+	linkAttributes func(triplet EventTriplet) []attribute.KeyValue
+	spanKind       func(name string, root bool) trace.SpanKind
+	// parentExtraction enables extraction of X-Ray tracing context from platform.start and Invoke events
+	parentExtraction bool
+	// propagators extract the parent tracing context by lambdaext.TracingType
+	propagators map[lambdaext.TracingType]propagation.TextMapPropagator
+	// sampler and resource are kept to recreate the tracer with updated resource in SetInvokedFunctionARN
+	sampler     sdktrace.Sampler
+	resource    *resource.Resource
+	functionARN string
 }
 
 type Option interface {
@@ -35,7 +47,22 @@ type Option interface {
 }
 
 type options struct {
-	log logr.Logger
+	log            logr.Logger
+	env            extapi.Environment
+	linkAttributes func(triplet EventTriplet) []attribute.KeyValue
+	sampler        sdktrace.Sampler
+	exportAttempts int
+	exportBackoff  time.Duration
+	dropOnExport   bool
+	// setGlobalLogger configures otel.SetLogger to use the logger
+	setGlobalLogger bool
+	spanKind        func(name string, root bool) trace.SpanKind
+	logsAsEvents    bool
+	// functionLogAttributes extracts attributes of the invoke span from JSON function logs
+	functionLogAttributes func(record json.RawMessage) []attribute.KeyValue
+	// parentExtraction is true by default
+	parentExtraction bool
+	propagators      map[lambdaext.TracingType]propagation.TextMapPropagator
 }
 
 type loggerOption struct {
@@ -50,41 +77,219 @@ func WithLogger(log logr.Logger) Option {
 	return loggerOption{log}
 }
 
+type environmentOption struct {
+	env extapi.Environment
+}
+
+func (o environmentOption) apply(opts *options) {
+	opts.env = o.env
+}
+
+// WithEnvironment configures lookup of runtime environment variables for the OpenTelemetry resource attributes.
+// Pass the same extapi.Environment which is used with extapi.WithEnvironment. os.Getenv is used by default.
+func WithEnvironment(env extapi.Environment) Option {
+	return environmentOption{env}
+}
+
+type linkAttributesOption func(triplet EventTriplet) []attribute.KeyValue
+
+func (o linkAttributesOption) apply(opts *options) {
+	opts.linkAttributes = o
+}
+
+// WithLinkAttributes configures a hook returning additional attributes for the link to the previous trace.
+func WithLinkAttributes(fn func(triplet EventTriplet) []attribute.KeyValue) Option {
+	return linkAttributesOption(fn)
+}
+
+type samplerOption struct {
+	sampler sdktrace.Sampler
+}
+
+func (o samplerOption) apply(opts *options) {
+	opts.sampler = o.sampler
+}
+
+// WithSampler configures sampler of the tracer provider.
+// By default, spans are sampled according to the upstream X-Ray sampling decision in the Sampled field of the tracing header
+// and always sampled when X-Ray tracing is not enabled.
+func WithSampler(sampler sdktrace.Sampler) Option {
+	return samplerOption{sampler}
+}
+
+type setGlobalLoggerOption bool
+
+func (o setGlobalLoggerOption) apply(opts *options) {
+	opts.setGlobalLogger = bool(o)
+}
+
+// WithSetGlobalLogger configures NewSpanConverter to set the logger as global OpenTelemetry logger with otel.SetLogger.
+// It overrides the global logger configured by the application and affects all SpanConverters in the process.
+// SpanConverter uses its own logger and doesn't modify the global logger by default.
+func WithSetGlobalLogger(set bool) Option {
+	return setGlobalLoggerOption(set)
+}
+
+type spanKindOption func(name string, root bool) trace.SpanKind
+
+func (o spanKindOption) apply(opts *options) {
+	opts.spanKind = o
+}
+
+// WithSpanKind configures a hook returning the kind of every created span.
+// name is the phase for root spans ("init", "invoke") and Telemetry API span name for child spans
+// ("responseLatency", "responseDuration"). DefaultSpanKind is used by default.
+func WithSpanKind(fn func(name string, root bool) trace.SpanKind) Option {
+	return spanKindOption(fn)
+}
+
+// DefaultSpanKind returns trace.SpanKindServer for root spans and trace.SpanKindInternal for child spans.
+func DefaultSpanKind(name string, root bool) trace.SpanKind {
+	if root {
+		return trace.SpanKindServer
+	}
+
+	return trace.SpanKindInternal
+}
+
+type parentExtractionOption bool
+
+func (o parentExtractionOption) apply(opts *options) {
+	opts.parentExtraction = bool(o)
+}
+
+// WithParentExtraction configures SpanConverter to extract X-Ray tracing context from platform.start and Invoke events
+// as the parent of the invocation span. Disable it for functions without X-Ray tracing to skip the propagator
+// and span id parsing overhead on every invocation, all spans are roots then. Parent extraction is enabled by default.
+func WithParentExtraction(enable bool) Option {
+	return parentExtractionOption(enable)
+}
+
+type propagatorsOption map[lambdaext.TracingType]propagation.TextMapPropagator
+
+func (o propagatorsOption) apply(opts *options) {
+	if opts.propagators == nil {
+		opts.propagators = make(map[lambdaext.TracingType]propagation.TextMapPropagator, len(o))
+	}
+	for tracingType, propagator := range o {
+		opts.propagators[tracingType] = propagator
+	}
+}
+
+// WithPropagators configures propagators extracting the parent tracing context by the tracing type
+// of platform.start and Invoke events, e.g. propagation.TraceContext for W3C trace context.
+// The tracing value is passed to the propagator under the tracing type key, e.g. "traceparent".
+// xray.Propagator is registered for lambdaext.TracingTypeAWSXRay and used for unknown tracing types by default,
+// it can be overridden as well.
+func WithPropagators(propagators map[lambdaext.TracingType]propagation.TextMapPropagator) Option {
+	return propagatorsOption(propagators)
+}
+
+type logsAsSpanEventsOption bool
+
+func (o logsAsSpanEventsOption) apply(opts *options) {
+	opts.logsAsEvents = bool(o)
+}
+
+// WithLogsAsSpanEvents configures Processor to attach function and extension log lines received between
+// phase start and report events as span events of the phase span for in-context debugging.
+// The extension must subscribe to function and extension logs with telemetryapi.WithSubscriptionTypes.
+// Log lines are not attached by default.
+func WithLogsAsSpanEvents(enable bool) Option {
+	return logsAsSpanEventsOption(enable)
+}
+
+type functionLogAttributeExtractorOption func(record json.RawMessage) []attribute.KeyValue
+
+func (o functionLogAttributeExtractorOption) apply(opts *options) {
+	opts.functionLogAttributes = o
+}
+
+// WithFunctionLogAttributeExtractor configures Processor to promote fields of structured JSON function logs,
+// e.g. trace ids or business keys, to attributes of the current invoke span.
+// fn is called with every function log line which is a JSON object received between platform.start and platform.report events,
+// returned attributes are added to the invoke span. Log lines which are not JSON objects are skipped.
+// The extension must subscribe to function logs with telemetryapi.WithSubscriptionTypes.
+func WithFunctionLogAttributeExtractor(fn func(record json.RawMessage) []attribute.KeyValue) Option {
+	return functionLogAttributeExtractorOption(fn)
+}
+
 // NewSpanConverter creates SpanConverter.
 func NewSpanConverter(ctx context.Context, registerResp *extapi.RegisterResponse, opts ...Option) *SpanConverter {
 	options := options{
-		log: logr.FromContextOrDiscard(ctx),
+		log:              logr.FromContextOrDiscard(ctx),
+		env:              os.Getenv,
+		sampler:          sdktrace.ParentBased(sdktrace.AlwaysSample()),
+		spanKind:         DefaultSpanKind,
+		parentExtraction: true,
 	}
 	for _, o := range opts {
 		o.apply(&options)
 	}
 
-	otel.SetLogger(options.log)
-	gen := &internal.IDGenerator{
-		Gen: xray.NewIDGenerator(),
+	if options.setGlobalLogger {
+		otel.SetLogger(options.log)
 	}
+	sc := &SpanConverter{
+		gen: &internal.IDGenerator{
+			Gen: xray.NewIDGenerator(),
+		},
+		log:              options.log,
+		functionName:     registerResp.FunctionName,
+		linkAttributes:   options.linkAttributes,
+		spanKind:         options.spanKind,
+		parentExtraction: options.parentExtraction,
+		propagators: map[lambdaext.TracingType]propagation.TextMapPropagator{
+			lambdaext.TracingTypeAWSXRay: xray.Propagator{},
+		},
+		sampler:  options.sampler,
+		resource: newResource(registerResp, options),
+	}
+	for tracingType, propagator := range options.propagators {
+		sc.propagators[tracingType] = propagator
+	}
+	sc.tracer = sc.newTracer()
+
+	return sc
+}
+
+// propagator returns the propagator registered for the tracing type or xray.Propagator for unknown types.
+func (sc *SpanConverter) propagator(tracingType lambdaext.TracingType) propagation.TextMapPropagator {
+	if propagator, ok := sc.propagators[tracingType]; ok {
+		return propagator
+	}
+
+	return sc.propagators[lambdaext.TracingTypeAWSXRay]
+}
+
+func (sc *SpanConverter) newTracer() trace.Tracer {
 	tp := sdktrace.NewTracerProvider(
-		sdktrace.WithIDGenerator(gen),
-		sdktrace.WithSampler(sdktrace.AlwaysSample()),
-		sdktrace.WithResource(resource.NewWithAttributes(
-			semconv.SchemaURL,
-			semconv.CloudProviderAWS,
-			semconv.CloudPlatformAWSLambda,
-			semconv.CloudAccountIDKey.String(registerResp.AccountID),
-			semconv.CloudRegionKey.String(extapi.EnvAWSRegion()),
-			semconv.FaaSNameKey.String(registerResp.FunctionName),
-			semconv.FaaSVersionKey.String(string(registerResp.FunctionVersion)),
-			semconv.FaaSMaxMemoryKey.Int(extapi.EnvAWSLambdaFunctionMemorySizeMB()),
-		)),
+		sdktrace.WithIDGenerator(sc.gen),
+		sdktrace.WithSampler(sc.sampler),
+		sdktrace.WithResource(sc.resource),
 	)
-	tracer := tp.Tracer("github.com/zakharovvi/aws-lambda-extensions/telemetryapi/otel")
 
-	return &SpanConverter{
-		tracer,
-		gen,
-		options.log,
-		registerResp.FunctionName,
+	return tp.Tracer("github.com/zakharovvi/aws-lambda-extensions/telemetryapi/otel")
+}
+
+// SetInvokedFunctionARN adds the function ARN as faas.id resource attribute of spans converted afterwards.
+// The ARN is known only from extapi.NextEventResponse.InvokedFunctionArn of Invoke events,
+// so it is set once the first Invoke event arrives and subsequent calls with the same ARN are no-op.
+// It helps to disambiguate aliases and versions of the function in trace backends.
+// SetInvokedFunctionARN must not be called concurrently with ConvertIntoSpans, use Processor.SetInvokeContext instead.
+func (sc *SpanConverter) SetInvokedFunctionARN(arn string) {
+	if arn == "" || arn == sc.functionARN {
+		return
+	}
+	sc.functionARN = arn
+	res, err := resource.Merge(sc.resource, resource.NewSchemaless(semconv.FaaSIDKey.String(arn)))
+	if err != nil {
+		sc.log.Error(err, "could not add faas.id resource attribute")
+
+		return
 	}
+	sc.resource = res
+	sc.tracer = sc.newTracer()
 }
 
 // EventTriplet contains chain of events from single Lambda function invocation.
@@ -94,6 +299,16 @@ type EventTriplet struct {
 	RuntimeDone telemetryapi.Event
 	Report      telemetryapi.Event
 	PrevSC      trace.SpanContext
+	// PrevRequestID is the request ID of the previous invocation linked with PrevSC. It's empty after init phase.
+	PrevRequestID lambdaext.RequestID
+	// InvokeTracing is the tracing header of the Invoke event received from extapi.Client.NextEvent for the same request.
+	// It takes precedence over platform.start tracing as the parent of the invocation span if set.
+	InvokeTracing extapi.Tracing
+	// Logs are function and extension log events received between Start and Report events.
+	// They are added as span events of the phase span.
+	Logs []telemetryapi.Event
+	// Attributes are added to the phase span, e.g. extracted from function logs with WithFunctionLogAttributeExtractor.
+	Attributes []attribute.KeyValue
 }
 
 // IsValid checks that received events match and in-order.
@@ -134,15 +349,20 @@ func (sc *SpanConverter) ConvertIntoSpans(triplet EventTriplet) ([]sdktrace.Read
 	}
 
 	parentCtx := context.Background()
-	if record, ok := triplet.Start.Record.(telemetryapi.RecordPlatformStart); ok {
+	if record, ok := triplet.Start.Record.(telemetryapi.RecordPlatformStart); ok && sc.parentExtraction {
+		tracingType, tracingValue := record.Tracing.Type, record.Tracing.Value
+		if triplet.InvokeTracing.Value != "" {
+			sc.log.V(1).Info("using invoke event tracing context as parent", "tracing", triplet.InvokeTracing.Value)
+			tracingType, tracingValue = triplet.InvokeTracing.Type, triplet.InvokeTracing.Value
+		}
 		carrier := propagation.MapCarrier{
-			string(record.Tracing.Type): string(record.Tracing.Value),
+			string(tracingType): string(tracingValue),
 		}
-		parentCtx = xray.Propagator{}.Extract(context.Background(), carrier)
+		parentCtx = sc.propagator(tracingType).Extract(context.Background(), carrier)
 		spanID, err := trace.SpanIDFromHex(record.Tracing.SpanID)
 		if err == nil {
 			traceID := trace.SpanContextFromContext(parentCtx).TraceID()
-			sc.log.V(1).Info("found xray tracing context", "traceID", traceID, "parentSpanID", spanID)
+			sc.log.V(1).Info("found tracing context", "type", tracingType, "traceID", traceID, "parentSpanID", spanID)
 			sc.gen.SetNext(traceID, spanID)
 		} else {
 			sc.log.V(1).Info("xray tracing is not enabled")
@@ -156,6 +376,12 @@ func (sc *SpanConverter) ConvertIntoSpans(triplet EventTriplet) ([]sdktrace.Read
 			SpanContext: triplet.PrevSC,
 			Attributes:  []attribute.KeyValue{attribute.String("aws.lambda.link_type", "previous-trace")},
 		}
+		if triplet.PrevRequestID != "" {
+			link.Attributes = append(link.Attributes, attribute.String("aws.lambda.previous_request_id", string(triplet.PrevRequestID)))
+		}
+		if sc.linkAttributes != nil {
+			link.Attributes = append(link.Attributes, sc.linkAttributes(triplet)...)
+		}
 		links = append(links, link)
 	}
 
@@ -164,8 +390,9 @@ func (sc *SpanConverter) ConvertIntoSpans(triplet EventTriplet) ([]sdktrace.Read
 		parentCtx,
 		spanName,
 		trace.WithTimestamp(triplet.Start.Time),
-		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithSpanKind(sc.spanKind(string(triplet.Type), true)),
 		trace.WithAttributes(getAttributes(triplet)...),
+		trace.WithAttributes(triplet.Attributes...),
 		trace.WithLinks(links...),
 	)
 	sc.log.V(1).Info(
@@ -180,17 +407,20 @@ func (sc *SpanConverter) ConvertIntoSpans(triplet EventTriplet) ([]sdktrace.Read
 		return nil, trace.SpanContext{}, err
 	}
 	span.SetStatus(status.Code, status.Description)
+	addLogEvents(span, triplet.Logs)
 
-	var spans []sdktrace.ReadOnlySpan
-	if record, ok := triplet.RuntimeDone.Record.(telemetryapi.RecordPlatformRuntimeDone); ok {
-		var err error
-		spans, err = sc.createChildSpans(curCtx, record)
-		if err != nil {
-			return nil, trace.SpanContext{}, err
-		}
+	spans, err := sc.createChildSpans(curCtx, getChildSpans(triplet))
+	if err != nil {
+		return nil, trace.SpanContext{}, err
 	}
 
 	span.End(trace.WithTimestamp(triplet.Report.Time))
+	if !span.SpanContext().IsSampled() {
+		// not sampled span is not recorded and should not be exported
+		sc.log.V(1).Info("span is not sampled", "name", spanName, "traceID", span.SpanContext().TraceID())
+
+		return spans, trace.SpanContextFromContext(curCtx), nil
+	}
 	roSpan, ok := span.(sdktrace.ReadOnlySpan)
 	if !ok {
 		return nil, trace.SpanContext{}, fmt.Errorf("could not cast span to ReadOnlySpan")
@@ -200,17 +430,52 @@ func (sc *SpanConverter) ConvertIntoSpans(triplet EventTriplet) ([]sdktrace.Read
 	return spans, trace.SpanContextFromContext(curCtx), nil
 }
 
-func (sc *SpanConverter) createChildSpans(ctx context.Context, record telemetryapi.RecordPlatformRuntimeDone) ([]sdktrace.ReadOnlySpan, error) {
-	spans := make([]sdktrace.ReadOnlySpan, 0, len(record.Spans))
-	for _, recordSpan := range record.Spans {
+// getChildSpans returns sub-timings of the phase reported in the spans array of runtimeDone and report records.
+// Init phase spans like extension init durations can be reported in both platform.initRuntimeDone and platform.initReport,
+// so spans repeated in the report are skipped.
+func getChildSpans(triplet EventTriplet) []telemetryapi.Span {
+	var spans []telemetryapi.Span
+	switch record := triplet.RuntimeDone.Record.(type) {
+	case telemetryapi.RecordPlatformRuntimeDone:
+		spans = append(spans, record.Spans...)
+	case telemetryapi.RecordPlatformInitRuntimeDone:
+		spans = append(spans, record.Spans...)
+	}
+	if record, ok := triplet.Report.Record.(telemetryapi.RecordPlatformInitReport); ok {
+		seen := make(map[telemetryapi.Span]bool, len(spans))
+		for _, span := range spans {
+			seen[span] = true
+		}
+		for _, span := range record.Spans {
+			if !seen[span] {
+				spans = append(spans, span)
+			}
+		}
+	}
+
+	return spans
+}
+
+func (sc *SpanConverter) createChildSpans(ctx context.Context, recordSpans []telemetryapi.Span) ([]sdktrace.ReadOnlySpan, error) {
+	spans := make([]sdktrace.ReadOnlySpan, 0, len(recordSpans))
+	for _, recordSpan := range recordSpans {
 		spanName := fmt.Sprintf("%s/%s", sc.functionName, recordSpan.Name)
 		_, childSpan := sc.tracer.Start(
 			ctx,
 			spanName,
 			trace.WithTimestamp(recordSpan.Start),
-			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithSpanKind(sc.spanKind(string(recordSpan.Name), false)),
 		)
-		childSpan.End(trace.WithTimestamp(recordSpan.Start.Add(time.Duration(recordSpan.Duration))))
+		duration := recordSpan.Duration.Duration()
+		if duration < 0 {
+			// span ending before its start is rejected by some backends
+			sc.log.Info("negative child span duration, ending span at its start time", "name", spanName, "duration", duration)
+			duration = 0
+		}
+		childSpan.End(trace.WithTimestamp(recordSpan.Start.Add(duration)))
+		if !childSpan.SpanContext().IsSampled() {
+			continue
+		}
 		sc.log.V(1).Info(
 			"created child span",
 			"name", spanName,
@@ -252,24 +517,51 @@ func getAttributes(triplet EventTriplet) []attribute.KeyValue {
 	}
 
 	if record, ok := triplet.RuntimeDone.Record.(telemetryapi.RecordPlatformRuntimeDone); ok {
-		attrs = append(attrs, attribute.Int("aws.lambda.produced_bytes", record.Metrics.ProducedBytes))
+		attrs = append(attrs, attribute.Int64("aws.lambda.produced_bytes", int64(record.Metrics.ProducedBytes)))
+		// timeouts are filterable by the attribute in addition to the span status
+		if record.Status == telemetryapi.StatusTimeout {
+			attrs = append(attrs, attribute.Bool("aws.lambda.timeout", true))
+		}
+	}
+	if record, ok := triplet.RuntimeDone.Record.(telemetryapi.RecordPlatformInitRuntimeDone); ok && record.Status == telemetryapi.StatusTimeout {
+		attrs = append(attrs, attribute.Bool("aws.lambda.timeout", true))
 	}
 
 	if record, ok := triplet.Report.Record.(telemetryapi.RecordPlatformReport); ok {
 		attrs = append(
 			attrs,
-			attribute.Int("aws.lambda.memory_size_mb", record.Metrics.MemorySizeMB),
-			attribute.Int("aws.lambda.max_memory_used_mb", record.Metrics.MaxMemoryUsedMB),
-			attribute.Int64("aws.lambda.billed_duration_ms", time.Duration(record.Metrics.BilledDuration).Milliseconds()),
+			attribute.Int64("aws.lambda.memory_size_mb", int64(record.Metrics.MemorySizeMB)),
+			attribute.Int64("aws.lambda.max_memory_used_mb", int64(record.Metrics.MaxMemoryUsedMB)),
+			attribute.Int64("aws.lambda.billed_duration_ms", record.Metrics.BilledDuration.Duration().Milliseconds()),
 		)
 		if record.Metrics.RestoreDuration != 0 {
-			attribute.Int64("aws.lambda.restore_duration_ms", time.Duration(record.Metrics.RestoreDuration).Milliseconds())
+			attribute.Int64("aws.lambda.restore_duration_ms", record.Metrics.RestoreDuration.Duration().Milliseconds())
 		}
 	}
 
 	return attrs
 }
 
+// addLogEvents adds log events as span events with the log line in log.message attribute.
+func addLogEvents(span trace.Span, logs []telemetryapi.Event) {
+	for _, event := range logs {
+		var message string
+		switch record := event.Record.(type) {
+		case telemetryapi.RecordFunction:
+			message = string(record)
+		case telemetryapi.RecordExtension:
+			message = string(record)
+		default:
+			continue
+		}
+		span.AddEvent(
+			string(event.Type),
+			trace.WithTimestamp(event.Time),
+			trace.WithAttributes(attribute.String("log.message", message)),
+		)
+	}
+}
+
 func getStatus(event telemetryapi.Event) (sdktrace.Status, error) {
 	var eventStatus telemetryapi.Status
 	status := sdktrace.Status{}
@@ -285,10 +577,19 @@ func getStatus(event telemetryapi.Event) (sdktrace.Status, error) {
 		return status, fmt.Errorf("unexpected type for triplet.RuntimeDone field")
 	}
 
-	if eventStatus == telemetryapi.StatusSuccess {
+	switch eventStatus {
+	case telemetryapi.StatusSuccess:
 		status.Code = codes.Ok
-	} else {
+	case telemetryapi.StatusTimeout:
+		status.Code = codes.Error
+		if status.Description == "" {
+			status.Description = "function timed out"
+		}
+	default:
 		status.Code = codes.Error
+		if status.Description == "" {
+			status.Description = fmt.Sprintf("function finished with %q status", eventStatus)
+		}
 	}
 
 	return status, nil
@@ -3,16 +3,27 @@ package otel_test
 import (
 	"bytes"
 	"context"
+	"encoding/json"
+	"log"
+	"os"
 	"testing"
 	"time"
 
+	"github.com/go-logr/stdr"
 	"github.com/stretchr/testify/require"
+	"github.com/tonglil/buflogr"
 	lambdaext "github.com/zakharovvi/aws-lambda-extensions"
 	"github.com/zakharovvi/aws-lambda-extensions/extapi"
 	"github.com/zakharovvi/aws-lambda-extensions/telemetryapi"
 	"github.com/zakharovvi/aws-lambda-extensions/telemetryapi/otel"
+	gootel "go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
 	"go.opentelemetry.io/otel/trace"
 )
 
@@ -95,6 +106,89 @@ func TestSpanConverter_ConvertIntoSpans_TracingNotEnabled(t *testing.T) {
 	require.False(t, spans[2].Parent().TraceID().IsValid())
 }
 
+func TestSpanConverter_ConvertIntoSpans_WithParentExtraction(t *testing.T) {
+	t.Parallel()
+
+	triplet := getInvokeTriplet()
+	xrayTraceID := "637e16f01fbed7cb2ea0e5d7537a6258"
+
+	sc := otel.NewSpanConverter(context.Background(), registerResp)
+	spans, _, err := sc.ConvertIntoSpans(triplet)
+	require.NoError(t, err)
+	root := spans[len(spans)-1]
+	require.True(t, root.Parent().IsValid())
+	require.Equal(t, xrayTraceID, root.SpanContext().TraceID().String())
+
+	sc = otel.NewSpanConverter(context.Background(), registerResp, otel.WithParentExtraction(false))
+	spans, _, err = sc.ConvertIntoSpans(triplet)
+	require.NoError(t, err)
+	for _, span := range spans[:len(spans)-1] {
+		require.Equal(t, spans[len(spans)-1].SpanContext().TraceID(), span.SpanContext().TraceID())
+	}
+	root = spans[len(spans)-1]
+	require.False(t, root.Parent().IsValid())
+	require.NotEqual(t, xrayTraceID, root.SpanContext().TraceID().String())
+}
+
+func TestSpanConverter_ConvertIntoSpans_WithPropagators(t *testing.T) {
+	t.Parallel()
+
+	const w3cTraceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	triplet := getInvokeTriplet()
+	record := triplet.Start.Record.(telemetryapi.RecordPlatformStart)
+	record.Tracing.Type = "traceparent"
+	record.Tracing.Value = "00-" + w3cTraceID + "-00f067aa0ba902b7-01"
+	triplet.Start.Record = record
+
+	// xray propagator can't extract W3C trace context
+	sc := otel.NewSpanConverter(context.Background(), registerResp)
+	spans, _, err := sc.ConvertIntoSpans(triplet)
+	require.NoError(t, err)
+	require.False(t, spans[len(spans)-1].Parent().IsValid())
+
+	sc = otel.NewSpanConverter(
+		context.Background(),
+		registerResp,
+		otel.WithPropagators(map[lambdaext.TracingType]propagation.TextMapPropagator{"traceparent": propagation.TraceContext{}}),
+	)
+	spans, _, err = sc.ConvertIntoSpans(triplet)
+	require.NoError(t, err)
+	root := spans[len(spans)-1]
+	require.True(t, root.Parent().IsValid())
+	require.Equal(t, w3cTraceID, root.Parent().TraceID().String())
+	require.Equal(t, "00f067aa0ba902b7", root.Parent().SpanID().String())
+	require.Equal(t, w3cTraceID, root.SpanContext().TraceID().String())
+
+	// X-Ray tracing type still uses xray propagator
+	spans, _, err = sc.ConvertIntoSpans(getInvokeTriplet())
+	require.NoError(t, err)
+	require.Equal(t, "637e16f01fbed7cb2ea0e5d7537a6258", spans[len(spans)-1].SpanContext().TraceID().String())
+}
+
+func BenchmarkSpanConverter_ConvertIntoSpans(b *testing.B) {
+	benchmarks := []struct {
+		name   string
+		enable bool
+	}{
+		{"parent extraction enabled", true},
+		{"parent extraction disabled", false},
+	}
+	for _, bm := range benchmarks {
+		bm := bm
+		b.Run(bm.name, func(b *testing.B) {
+			sc := otel.NewSpanConverter(context.Background(), registerResp, otel.WithParentExtraction(bm.enable))
+			triplet := getInvokeTriplet()
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, _, err := sc.ConvertIntoSpans(triplet); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
 func TestSpanConverter_ConvertIntoSpans_SpanContext(t *testing.T) {
 	t.Parallel()
 
@@ -105,6 +199,131 @@ func TestSpanConverter_ConvertIntoSpans_SpanContext(t *testing.T) {
 	require.Equal(t, spans[2].SpanContext(), spanContext)
 }
 
+func TestSpanConverter_ConvertIntoSpans_WithSpanKind(t *testing.T) {
+	t.Parallel()
+
+	sc := otel.NewSpanConverter(
+		context.Background(),
+		registerResp,
+		otel.WithSpanKind(func(name string, root bool) trace.SpanKind {
+			if name == "responseLatency" {
+				return trace.SpanKindClient
+			}
+
+			return otel.DefaultSpanKind(name, root)
+		}),
+	)
+
+	spans, _, err := sc.ConvertIntoSpans(getInvokeTriplet())
+	require.NoError(t, err)
+	require.Len(t, spans, 3)
+	require.Equal(t, trace.SpanKindClient, spans[0].SpanKind())
+	require.Equal(t, trace.SpanKindInternal, spans[1].SpanKind())
+	require.Equal(t, trace.SpanKindServer, spans[2].SpanKind())
+}
+
+func TestSpanConverter_ConvertIntoSpans_WithEnvironment(t *testing.T) {
+	t.Parallel()
+
+	env := map[string]string{
+		"AWS_REGION":                      "ap-south-1",
+		"AWS_LAMBDA_FUNCTION_MEMORY_SIZE": "256",
+	}
+	getenv := func(key string) string {
+		return env[key]
+	}
+	sc := otel.NewSpanConverter(context.Background(), registerResp, otel.WithEnvironment(getenv))
+
+	spans, _, err := sc.ConvertIntoSpans(getInitTriplet())
+	require.NoError(t, err)
+
+	res := spans[0].Resource()
+	region, ok := res.Set().Value(semconv.CloudRegionKey)
+	require.True(t, ok)
+	require.Equal(t, "ap-south-1", region.AsString())
+	memory, ok := res.Set().Value(semconv.FaaSMaxMemoryKey)
+	require.True(t, ok)
+	require.Equal(t, int64(256), memory.AsInt64())
+}
+
+func TestSpanConverter_ConvertIntoSpans_InvalidEnvironment(t *testing.T) {
+	t.Parallel()
+
+	env := map[string]string{
+		"AWS_LAMBDA_FUNCTION_MEMORY_SIZE": "garbage",
+	}
+	getenv := func(key string) string {
+		return env[key]
+	}
+	sc := otel.NewSpanConverter(context.Background(), registerResp, otel.WithEnvironment(getenv))
+
+	spans, _, err := sc.ConvertIntoSpans(getInitTriplet())
+	require.NoError(t, err)
+
+	res := spans[0].Resource()
+	require.False(t, res.Set().HasValue(semconv.CloudRegionKey))
+	require.False(t, res.Set().HasValue(semconv.FaaSMaxMemoryKey))
+}
+
+func TestSpanConverter_ConvertIntoSpans_Sampling(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name          string
+		tracingValue  lambdaext.TracingValue
+		opts          []otel.Option
+		wantSpansLen  int
+		wantIsSampled bool
+	}{
+		{
+			"sampled parent",
+			"Root=1-637e16f0-1fbed7cb2ea0e5d7537a6258;Parent=5ac36eec7a279fc5;Sampled=1",
+			nil,
+			3,
+			true,
+		},
+		{
+			"unsampled parent",
+			"Root=1-637e16f0-1fbed7cb2ea0e5d7537a6258;Parent=5ac36eec7a279fc5;Sampled=0",
+			nil,
+			0,
+			false,
+		},
+		{
+			"sampled parent with never sample sampler",
+			"Root=1-637e16f0-1fbed7cb2ea0e5d7537a6258;Parent=5ac36eec7a279fc5;Sampled=1",
+			[]otel.Option{otel.WithSampler(sdktrace.NeverSample())},
+			0,
+			false,
+		},
+		{
+			"unsampled parent with always sample sampler",
+			"Root=1-637e16f0-1fbed7cb2ea0e5d7537a6258;Parent=5ac36eec7a279fc5;Sampled=0",
+			[]otel.Option{otel.WithSampler(sdktrace.AlwaysSample())},
+			3,
+			true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			sc := otel.NewSpanConverter(context.Background(), registerResp, tt.opts...)
+
+			triplet := getInvokeTriplet()
+			record := triplet.Start.Record.(telemetryapi.RecordPlatformStart)
+			record.Tracing.Value = tt.tracingValue
+			triplet.Start.Record = record
+
+			spans, spanContext, err := sc.ConvertIntoSpans(triplet)
+			require.NoError(t, err)
+			require.Len(t, spans, tt.wantSpansLen)
+			require.True(t, spanContext.IsValid())
+			require.Equal(t, tt.wantIsSampled, spanContext.IsSampled())
+		})
+	}
+}
+
 func TestSpanConverter_ConvertIntoSpans(t *testing.T) {
 	t.Setenv("AWS_REGION", "eu-west-1")
 	t.Setenv("AWS_LAMBDA_FUNCTION_MEMORY_SIZE", "128")
@@ -175,7 +394,7 @@ var wantInvokeJSON = `{
 		"TraceState": "",
 		"Remote": false
 	},
-	"SpanKind": 2,
+	"SpanKind": 1,
 	"StartTime": "2022-11-23T12:49:53.086Z",
 	"EndTime": "2022-11-23T12:49:53.087Z",
 	"Attributes": null,
@@ -262,7 +481,7 @@ var wantInvokeJSON = `{
 		"TraceState": "",
 		"Remote": false
 	},
-	"SpanKind": 2,
+	"SpanKind": 1,
 	"StartTime": "2022-11-23T12:49:53.233Z",
 	"EndTime": "2022-11-23T12:49:53.2552Z",
 	"Attributes": null,
@@ -692,3 +911,186 @@ func getInitTriplet() otel.EventTriplet {
 		},
 	}
 }
+
+func TestNewSpanConverter_GlobalLogger(t *testing.T) {
+	var globalBuf, converterBuf bytes.Buffer
+	gootel.SetLogger(buflogr.NewWithBuffer(&globalBuf))
+	t.Cleanup(func() {
+		gootel.SetLogger(stdr.New(log.New(os.Stderr, "", log.LstdFlags|log.Lshortfile)))
+	})
+
+	// OpenTelemetry SDK logs TracerProvider creation with the global logger
+	otel.NewSpanConverter(context.Background(), registerResp, otel.WithLogger(buflogr.NewWithBuffer(&converterBuf)))
+	require.Contains(t, globalBuf.String(), "TracerProvider created")
+	require.NotContains(t, converterBuf.String(), "TracerProvider created")
+
+	globalBuf.Reset()
+	otel.NewSpanConverter(
+		context.Background(),
+		registerResp,
+		otel.WithLogger(buflogr.NewWithBuffer(&converterBuf)),
+		otel.WithSetGlobalLogger(true),
+	)
+	require.NotContains(t, globalBuf.String(), "TracerProvider created")
+	require.Contains(t, converterBuf.String(), "TracerProvider created")
+}
+
+func TestSpanConverter_ConvertIntoSpans_InitSpans(t *testing.T) {
+	t.Parallel()
+
+	sc := otel.NewSpanConverter(context.Background(), registerResp)
+
+	triplet := getInitTriplet()
+	extensionInit := telemetryapi.Span{
+		Name:     "extensionInit",
+		Start:    triplet.Start.Time.Add(time.Millisecond),
+		Duration: lambdaext.DurationMs(50 * time.Millisecond),
+	}
+	runtimeInit := telemetryapi.Span{
+		Name:     "runtimeInit",
+		Start:    triplet.Start.Time.Add(51 * time.Millisecond),
+		Duration: lambdaext.DurationMs(100 * time.Millisecond),
+	}
+	runtimeDone := triplet.RuntimeDone.Record.(telemetryapi.RecordPlatformInitRuntimeDone)
+	runtimeDone.Spans = []telemetryapi.Span{extensionInit}
+	triplet.RuntimeDone.Record = runtimeDone
+	report := triplet.Report.Record.(telemetryapi.RecordPlatformInitReport)
+	report.Spans = []telemetryapi.Span{extensionInit, runtimeInit}
+	triplet.Report.Record = report
+
+	spans, spanContext, err := sc.ConvertIntoSpans(triplet)
+	require.NoError(t, err)
+	require.Len(t, spans, 3)
+	require.Equal(t, "test-name/extensionInit", spans[0].Name())
+	require.Equal(t, extensionInit.Start, spans[0].StartTime())
+	require.Equal(t, extensionInit.Start.Add(50*time.Millisecond), spans[0].EndTime())
+	require.Equal(t, "test-name/runtimeInit", spans[1].Name())
+	require.Equal(t, "test-name/init", spans[2].Name())
+	for _, span := range spans[:2] {
+		require.Equal(t, spanContext.SpanID(), span.Parent().SpanID())
+		require.Equal(t, trace.SpanKindInternal, span.SpanKind())
+	}
+}
+
+func TestSpanConverter_ConvertIntoSpans_NonPositiveChildSpanDuration(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	sc := otel.NewSpanConverter(context.Background(), registerResp, otel.WithLogger(buflogr.NewWithBuffer(&buf)))
+
+	triplet := getInvokeTriplet()
+	start := triplet.Start.Time
+	runtimeDone := triplet.RuntimeDone.Record.(telemetryapi.RecordPlatformRuntimeDone)
+	runtimeDone.Spans = []telemetryapi.Span{
+		{Name: telemetryapi.SpanResponseLatency, Start: start, Duration: 0},
+		{Name: telemetryapi.SpanResponseDuration, Start: start, Duration: lambdaext.DurationMs(-time.Millisecond)},
+	}
+	triplet.RuntimeDone.Record = runtimeDone
+
+	spans, _, err := sc.ConvertIntoSpans(triplet)
+	require.NoError(t, err)
+	require.Len(t, spans, 3)
+	for _, span := range spans[:2] {
+		require.Equal(t, start, span.StartTime(), span.Name())
+		require.Equal(t, start, span.EndTime(), span.Name())
+	}
+	require.Contains(t, buf.String(), "negative child span duration, ending span at its start time name test-name/responseDuration")
+}
+
+func TestSpanConverter_ConvertIntoSpans_UnknownSpanName(t *testing.T) {
+	t.Parallel()
+
+	triplet := getInvokeTriplet()
+	err := json.Unmarshal([]byte(`{
+		"time": "2022-11-23T12:49:53.256Z",
+		"type": "platform.runtimeDone",
+		"record": {
+			"requestId": "cfa3c5e3-4441-42cc-86d0-404768d42e1b",
+			"status": "success",
+			"spans": [
+				{"name": "runtimeOverhead", "start": "2022-11-23T12:49:53.100Z", "durationMs": 5.5}
+			]
+		}
+	}`), &triplet.RuntimeDone)
+	require.NoError(t, err)
+
+	sc := otel.NewSpanConverter(context.Background(), registerResp)
+	spans, _, err := sc.ConvertIntoSpans(triplet)
+	require.NoError(t, err)
+	require.Len(t, spans, 2)
+	require.Equal(t, "test-name/runtimeOverhead", spans[0].Name())
+	require.Equal(t, time.Date(2022, 11, 23, 12, 49, 53, int(100*time.Millisecond), time.UTC), spans[0].StartTime())
+	require.Equal(t, time.Date(2022, 11, 23, 12, 49, 53, int(105500*time.Microsecond), time.UTC), spans[0].EndTime())
+	require.Equal(t, "test-name/invoke", spans[1].Name())
+}
+
+func TestSpanConverter_ConvertIntoSpans_Status(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name            string
+		status          telemetryapi.Status
+		errorType       string
+		wantCode        codes.Code
+		wantDescription string
+		wantTimeout     bool
+	}{
+		{
+			"success",
+			telemetryapi.StatusSuccess,
+			"",
+			codes.Ok,
+			"",
+			false,
+		},
+		{
+			"timeout",
+			telemetryapi.StatusTimeout,
+			"",
+			codes.Error,
+			"function timed out",
+			true,
+		},
+		{
+			"failure with error type",
+			telemetryapi.StatusFailure,
+			"Runtime.ExitError",
+			codes.Error,
+			"Runtime.ExitError",
+			false,
+		},
+		{
+			"failure without error type",
+			telemetryapi.StatusFailure,
+			"",
+			codes.Error,
+			`function finished with "failure" status`,
+			false,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			triplet := getInvokeTriplet()
+			record := triplet.RuntimeDone.Record.(telemetryapi.RecordPlatformRuntimeDone)
+			record.Status = tt.status
+			record.ErrorType = tt.errorType
+			triplet.RuntimeDone.Record = record
+
+			sc := otel.NewSpanConverter(context.Background(), registerResp)
+			spans, _, err := sc.ConvertIntoSpans(triplet)
+			require.NoError(t, err)
+			root := spans[len(spans)-1]
+			require.Equal(t, tt.wantCode, root.Status().Code)
+			require.Equal(t, tt.wantDescription, root.Status().Description)
+			timeout := attribute.Bool("aws.lambda.timeout", true)
+			if tt.wantTimeout {
+				require.Contains(t, root.Attributes(), timeout)
+			} else {
+				require.NotContains(t, root.Attributes(), timeout)
+			}
+		})
+	}
+}
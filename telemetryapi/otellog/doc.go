@@ -0,0 +1,11 @@
+// Package otellog implements conversion from Telemetry API function and extension log events into OpenTelemetry log records.
+// https://opentelemetry.io/docs/specs/otel/logs/data-model/
+//
+// Package otellog can be used with OpenTelemetry compatible log exporter to send logs to any destinations.
+// https://github.com/open-telemetry/opentelemetry-go/tree/main/exporters
+//
+// otellog is a separate go module because OpenTelemetry logs SDK requires newer go and OpenTelemetry versions
+// than the rest of the library.
+//
+// End-to-end example is available in examples/telemetry-otel-log-exporter
+package otellog
@@ -0,0 +1,25 @@
+module github.com/zakharovvi/aws-lambda-extensions/telemetryapi/otellog
+
+go 1.21
+
+require (
+	github.com/go-logr/logr v1.4.1
+	github.com/stretchr/testify v1.9.0
+	github.com/zakharovvi/aws-lambda-extensions v1.0.0
+	go.opentelemetry.io/otel v1.27.0
+	go.opentelemetry.io/otel/log v0.3.0
+	go.opentelemetry.io/otel/sdk/log v0.3.0
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/go-logr/stdr v1.2.2 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	go.opentelemetry.io/contrib/propagators/aws v1.11.1 // indirect
+	go.opentelemetry.io/otel/metric v1.27.0 // indirect
+	go.opentelemetry.io/otel/sdk v1.27.0 // indirect
+	go.opentelemetry.io/otel/trace v1.27.0 // indirect
+	golang.org/x/sync v0.7.0 // indirect
+	golang.org/x/sys v0.20.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
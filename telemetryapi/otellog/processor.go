@@ -0,0 +1,163 @@
+package otellog
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/zakharovvi/aws-lambda-extensions/extapi"
+	"github.com/zakharovvi/aws-lambda-extensions/logsapi"
+	"github.com/zakharovvi/aws-lambda-extensions/telemetryapi"
+	"github.com/zakharovvi/aws-lambda-extensions/telemetryapi/otel"
+	otlog "go.opentelemetry.io/otel/log"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+)
+
+// AttributeEventType is the log record attribute holding telemetryapi.EventType, "function" or "extension".
+const AttributeEventType = "event.type"
+
+// Processor implements telemetryapi.Processor interface to export function and extension logs as OpenTelemetry log records
+// through a given exporter. Platform events are ignored.
+// Processor should be passed into telemetryapi.Run instead of direct usage.
+type Processor struct {
+	exporter     sdklog.Exporter
+	log          logr.Logger
+	resourceOpts []otel.Option
+	provider     *sdklog.LoggerProvider
+	logger       otlog.Logger
+}
+
+// Option allows to configure Processor parameters.
+type Option interface {
+	apply(*options)
+}
+
+type options struct {
+	log          logr.Logger
+	resourceOpts []otel.Option
+}
+
+type loggerOption struct {
+	log logr.Logger
+}
+
+func (o loggerOption) apply(opts *options) {
+	opts.log = o.log
+}
+
+// WithLogger configures a logger for the Processor itself.
+// By default, the logger from the ctx passed into NewProcessor is used.
+func WithLogger(log logr.Logger) Option {
+	return loggerOption{log}
+}
+
+type resourceOptions []otel.Option
+
+func (o resourceOptions) apply(opts *options) {
+	opts.resourceOpts = append(opts.resourceOpts, o...)
+}
+
+// WithResourceOptions passes options to otel.NewResource which creates the resource attached to all log records.
+// The logger configured with WithLogger is passed first and can be overridden with otel.WithLogger.
+func WithResourceOptions(opts ...otel.Option) Option {
+	return resourceOptions(opts)
+}
+
+// NewProcessor creates Processor with provided sdklog.Exporter.
+func NewProcessor(ctx context.Context, exporter sdklog.Exporter, opts ...Option) *Processor {
+	options := options{
+		log: logr.FromContextOrDiscard(ctx),
+	}
+	for _, o := range opts {
+		o.apply(&options)
+	}
+
+	return &Processor{
+		exporter:     exporter,
+		log:          options.log,
+		resourceOpts: append([]otel.Option{otel.WithLogger(options.log)}, options.resourceOpts...),
+	}
+}
+
+func (p *Processor) Init(ctx context.Context, registerResp *extapi.RegisterResponse) error {
+	p.provider = sdklog.NewLoggerProvider(
+		sdklog.WithResource(otel.NewResource(ctx, registerResp, p.resourceOpts...)),
+		sdklog.WithProcessor(sdklog.NewBatchProcessor(p.exporter)),
+	)
+	p.logger = p.provider.Logger("github.com/zakharovvi/aws-lambda-extensions/telemetryapi/otellog")
+
+	return nil
+}
+
+func (p *Processor) Process(ctx context.Context, event telemetryapi.Event) error {
+	record, ok := ConvertIntoLogRecord(event)
+	if !ok {
+		return nil
+	}
+	record.SetObservedTimestamp(time.Now())
+	p.logger.Emit(ctx, record)
+
+	return nil
+}
+
+// Flush exports buffered log records, it implements telemetryapi.Flusher.
+func (p *Processor) Flush(ctx context.Context) error {
+	if err := p.provider.ForceFlush(ctx); err != nil {
+		return fmt.Errorf("could not flush log records: %w", err)
+	}
+
+	return nil
+}
+
+func (p *Processor) Shutdown(ctx context.Context, reason extapi.ShutdownReason, err error) error {
+	p.log.V(1).Info("shutting down log provider", "reason", reason, "error", err)
+	if err := p.provider.Shutdown(ctx); err != nil {
+		return fmt.Errorf("could not shutdown log provider: %w", err)
+	}
+
+	return nil
+}
+
+// ConvertIntoLogRecord converts RecordFunction and RecordExtension events into OpenTelemetry log record.
+// The log line becomes the record body and the severity is detected with logsapi.DetectLevel.
+// It returns false for other events.
+func ConvertIntoLogRecord(event telemetryapi.Event) (otlog.Record, bool) {
+	var line string
+	switch record := event.Record.(type) {
+	case telemetryapi.RecordFunction:
+		line = string(record)
+	case telemetryapi.RecordExtension:
+		line = string(record)
+	default:
+		return otlog.Record{}, false
+	}
+
+	var record otlog.Record
+	record.SetTimestamp(event.Time)
+	record.SetBody(otlog.StringValue(line))
+	if level := logsapi.DetectLevel(line); level != "" {
+		record.SetSeverity(Severity(level))
+		record.SetSeverityText(string(level))
+	}
+	record.AddAttributes(otlog.String(AttributeEventType, string(event.Type)))
+
+	return record, true
+}
+
+// Severity maps logsapi.Level into OpenTelemetry log severity.
+// otlog.SeverityUndefined is returned for an empty or unknown Level.
+func Severity(level logsapi.Level) otlog.Severity {
+	switch level {
+	case logsapi.LevelError:
+		return otlog.SeverityError
+	case logsapi.LevelWarn:
+		return otlog.SeverityWarn
+	case logsapi.LevelInfo:
+		return otlog.SeverityInfo
+	case logsapi.LevelDebug:
+		return otlog.SeverityDebug
+	default:
+		return otlog.SeverityUndefined
+	}
+}
@@ -0,0 +1,184 @@
+package otellog_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zakharovvi/aws-lambda-extensions/extapi"
+	"github.com/zakharovvi/aws-lambda-extensions/logsapi"
+	"github.com/zakharovvi/aws-lambda-extensions/telemetryapi"
+	"github.com/zakharovvi/aws-lambda-extensions/telemetryapi/otel"
+	"github.com/zakharovvi/aws-lambda-extensions/telemetryapi/otellog"
+	otlog "go.opentelemetry.io/otel/log"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+)
+
+var registerResp = &extapi.RegisterResponse{
+	FunctionName:    "test-name",
+	FunctionVersion: "$LATEST",
+	Handler:         "main",
+	AccountID:       "0123456789",
+}
+
+type inMemoryExporter struct {
+	mu      sync.Mutex
+	records []sdklog.Record
+}
+
+func (e *inMemoryExporter) Export(_ context.Context, records []sdklog.Record) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, r := range records {
+		e.records = append(e.records, r.Clone())
+	}
+
+	return nil
+}
+
+func (e *inMemoryExporter) Shutdown(context.Context) error { return nil }
+
+func (e *inMemoryExporter) ForceFlush(context.Context) error { return nil }
+
+func (e *inMemoryExporter) Records() []sdklog.Record {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.records
+}
+
+func TestProcessor(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	exporter := &inMemoryExporter{}
+	getenv := func(key string) string {
+		return map[string]string{"AWS_REGION": "ap-south-1"}[key]
+	}
+	proc := otellog.NewProcessor(ctx, exporter, otellog.WithResourceOptions(otel.WithEnvironment(getenv)))
+	require.NoError(t, proc.Init(ctx, registerResp))
+
+	ts := time.Date(2022, 10, 12, 0, 0, 0, 0, time.UTC)
+	events := []telemetryapi.Event{
+		{Time: ts, Type: telemetryapi.TypeFunction, Record: telemetryapi.RecordFunction("2022-10-12T00:00:00.000Z\tREQUEST-ID\tERROR\tfailed")},
+		{Time: ts, Type: telemetryapi.TypePlatformStart, Record: telemetryapi.RecordPlatformStart{RequestID: "REQUEST-ID"}},
+		{Time: ts, Type: telemetryapi.TypeExtension, Record: telemetryapi.RecordExtension("started")},
+	}
+	for _, event := range events {
+		require.NoError(t, proc.Process(ctx, event))
+	}
+	require.NoError(t, proc.Flush(ctx))
+
+	records := exporter.Records()
+	require.Len(t, records, 2)
+
+	require.Equal(t, "2022-10-12T00:00:00.000Z\tREQUEST-ID\tERROR\tfailed", records[0].Body().AsString())
+	require.Equal(t, otlog.SeverityError, records[0].Severity())
+	require.Equal(t, "ERROR", records[0].SeverityText())
+	require.Equal(t, ts, records[0].Timestamp())
+	require.False(t, records[0].ObservedTimestamp().IsZero())
+
+	require.Equal(t, "started", records[1].Body().AsString())
+	require.Equal(t, otlog.SeverityUndefined, records[1].Severity())
+	require.Empty(t, records[1].SeverityText())
+	var eventType string
+	records[1].WalkAttributes(func(kv otlog.KeyValue) bool {
+		if kv.Key == otellog.AttributeEventType {
+			eventType = kv.Value.AsString()
+		}
+
+		return true
+	})
+	require.Equal(t, string(telemetryapi.TypeExtension), eventType)
+
+	res := records[0].Resource()
+	wantRes := otel.NewResource(ctx, registerResp, otel.WithEnvironment(getenv))
+	require.Equal(t, wantRes.Equivalent(), res.Equivalent())
+	region, ok := res.Set().Value(semconv.CloudRegionKey)
+	require.True(t, ok)
+	require.Equal(t, "ap-south-1", region.AsString())
+
+	require.NoError(t, proc.Shutdown(ctx, extapi.Spindown, nil))
+}
+
+func TestConvertIntoLogRecord(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name         string
+		event        telemetryapi.Event
+		wantOK       bool
+		wantBody     string
+		wantSeverity otlog.Severity
+		wantText     string
+	}{
+		{
+			"function plain text",
+			telemetryapi.Event{Type: telemetryapi.TypeFunction, Record: telemetryapi.RecordFunction("[WARN] retrying")},
+			true,
+			"[WARN] retrying",
+			otlog.SeverityWarn,
+			"WARN",
+		},
+		{
+			"function json",
+			telemetryapi.Event{Type: telemetryapi.TypeFunction, Record: telemetryapi.RecordFunction(`{"level":"debug","msg":"details"}`)},
+			true,
+			`{"level":"debug","msg":"details"}`,
+			otlog.SeverityDebug,
+			"DEBUG",
+		},
+		{
+			"extension logfmt",
+			telemetryapi.Event{Type: telemetryapi.TypeExtension, Record: telemetryapi.RecordExtension("level=info msg=ready")},
+			true,
+			"level=info msg=ready",
+			otlog.SeverityInfo,
+			"INFO",
+		},
+		{
+			"no level",
+			telemetryapi.Event{Type: telemetryapi.TypeFunction, Record: telemetryapi.RecordFunction("hello")},
+			true,
+			"hello",
+			otlog.SeverityUndefined,
+			"",
+		},
+		{
+			"platform event",
+			telemetryapi.Event{Type: telemetryapi.TypePlatformStart, Record: telemetryapi.RecordPlatformStart{}},
+			false,
+			"",
+			otlog.SeverityUndefined,
+			"",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			record, ok := otellog.ConvertIntoLogRecord(tt.event)
+			require.Equal(t, tt.wantOK, ok)
+			if !ok {
+				return
+			}
+			require.Equal(t, tt.wantBody, record.Body().AsString())
+			require.Equal(t, tt.wantSeverity, record.Severity())
+			require.Equal(t, tt.wantText, record.SeverityText())
+		})
+	}
+}
+
+func TestSeverity(t *testing.T) {
+	t.Parallel()
+
+	require.Equal(t, otlog.SeverityError, otellog.Severity(logsapi.LevelError))
+	require.Equal(t, otlog.SeverityWarn, otellog.Severity(logsapi.LevelWarn))
+	require.Equal(t, otlog.SeverityInfo, otellog.Severity(logsapi.LevelInfo))
+	require.Equal(t, otlog.SeverityDebug, otellog.Severity(logsapi.LevelDebug))
+	require.Equal(t, otlog.SeverityUndefined, otellog.Severity(""))
+}
@@ -0,0 +1,240 @@
+package telemetryapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/zakharovvi/aws-lambda-extensions/extapi"
+	"github.com/zakharovvi/aws-lambda-extensions/internal"
+	"github.com/zakharovvi/aws-lambda-extensions/internal/detached"
+)
+
+// partitionQueueSize is the number of events buffered for every worker before Process blocks.
+const partitionQueueSize = 100
+
+type partitionKey struct{}
+
+// PartitionFromContext returns the index of the worker calling Processor.Process with WithPartitionedProcessing option.
+// It returns false if the ctx is not passed from a partition worker.
+func PartitionFromContext(ctx context.Context) (int, bool) {
+	partition, ok := ctx.Value(partitionKey{}).(int)
+
+	return partition, ok
+}
+
+// RequestIDKey is a key function for WithPartitionedProcessing which partitions events by request id.
+// It returns an empty key for events without request id, e.g. function and extension log lines,
+// so all of them are processed by the same worker.
+func RequestIDKey(event Event) string {
+	switch record := event.Record.(type) {
+	case RecordPlatformStart:
+		return string(record.RequestID)
+	case RecordPlatformRuntimeDone:
+		return string(record.RequestID)
+	case RecordPlatformReport:
+		return string(record.RequestID)
+	default:
+		return ""
+	}
+}
+
+// partitionedEvent is an event sent to a worker with the ctx of Process call and its deadline if any.
+// Events without ctx are flush barriers.
+type partitionedEvent struct {
+	ctx      context.Context
+	deadline time.Time
+	event    Event
+	done     chan<- struct{}
+}
+
+// newPartitionedEvent detaches the event ctx from the Process call as Run cancels it once Process returns,
+// which happens before the worker processes the queued event. The shutdown deadline is applied by the worker.
+func newPartitionedEvent(ctx context.Context, event Event) partitionedEvent {
+	deadline, _ := ctx.Deadline()
+
+	return partitionedEvent{ctx: detached.Context(ctx), deadline: deadline, event: event}
+}
+
+// errPartitionedProcessingStopped is returned by Process and Flush called after Shutdown stopped the workers.
+var errPartitionedProcessingStopped = errors.New("partitioned processing is stopped by Shutdown")
+
+// partitionedProcessor calls Processor.Process from worker goroutines selected by the event key.
+// Process errors are returned from the next Process, Flush or Shutdown call.
+// Queues are never closed as Process can still be sending when Shutdown is called after the shutdown deadline,
+// stopCh signals workers to process the queued events and exit instead.
+type partitionedProcessor struct {
+	proc    Processor
+	keyFunc func(Event) string
+	queues  []chan partitionedEvent
+	stopCh  chan struct{}
+	wg      sync.WaitGroup
+	errMu   sync.Mutex
+	err     error
+}
+
+func withPartitionedProcessing(proc Processor, keyFunc func(Event) string, workers int) Processor {
+	pp := &partitionedProcessor{
+		proc:    proc,
+		keyFunc: keyFunc,
+		queues:  make([]chan partitionedEvent, workers),
+		stopCh:  make(chan struct{}),
+	}
+
+	return internal.WithFlush[Event](pp, proc, pp.flush)
+}
+
+func (p *partitionedProcessor) Init(ctx context.Context, registerResp *extapi.RegisterResponse) error {
+	if err := p.proc.Init(ctx, registerResp); err != nil {
+		return err
+	}
+	for i := range p.queues {
+		p.queues[i] = make(chan partitionedEvent, partitionQueueSize)
+		p.wg.Add(1)
+		go p.work(i, p.queues[i])
+	}
+
+	return nil
+}
+
+func (p *partitionedProcessor) work(partition int, queue <-chan partitionedEvent) {
+	defer p.wg.Done()
+	for {
+		select {
+		case msg := <-queue:
+			p.handle(partition, msg)
+		case <-p.stopCh:
+			// process the events queued before Shutdown
+			for {
+				select {
+				case msg := <-queue:
+					p.handle(partition, msg)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (p *partitionedProcessor) handle(partition int, msg partitionedEvent) {
+	if msg.ctx == nil {
+		close(msg.done)
+
+		return
+	}
+	ctx := context.WithValue(msg.ctx, partitionKey{}, partition)
+	if !msg.deadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, msg.deadline)
+		defer cancel()
+	}
+	if err := p.proc.Process(ctx, msg.event); err != nil {
+		p.setErr(err)
+	}
+}
+
+func (p *partitionedProcessor) Process(ctx context.Context, event Event) error {
+	if err := p.getErr(); err != nil {
+		return err
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(p.keyFunc(event)))
+	select {
+	case p.queues[h.Sum32()%uint32(len(p.queues))] <- newPartitionedEvent(ctx, event):
+		return nil
+	case <-p.stopCh:
+		return errPartitionedProcessingStopped
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// wait blocks till all workers process the queued events or ctx is done.
+func (p *partitionedProcessor) wait(ctx context.Context) error {
+	dones := make([]chan struct{}, len(p.queues))
+	for i, queue := range p.queues {
+		dones[i] = make(chan struct{})
+		select {
+		case queue <- partitionedEvent{done: dones[i]}:
+		case <-p.stopCh:
+			return errPartitionedProcessingStopped
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	for _, done := range dones {
+		select {
+		case <-done:
+		case <-p.stopCh:
+			return errPartitionedProcessingStopped
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	return nil
+}
+
+// Shutdown stops the workers after they process the queued events and returns the first worker Process error
+// together with Processor.Shutdown error. The worker error is also passed to Processor.Shutdown if err is nil.
+// Processor.Shutdown is called while workers are still busy if they don't finish before ctx is done.
+func (p *partitionedProcessor) Shutdown(ctx context.Context, reason extapi.ShutdownReason, err error) error {
+	close(p.stopCh)
+	// workers are not started if Init failed
+	if p.queues[0] != nil {
+		stopped := make(chan struct{})
+		go func() {
+			p.wg.Wait()
+			close(stopped)
+		}()
+		// a hung worker must not block Processor.Shutdown past the shutdown deadline
+		select {
+		case <-stopped:
+		case <-ctx.Done():
+		}
+	}
+	workerErr := p.getErr()
+	if err == nil {
+		err = workerErr
+	}
+	shutdownErr := p.proc.Shutdown(ctx, reason, err)
+	switch {
+	case workerErr == nil:
+		return shutdownErr
+	case shutdownErr == nil:
+		return fmt.Errorf("partitioned Processor.Process failed: %w", workerErr)
+	default:
+		return fmt.Errorf("%w, partitioned Processor.Process failed: %v", shutdownErr, workerErr)
+	}
+}
+
+func (p *partitionedProcessor) setErr(err error) {
+	p.errMu.Lock()
+	defer p.errMu.Unlock()
+	if p.err == nil {
+		p.err = err
+	}
+}
+
+func (p *partitionedProcessor) getErr() error {
+	p.errMu.Lock()
+	defer p.errMu.Unlock()
+
+	return p.err
+}
+
+// flush waits for all queued events to be processed and calls Flusher.Flush while workers are idle.
+func (p *partitionedProcessor) flush(ctx context.Context, flusher internal.Flusher) error {
+	if err := p.wait(ctx); err != nil {
+		return err
+	}
+	if err := p.getErr(); err != nil {
+		return err
+	}
+
+	return flusher.Flush(ctx)
+}
@@ -0,0 +1,178 @@
+package telemetryapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// TimeLayout is the layout of Event.Time in events sent by Telemetry API, e.g. "2022-10-12T00:00:00.000Z".
+// Decoding accepts any RFC 3339 timestamp, including microsecond or nanosecond precision and numeric timezone offsets.
+const TimeLayout = "2006-01-02T15:04:05.000Z07:00"
+
+// formatTime formats t with TimeLayout, or with up to nanosecond precision if t has sub-millisecond fractional seconds
+// not to truncate higher precision timestamps.
+func formatTime(t time.Time) string {
+	if t.Nanosecond()%int(time.Millisecond) == 0 {
+		return t.Format(TimeLayout)
+	}
+
+	return t.Format(time.RFC3339Nano)
+}
+
+// IsPlatform reports whether the Event is emitted by Lambda platform and not a function or extension log line.
+func (e Event) IsPlatform() bool {
+	return strings.HasPrefix(string(e.Type), "platform.")
+}
+
+// RawEvent reconstructs the original json event object for byte-exact pass-through.
+// Event.RawTime and Event.RawRecord are copied as is without re-marshaling, so the timestamp format,
+// record key order and whitespace are preserved.
+// Only the wrapper is synthesized with fields in the order Telemetry API sends them.
+// If RawTime is empty, e.g. the Event is not decoded from json, Event.Time is formatted with TimeLayout,
+// or with higher precision if Event.Time has sub-millisecond fractional seconds.
+// If RawRecord was dropped with WithDropRawRecord, Event.Record is encoded instead.
+// Such record is meant for printing and may not be decoded back, e.g. lambdaext.DurationMs is encoded as a string.
+// The record is null if Event.Record is nil or can't be encoded.
+func (e Event) RawEvent() []byte {
+	eventType, _ := json.Marshal(string(e.Type))
+	record := []byte(e.RawRecord)
+	if len(record) == 0 && e.Record != nil {
+		record, _ = json.Marshal(e.Record)
+	}
+	if len(record) == 0 {
+		record = []byte("null")
+	}
+
+	eventTime := []byte(e.RawTime)
+	if len(eventTime) == 0 {
+		eventTime = []byte(`"` + formatTime(e.Time) + `"`)
+	}
+
+	var b bytes.Buffer
+	b.Grow(len(`{"time":,"type":,"record":}`) + len(eventTime) + len(eventType) + len(record))
+	b.WriteString(`{"time":`)
+	b.Write(eventTime)
+	b.WriteString(`,"type":`)
+	b.Write(eventType)
+	b.WriteString(`,"record":`)
+	b.Write(record)
+	b.WriteString(`}`)
+
+	return b.Bytes()
+}
+
+// AsPlatformInitStart returns Event.Record as RecordPlatformInitStart and false if the Record is of another type.
+func (e Event) AsPlatformInitStart() (RecordPlatformInitStart, bool) {
+	return as[RecordPlatformInitStart](e)
+}
+
+// AsPlatformInitRuntimeDone returns Event.Record as RecordPlatformInitRuntimeDone and false if the Record is of another type.
+func (e Event) AsPlatformInitRuntimeDone() (RecordPlatformInitRuntimeDone, bool) {
+	return as[RecordPlatformInitRuntimeDone](e)
+}
+
+// AsPlatformInitReport returns Event.Record as RecordPlatformInitReport and false if the Record is of another type.
+func (e Event) AsPlatformInitReport() (RecordPlatformInitReport, bool) {
+	return as[RecordPlatformInitReport](e)
+}
+
+// AsPlatformStart returns Event.Record as RecordPlatformStart and false if the Record is of another type.
+func (e Event) AsPlatformStart() (RecordPlatformStart, bool) {
+	return as[RecordPlatformStart](e)
+}
+
+// AsPlatformRuntimeDone returns Event.Record as RecordPlatformRuntimeDone and false if the Record is of another type.
+func (e Event) AsPlatformRuntimeDone() (RecordPlatformRuntimeDone, bool) {
+	return as[RecordPlatformRuntimeDone](e)
+}
+
+// AsPlatformReport returns Event.Record as RecordPlatformReport and false if the Record is of another type.
+func (e Event) AsPlatformReport() (RecordPlatformReport, bool) {
+	return as[RecordPlatformReport](e)
+}
+
+// AsPlatformRestoreStart returns Event.Record as RecordPlatformRestoreStart and false if the Record is of another type.
+func (e Event) AsPlatformRestoreStart() (RecordPlatformRestoreStart, bool) {
+	return as[RecordPlatformRestoreStart](e)
+}
+
+// AsPlatformRestoreRuntimeDone returns Event.Record as RecordPlatformRestoreRuntimeDone and false if the Record is of another type.
+func (e Event) AsPlatformRestoreRuntimeDone() (RecordPlatformRestoreRuntimeDone, bool) {
+	return as[RecordPlatformRestoreRuntimeDone](e)
+}
+
+// AsPlatformRestoreReport returns Event.Record as RecordPlatformRestoreReport and false if the Record is of another type.
+func (e Event) AsPlatformRestoreReport() (RecordPlatformRestoreReport, bool) {
+	return as[RecordPlatformRestoreReport](e)
+}
+
+// AsPlatformExtension returns Event.Record as RecordPlatformExtension and false if the Record is of another type.
+func (e Event) AsPlatformExtension() (RecordPlatformExtension, bool) {
+	return as[RecordPlatformExtension](e)
+}
+
+// AsPlatformTelemetrySubscription returns Event.Record as RecordPlatformTelemetrySubscription and false if the Record is of another type.
+func (e Event) AsPlatformTelemetrySubscription() (RecordPlatformTelemetrySubscription, bool) {
+	return as[RecordPlatformTelemetrySubscription](e)
+}
+
+// AsPlatformLogsDropped returns Event.Record as RecordPlatformLogsDropped and false if the Record is of another type.
+func (e Event) AsPlatformLogsDropped() (RecordPlatformLogsDropped, bool) {
+	return as[RecordPlatformLogsDropped](e)
+}
+
+// AsFunction returns Event.Record as RecordFunction and false if the Record is of another type.
+func (e Event) AsFunction() (RecordFunction, bool) {
+	return as[RecordFunction](e)
+}
+
+// AsExtension returns Event.Record as RecordExtension and false if the Record is of another type.
+func (e Event) AsExtension() (RecordExtension, bool) {
+	return as[RecordExtension](e)
+}
+
+func as[T any](e Event) (T, bool) {
+	record, ok := e.Record.(T)
+
+	return record, ok
+}
+
+// RecordType returns a stable name of the Event.Record type, e.g. "RecordPlatformStart" or "RecordFunction".
+// It makes test assertions, logging and metric labels independent of the Event.Type string.
+// An empty string is returned if the Record is nil, e.g. for unknown event types decoded with WithIgnoreUnknownTypes.
+func RecordType(event Event) string {
+	switch event.Record.(type) {
+	case RecordPlatformInitStart:
+		return "RecordPlatformInitStart"
+	case RecordPlatformInitRuntimeDone:
+		return "RecordPlatformInitRuntimeDone"
+	case RecordPlatformInitReport:
+		return "RecordPlatformInitReport"
+	case RecordPlatformStart:
+		return "RecordPlatformStart"
+	case RecordPlatformRuntimeDone:
+		return "RecordPlatformRuntimeDone"
+	case RecordPlatformReport:
+		return "RecordPlatformReport"
+	case RecordPlatformRestoreStart:
+		return "RecordPlatformRestoreStart"
+	case RecordPlatformRestoreRuntimeDone:
+		return "RecordPlatformRestoreRuntimeDone"
+	case RecordPlatformRestoreReport:
+		return "RecordPlatformRestoreReport"
+	case RecordPlatformExtension:
+		return "RecordPlatformExtension"
+	case RecordPlatformTelemetrySubscription:
+		return "RecordPlatformTelemetrySubscription"
+	case RecordPlatformLogsDropped:
+		return "RecordPlatformLogsDropped"
+	case RecordFunction:
+		return "RecordFunction"
+	case RecordExtension:
+		return "RecordExtension"
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,124 @@
+package telemetryapi_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zakharovvi/aws-lambda-extensions/telemetryapi"
+)
+
+func TestEvent_As(t *testing.T) {
+	report := telemetryapi.Event{
+		Type:   telemetryapi.TypePlatformReport,
+		Record: telemetryapi.RecordPlatformReport{RequestID: "1.1", Status: telemetryapi.StatusSuccess},
+	}
+	require.True(t, report.IsPlatform())
+
+	record, ok := report.AsPlatformReport()
+	require.True(t, ok)
+	require.Equal(t, telemetryapi.RecordPlatformReport{RequestID: "1.1", Status: telemetryapi.StatusSuccess}, record)
+
+	start, ok := report.AsPlatformStart()
+	require.False(t, ok)
+	require.Equal(t, telemetryapi.RecordPlatformStart{}, start)
+	_, ok = report.AsPlatformRuntimeDone()
+	require.False(t, ok)
+	_, ok = report.AsFunction()
+	require.False(t, ok)
+
+	function := telemetryapi.Event{
+		Type:   telemetryapi.TypeFunction,
+		Record: telemetryapi.RecordFunction("hello"),
+	}
+	require.False(t, function.IsPlatform())
+
+	line, ok := function.AsFunction()
+	require.True(t, ok)
+	require.Equal(t, telemetryapi.RecordFunction("hello"), line)
+	_, ok = function.AsExtension()
+	require.False(t, ok)
+	_, ok = function.AsPlatformReport()
+	require.False(t, ok)
+
+	unknown := telemetryapi.Event{Type: "platform.unknown"}
+	require.True(t, unknown.IsPlatform())
+	_, ok = unknown.AsPlatformReport()
+	require.False(t, ok)
+}
+
+func TestRecordType(t *testing.T) {
+	tests := []struct {
+		record any
+		want   string
+	}{
+		{telemetryapi.RecordPlatformInitStart{}, "RecordPlatformInitStart"},
+		{telemetryapi.RecordPlatformInitRuntimeDone{}, "RecordPlatformInitRuntimeDone"},
+		{telemetryapi.RecordPlatformInitReport{}, "RecordPlatformInitReport"},
+		{telemetryapi.RecordPlatformStart{}, "RecordPlatformStart"},
+		{telemetryapi.RecordPlatformRuntimeDone{}, "RecordPlatformRuntimeDone"},
+		{telemetryapi.RecordPlatformReport{}, "RecordPlatformReport"},
+		{telemetryapi.RecordPlatformRestoreStart{}, "RecordPlatformRestoreStart"},
+		{telemetryapi.RecordPlatformRestoreRuntimeDone{}, "RecordPlatformRestoreRuntimeDone"},
+		{telemetryapi.RecordPlatformRestoreReport{}, "RecordPlatformRestoreReport"},
+		{telemetryapi.RecordPlatformExtension{}, "RecordPlatformExtension"},
+		{telemetryapi.RecordPlatformTelemetrySubscription{}, "RecordPlatformTelemetrySubscription"},
+		{telemetryapi.RecordPlatformLogsDropped{}, "RecordPlatformLogsDropped"},
+		{telemetryapi.RecordFunction("hello"), "RecordFunction"},
+		{telemetryapi.RecordExtension("hello"), "RecordExtension"},
+		{"plain string", ""},
+		{nil, ""},
+	}
+	for _, tt := range tests {
+		require.Equal(t, tt.want, telemetryapi.RecordType(telemetryapi.Event{Record: tt.record}))
+	}
+}
+
+func TestEvent_RawEvent(t *testing.T) {
+	input := `{"time":"2022-10-12T00:03:50.000Z","type":"platform.start","record":{ "requestId" : "6f7f0961f83442118a7af6fe80b88d56",  "version":"$LATEST"}}`
+
+	eventsCh := make(chan telemetryapi.Event, 1)
+	require.NoError(t, telemetryapi.Decode(context.Background(), io.NopCloser(strings.NewReader("["+input+"]")), eventsCh))
+	event := <-eventsCh
+
+	require.Equal(t, input, string(event.RawEvent()))
+
+	event.RawRecord = nil
+	require.Equal(
+		t,
+		`{"time":"2022-10-12T00:03:50.000Z","type":"platform.start","record":{"requestId":"6f7f0961f83442118a7af6fe80b88d56","version":"$LATEST","tracing":{"type":"","value":""}}}`,
+		string(event.RawEvent()),
+	)
+
+	event.Record = nil
+	require.Equal(t, `{"time":"2022-10-12T00:03:50.000Z","type":"platform.start","record":null}`, string(event.RawEvent()))
+}
+
+func TestEvent_RawEvent_TimeRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	for _, value := range []string{
+		"2020-08-20T12:31:32.0Z",
+		"2022-10-12T00:00:00.000+00:00",
+		"2022-10-12T00:00:00.000Z",
+		"2020-08-20T12:31:32.123456Z",
+		"2020-08-20T14:31:32.123+02:00",
+	} {
+		value := value
+		t.Run(value, func(t *testing.T) {
+			t.Parallel()
+
+			input := `{"time":"` + value + `","type":"function","record":"Hello world"}`
+			eventsCh := make(chan telemetryapi.Event, 1)
+			require.NoError(t, telemetryapi.Decode(context.Background(), io.NopCloser(strings.NewReader("["+input+"]")), eventsCh))
+			require.Equal(t, input, string((<-eventsCh).RawEvent()))
+
+			event := telemetryapi.Event{}
+			require.NoError(t, json.Unmarshal([]byte(input), &event))
+			require.Equal(t, input, string(event.RawEvent()))
+		})
+	}
+}
@@ -2,6 +2,9 @@ package telemetryapi
 
 import (
 	"context"
+	"fmt"
+	"net"
+	"time"
 
 	"github.com/go-logr/logr"
 	"github.com/zakharovvi/aws-lambda-extensions/extapi"
@@ -9,23 +12,79 @@ import (
 )
 
 // Processor implements client logic to process and store events.
+//
+// Run calls all Processor methods sequentially from a single goroutine, so Processor implementations
+// don't need to be safe for concurrent use. Wrap Processor with Synchronized if its methods can be called
+// concurrently, e.g. from custom HTTP handlers decoding events with Decode.
+// The only exception is the shutdown deadline: if Process or Flusher.Flush is still in progress when it passes,
+// Shutdown is called concurrently with it not to be killed by Lambda before Shutdown runs.
 type Processor interface {
 	// Init is called before starting receiving events and Process.
 	// It's the best place to make network connections, warmup caches, preallocate buffers, etc.
+	// extapi.ClientFromContext returns extapi.Client from the ctx passed into all Processor methods
+	// to make additional Extensions API calls.
 	Init(ctx context.Context, registerResp *extapi.RegisterResponse) error
 	// Process stores events in persistent storage or accumulate in a buffer and flush periodically.
+	// extapi.RegisterResponseFromContext returns RegisterResponse from the ctx passed into Process and Shutdown.
+	// The ctx has no deadline until the shutdown starts. Events still queued when the shutdown starts are processed
+	// with the Shutdown deadline, so Process can budget I/O with ctx.Deadline.
+	// The ctx is cancelled once Process returns, it must not be used by work continued asynchronously.
 	Process(ctx context.Context, event Event) error
-	// Shutdown is called before exiting the extension.
+	// Shutdown is called before exiting the extension after processing the received events or the shutdown deadline.
+	// In the latter case, Shutdown can run concurrently with the in-flight Process or Flusher.Flush.
 	// Processor should flush all the buffered data to persistent storage if any and cleanup all used resources.
 	Shutdown(ctx context.Context, reason extapi.ShutdownReason, err error) error
 }
 
+// Flusher can be optionally implemented by Processor to flush buffered data periodically
+// independent of event arrival. See WithFlushInterval.
+type Flusher interface {
+	// Flush is called in the same goroutine as Processor.Process, so no synchronization with Process is needed.
+	// Flush can still be in progress when Shutdown is called after the shutdown deadline.
+	Flush(ctx context.Context) error
+}
+
+// Stats contains counters of events HTTP requests received by Run.
+// Sequence-Id gaps indicate that Lambda dropped batches because the Processor fell behind.
+type Stats = internal.Stats
+
+// StatsFromContext returns Stats from the ctx passed into Processor.Process, Flusher.Flush and Processor.Shutdown.
+// It returns false if the ctx doesn't carry Stats.
+func StatsFromContext(ctx context.Context) (Stats, bool) {
+	return internal.StatsFromContext(ctx)
+}
+
 type options struct {
-	log               logr.Logger
-	subscriptionTypes []extapi.TelemetrySubscriptionType
-	bufferingCfg      *extapi.TelemetryBufferingCfg
-	clientOptions     []extapi.Option
-	destinationAddr   string
+	log                   logr.Logger
+	subscriptionTypes     []extapi.TelemetrySubscriptionType
+	bufferingCfg          *extapi.TelemetryBufferingCfg
+	clientOptions         []extapi.Option
+	destinationAddr       string
+	allowNonSandboxHost   bool
+	destinationListener   net.Listener
+	invokeHandler         func(ctx context.Context, event *extapi.NextEventResponse) error
+	invokeDeadline        bool
+	dropRawRecord         bool
+	ignoreUnknownTypes    bool
+	skipMalformedRecords  bool
+	disallowUnknownFields bool
+	validateEnums         bool
+	strictContentType     bool
+	flushInterval         time.Duration
+	processRetry          internal.ProcessRetry
+	// maxConcurrentDeliveries limits concurrently decoded events HTTP requests, zero means unlimited
+	maxConcurrentDeliveries int
+	asyncDecode             bool
+	destinationURLCallback  func(url string)
+	acceptRetry             internal.AcceptRetry
+	schemaVersion           extapi.TelemetrySchemaVersion
+	logLevel                extapi.TelemetryLogLevel
+	logFormat               extapi.TelemetryLogFormat
+	partitionKey            func(Event) string
+	partitionWorkers        int
+	dedupWindow             int
+	processTiming           bool
+	slowProcessThreshold    time.Duration
 }
 
 type loggerOption struct {
@@ -85,48 +144,446 @@ func (o destinationAddrOption) apply(opts *options) {
 }
 
 // WithDestinationAddr configures host and port for telemetry HTTP server to listen
-// Lambda API accepts only "sandbox.localdomain" host.
+// Lambda API accepts only "sandbox.localdomain" host. Run logs a warning for other hosts unless WithAllowNonSandboxHost is set.
 func WithDestinationAddr(addr string) Option {
 	return destinationAddrOption(addr)
 }
 
+type allowNonSandboxHostOption bool
+
+func (o allowNonSandboxHostOption) apply(opts *options) {
+	opts.allowNonSandboxHost = bool(o)
+}
+
+// WithAllowNonSandboxHost disables the warning logged by Run if WithDestinationAddr host is not "sandbox.localdomain".
+// Useful in tests and local environments which accept other hosts.
+func WithAllowNonSandboxHost(allow bool) Option {
+	return allowNonSandboxHostOption(allow)
+}
+
+type destinationListenerOption struct {
+	ln net.Listener
+}
+
+func (o destinationListenerOption) apply(opts *options) {
+	opts.destinationListener = o.ln
+}
+
+// WithDestinationListener configures pre-bound listener for events receiving HTTP server to use instead of binding WithDestinationAddr.
+// Host from WithDestinationAddr and port from the listener are used to build the destination URL for the subscription.
+// Run takes ownership of the listener and closes it on shutdown.
+func WithDestinationListener(ln net.Listener) Option {
+	return destinationListenerOption{ln}
+}
+
+type destinationURLCallbackOption func(url string)
+
+func (o destinationURLCallbackOption) apply(opts *options) {
+	opts.destinationURLCallback = o
+}
+
+// WithDestinationURLCallback configures a callback receiving the destination URL of the subscription
+// after the events receiving HTTP server starts listening, e.g. http://sandbox.localdomain:41837.
+// It reports the actual port if WithDestinationAddr port is 0. Useful for diagnostics and tests.
+func WithDestinationURLCallback(fn func(url string)) Option {
+	return destinationURLCallbackOption(fn)
+}
+
+type dropRawRecordOption bool
+
+func (o dropRawRecordOption) apply(opts *options) {
+	opts.dropRawRecord = bool(o)
+}
+
+// WithDropRawRecord configures Run to clear Event.RawRecord after decoding the typed Event.Record.
+// It reduces memory usage for processors which don't need raw json. RawRecord is kept by default.
+func WithDropRawRecord(drop bool) Option {
+	return dropRawRecordOption(drop)
+}
+
+type ignoreUnknownTypesOption bool
+
+func (o ignoreUnknownTypesOption) apply(opts *options) {
+	opts.ignoreUnknownTypes = bool(o)
+}
+
+// WithIgnoreUnknownTypes enables lenient decoding mode.
+// Events of unknown types are passed to Processor with nil Record and preserved RawRecord instead of failing the extension.
+// It protects deployed extensions from new event types introduced by AWS. Decoding is strict by default.
+func WithIgnoreUnknownTypes(ignore bool) Option {
+	return ignoreUnknownTypesOption(ignore)
+}
+
+type skipMalformedRecordsOption bool
+
+func (o skipMalformedRecordsOption) apply(opts *options) {
+	opts.skipMalformedRecords = bool(o)
+}
+
+// WithSkipMalformedRecords configures decoding to log and skip events which could not be decoded
+// and continue with the next event in the batch instead of failing the extension.
+func WithSkipMalformedRecords(skip bool) Option {
+	return skipMalformedRecordsOption(skip)
+}
+
+type strictContentTypeOption bool
+
+func (o strictContentTypeOption) apply(opts *options) {
+	opts.strictContentType = bool(o)
+}
+
+// WithStrictContentType configures events receiving HTTP server to reject requests with Content-Type other than application/json
+// with 415 Unsupported Media Type status without decoding them and failing the extension.
+// It protects from unrelated requests like health checks. The check is enabled by default.
+func WithStrictContentType(strict bool) Option {
+	return strictContentTypeOption(strict)
+}
+
+type disallowUnknownFieldsOption bool
+
+func (o disallowUnknownFieldsOption) apply(opts *options) {
+	opts.disallowUnknownFields = bool(o)
+}
+
+// WithDisallowUnknownFields enables strict decoding mode of records with json.Decoder.DisallowUnknownFields.
+// Fields not defined in the typed Record struct are reported as decoding errors naming the event type and the field.
+// It helps to catch AWS schema changes early in tests. Unknown fields are ignored by default.
+func WithDisallowUnknownFields(disallow bool) Option {
+	return disallowUnknownFieldsOption(disallow)
+}
+
+type validateEnumsOption bool
+
+func (o validateEnumsOption) apply(opts *options) {
+	opts.validateEnums = bool(o)
+}
+
+// WithValidateEnums enables validation of Status and Phase record fields after decoding.
+// Values not defined in the schema are reported as decoding errors to catch AWS schema drift early.
+// Unknown values are decoded as is by default.
+func WithValidateEnums(validate bool) Option {
+	return validateEnumsOption(validate)
+}
+
+type invokeHandlerOption func(ctx context.Context, event *extapi.NextEventResponse) error
+
+func (o invokeHandlerOption) apply(opts *options) {
+	opts.invokeHandler = o
+}
+
+// WithInvokeHandler subscribes the extension to Invoke events in addition to Shutdown
+// and calls the handler for every invocation while events are received in the background.
+// It allows correlating telemetry with the invoke event data like deadline and invoked function arn.
+// Run fails if the handler returns an error.
+func WithInvokeHandler(handler func(ctx context.Context, event *extapi.NextEventResponse) error) Option {
+	return invokeHandlerOption(handler)
+}
+
+type invokeDeadlineOption bool
+
+func (o invokeDeadlineOption) apply(opts *options) {
+	opts.invokeDeadline = bool(o)
+}
+
+// WithInvokeDeadline subscribes the extension to Invoke events in addition to Shutdown only to capture invocation deadlines
+// without implementing an invoke handler. InvokeDeadlineFromContext returns the deadline of the last invocation
+// from the ctx passed into Processor.Process and Flusher.Flush, e.g. to time flushes before the invocation times out.
+// Subscription to Invoke events makes Lambda wait for the extension on every invocation.
+// It can be combined with WithInvokeHandler.
+func WithInvokeDeadline(enable bool) Option {
+	return invokeDeadlineOption(enable)
+}
+
+type flushIntervalOption time.Duration
+
+func (o flushIntervalOption) apply(opts *options) {
+	opts.flushInterval = time.Duration(o)
+}
+
+// WithFlushInterval configures Run to call Flusher.Flush with the interval if Processor implements Flusher.
+// The ticker doesn't fire while the execution environment is frozen between invocations,
+// so flushes can be delayed till the next invocation or Shutdown. Periodic flushes are disabled by default.
+func WithFlushInterval(interval time.Duration) Option {
+	return flushIntervalOption(interval)
+}
+
+// SupportedSchemaVersions lists Telemetry API schema versions which Decode understands.
+var SupportedSchemaVersions = []extapi.TelemetrySchemaVersion{
+	extapi.TelemetrySchemaVersion20220701,
+	extapi.TelemetrySchemaVersion20221213,
+}
+
+type schemaVersionOption extapi.TelemetrySchemaVersion
+
+func (o schemaVersionOption) apply(opts *options) {
+	opts.schemaVersion = extapi.TelemetrySchemaVersion(o)
+}
+
+// WithSchemaVersion configures Telemetry API schema version to subscribe with.
+// Run fails at subscribe time if the version is not listed in SupportedSchemaVersions.
+func WithSchemaVersion(version extapi.TelemetrySchemaVersion) Option {
+	return schemaVersionOption(version)
+}
+
+type processRetryOption internal.ProcessRetry
+
+func (o processRetryOption) apply(opts *options) {
+	opts.processRetry = internal.ProcessRetry(o)
+}
+
+// WithProcessRetry configures Run to retry Processor.Process up to attempts times if it returns an error,
+// e.g. to recover from transient failures of the downstream sink.
+// Delay before each retry doubles starting from backoff. Retries stop early if the delay exceeds the context deadline.
+// Run fails with the last error after retries are exhausted. Process is not retried by default.
+func WithProcessRetry(attempts int, backoff time.Duration) Option {
+	return processRetryOption{Attempts: attempts, Backoff: backoff}
+}
+
+type maxConcurrentDeliveriesOption int
+
+func (o maxConcurrentDeliveriesOption) apply(opts *options) {
+	opts.maxConcurrentDeliveries = int(o)
+}
+
+// WithMaxConcurrentDeliveries limits the number of events HTTP requests decoded concurrently.
+// Requests over the limit are rejected with 429 Too Many Requests status code and retried by Lambda API later.
+// Lambda API delivers events sequentially, so the limit protects the extension from unbounded goroutine growth
+// caused by misbehaving clients. The number of concurrent deliveries is unlimited by default.
+func WithMaxConcurrentDeliveries(n int) Option {
+	return maxConcurrentDeliveriesOption(n)
+}
+
+type serverAcceptRetriesOption internal.AcceptRetry
+
+func (o serverAcceptRetriesOption) apply(opts *options) {
+	opts.acceptRetry = internal.AcceptRetry(o)
+}
+
+// WithServerAcceptRetries configures the receiving HTTP server to retry accepting connections up to attempts times
+// after consecutive failures, e.g. when the process runs out of file descriptors. The delay between attempts starts
+// with backoff and doubles after every failed attempt. The server stops and Run fails on the first error by default.
+func WithServerAcceptRetries(attempts int, backoff time.Duration) Option {
+	return serverAcceptRetriesOption{Attempts: attempts, Backoff: backoff}
+}
+
+type asyncDecodeOption bool
+
+func (o asyncDecodeOption) apply(opts *options) {
+	opts.asyncDecode = bool(o)
+}
+
+// WithAsyncDecode configures the events HTTP server to read the request body into memory and respond
+// before decoding to minimize the time Lambda API delivery request is held open. It trades memory for faster ack.
+// Deliveries are decoded in order of arrival and all of them are processed before Processor.Shutdown call.
+// Decoding errors can't be returned to Lambda API and stop the extension. Decoding is synchronous by default.
+func WithAsyncDecode(enable bool) Option {
+	return asyncDecodeOption(enable)
+}
+
+type logLevelOption extapi.TelemetryLogLevel
+
+func (o logLevelOption) apply(opts *options) {
+	opts.logLevel = extapi.TelemetryLogLevel(o)
+}
+
+// WithLogLevel configures the minimum level of function logs delivered with the subscription.
+// Run fails at subscribe time if the level is not valid. The level is not sent by default.
+func WithLogLevel(level extapi.TelemetryLogLevel) Option {
+	return logLevelOption(level)
+}
+
+type logFormatOption extapi.TelemetryLogFormat
+
+func (o logFormatOption) apply(opts *options) {
+	opts.logFormat = extapi.TelemetryLogFormat(o)
+}
+
+// WithLogFormat configures the format of function logs delivered with the subscription.
+// Run fails at subscribe time if the format is not valid. The format is not sent by default.
+func WithLogFormat(format extapi.TelemetryLogFormat) Option {
+	return logFormatOption(format)
+}
+
+type partitionedProcessingOption struct {
+	keyFunc func(Event) string
+	workers int
+}
+
+func (o partitionedProcessingOption) apply(opts *options) {
+	opts.partitionKey = o.keyFunc
+	opts.partitionWorkers = o.workers
+}
+
+// WithPartitionedProcessing configures Run to call Processor.Process concurrently from workers goroutines.
+// Events are assigned to workers by hash of keyFunc result, so events with the same key are processed
+// by the same worker in order of arrival. Use RequestIDKey to parallelize processing across invocations.
+// Processor must be safe for concurrent use of Process. Init, Flusher.Flush and Shutdown are called
+// when all workers are idle, except Shutdown called after the shutdown deadline while workers are still busy.
+// PartitionFromContext returns the worker index from the ctx passed into Process.
+// Process errors fail Run on the next received event, flush or shutdown, the failed event is not retried
+// with WithProcessRetry as it is already queued. Events are processed sequentially by default.
+func WithPartitionedProcessing(keyFunc func(Event) string, workers int) Option {
+	return partitionedProcessingOption{keyFunc, workers}
+}
+
+type dedupOption int
+
+func (o dedupOption) apply(opts *options) {
+	opts.dedupWindow = int(o)
+}
+
+// WithDedup configures Run to drop platform events with the same request id and type as one of window
+// recently seen events before calling Processor.Process, e.g. when Lambda redelivers a batch.
+// Memory is bounded by window pairs, the least recently seen pair is forgotten first.
+// Events without request id, e.g. function and extension log lines, are never dropped. Dedup is disabled by default.
+func WithDedup(window int) Option {
+	return dedupOption(window)
+}
+
+type processTimingOption time.Duration
+
+func (o processTimingOption) apply(opts *options) {
+	opts.processTiming = true
+	opts.slowProcessThreshold = time.Duration(o)
+}
+
+// WithProcessTiming configures Run to measure Processor.Process durations by RecordType.
+// Aggregated timings are available in Stats.ProcessTimings returned by StatsFromContext.
+// Process calls slower than threshold are logged at V(1) level, zero threshold disables logging.
+// With WithPartitionedProcessing, the time spent in workers is measured.
+func WithProcessTiming(threshold time.Duration) Option {
+	return processTimingOption(threshold)
+}
+
 // Run runs the Processor.
 // Run blocks the current goroutine till extension lifecycle is finished or error occurs.
 func Run(ctx context.Context, proc Processor, opts ...Option) error {
-	options := options{
-		destinationAddr: "sandbox.localdomain:0",
-		log:             logr.FromContextOrDiscard(ctx),
-	}
-	for _, o := range opts {
-		o.apply(&options)
-	}
+	options := newOptions(ctx, opts)
+	hostErr := internal.WarnDestinationHost(options.log, options.destinationAddr, options.allowNonSandboxHost)
 
 	subscriber := func(ctx context.Context, client *extapi.Client, destinationURL string) error {
+		if err := options.validateSubscription(); err != nil {
+			return err
+		}
 		options.log.V(1).Info(
 			"calling Client.TelemetrySubscribe",
 			"url", destinationURL,
 			"subscriptionTypes", options.subscriptionTypes,
 			"bufferingCfg", options.bufferingCfg,
+			"schemaVersion", options.schemaVersion,
 		)
-		req := extapi.NewTelemetrySubscribeRequest(destinationURL, options.subscriptionTypes, options.bufferingCfg)
+		req := options.subscribeRequest(destinationURL)
+
+		return internal.WithDestinationHostHint(client.TelemetrySubscribe(ctx, req), hostErr)
+	}
+
+	if options.processTiming {
+		proc = withProcessTiming(proc, options.slowProcessThreshold, options.log)
+	}
+	if options.partitionKey != nil && options.partitionWorkers > 0 {
+		proc = withPartitionedProcessing(proc, options.partitionKey, options.partitionWorkers)
+	}
+	invokeHandler := options.invokeHandler
+	if options.invokeDeadline {
+		deadline := &invokeDeadline{}
+		proc = withInvokeDeadline(proc, deadline)
+		invokeHandler = deadline.wrapHandler(invokeHandler)
+	}
+	var filters []func(Event) bool
+	if options.dedupWindow > 0 {
+		filters = append(filters, newDedupFilter(options.dedupWindow))
+	}
+
+	ext := internal.NewExtension(ctx, internal.Config[Event]{
+		Processor:               proc,
+		DestinationAddr:         options.destinationAddr,
+		Listener:                options.destinationListener,
+		Log:                     options.log,
+		Decoder:                 options.decoder().decode,
+		Subscriber:              subscriber,
+		InvokeHandler:           invokeHandler,
+		StrictContentType:       options.strictContentType,
+		FlushInterval:           options.flushInterval,
+		ProcessRetry:            options.processRetry,
+		Filters:                 filters,
+		MaxConcurrentDeliveries: options.maxConcurrentDeliveries,
+		AsyncDecode:             options.asyncDecode,
+		DestinationURLCallback:  options.destinationURLCallback,
+		AcceptRetry:             options.acceptRetry,
+	})
+
+	return options.run(ctx, ext, invokeHandler != nil)
+}
 
-		return client.TelemetrySubscribe(ctx, req)
+func newOptions(ctx context.Context, opts []Option) options {
+	options := options{
+		destinationAddr:   "sandbox.localdomain:0",
+		strictContentType: true,
+		log:               logr.FromContextOrDiscard(ctx),
+		schemaVersion:     extapi.TelemetrySchemaVersion20220701,
+	}
+	for _, o := range opts {
+		o.apply(&options)
 	}
 
-	ext := internal.NewExtension[Event](
-		ctx,
-		proc,
-		options.destinationAddr,
-		options.log,
-		Decode,
-		subscriber,
-	)
-
-	// subscribe only to shutdown events
-	options.clientOptions = append(options.clientOptions, extapi.WithEventTypes([]extapi.EventType{extapi.Shutdown}))
+	return options
+}
+
+// validateSubscription returns an error if Telemetry API doesn't accept the subscription options.
+func (options options) validateSubscription() error {
+	if !isSupportedSchemaVersion(options.schemaVersion) {
+		return fmt.Errorf("unsupported telemetry schema version %s, supported versions are %v", options.schemaVersion, SupportedSchemaVersions)
+	}
+	if options.logLevel != "" && !options.logLevel.IsValid() {
+		return fmt.Errorf("unsupported telemetry log level %q", options.logLevel)
+	}
+	if options.logFormat != "" && !options.logFormat.IsValid() {
+		return fmt.Errorf("unsupported telemetry log format %q", options.logFormat)
+	}
+
+	return nil
+}
+
+func (options options) subscribeRequest(destinationURL string) *extapi.TelemetrySubscribeRequest {
+	req := extapi.NewTelemetrySubscribeRequest(destinationURL, options.subscriptionTypes, options.bufferingCfg, options.schemaVersion)
+	req.LogLevel = options.logLevel
+	req.LogFormat = options.logFormat
+
+	return req
+}
+
+func (options options) decoder() decoder {
+	return decoder{
+		dropRawRecord:         options.dropRawRecord,
+		ignoreUnknownTypes:    options.ignoreUnknownTypes,
+		skipMalformedRecords:  options.skipMalformedRecords,
+		disallowUnknownFields: options.disallowUnknownFields,
+		validateEnums:         options.validateEnums,
+		log:                   options.log,
+	}
+}
+
+// run registers the extension and blocks till its lifecycle is finished.
+func (options options) run(ctx context.Context, ext extapi.Extension, subscribeInvoke bool) error {
+	// subscribe only to shutdown events unless invoke handler or deadline is requested
+	eventTypes := []extapi.EventType{extapi.Shutdown}
+	if subscribeInvoke {
+		eventTypes = []extapi.EventType{extapi.Invoke, extapi.Shutdown}
+	}
+	clientOptions := append(options.clientOptions, extapi.WithEventTypes(eventTypes))
 	// pass current logger to Extension. It will be overridden with logger from WithClientOptionsOption if passed.
-	options.clientOptions = append([]extapi.Option{extapi.WithLogger(options.log)}, options.clientOptions...)
+	clientOptions = append([]extapi.Option{extapi.WithLogger(options.log)}, clientOptions...)
 	options.log.V(1).Info("starting extension")
 
-	return extapi.Run(ctx, ext, options.clientOptions...)
+	return extapi.Run(ctx, ext, clientOptions...)
+}
+
+func isSupportedSchemaVersion(version extapi.TelemetrySchemaVersion) bool {
+	for _, v := range SupportedSchemaVersions {
+		if v == version {
+			return true
+		}
+	}
+
+	return false
 }
@@ -2,16 +2,23 @@ package telemetryapi_test
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/require"
+	"github.com/tonglil/buflogr"
 	"github.com/zakharovvi/aws-lambda-extensions/extapi"
+	"github.com/zakharovvi/aws-lambda-extensions/logsapi"
 	"github.com/zakharovvi/aws-lambda-extensions/telemetryapi"
 )
 
@@ -45,6 +52,7 @@ type testProcessor struct {
 	processErrors  []error
 	shutdownErr    error
 	shutdownCalled bool
+	registerResp   *extapi.RegisterResponse
 }
 
 func (proc *testProcessor) Init(ctx context.Context, registerResp *extapi.RegisterResponse) error {
@@ -55,6 +63,7 @@ func (proc *testProcessor) Init(ctx context.Context, registerResp *extapi.Regist
 
 func (proc *testProcessor) Process(ctx context.Context, msg telemetryapi.Event) error {
 	proc.receivedEvents = append(proc.receivedEvents, msg)
+	proc.registerResp = extapi.RegisterResponseFromContext(ctx)
 
 	res := proc.processErrors[0]
 	proc.processErrors = proc.processErrors[1:]
@@ -71,13 +80,23 @@ func (proc *testProcessor) Shutdown(ctx context.Context, reason extapi.ShutdownR
 type lambdaAPIMock struct {
 	t                        *testing.T
 	wantDestinationURI       string
+	contentType              string
 	eventsRequests           [][]byte
+	eventsContentEncoding    string
 	wantEventsResponses      []int
 	telemetrySubscribeStatus int
+	invokeEvents             [][]byte
+	registerEventTypes       []extapi.EventType
 	registerCalled           bool
 	telemetrySubscribeCalled bool
+	telemetrySubscribeBody   []byte
+	wantLogsDestinationURI   string
+	logsRequests             [][]byte
+	logsSubscribeCalled      bool
 	initErrorCalled          bool
 	exitErrorCalled          bool
+	// shutdownEvent replaces respShutdown if set
+	shutdownEvent []byte
 }
 
 func (h *lambdaAPIMock) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -85,14 +104,34 @@ func (h *lambdaAPIMock) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	case "/2020-01-01/extension/register":
 		require.Falsef(h.t, h.registerCalled, "extension/register has already been called")
 		h.registerCalled = true
+		registerReq := extapi.RegisterRequest{}
+		require.NoError(h.t, json.NewDecoder(r.Body).Decode(&registerReq))
+		h.registerEventTypes = registerReq.EventTypes
 		w.Header().Set("Lambda-Extension-Identifier", testIdentifier)
 		if _, err := w.Write(respRegister); err != nil {
 			require.NoError(h.t, err, "extension/register")
 		}
 	case "/2020-01-01/extension/event/next":
+		if len(h.invokeEvents) > 0 {
+			resp := h.invokeEvents[0]
+			h.invokeEvents = h.invokeEvents[1:]
+			if _, err := w.Write(resp); err != nil {
+				require.NoError(h.t, err, "extension/event/next")
+			}
+
+			return
+		}
 		for _, events := range h.eventsRequests {
 			req, err := http.NewRequestWithContext(r.Context(), http.MethodPost, h.wantDestinationURI, bytes.NewReader(events))
 			require.NoError(h.t, err)
+			contentType := "application/json"
+			if h.contentType != "" {
+				contentType = h.contentType
+			}
+			req.Header.Set("Content-Type", contentType)
+			if h.eventsContentEncoding != "" {
+				req.Header.Set("Content-Encoding", h.eventsContentEncoding)
+			}
 
 			resp, err := http.DefaultClient.Do(req)
 			// request context can be cancelled for test cases with injected failures
@@ -107,7 +146,20 @@ func (h *lambdaAPIMock) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 			require.NoError(h.t, resp.Body.Close())
 		}
-		if _, err := w.Write(respShutdown); err != nil {
+		for _, logs := range h.logsRequests {
+			req, err := http.NewRequestWithContext(r.Context(), http.MethodPost, h.wantLogsDestinationURI, bytes.NewReader(logs))
+			require.NoError(h.t, err)
+			req.Header.Set("Content-Type", "application/json")
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(h.t, err)
+			require.Equal(h.t, http.StatusOK, resp.StatusCode)
+			require.NoError(h.t, resp.Body.Close())
+		}
+		shutdownEvent := respShutdown
+		if h.shutdownEvent != nil {
+			shutdownEvent = h.shutdownEvent
+		}
+		if _, err := w.Write(shutdownEvent); err != nil {
 			require.NoError(h.t, err, "extension/event/next")
 		}
 
@@ -127,8 +179,11 @@ func (h *lambdaAPIMock) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		require.Falsef(h.t, h.telemetrySubscribeCalled, "events has already been called")
 		h.telemetrySubscribeCalled = true
 
+		body, err := io.ReadAll(r.Body)
+		require.NoError(h.t, err)
+		h.telemetrySubscribeBody = body
 		subscription := extapi.TelemetrySubscribeRequest{}
-		require.NoError(h.t, json.NewDecoder(r.Body).Decode(&subscription))
+		require.NoError(h.t, json.Unmarshal(body, &subscription))
 
 		require.Equal(h.t, h.wantDestinationURI, subscription.Destination.URI)
 
@@ -137,6 +192,14 @@ func (h *lambdaAPIMock) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			status = h.telemetrySubscribeStatus
 		}
 		w.WriteHeader(status)
+	case "/2020-08-15/logs":
+		require.Falsef(h.t, h.logsSubscribeCalled, "logs has already been called")
+		h.logsSubscribeCalled = true
+
+		subscription := extapi.LogsSubscribeRequest{}
+		require.NoError(h.t, json.NewDecoder(r.Body).Decode(&subscription))
+
+		require.Equal(h.t, h.wantLogsDestinationURI, subscription.Destination.URI)
 	default:
 		require.Failf(h.t, "unknown url called: %s", r.URL.String())
 		http.NotFound(w, r)
@@ -209,24 +272,28 @@ func TestRun(t *testing.T) {
 					time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
 					json.RawMessage(`{"requestId":"1.1"}`),
 					telemetryapi.RecordPlatformStart{RequestID: "1.1"},
+					json.RawMessage(`"2022-01-01T00:00:00Z"`),
 				},
 				{
 					telemetryapi.TypePlatformStart,
 					time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
 					json.RawMessage(`{"requestId":"1.2"}`),
 					telemetryapi.RecordPlatformStart{RequestID: "1.2"},
+					json.RawMessage(`"2022-01-01T00:00:00Z"`),
 				},
 				{
 					telemetryapi.TypePlatformStart,
 					time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
 					json.RawMessage(`{"requestId":"2.1"}`),
 					telemetryapi.RecordPlatformStart{RequestID: "2.1"},
+					json.RawMessage(`"2022-01-01T00:00:00Z"`),
 				},
 				{
 					telemetryapi.TypePlatformStart,
 					time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
 					json.RawMessage(`{"requestId":"2.2"}`),
 					telemetryapi.RecordPlatformStart{RequestID: "2.2"},
+					json.RawMessage(`"2022-01-01T00:00:00Z"`),
 				},
 			},
 			nil,
@@ -252,6 +319,7 @@ func TestRun(t *testing.T) {
 					time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
 					json.RawMessage(`{"requestId":"1.1"}`),
 					telemetryapi.RecordPlatformStart{RequestID: "1.1"},
+					json.RawMessage(`"2022-01-01T00:00:00Z"`),
 				},
 			},
 			errors.New("extension loop failed: Extension.Err() signaled an error: decoding failed or interrupted: could not decode log message from json array: invalid character 'I' looking for beginning of value"),
@@ -277,12 +345,14 @@ func TestRun(t *testing.T) {
 					time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
 					json.RawMessage(`{"requestId":"1.1"}`),
 					telemetryapi.RecordPlatformStart{RequestID: "1.1"},
+					json.RawMessage(`"2022-01-01T00:00:00Z"`),
 				},
 				{
 					telemetryapi.TypePlatformStart,
 					time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
 					json.RawMessage(`{"requestId":"1.2"}`),
 					telemetryapi.RecordPlatformStart{RequestID: "1.2"},
+					json.RawMessage(`"2022-01-01T00:00:00Z"`),
 				},
 			},
 			errors.New("extension loop failed: Extension.Err() signaled an error: EventProcessor.Process failed: test_error"),
@@ -309,6 +379,7 @@ func TestRun(t *testing.T) {
 					time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
 					json.RawMessage(`{"requestId":"1.1"}`),
 					telemetryapi.RecordPlatformStart{RequestID: "1.1"},
+					json.RawMessage(`"2022-01-01T00:00:00Z"`),
 				},
 			},
 			errors.New("Extension.Shutdown failed: EventProcessor.Shutdown failed: shutdown_failed"),
@@ -355,3 +426,1132 @@ func TestRun(t *testing.T) {
 		})
 	}
 }
+
+func TestRun_WithDropRawRecord(t *testing.T) {
+	destinationAddr := "localhost:10000"
+	apiMock := &lambdaAPIMock{
+		t:                  t,
+		wantDestinationURI: "http://" + destinationAddr,
+		eventsRequests: [][]byte{
+			[]byte(`[{"type":"platform.start","time":"2022-01-01T00:00:00Z","record":{"requestId":"1.1"}}]`),
+		},
+		wantEventsResponses: []int{http.StatusOK},
+	}
+	proc := &testProcessor{
+		processErrors: []error{nil},
+	}
+	server := httptest.NewServer(apiMock)
+	defer server.Close()
+	t.Setenv("AWS_LAMBDA_RUNTIME_API", server.Listener.Addr().String())
+
+	err := telemetryapi.Run(
+		context.Background(),
+		proc,
+		telemetryapi.WithDestinationAddr(destinationAddr),
+		telemetryapi.WithDropRawRecord(true),
+	)
+	require.NoError(t, err)
+	require.Len(t, proc.receivedEvents, 1)
+	require.Nil(t, proc.receivedEvents[0].RawRecord)
+	require.Equal(t, telemetryapi.RecordPlatformStart{RequestID: "1.1"}, proc.receivedEvents[0].Record)
+}
+
+func TestRun_WithIgnoreUnknownTypes(t *testing.T) {
+	destinationAddr := "localhost:10000"
+	apiMock := &lambdaAPIMock{
+		t:                  t,
+		wantDestinationURI: "http://" + destinationAddr,
+		eventsRequests: [][]byte{
+			[]byte(`[{"type":"platform.unknown","time":"2022-01-01T00:00:00Z","record":{"requestId":"1.1"}},{"type":"platform.start","time":"2022-01-01T00:00:00Z","record":{"requestId":"1.2"}}]`),
+		},
+		wantEventsResponses: []int{http.StatusOK},
+	}
+	proc := &testProcessor{
+		processErrors: []error{nil, nil},
+	}
+	server := httptest.NewServer(apiMock)
+	defer server.Close()
+	t.Setenv("AWS_LAMBDA_RUNTIME_API", server.Listener.Addr().String())
+
+	err := telemetryapi.Run(
+		context.Background(),
+		proc,
+		telemetryapi.WithDestinationAddr(destinationAddr),
+		telemetryapi.WithIgnoreUnknownTypes(true),
+	)
+	require.NoError(t, err)
+	require.Equal(
+		t,
+		[]telemetryapi.Event{
+			{
+				Type:      "platform.unknown",
+				Time:      time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+				RawTime:   json.RawMessage(`"2022-01-01T00:00:00Z"`),
+				RawRecord: json.RawMessage(`{"requestId":"1.1"}`),
+			},
+			{
+				Type:      telemetryapi.TypePlatformStart,
+				Time:      time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+				RawTime:   json.RawMessage(`"2022-01-01T00:00:00Z"`),
+				RawRecord: json.RawMessage(`{"requestId":"1.2"}`),
+				Record:    telemetryapi.RecordPlatformStart{RequestID: "1.2"},
+			},
+		},
+		proc.receivedEvents,
+	)
+}
+
+func TestRun_GzipContentEncoding(t *testing.T) {
+	var body bytes.Buffer
+	zw := gzip.NewWriter(&body)
+	_, err := zw.Write([]byte(`[{"type":"platform.start","time":"2022-01-01T00:00:00Z","record":{"requestId":"1.1"}}]`))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+
+	destinationAddr := "localhost:10000"
+	apiMock := &lambdaAPIMock{
+		t:                     t,
+		wantDestinationURI:    "http://" + destinationAddr,
+		eventsRequests:        [][]byte{body.Bytes()},
+		eventsContentEncoding: "gzip",
+		wantEventsResponses:   []int{http.StatusOK},
+	}
+	proc := &testProcessor{
+		processErrors: []error{nil},
+	}
+	server := httptest.NewServer(apiMock)
+	defer server.Close()
+	t.Setenv("AWS_LAMBDA_RUNTIME_API", server.Listener.Addr().String())
+
+	err = telemetryapi.Run(context.Background(), proc, telemetryapi.WithDestinationAddr(destinationAddr))
+	require.NoError(t, err)
+	require.Equal(
+		t,
+		[]telemetryapi.Event{
+			{
+				Type:      telemetryapi.TypePlatformStart,
+				Time:      time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+				RawTime:   json.RawMessage(`"2022-01-01T00:00:00Z"`),
+				RawRecord: json.RawMessage(`{"requestId":"1.1"}`),
+				Record:    telemetryapi.RecordPlatformStart{RequestID: "1.1"},
+			},
+		},
+		proc.receivedEvents,
+	)
+}
+
+func TestRun_WithSkipMalformedRecords(t *testing.T) {
+	destinationAddr := "localhost:10000"
+	apiMock := &lambdaAPIMock{
+		t:                  t,
+		wantDestinationURI: "http://" + destinationAddr,
+		eventsRequests: [][]byte{
+			[]byte(`[{"type":"platform.start","time":"2022-01-01T00:00:00Z","record":{"requestId":"1.1"}}, INVALID_JSON, {"type":"platform.start","time":"2022-01-01T00:00:00Z","record":{"requestId":"1.2"}}]`),
+			[]byte(`[{"type":"platform.start","time":"2022-01-01T00:00:00Z","record":{"requestId":"2.1"}},{"type":"platform.start","time":"invalid","record":{"requestId":"[,]"}},{"type":"platform.start","time":"2022-01-01T00:00:00Z","record":{"requestId":"2.2"}}]`),
+			[]byte(`[{"type":"platform.start","time":"2022-01-01T00:00:00Z","record":{"requestId":"3.1"}},{"type":INVALID_JSON}]`),
+		},
+		wantEventsResponses: []int{http.StatusOK, http.StatusOK, http.StatusOK},
+	}
+	proc := &testProcessor{
+		processErrors: []error{nil, nil, nil, nil, nil},
+	}
+	server := httptest.NewServer(apiMock)
+	defer server.Close()
+	t.Setenv("AWS_LAMBDA_RUNTIME_API", server.Listener.Addr().String())
+
+	err := telemetryapi.Run(
+		context.Background(),
+		proc,
+		telemetryapi.WithDestinationAddr(destinationAddr),
+		telemetryapi.WithSkipMalformedRecords(true),
+	)
+	require.NoError(t, err)
+	var gotRequestIDs []string
+	for _, event := range proc.receivedEvents {
+		gotRequestIDs = append(gotRequestIDs, string(event.Record.(telemetryapi.RecordPlatformStart).RequestID))
+	}
+	require.Equal(t, []string{"1.1", "1.2", "2.1", "2.2", "3.1"}, gotRequestIDs)
+}
+
+func TestRun_RegisterResponseFromContext(t *testing.T) {
+	destinationAddr := "localhost:10000"
+	apiMock := &lambdaAPIMock{
+		t:                  t,
+		wantDestinationURI: "http://" + destinationAddr,
+		eventsRequests: [][]byte{
+			[]byte(`[{"type":"platform.start","time":"2022-01-01T00:00:00Z","record":{"requestId":"1.1"}}]`),
+		},
+		wantEventsResponses: []int{http.StatusOK},
+	}
+	proc := &testProcessor{
+		processErrors: []error{nil},
+	}
+	server := httptest.NewServer(apiMock)
+	defer server.Close()
+	t.Setenv("AWS_LAMBDA_RUNTIME_API", server.Listener.Addr().String())
+
+	err := telemetryapi.Run(context.Background(), proc, telemetryapi.WithDestinationAddr(destinationAddr))
+	require.NoError(t, err)
+	require.NotNil(t, proc.registerResp)
+	require.Equal(t, "helloWorld", proc.registerResp.FunctionName)
+}
+
+type clientProcessor struct {
+	testProcessor
+	functionName string
+}
+
+func (proc *clientProcessor) Init(ctx context.Context, registerResp *extapi.RegisterResponse) error {
+	client := extapi.ClientFromContext(ctx)
+	if client == nil {
+		return errors.New("no client in context")
+	}
+	proc.functionName = client.GetRegisterResponse().FunctionName
+
+	return nil
+}
+
+func TestRun_ClientFromContext(t *testing.T) {
+	destinationAddr := "localhost:10000"
+	apiMock := &lambdaAPIMock{
+		t:                  t,
+		wantDestinationURI: "http://" + destinationAddr,
+		eventsRequests: [][]byte{
+			[]byte(`[{"type":"platform.start","time":"2022-01-01T00:00:00Z","record":{"requestId":"1.1"}}]`),
+		},
+		wantEventsResponses: []int{http.StatusOK},
+	}
+	proc := &clientProcessor{
+		testProcessor: testProcessor{processErrors: []error{nil}},
+	}
+	server := httptest.NewServer(apiMock)
+	defer server.Close()
+	t.Setenv("AWS_LAMBDA_RUNTIME_API", server.Listener.Addr().String())
+
+	err := telemetryapi.Run(context.Background(), proc, telemetryapi.WithDestinationAddr(destinationAddr))
+	require.NoError(t, err)
+	require.Equal(t, "helloWorld", proc.functionName)
+}
+
+func TestRun_WithSchemaVersion_Unknown(t *testing.T) {
+	apiMock := &lambdaAPIMock{t: t}
+	proc := &testProcessor{}
+	server := httptest.NewServer(apiMock)
+	defer server.Close()
+	t.Setenv("AWS_LAMBDA_RUNTIME_API", server.Listener.Addr().String())
+
+	err := telemetryapi.Run(
+		context.Background(),
+		proc,
+		telemetryapi.WithDestinationAddr("localhost:10000"),
+		telemetryapi.WithSchemaVersion("2099-01-01"),
+	)
+	require.EqualError(t, err, "Extension.Init failed: unsupported telemetry schema version 2099-01-01, supported versions are [2022-07-01 2022-12-13]")
+	require.False(t, apiMock.telemetrySubscribeCalled)
+	require.True(t, apiMock.initErrorCalled)
+	require.True(t, proc.shutdownCalled)
+}
+
+func TestRun_WithInvokeHandler(t *testing.T) {
+	destinationAddr := "localhost:10000"
+	apiMock := &lambdaAPIMock{
+		t:                  t,
+		wantDestinationURI: "http://" + destinationAddr,
+		invokeEvents: [][]byte{
+			[]byte(`{"eventType":"INVOKE","deadlineMs":9223372036854775807,"requestId":"1.1","invokedFunctionArn":"arn:aws:lambda:us-east-1:123456789012:function:helloWorld"}`),
+		},
+		eventsRequests: [][]byte{
+			[]byte(`[{"type":"platform.start","time":"2022-01-01T00:00:00Z","record":{"requestId":"1.1"}}]`),
+		},
+		wantEventsResponses: []int{http.StatusOK},
+	}
+	proc := &testProcessor{
+		processErrors: []error{nil},
+	}
+	server := httptest.NewServer(apiMock)
+	defer server.Close()
+	t.Setenv("AWS_LAMBDA_RUNTIME_API", server.Listener.Addr().String())
+
+	var invokes []*extapi.NextEventResponse
+	handler := func(ctx context.Context, event *extapi.NextEventResponse) error {
+		invokes = append(invokes, event)
+
+		return nil
+	}
+	err := telemetryapi.Run(
+		context.Background(),
+		proc,
+		telemetryapi.WithDestinationAddr(destinationAddr),
+		telemetryapi.WithInvokeHandler(handler),
+	)
+	require.NoError(t, err)
+	require.Equal(t, []extapi.EventType{extapi.Invoke, extapi.Shutdown}, apiMock.registerEventTypes)
+	require.Len(t, invokes, 1)
+	require.Equal(t, extapi.Invoke, invokes[0].EventType)
+	require.Equal(t, "arn:aws:lambda:us-east-1:123456789012:function:helloWorld", invokes[0].InvokedFunctionArn)
+	require.Len(t, proc.receivedEvents, 1)
+	require.True(t, proc.shutdownCalled)
+}
+
+func TestRun_WithDisallowUnknownFields(t *testing.T) {
+	destinationAddr := "localhost:10000"
+	apiMock := &lambdaAPIMock{
+		t:                  t,
+		wantDestinationURI: "http://" + destinationAddr,
+		eventsRequests: [][]byte{
+			[]byte(`[{"type":"platform.report","time":"2022-01-01T00:00:00Z","record":{"requestId":"1.1","metrics":{"durationMs":1}}},{"type":"platform.report","time":"2022-01-01T00:00:00Z","record":{"requestId":"1.2","metrics":{"durationMs":1},"newField":"value"}}]`),
+		},
+		wantEventsResponses: []int{http.StatusInternalServerError},
+	}
+	proc := &testProcessor{
+		processErrors: []error{nil},
+	}
+	server := httptest.NewServer(apiMock)
+	defer server.Close()
+	t.Setenv("AWS_LAMBDA_RUNTIME_API", server.Listener.Addr().String())
+
+	err := telemetryapi.Run(
+		context.Background(),
+		proc,
+		telemetryapi.WithDestinationAddr(destinationAddr),
+		telemetryapi.WithDisallowUnknownFields(true),
+	)
+	require.ErrorContains(t, err, `platform.report with error: json: unknown field "newField"`)
+	require.Len(t, proc.receivedEvents, 1)
+	require.True(t, apiMock.exitErrorCalled)
+}
+
+func TestRun_WithValidateEnums(t *testing.T) {
+	destinationAddr := "localhost:10000"
+	apiMock := &lambdaAPIMock{
+		t:                  t,
+		wantDestinationURI: "http://" + destinationAddr,
+		eventsRequests: [][]byte{
+			[]byte(`[{"type":"platform.runtimeDone","time":"2022-01-01T00:00:00Z","record":{"requestId":"1.1","status":"success"}},{"type":"platform.runtimeDone","time":"2022-01-01T00:00:00Z","record":{"requestId":"1.2","status":"throttled"}}]`),
+		},
+		wantEventsResponses: []int{http.StatusInternalServerError},
+	}
+	proc := &testProcessor{
+		processErrors: []error{nil},
+	}
+	server := httptest.NewServer(apiMock)
+	defer server.Close()
+	t.Setenv("AWS_LAMBDA_RUNTIME_API", server.Listener.Addr().String())
+
+	err := telemetryapi.Run(
+		context.Background(),
+		proc,
+		telemetryapi.WithDestinationAddr(destinationAddr),
+		telemetryapi.WithValidateEnums(true),
+	)
+	require.ErrorContains(t, err, `platform.runtimeDone: unknown status "throttled", want one of "success", "failure", "error", "timeout"`)
+	require.Len(t, proc.receivedEvents, 1)
+	require.True(t, apiMock.exitErrorCalled)
+}
+
+func TestRun_WithDestinationURLCallback(t *testing.T) {
+	apiMock := &lambdaAPIMock{
+		t: t,
+		eventsRequests: [][]byte{
+			[]byte(`[{"type":"function","time":"2022-01-01T00:00:00Z","record":"hello"}]`),
+		},
+		wantEventsResponses: []int{http.StatusOK},
+	}
+	proc := &testProcessor{processErrors: []error{nil}}
+	server := httptest.NewServer(apiMock)
+	defer server.Close()
+	t.Setenv("AWS_LAMBDA_RUNTIME_API", server.Listener.Addr().String())
+
+	var destinationURL string
+	err := telemetryapi.Run(
+		context.Background(),
+		proc,
+		telemetryapi.WithDestinationAddr("localhost:0"),
+		telemetryapi.WithDestinationURLCallback(func(url string) {
+			destinationURL = url
+			// the mock sends events to the reported URL
+			apiMock.wantDestinationURI = url
+		}),
+	)
+	require.NoError(t, err)
+	require.Regexp(t, `^http://localhost:[1-9][0-9]*$`, destinationURL)
+	require.Len(t, proc.receivedEvents, 1)
+}
+
+func TestRun_WithStrictContentType(t *testing.T) {
+	tests := []struct {
+		name         string
+		strict       bool
+		wantResponse int
+		wantReceived int
+	}{
+		{"strict", true, http.StatusUnsupportedMediaType, 0},
+		{"not strict", false, http.StatusOK, 1},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			destinationAddr := "localhost:10000"
+			apiMock := &lambdaAPIMock{
+				t:                  t,
+				wantDestinationURI: "http://" + destinationAddr,
+				contentType:        "text/plain",
+				eventsRequests: [][]byte{
+					[]byte(`[{"type":"platform.start","time":"2022-01-01T00:00:00Z","record":{"requestId":"1.1"}}]`),
+				},
+				wantEventsResponses: []int{tt.wantResponse},
+			}
+			proc := &testProcessor{
+				processErrors: []error{nil},
+			}
+			server := httptest.NewServer(apiMock)
+			defer server.Close()
+			t.Setenv("AWS_LAMBDA_RUNTIME_API", server.Listener.Addr().String())
+
+			err := telemetryapi.Run(
+				context.Background(),
+				proc,
+				telemetryapi.WithDestinationAddr(destinationAddr),
+				telemetryapi.WithStrictContentType(tt.strict),
+			)
+			require.NoError(t, err)
+			require.Len(t, proc.receivedEvents, tt.wantReceived)
+			require.False(t, apiMock.exitErrorCalled)
+		})
+	}
+}
+
+type flushingProcessor struct {
+	testProcessor
+	flushCalls int
+}
+
+func (proc *flushingProcessor) Process(ctx context.Context, msg telemetryapi.Event) error {
+	// give the flush ticker a chance to fire between events
+	time.Sleep(15 * time.Millisecond)
+
+	return proc.testProcessor.Process(ctx, msg)
+}
+
+func (proc *flushingProcessor) Flush(ctx context.Context) error {
+	proc.flushCalls++
+
+	return nil
+}
+
+func TestRun_WithFlushInterval(t *testing.T) {
+	// the ticker competes with incoming events, so send enough events to make at least one flush certain
+	var events []string
+	for i := 0; i < 10; i++ {
+		events = append(events, fmt.Sprintf(`{"type":"platform.start","time":"2022-01-01T00:00:00Z","record":{"requestId":"1.%d"}}`, i))
+	}
+	destinationAddr := "localhost:10000"
+	apiMock := &lambdaAPIMock{
+		t:                  t,
+		wantDestinationURI: "http://" + destinationAddr,
+		eventsRequests: [][]byte{
+			[]byte("[" + strings.Join(events, ",") + "]"),
+		},
+		wantEventsResponses: []int{http.StatusOK},
+	}
+	proc := &flushingProcessor{
+		testProcessor: testProcessor{
+			processErrors: make([]error, len(events)),
+		},
+	}
+	server := httptest.NewServer(apiMock)
+	defer server.Close()
+	t.Setenv("AWS_LAMBDA_RUNTIME_API", server.Listener.Addr().String())
+
+	err := telemetryapi.Run(
+		context.Background(),
+		proc,
+		telemetryapi.WithDestinationAddr(destinationAddr),
+		telemetryapi.WithFlushInterval(10*time.Millisecond),
+	)
+	require.NoError(t, err)
+	require.Len(t, proc.receivedEvents, len(events))
+	require.Positive(t, proc.flushCalls)
+}
+
+// multiExtensionAPIMock serves several extensions registered from one process.
+// Extension ID equals the extension name.
+type multiExtensionAPIMock struct {
+	t            *testing.T
+	mu           sync.Mutex
+	destinations map[string]string
+	registered   []string
+}
+
+func (h *multiExtensionAPIMock) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	id := r.Header.Get("Lambda-Extension-Identifier")
+	switch r.URL.Path {
+	case "/2020-01-01/extension/register":
+		name := r.Header.Get("Lambda-Extension-Name")
+		h.mu.Lock()
+		h.registered = append(h.registered, name)
+		h.mu.Unlock()
+		w.Header().Set("Lambda-Extension-Identifier", name)
+		_, err := w.Write(respRegister)
+		require.NoError(h.t, err)
+	case "/2020-08-15/logs", "/2022-07-01/telemetry":
+		subscription := extapi.TelemetrySubscribeRequest{}
+		require.NoError(h.t, json.NewDecoder(r.Body).Decode(&subscription))
+		h.mu.Lock()
+		h.destinations[id] = subscription.Destination.URI
+		h.mu.Unlock()
+	case "/2020-01-01/extension/event/next":
+		h.mu.Lock()
+		destination := h.destinations[id]
+		h.mu.Unlock()
+		body := fmt.Sprintf(`[{"type":"platform.start","time":"2022-01-01T00:00:00Z","record":{"requestId":"%s"}}]`, id)
+		req, err := http.NewRequestWithContext(r.Context(), http.MethodPost, destination, strings.NewReader(body))
+		require.NoError(h.t, err)
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(h.t, err)
+		require.Equal(h.t, http.StatusOK, resp.StatusCode)
+		require.NoError(h.t, resp.Body.Close())
+
+		_, err = w.Write(respShutdown)
+		require.NoError(h.t, err)
+	default:
+		require.Failf(h.t, "unknown url called: %s", r.URL.String())
+		http.NotFound(w, r)
+	}
+}
+
+func TestRun_MultipleExtensions(t *testing.T) {
+	apiMock := &multiExtensionAPIMock{
+		t:            t,
+		destinations: map[string]string{},
+	}
+	server := httptest.NewServer(apiMock)
+	defer server.Close()
+	t.Setenv("AWS_LAMBDA_RUNTIME_API", server.Listener.Addr().String())
+
+	logsProc := &logsProcessor{}
+	telemetryProc := &testProcessor{
+		processErrors: []error{nil},
+	}
+	errCh := make(chan error, 2)
+	go func() {
+		errCh <- logsapi.Run(
+			context.Background(),
+			logsProc,
+			logsapi.WithDestinationAddr("localhost:0"),
+			logsapi.WithClientOptionsOption([]extapi.Option{extapi.WithExtensionName("logs-extension")}),
+		)
+	}()
+	go func() {
+		errCh <- telemetryapi.Run(
+			context.Background(),
+			telemetryProc,
+			telemetryapi.WithDestinationAddr("localhost:0"),
+			telemetryapi.WithClientOptionsOption([]extapi.Option{extapi.WithExtensionName("telemetry-extension")}),
+		)
+	}()
+	require.NoError(t, <-errCh)
+	require.NoError(t, <-errCh)
+
+	require.ElementsMatch(t, []string{"logs-extension", "telemetry-extension"}, apiMock.registered)
+	require.Len(t, logsProc.logs, 1)
+	require.Equal(t, logsapi.RecordPlatformStart{RequestID: "logs-extension"}, logsProc.logs[0].Record)
+	require.Len(t, telemetryProc.receivedEvents, 1)
+	require.Equal(t, telemetryapi.RecordPlatformStart{RequestID: "telemetry-extension"}, telemetryProc.receivedEvents[0].Record)
+}
+
+func TestRun_WithAllowNonSandboxHost(t *testing.T) {
+	tests := []struct {
+		name        string
+		opts        []telemetryapi.Option
+		wantWarning bool
+	}{
+		{"warning", nil, true},
+		{"suppressed", []telemetryapi.Option{telemetryapi.WithAllowNonSandboxHost(true)}, false},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(&lambdaAPIMock{t: t})
+			defer server.Close()
+			t.Setenv("AWS_LAMBDA_RUNTIME_API", server.Listener.Addr().String())
+
+			var buf bytes.Buffer
+			opts := append([]telemetryapi.Option{
+				telemetryapi.WithDestinationAddr("localhost:0"),
+				telemetryapi.WithLogger(buflogr.NewWithBuffer(&buf)),
+			}, tt.opts...)
+			proc := &testProcessor{initErr: errors.New("stop before subscribe")}
+
+			require.Error(t, telemetryapi.Run(context.Background(), proc, opts...))
+			require.Equal(t, tt.wantWarning, strings.Contains(buf.String(), `destination host "localhost" is not sandbox.localdomain`), buf.String())
+		})
+	}
+}
+
+type deadlineProcessor struct {
+	testProcessor
+	deadlines []time.Time
+}
+
+func (proc *deadlineProcessor) Process(ctx context.Context, msg telemetryapi.Event) error {
+	deadline, ok := telemetryapi.InvokeDeadlineFromContext(ctx)
+	if ok {
+		proc.deadlines = append(proc.deadlines, deadline)
+	}
+
+	return proc.testProcessor.Process(ctx, msg)
+}
+
+func TestRun_WithInvokeDeadline(t *testing.T) {
+	destinationAddr := "localhost:10000"
+	apiMock := &lambdaAPIMock{
+		t:                  t,
+		wantDestinationURI: "http://" + destinationAddr,
+		invokeEvents: [][]byte{
+			[]byte(`{"eventType":"INVOKE","deadlineMs":1893456000000,"requestId":"1.1"}`),
+		},
+		eventsRequests: [][]byte{
+			[]byte(`[{"type":"platform.start","time":"2022-01-01T00:00:00Z","record":{"requestId":"1.1"}}]`),
+		},
+		wantEventsResponses: []int{http.StatusOK},
+	}
+	proc := &deadlineProcessor{testProcessor: testProcessor{processErrors: []error{nil}}}
+	server := httptest.NewServer(apiMock)
+	defer server.Close()
+	t.Setenv("AWS_LAMBDA_RUNTIME_API", server.Listener.Addr().String())
+
+	err := telemetryapi.Run(
+		context.Background(),
+		proc,
+		telemetryapi.WithDestinationAddr(destinationAddr),
+		telemetryapi.WithInvokeDeadline(true),
+	)
+	require.NoError(t, err)
+	require.Equal(t, []extapi.EventType{extapi.Invoke, extapi.Shutdown}, apiMock.registerEventTypes)
+	require.Len(t, proc.receivedEvents, 1)
+	require.Equal(t, []time.Time{time.UnixMilli(1893456000000)}, proc.deadlines)
+}
+
+type bothProcessor struct {
+	testProcessor
+	receivedLogs []logsapi.Log
+}
+
+func (proc *bothProcessor) ProcessLog(ctx context.Context, log logsapi.Log) error {
+	proc.receivedLogs = append(proc.receivedLogs, log)
+
+	return nil
+}
+
+func TestRunBoth(t *testing.T) {
+	destinationAddr := "localhost:10000"
+	apiMock := &lambdaAPIMock{
+		t:                      t,
+		wantDestinationURI:     "http://" + destinationAddr + telemetryapi.BothTelemetryPath,
+		wantLogsDestinationURI: "http://" + destinationAddr + telemetryapi.BothLogsPath,
+		eventsRequests: [][]byte{
+			[]byte(`[{"type":"function","time":"2022-01-01T00:00:00Z","record":"hello"}]`),
+		},
+		wantEventsResponses: []int{http.StatusOK},
+		logsRequests: [][]byte{
+			[]byte(`[{"type":"function","time":"2022-01-01T00:00:00Z","record":"hello"},{"type":"platform.end","time":"2022-01-01T00:00:00Z","record":{"requestId":"1.1"}}]`),
+		},
+	}
+	proc := &bothProcessor{testProcessor: testProcessor{processErrors: []error{nil}}}
+	server := httptest.NewServer(apiMock)
+	defer server.Close()
+	t.Setenv("AWS_LAMBDA_RUNTIME_API", server.Listener.Addr().String())
+
+	err := telemetryapi.RunBoth(context.Background(), proc, telemetryapi.WithDestinationAddr(destinationAddr))
+	require.NoError(t, err)
+	require.True(t, apiMock.telemetrySubscribeCalled)
+	require.True(t, apiMock.logsSubscribeCalled)
+	require.Len(t, proc.receivedEvents, 1)
+	require.Equal(t, telemetryapi.RecordFunction("hello"), proc.receivedEvents[0].Record)
+	require.Len(t, proc.receivedLogs, 2)
+	require.Equal(t, logsapi.RecordFunction("hello"), proc.receivedLogs[0].Record)
+	require.Equal(t, logsapi.RecordPlatformEnd{RequestID: "1.1"}, proc.receivedLogs[1].Record)
+	require.True(t, proc.shutdownCalled)
+}
+
+func TestRun_WithProcessRetry(t *testing.T) {
+	destinationAddr := "localhost:10000"
+	apiMock := &lambdaAPIMock{
+		t:                  t,
+		wantDestinationURI: "http://" + destinationAddr,
+		eventsRequests: [][]byte{
+			[]byte(`[{"type":"platform.start","time":"2022-01-01T00:00:00Z","record":{"requestId":"1.1"}}]`),
+		},
+		wantEventsResponses: []int{http.StatusOK},
+	}
+	proc := &testProcessor{
+		processErrors: []error{errors.New("first attempt failed"), errors.New("second attempt failed"), nil},
+	}
+	server := httptest.NewServer(apiMock)
+	defer server.Close()
+	t.Setenv("AWS_LAMBDA_RUNTIME_API", server.Listener.Addr().String())
+
+	err := telemetryapi.Run(
+		context.Background(),
+		proc,
+		telemetryapi.WithDestinationAddr(destinationAddr),
+		telemetryapi.WithProcessRetry(2, time.Millisecond),
+	)
+	require.NoError(t, err)
+	require.Len(t, proc.receivedEvents, 3)
+	require.Empty(t, proc.processErrors)
+	require.False(t, apiMock.exitErrorCalled)
+}
+
+func TestRun_WithLogLevelAndFormat(t *testing.T) {
+	tests := []struct {
+		name         string
+		opts         []telemetryapi.Option
+		wantContains []string
+		wantMissing  []string
+	}{
+		{
+			"omitted by default",
+			nil,
+			nil,
+			[]string{"logLevel", "logFormat"},
+		},
+		{
+			"configured",
+			[]telemetryapi.Option{
+				telemetryapi.WithLogLevel(extapi.TelemetryLogLevelWarn),
+				telemetryapi.WithLogFormat(extapi.TelemetryLogFormatJSON),
+			},
+			[]string{`"logLevel":"WARN"`, `"logFormat":"JSON"`},
+			nil,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			destinationAddr := "localhost:10000"
+			apiMock := &lambdaAPIMock{
+				t:                  t,
+				wantDestinationURI: "http://" + destinationAddr,
+			}
+			server := httptest.NewServer(apiMock)
+			defer server.Close()
+			t.Setenv("AWS_LAMBDA_RUNTIME_API", server.Listener.Addr().String())
+
+			opts := append([]telemetryapi.Option{telemetryapi.WithDestinationAddr(destinationAddr)}, tt.opts...)
+			require.NoError(t, telemetryapi.Run(context.Background(), &testProcessor{}, opts...))
+			for _, want := range tt.wantContains {
+				require.Contains(t, string(apiMock.telemetrySubscribeBody), want)
+			}
+			for _, missing := range tt.wantMissing {
+				require.NotContains(t, string(apiMock.telemetrySubscribeBody), missing)
+			}
+		})
+	}
+}
+
+func TestRun_WithLogLevel_Invalid(t *testing.T) {
+	apiMock := &lambdaAPIMock{t: t}
+	server := httptest.NewServer(apiMock)
+	defer server.Close()
+	t.Setenv("AWS_LAMBDA_RUNTIME_API", server.Listener.Addr().String())
+
+	err := telemetryapi.Run(
+		context.Background(),
+		&testProcessor{},
+		telemetryapi.WithDestinationAddr("localhost:10000"),
+		telemetryapi.WithLogLevel("VERBOSE"),
+	)
+	require.EqualError(t, err, `Extension.Init failed: unsupported telemetry log level "VERBOSE"`)
+	require.False(t, apiMock.telemetrySubscribeCalled)
+}
+
+type partitionedEvent struct {
+	partition int
+	requestID string
+	version   string
+}
+
+type partitionProcessor struct {
+	mu     sync.Mutex
+	events []partitionedEvent
+}
+
+func (proc *partitionProcessor) Init(ctx context.Context, registerResp *extapi.RegisterResponse) error {
+	return nil
+}
+
+func (proc *partitionProcessor) Process(ctx context.Context, event telemetryapi.Event) error {
+	partition, ok := telemetryapi.PartitionFromContext(ctx)
+	if !ok {
+		return errors.New("partition is not found in context")
+	}
+	proc.mu.Lock()
+	defer proc.mu.Unlock()
+	record := event.Record.(telemetryapi.RecordPlatformStart)
+	proc.events = append(proc.events, partitionedEvent{partition, string(record.RequestID), string(record.Version)})
+
+	return nil
+}
+
+func (proc *partitionProcessor) Shutdown(ctx context.Context, reason extapi.ShutdownReason, err error) error {
+	return err
+}
+
+func TestRun_WithPartitionedProcessing(t *testing.T) {
+	destinationAddr := "localhost:10000"
+	apiMock := &lambdaAPIMock{
+		t:                  t,
+		wantDestinationURI: "http://" + destinationAddr,
+		eventsRequests: [][]byte{
+			[]byte(`[
+				{"type":"platform.start","time":"2022-01-01T00:00:00Z","record":{"requestId":"1","version":"1"}},
+				{"type":"platform.start","time":"2022-01-01T00:00:00Z","record":{"requestId":"2","version":"1"}},
+				{"type":"platform.start","time":"2022-01-01T00:00:00Z","record":{"requestId":"1","version":"2"}}
+			]`),
+			[]byte(`[
+				{"type":"platform.start","time":"2022-01-01T00:00:00Z","record":{"requestId":"2","version":"2"}},
+				{"type":"platform.start","time":"2022-01-01T00:00:00Z","record":{"requestId":"1","version":"3"}}
+			]`),
+		},
+		wantEventsResponses: []int{http.StatusOK, http.StatusOK},
+	}
+	proc := &partitionProcessor{}
+	server := httptest.NewServer(apiMock)
+	defer server.Close()
+	t.Setenv("AWS_LAMBDA_RUNTIME_API", server.Listener.Addr().String())
+
+	err := telemetryapi.Run(
+		context.Background(),
+		proc,
+		telemetryapi.WithDestinationAddr(destinationAddr),
+		telemetryapi.WithPartitionedProcessing(telemetryapi.RequestIDKey, 4),
+	)
+	require.NoError(t, err)
+	require.Len(t, proc.events, 5)
+
+	partitions := make(map[string]map[int]bool)
+	var requestOneVersions []string
+	for _, event := range proc.events {
+		if partitions[event.requestID] == nil {
+			partitions[event.requestID] = make(map[int]bool)
+		}
+		partitions[event.requestID][event.partition] = true
+		if event.requestID == "1" {
+			requestOneVersions = append(requestOneVersions, event.version)
+		}
+	}
+	require.Len(t, partitions["1"], 1, "events for one request id must be processed by one worker")
+	require.Len(t, partitions["2"], 1, "events for one request id must be processed by one worker")
+	require.Equal(t, []string{"1", "2", "3"}, requestOneVersions)
+}
+
+func TestRun_WithPartitionedProcessing_LastProcessError(t *testing.T) {
+	destinationAddr := "localhost:10000"
+	apiMock := &lambdaAPIMock{
+		t:                  t,
+		wantDestinationURI: "http://" + destinationAddr,
+		eventsRequests: [][]byte{
+			[]byte(`[{"type":"platform.start","time":"2022-01-01T00:00:00Z","record":{"requestId":"1"}}]`),
+		},
+		wantEventsResponses: []int{http.StatusOK},
+	}
+	// Processor.Shutdown ignores err, the worker error must be returned anyway
+	proc := &testProcessor{
+		processErrors: []error{errors.New("test_error")},
+	}
+	server := httptest.NewServer(apiMock)
+	defer server.Close()
+	t.Setenv("AWS_LAMBDA_RUNTIME_API", server.Listener.Addr().String())
+
+	err := telemetryapi.Run(
+		context.Background(),
+		proc,
+		telemetryapi.WithDestinationAddr(destinationAddr),
+		telemetryapi.WithPartitionedProcessing(telemetryapi.RequestIDKey, 2),
+	)
+	require.EqualError(
+		t,
+		err,
+		"Extension.Shutdown failed: EventProcessor.Shutdown failed: partitioned Processor.Process failed: test_error",
+	)
+	require.True(t, proc.shutdownCalled)
+}
+
+type hungPartitionProcessor struct {
+	release        chan struct{}
+	shutdownCalled chan struct{}
+}
+
+func (proc *hungPartitionProcessor) Init(ctx context.Context, registerResp *extapi.RegisterResponse) error {
+	return nil
+}
+
+func (proc *hungPartitionProcessor) Process(ctx context.Context, event telemetryapi.Event) error {
+	<-proc.release
+
+	return nil
+}
+
+func (proc *hungPartitionProcessor) Shutdown(ctx context.Context, reason extapi.ShutdownReason, err error) error {
+	close(proc.shutdownCalled)
+
+	return nil
+}
+
+func TestRun_WithPartitionedProcessing_HungWorker(t *testing.T) {
+	destinationAddr := "localhost:10000"
+	// more events than the worker queue holds, so Process blocks while the worker is hung
+	events := make([]string, 150)
+	for i := range events {
+		events[i] = `{"type":"platform.start","time":"2022-01-01T00:00:00Z","record":{"requestId":"1"}}`
+	}
+	apiMock := &lambdaAPIMock{
+		t:                   t,
+		wantDestinationURI:  "http://" + destinationAddr,
+		eventsRequests:      [][]byte{[]byte("[" + strings.Join(events, ",") + "]")},
+		wantEventsResponses: []int{http.StatusOK},
+		shutdownEvent: []byte(fmt.Sprintf(
+			`{"eventType":"SHUTDOWN","shutdownReason":"spindown","deadlineMs":%d}`,
+			time.Now().Add(300*time.Millisecond).UnixMilli(),
+		)),
+	}
+	proc := &hungPartitionProcessor{release: make(chan struct{}), shutdownCalled: make(chan struct{})}
+	defer close(proc.release)
+	server := httptest.NewServer(apiMock)
+	defer server.Close()
+	t.Setenv("AWS_LAMBDA_RUNTIME_API", server.Listener.Addr().String())
+
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- telemetryapi.Run(
+			context.Background(),
+			proc,
+			telemetryapi.WithDestinationAddr(destinationAddr),
+			telemetryapi.WithAsyncDecode(true),
+			telemetryapi.WithPartitionedProcessing(telemetryapi.RequestIDKey, 1),
+		)
+	}()
+
+	select {
+	case <-runErr:
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "Run must not wait for the hung worker past the shutdown deadline")
+	}
+	select {
+	case <-proc.shutdownCalled:
+	default:
+		require.Fail(t, "Processor.Shutdown must be called")
+	}
+}
+
+type partitionDeadlineProcessor struct {
+	mu           sync.Mutex
+	processed    int
+	withDeadline int
+	ctxErrors    []error
+}
+
+func (proc *partitionDeadlineProcessor) Init(ctx context.Context, registerResp *extapi.RegisterResponse) error {
+	return nil
+}
+
+func (proc *partitionDeadlineProcessor) Process(ctx context.Context, event telemetryapi.Event) error {
+	proc.mu.Lock()
+	defer proc.mu.Unlock()
+	if proc.processed == 0 {
+		// fill the worker queue till the shutdown starts
+		time.Sleep(100 * time.Millisecond)
+	}
+	proc.processed++
+	if _, ok := ctx.Deadline(); ok {
+		proc.withDeadline++
+	}
+	if err := ctx.Err(); err != nil {
+		proc.ctxErrors = append(proc.ctxErrors, err)
+	}
+
+	return nil
+}
+
+func (proc *partitionDeadlineProcessor) Shutdown(ctx context.Context, reason extapi.ShutdownReason, err error) error {
+	return err
+}
+
+func TestRun_WithPartitionedProcessing_ShutdownDeadline(t *testing.T) {
+	destinationAddr := "localhost:10000"
+	events := make([]string, 150)
+	for i := range events {
+		events[i] = `{"type":"platform.start","time":"2022-01-01T00:00:00Z","record":{"requestId":"1"}}`
+	}
+	apiMock := &lambdaAPIMock{
+		t:                   t,
+		wantDestinationURI:  "http://" + destinationAddr,
+		eventsRequests:      [][]byte{[]byte("[" + strings.Join(events, ",") + "]")},
+		wantEventsResponses: []int{http.StatusOK},
+		shutdownEvent: []byte(fmt.Sprintf(
+			`{"eventType":"SHUTDOWN","shutdownReason":"spindown","deadlineMs":%d}`,
+			time.Now().Add(time.Minute).UnixMilli(),
+		)),
+	}
+	proc := &partitionDeadlineProcessor{}
+	server := httptest.NewServer(apiMock)
+	defer server.Close()
+	t.Setenv("AWS_LAMBDA_RUNTIME_API", server.Listener.Addr().String())
+
+	err := telemetryapi.Run(
+		context.Background(),
+		proc,
+		telemetryapi.WithDestinationAddr(destinationAddr),
+		telemetryapi.WithAsyncDecode(true),
+		telemetryapi.WithPartitionedProcessing(telemetryapi.RequestIDKey, 1),
+	)
+	require.NoError(t, err)
+	require.Equal(t, 150, proc.processed)
+	require.Positive(t, proc.withDeadline, "events queued after the shutdown start must have the shutdown deadline")
+	require.Empty(t, proc.ctxErrors, "worker ctx must not be cancelled once Process returns")
+}
+
+func TestRun_WithDedup(t *testing.T) {
+	destinationAddr := "localhost:10000"
+	batch := []byte(`[
+		{"type":"platform.start","time":"2022-01-01T00:00:00Z","record":{"requestId":"1"}},
+		{"type":"function","time":"2022-01-01T00:00:00Z","record":"line 1"},
+		{"type":"platform.runtimeDone","time":"2022-01-01T00:00:00Z","record":{"requestId":"1","status":"success"}}
+	]`)
+	apiMock := &lambdaAPIMock{
+		t:                   t,
+		wantDestinationURI:  "http://" + destinationAddr,
+		eventsRequests:      [][]byte{batch, batch},
+		wantEventsResponses: []int{http.StatusOK, http.StatusOK},
+	}
+	proc := &testProcessor{
+		processErrors: []error{nil, nil, nil, nil},
+	}
+	server := httptest.NewServer(apiMock)
+	defer server.Close()
+	t.Setenv("AWS_LAMBDA_RUNTIME_API", server.Listener.Addr().String())
+
+	err := telemetryapi.Run(
+		context.Background(),
+		proc,
+		telemetryapi.WithDestinationAddr(destinationAddr),
+		telemetryapi.WithDedup(10),
+	)
+	require.NoError(t, err)
+	var got []telemetryapi.Type
+	for _, event := range proc.receivedEvents {
+		got = append(got, event.Type)
+	}
+	require.Equal(
+		t,
+		[]telemetryapi.Type{
+			telemetryapi.TypePlatformStart,
+			telemetryapi.TypeFunction,
+			telemetryapi.TypePlatformRuntimeDone,
+			telemetryapi.TypeFunction,
+		},
+		got,
+	)
+}
+
+func TestRun_WithDedup_ProcessRetry(t *testing.T) {
+	destinationAddr := "localhost:10000"
+	batch := []byte(`[
+		{"type":"platform.start","time":"2022-01-01T00:00:00Z","record":{"requestId":"1"}}
+	]`)
+	apiMock := &lambdaAPIMock{
+		t:                   t,
+		wantDestinationURI:  "http://" + destinationAddr,
+		eventsRequests:      [][]byte{batch, batch},
+		wantEventsResponses: []int{http.StatusOK, http.StatusOK},
+	}
+	proc := &testProcessor{
+		processErrors: []error{errors.New("test_error"), nil},
+	}
+	server := httptest.NewServer(apiMock)
+	defer server.Close()
+	t.Setenv("AWS_LAMBDA_RUNTIME_API", server.Listener.Addr().String())
+
+	err := telemetryapi.Run(
+		context.Background(),
+		proc,
+		telemetryapi.WithDestinationAddr(destinationAddr),
+		telemetryapi.WithDedup(10),
+		telemetryapi.WithProcessRetry(1, time.Millisecond),
+	)
+	require.NoError(t, err)
+	// the failed event is retried once and the redelivered batch is dropped
+	require.Len(t, proc.receivedEvents, 2)
+	require.Equal(t, proc.receivedEvents[0], proc.receivedEvents[1])
+	require.Empty(t, proc.processErrors)
+}
+
+type slowProcessor struct {
+	testProcessor
+	delay map[telemetryapi.Type]time.Duration
+	stats telemetryapi.Stats
+}
+
+func (proc *slowProcessor) Process(ctx context.Context, msg telemetryapi.Event) error {
+	time.Sleep(proc.delay[msg.Type])
+
+	return proc.testProcessor.Process(ctx, msg)
+}
+
+func (proc *slowProcessor) Shutdown(ctx context.Context, reason extapi.ShutdownReason, err error) error {
+	proc.stats, _ = telemetryapi.StatsFromContext(ctx)
+
+	return proc.testProcessor.Shutdown(ctx, reason, err)
+}
+
+func TestRun_WithProcessTiming(t *testing.T) {
+	destinationAddr := "localhost:10000"
+	apiMock := &lambdaAPIMock{
+		t:                  t,
+		wantDestinationURI: "http://" + destinationAddr,
+		eventsRequests: [][]byte{
+			[]byte(`[
+				{"type":"platform.start","time":"2022-01-01T00:00:00Z","record":{"requestId":"1"}},
+				{"type":"function","time":"2022-01-01T00:00:00Z","record":"line 1"},
+				{"type":"function","time":"2022-01-01T00:00:00Z","record":"line 2"}
+			]`),
+		},
+		wantEventsResponses: []int{http.StatusOK},
+	}
+	proc := &slowProcessor{
+		testProcessor: testProcessor{processErrors: []error{nil, nil, nil}},
+		delay:         map[telemetryapi.Type]time.Duration{telemetryapi.TypePlatformStart: 50 * time.Millisecond},
+	}
+	server := httptest.NewServer(apiMock)
+	defer server.Close()
+	t.Setenv("AWS_LAMBDA_RUNTIME_API", server.Listener.Addr().String())
+
+	var buf bytes.Buffer
+	err := telemetryapi.Run(
+		context.Background(),
+		proc,
+		telemetryapi.WithDestinationAddr(destinationAddr),
+		telemetryapi.WithLogger(buflogr.NewWithBuffer(&buf)),
+		telemetryapi.WithProcessTiming(20*time.Millisecond),
+	)
+	require.NoError(t, err)
+
+	var slowLogs []string
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if strings.Contains(line, "slow Processor.Process call") {
+			slowLogs = append(slowLogs, line)
+		}
+	}
+	require.Len(t, slowLogs, 1, buf.String())
+	require.Contains(t, slowLogs[0], "recordType RecordPlatformStart")
+
+	timings := proc.stats.ProcessTimings
+	require.Len(t, timings, 2)
+	require.Equal(t, uint64(1), timings["RecordPlatformStart"].Count)
+	require.GreaterOrEqual(t, timings["RecordPlatformStart"].Max, 50*time.Millisecond)
+	require.Equal(t, uint64(2), timings["RecordFunction"].Count)
+	require.GreaterOrEqual(t, timings["RecordFunction"].Total, timings["RecordFunction"].Max)
+}
@@ -0,0 +1,49 @@
+package telemetryapi
+
+import (
+	"context"
+	"sync"
+
+	"github.com/zakharovvi/aws-lambda-extensions/extapi"
+	"github.com/zakharovvi/aws-lambda-extensions/internal"
+)
+
+// Synchronized wraps Processor to serialize all its method calls with a mutex.
+// It allows to call non-thread-safe Processor concurrently.
+// The returned Processor implements Flusher if proc implements it.
+func Synchronized(proc Processor) Processor {
+	sp := &synchronizedProcessor{proc: proc}
+
+	return internal.WithFlush[Event](sp, proc, func(ctx context.Context, flusher internal.Flusher) error {
+		sp.mu.Lock()
+		defer sp.mu.Unlock()
+
+		return flusher.Flush(ctx)
+	})
+}
+
+type synchronizedProcessor struct {
+	mu   sync.Mutex
+	proc Processor
+}
+
+func (p *synchronizedProcessor) Init(ctx context.Context, registerResp *extapi.RegisterResponse) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.proc.Init(ctx, registerResp)
+}
+
+func (p *synchronizedProcessor) Process(ctx context.Context, event Event) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.proc.Process(ctx, event)
+}
+
+func (p *synchronizedProcessor) Shutdown(ctx context.Context, reason extapi.ShutdownReason, err error) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.proc.Shutdown(ctx, reason, err)
+}
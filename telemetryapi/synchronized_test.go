@@ -0,0 +1,70 @@
+package telemetryapi_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zakharovvi/aws-lambda-extensions/extapi"
+	"github.com/zakharovvi/aws-lambda-extensions/telemetryapi"
+)
+
+// countingProcessor is not safe for concurrent use.
+type countingProcessor struct {
+	processed int
+	flushed   int
+}
+
+func (p *countingProcessor) Init(ctx context.Context, registerResp *extapi.RegisterResponse) error {
+	return nil
+}
+
+func (p *countingProcessor) Process(ctx context.Context, event telemetryapi.Event) error {
+	p.processed++
+
+	return nil
+}
+
+func (p *countingProcessor) Flush(ctx context.Context) error {
+	p.flushed++
+
+	return nil
+}
+
+func (p *countingProcessor) Shutdown(ctx context.Context, reason extapi.ShutdownReason, err error) error {
+	return nil
+}
+
+func TestSynchronized(t *testing.T) {
+	const goroutines, events = 8, 100
+
+	counting := &countingProcessor{}
+	proc := telemetryapi.Synchronized(counting)
+	flusher, ok := proc.(telemetryapi.Flusher)
+	require.True(t, ok, "Synchronized must keep Flusher implementation")
+
+	require.NoError(t, proc.Init(context.Background(), nil))
+	wg := sync.WaitGroup{}
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < events; j++ {
+				_ = proc.Process(context.Background(), telemetryapi.Event{Type: telemetryapi.TypeFunction})
+				_ = flusher.Flush(context.Background())
+			}
+		}()
+	}
+	wg.Wait()
+	require.NoError(t, proc.Shutdown(context.Background(), extapi.Spindown, nil))
+
+	require.Equal(t, goroutines*events, counting.processed)
+	require.Equal(t, goroutines*events, counting.flushed)
+}
+
+func TestSynchronized_NotFlusher(t *testing.T) {
+	proc := telemetryapi.Synchronized(telemetryapi.FromLogsProcessor(&logsProcessor{}))
+	_, ok := proc.(telemetryapi.Flusher)
+	require.False(t, ok)
+}
@@ -0,0 +1,4 @@
+// Package telemetrytest provides utilities for testing telemetryapi.Run wiring and code consuming telemetryapi.Processor.
+//
+// InMemoryProcessor records all received events and allows injecting Init, Process and Shutdown errors.
+package telemetrytest
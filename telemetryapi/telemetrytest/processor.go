@@ -0,0 +1,93 @@
+package telemetrytest
+
+import (
+	"context"
+	"sync"
+
+	"github.com/zakharovvi/aws-lambda-extensions/extapi"
+	"github.com/zakharovvi/aws-lambda-extensions/telemetryapi"
+)
+
+// InMemoryProcessor implements telemetryapi.Processor which records received events in memory.
+// Exported error fields are returned from the corresponding methods and must be set before passing the processor to Run.
+// InMemoryProcessor is safe for concurrent use.
+type InMemoryProcessor struct {
+	// InitErr is returned from Init.
+	InitErr error
+	// ProcessErrs are returned from consecutive Process calls, nil is returned after they are exhausted.
+	// The event is recorded even if an error is returned.
+	ProcessErrs []error
+	// ShutdownErr is returned from Shutdown.
+	ShutdownErr error
+
+	mu             sync.Mutex
+	registerResp   *extapi.RegisterResponse
+	events         []telemetryapi.Event
+	shutdownCalled bool
+	shutdownReason extapi.ShutdownReason
+	shutdownErr    error
+}
+
+func (p *InMemoryProcessor) Init(ctx context.Context, registerResp *extapi.RegisterResponse) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.registerResp = registerResp
+
+	return p.InitErr
+}
+
+func (p *InMemoryProcessor) Process(ctx context.Context, event telemetryapi.Event) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.events = append(p.events, event)
+	if n := len(p.events); n <= len(p.ProcessErrs) {
+		return p.ProcessErrs[n-1]
+	}
+
+	return nil
+}
+
+func (p *InMemoryProcessor) Shutdown(ctx context.Context, reason extapi.ShutdownReason, err error) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.shutdownCalled = true
+	p.shutdownReason = reason
+	p.shutdownErr = err
+
+	return p.ShutdownErr
+}
+
+// Events returns a copy of all events received by Process in order of arrival.
+func (p *InMemoryProcessor) Events() []telemetryapi.Event {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]telemetryapi.Event(nil), p.events...)
+}
+
+// RegisterResponse returns RegisterResponse passed into Init or nil if Init hasn't been called.
+func (p *InMemoryProcessor) RegisterResponse() *extapi.RegisterResponse {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.registerResp
+}
+
+// ShutdownReason returns the reason passed into Shutdown and false if Shutdown hasn't been called.
+func (p *InMemoryProcessor) ShutdownReason() (extapi.ShutdownReason, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.shutdownReason, p.shutdownCalled
+}
+
+// ShutdownError returns the error passed into Shutdown.
+func (p *InMemoryProcessor) ShutdownError() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.shutdownErr
+}
@@ -0,0 +1,38 @@
+package telemetrytest_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zakharovvi/aws-lambda-extensions/extapi"
+	"github.com/zakharovvi/aws-lambda-extensions/telemetryapi"
+	"github.com/zakharovvi/aws-lambda-extensions/telemetryapi/telemetrytest"
+)
+
+func TestInMemoryProcessor(t *testing.T) {
+	processErr := errors.New("process failed")
+	proc := &telemetrytest.InMemoryProcessor{ProcessErrs: []error{nil, processErr}}
+	var _ telemetryapi.Processor = proc
+
+	registerResp := &extapi.RegisterResponse{FunctionName: "helloWorld"}
+	require.NoError(t, proc.Init(context.Background(), registerResp))
+	require.Same(t, registerResp, proc.RegisterResponse())
+
+	first := telemetryapi.Event{Type: telemetryapi.TypeFunction, Record: telemetryapi.RecordFunction("first")}
+	second := telemetryapi.Event{Type: telemetryapi.TypeFunction, Record: telemetryapi.RecordFunction("second")}
+	third := telemetryapi.Event{Type: telemetryapi.TypeFunction, Record: telemetryapi.RecordFunction("third")}
+	require.NoError(t, proc.Process(context.Background(), first))
+	require.ErrorIs(t, proc.Process(context.Background(), second), processErr)
+	require.NoError(t, proc.Process(context.Background(), third))
+	require.Equal(t, []telemetryapi.Event{first, second, third}, proc.Events())
+
+	_, called := proc.ShutdownReason()
+	require.False(t, called)
+	require.NoError(t, proc.Shutdown(context.Background(), extapi.ExtensionError, processErr))
+	reason, called := proc.ShutdownReason()
+	require.True(t, called)
+	require.Equal(t, extapi.ExtensionError, reason)
+	require.ErrorIs(t, proc.ShutdownError(), processErr)
+}
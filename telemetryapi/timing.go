@@ -0,0 +1,37 @@
+package telemetryapi
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/zakharovvi/aws-lambda-extensions/internal"
+)
+
+// ProcessTiming aggregates durations of Processor.Process calls for one record type in Stats.ProcessTimings.
+type ProcessTiming = internal.ProcessTiming
+
+// timingProcessor measures Processor.Process durations by RecordType and logs calls slower than threshold.
+type timingProcessor struct {
+	Processor
+	threshold time.Duration
+	log       logr.Logger
+}
+
+func (p *timingProcessor) Process(ctx context.Context, event Event) error {
+	start := time.Now()
+	err := p.Processor.Process(ctx, event)
+	d := time.Since(start)
+
+	recordType := RecordType(event)
+	internal.TrackProcessTiming(ctx, recordType, d)
+	if p.threshold > 0 && d > p.threshold {
+		p.log.V(1).Info("slow Processor.Process call", "recordType", recordType, "duration", d, "threshold", p.threshold)
+	}
+
+	return err
+}
+
+func withProcessTiming(proc Processor, threshold time.Duration, log logr.Logger) Processor {
+	return internal.WithFlush[Event](&timingProcessor{proc, threshold, log}, proc, nil)
+}
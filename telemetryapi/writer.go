@@ -0,0 +1,42 @@
+package telemetryapi
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/zakharovvi/aws-lambda-extensions/extapi"
+)
+
+// NewWriterProcessor creates a Processor writing every Event to w as one JSON object per line (NDJSON)
+// in the wire form received from Telemetry API: {"time":...,"type":...,"record":...}.
+// Writes are buffered and flushed on Shutdown and by Flush, so it can be combined with WithFlushInterval.
+// Lines are encoded with Event.RawEvent, so Record is used if the Event has no RawRecord.
+func NewWriterProcessor(w io.Writer) Processor {
+	return &writerProcessor{bufio.NewWriter(w)}
+}
+
+type writerProcessor struct {
+	w *bufio.Writer
+}
+
+func (p *writerProcessor) Init(ctx context.Context, registerResp *extapi.RegisterResponse) error {
+	return nil
+}
+
+func (p *writerProcessor) Process(ctx context.Context, event Event) error {
+	if _, err := p.w.Write(append(event.RawEvent(), '\n')); err != nil {
+		return fmt.Errorf("could not write event: %w", err)
+	}
+
+	return nil
+}
+
+func (p *writerProcessor) Flush(ctx context.Context) error {
+	return p.w.Flush()
+}
+
+func (p *writerProcessor) Shutdown(ctx context.Context, reason extapi.ShutdownReason, err error) error {
+	return p.w.Flush()
+}
@@ -0,0 +1,54 @@
+package telemetryapi_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zakharovvi/aws-lambda-extensions/extapi"
+	"github.com/zakharovvi/aws-lambda-extensions/telemetryapi"
+)
+
+func TestNewWriterProcessor(t *testing.T) {
+	ts := time.Date(2022, 10, 12, 0, 0, 0, 0, time.UTC)
+	buf := &bytes.Buffer{}
+	proc := telemetryapi.NewWriterProcessor(buf)
+
+	require.NoError(t, proc.Init(context.Background(), nil))
+	require.NoError(t, proc.Process(context.Background(), telemetryapi.Event{
+		Type:      telemetryapi.TypeFunction,
+		Time:      ts,
+		RawRecord: json.RawMessage(`"Hello <world>"`),
+		Record:    telemetryapi.RecordFunction("Hello <world>"),
+	}))
+	require.NoError(t, proc.Process(context.Background(), telemetryapi.Event{
+		Type:   telemetryapi.TypePlatformStart,
+		Time:   ts,
+		Record: telemetryapi.RecordPlatformStart{RequestID: "1.1", Version: "$LATEST"},
+	}))
+	require.Empty(t, buf.String(), "writes must be buffered till Shutdown")
+
+	require.NoError(t, proc.Shutdown(context.Background(), extapi.Spindown, nil))
+	want := `{"time":"2022-10-12T00:00:00.000Z","type":"function","record":"Hello <world>"}
+{"time":"2022-10-12T00:00:00.000Z","type":"platform.start","record":{"requestId":"1.1","version":"$LATEST","tracing":{"type":"","value":""}}}
+`
+	require.Equal(t, want, buf.String())
+}
+
+func TestNewWriterProcessor_Flush(t *testing.T) {
+	buf := &bytes.Buffer{}
+	proc := telemetryapi.NewWriterProcessor(buf)
+	require.NoError(t, proc.Process(context.Background(), telemetryapi.Event{
+		Type:      telemetryapi.TypeExtension,
+		Time:      time.Date(2022, 10, 12, 0, 0, 0, 0, time.UTC),
+		RawRecord: json.RawMessage(`"Hello extension"`),
+	}))
+
+	flusher, ok := proc.(telemetryapi.Flusher)
+	require.True(t, ok)
+	require.NoError(t, flusher.Flush(context.Background()))
+	require.Equal(t, `{"time":"2022-10-12T00:00:00.000Z","type":"extension","record":"Hello extension"}`+"\n", buf.String())
+}
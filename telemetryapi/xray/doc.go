@@ -0,0 +1,8 @@
+// Package xray implements OpenTelemetry span exporter sending spans to AWS X-Ray daemon without OTLP collector.
+// https://docs.aws.amazon.com/xray/latest/devguide/xray-api-sendingdata.html#xray-api-daemon
+//
+// Exporter serializes spans created by telemetryapi/otel.SpanConverter into X-Ray segment documents
+// and sends them over UDP to the daemon address from AWS_XRAY_DAEMON_ADDRESS environment variable.
+// Lambda runs the daemon and sets the variable when active tracing is enabled for the function.
+// Use Exporter with otel.NewProcessor and telemetryapi.Run.
+package xray
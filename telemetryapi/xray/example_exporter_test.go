@@ -0,0 +1,23 @@
+package xray_test
+
+import (
+	"context"
+	"log"
+
+	"github.com/zakharovvi/aws-lambda-extensions/telemetryapi"
+	"github.com/zakharovvi/aws-lambda-extensions/telemetryapi/otel"
+	"github.com/zakharovvi/aws-lambda-extensions/telemetryapi/xray"
+)
+
+func ExampleNewExporter() {
+	ctx := context.Background()
+	// X-Ray daemon address is read from AWS_XRAY_DAEMON_ADDRESS environment variable set by Lambda
+	exporter, err := xray.NewExporter(ctx)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	if err := telemetryapi.Run(ctx, otel.NewProcessor(ctx, exporter)); err != nil {
+		log.Panic(err)
+	}
+}
@@ -0,0 +1,224 @@
+package xray
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/zakharovvi/aws-lambda-extensions/extapi"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+const (
+	// DefaultDaemonAddress is used if AWS_XRAY_DAEMON_ADDRESS environment variable is not set.
+	DefaultDaemonAddress = "127.0.0.1:2000"
+	// maxSegmentNameLen is the maximum length of segment name accepted by X-Ray.
+	maxSegmentNameLen = 200
+	// header precedes every segment document sent to the daemon.
+	header = `{"format":"json","version":1}` + "\n"
+)
+
+type Option interface {
+	apply(*options)
+}
+
+type options struct {
+	log        logr.Logger
+	env        extapi.Environment
+	daemonAddr string
+}
+
+type loggerOption struct {
+	log logr.Logger
+}
+
+func (o loggerOption) apply(opts *options) {
+	opts.log = o.log
+}
+
+func WithLogger(log logr.Logger) Option {
+	return loggerOption{log}
+}
+
+type environmentOption struct {
+	env extapi.Environment
+}
+
+func (o environmentOption) apply(opts *options) {
+	opts.env = o.env
+}
+
+// WithEnvironment configures lookup of AWS_XRAY_DAEMON_ADDRESS environment variable. os.Getenv is used by default.
+func WithEnvironment(env extapi.Environment) Option {
+	return environmentOption{env}
+}
+
+type daemonAddressOption string
+
+func (o daemonAddressOption) apply(opts *options) {
+	opts.daemonAddr = string(o)
+}
+
+// WithDaemonAddress configures UDP address of X-Ray daemon instead of AWS_XRAY_DAEMON_ADDRESS environment variable.
+func WithDaemonAddress(addr string) Option {
+	return daemonAddressOption(addr)
+}
+
+// Exporter implements sdktrace.SpanExporter to send spans to X-Ray daemon.
+// Spans without parent are sent as segments and spans with parent are sent as independent subsegments.
+type Exporter struct {
+	log     logr.Logger
+	mu      sync.Mutex
+	conn    net.Conn
+	stopped bool
+}
+
+// NewExporter creates Exporter sending spans to X-Ray daemon.
+// DefaultDaemonAddress is used if neither WithDaemonAddress nor AWS_XRAY_DAEMON_ADDRESS is set.
+func NewExporter(ctx context.Context, opts ...Option) (*Exporter, error) {
+	options := options{
+		log: logr.FromContextOrDiscard(ctx),
+		env: os.Getenv,
+	}
+	for _, o := range opts {
+		o.apply(&options)
+	}
+
+	addr := options.daemonAddr
+	if addr == "" {
+		var err error
+		if addr, err = parseDaemonAddress(options.env("AWS_XRAY_DAEMON_ADDRESS")); err != nil {
+			return nil, err
+		}
+	}
+	if addr == "" {
+		options.log.Info("AWS_XRAY_DAEMON_ADDRESS is not set, using default X-Ray daemon address", "addr", DefaultDaemonAddress)
+		addr = DefaultDaemonAddress
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to X-Ray daemon: %w", err)
+	}
+	options.log.V(1).Info("sending spans to X-Ray daemon", "addr", addr)
+
+	return &Exporter{log: options.log, conn: conn}, nil
+}
+
+// parseDaemonAddress returns UDP address from AWS_XRAY_DAEMON_ADDRESS value.
+// The value is either "host:port" or "tcp:host:port udp:host:port" in any order.
+func parseDaemonAddress(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return "", nil
+	}
+	fields := strings.Fields(value)
+	if len(fields) == 1 {
+		return strings.TrimPrefix(fields[0], "udp:"), nil
+	}
+	for _, field := range fields {
+		if addr := strings.TrimPrefix(field, "udp:"); addr != field {
+			return addr, nil
+		}
+	}
+
+	return "", fmt.Errorf("could not find udp address in AWS_XRAY_DAEMON_ADDRESS=%q", value)
+}
+
+// ExportSpans sends every span to X-Ray daemon in a separate UDP datagram.
+func (e *Exporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.stopped {
+		return nil
+	}
+	for _, span := range spans {
+		doc, err := json.Marshal(newSegment(span))
+		if err != nil {
+			return fmt.Errorf("could not json encode X-Ray segment: %w", err)
+		}
+		if _, err := e.conn.Write(append([]byte(header), doc...)); err != nil {
+			return fmt.Errorf("could not send X-Ray segment to daemon: %w", err)
+		}
+		e.log.V(1).Info("sent X-Ray segment", "name", span.Name(), "id", span.SpanContext().SpanID())
+	}
+
+	return nil
+}
+
+// Shutdown closes the connection to X-Ray daemon. Spans exported after Shutdown are dropped.
+func (e *Exporter) Shutdown(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.stopped {
+		return nil
+	}
+	e.stopped = true
+
+	return e.conn.Close()
+}
+
+// segment is X-Ray segment document.
+// https://docs.aws.amazon.com/xray/latest/devguide/xray-api-segmentdocuments.html
+type segment struct {
+	Name      string                    `json:"name"`
+	ID        string                    `json:"id"`
+	TraceID   string                    `json:"trace_id"`
+	ParentID  string                    `json:"parent_id,omitempty"`
+	Type      string                    `json:"type,omitempty"`
+	StartTime float64                   `json:"start_time"`
+	EndTime   float64                   `json:"end_time"`
+	Fault     bool                      `json:"fault,omitempty"`
+	Metadata  map[string]map[string]any `json:"metadata,omitempty"`
+}
+
+func newSegment(span sdktrace.ReadOnlySpan) segment {
+	name := span.Name()
+	if len(name) > maxSegmentNameLen {
+		name = name[:maxSegmentNameLen]
+	}
+	seg := segment{
+		Name:      name,
+		ID:        span.SpanContext().SpanID().String(),
+		TraceID:   traceID(span.SpanContext().TraceID()),
+		StartTime: epochSeconds(span.StartTime()),
+		EndTime:   epochSeconds(span.EndTime()),
+		Fault:     span.Status().Code == codes.Error,
+	}
+	if span.Parent().HasSpanID() {
+		seg.ParentID = span.Parent().SpanID().String()
+		seg.Type = "subsegment"
+	}
+	if attrs := span.Attributes(); len(attrs) > 0 {
+		metadata := make(map[string]any, len(attrs))
+		for _, attr := range attrs {
+			metadata[string(attr.Key)] = attr.Value.AsInterface()
+		}
+		seg.Metadata = map[string]map[string]any{"otel": metadata}
+	}
+
+	return seg
+}
+
+// traceID converts OpenTelemetry trace ID into X-Ray format 1-{8 hex digits of epoch time}-{24 hex digits}.
+func traceID(id [16]byte) string {
+	s := hex.EncodeToString(id[:])
+
+	return "1-" + s[:8] + "-" + s[8:]
+}
+
+// epochSeconds converts time into epoch seconds with fractional part used in X-Ray segment documents.
+func epochSeconds(t time.Time) float64 {
+	return float64(t.Unix()) + float64(t.Nanosecond())/float64(time.Second)
+}
@@ -0,0 +1,114 @@
+package xray_test
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zakharovvi/aws-lambda-extensions/telemetryapi/xray"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestExporter_ExportSpans(t *testing.T) {
+	daemon, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer daemon.Close()
+
+	env := func(key string) string {
+		if key == "AWS_XRAY_DAEMON_ADDRESS" {
+			return "tcp:127.0.0.1:1 udp:" + daemon.LocalAddr().String()
+		}
+
+		return ""
+	}
+	exporter, err := xray.NewExporter(context.Background(), xray.WithEnvironment(env))
+	require.NoError(t, err)
+
+	traceID, err := trace.TraceIDFromHex("637e16f01fbed7cb2ea0e5d7537a6258")
+	require.NoError(t, err)
+	start := time.Date(2022, 11, 23, 12, 49, 53, int(86*time.Millisecond), time.UTC)
+	stubs := tracetest.SpanStubs{
+		{
+			Name: "test-name/invoke",
+			SpanContext: trace.NewSpanContext(trace.SpanContextConfig{
+				TraceID: traceID,
+				SpanID:  [8]byte{1},
+			}),
+			StartTime:  start,
+			EndTime:    start.Add(170 * time.Millisecond),
+			Status:     sdktrace.Status{Code: codes.Error},
+			Attributes: []attribute.KeyValue{attribute.Int("aws.lambda.produced_bytes", 16)},
+		},
+		{
+			Name: "test-name/responseLatency",
+			SpanContext: trace.NewSpanContext(trace.SpanContextConfig{
+				TraceID: traceID,
+				SpanID:  [8]byte{2},
+			}),
+			Parent: trace.NewSpanContext(trace.SpanContextConfig{
+				TraceID: traceID,
+				SpanID:  [8]byte{1},
+			}),
+			StartTime: start,
+			EndTime:   start.Add(time.Millisecond),
+		},
+	}
+	require.NoError(t, exporter.ExportSpans(context.Background(), stubs.Snapshots()))
+
+	want := []string{
+		`{"name":"test-name/invoke","id":"0100000000000000","trace_id":"1-637e16f0-1fbed7cb2ea0e5d7537a6258",` +
+			`"start_time":1669207793.086,"end_time":1669207793.256,"fault":true,"metadata":{"otel":{"aws.lambda.produced_bytes":16}}}`,
+		`{"name":"test-name/responseLatency","id":"0200000000000000","trace_id":"1-637e16f0-1fbed7cb2ea0e5d7537a6258",` +
+			`"parent_id":"0100000000000000","type":"subsegment","start_time":1669207793.086,"end_time":1669207793.087}`,
+	}
+	buf := make([]byte, 64*1024)
+	for _, wantDoc := range want {
+		require.NoError(t, daemon.SetReadDeadline(time.Now().Add(time.Second)))
+		n, _, err := daemon.ReadFrom(buf)
+		require.NoError(t, err)
+
+		header, doc, found := strings.Cut(string(buf[:n]), "\n")
+		require.True(t, found)
+		require.JSONEq(t, `{"format":"json","version":1}`, header)
+		require.JSONEq(t, wantDoc, doc)
+		require.True(t, json.Valid([]byte(doc)))
+	}
+
+	require.NoError(t, exporter.Shutdown(context.Background()))
+	require.NoError(t, exporter.ExportSpans(context.Background(), stubs.Snapshots()))
+}
+
+func TestNewExporter_DaemonAddress(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		wantErr bool
+	}{
+		{"unset uses default", "", false},
+		{"host and port", "127.0.0.1:2000", false},
+		{"tcp and udp", "udp:127.0.0.1:2000 tcp:127.0.0.1:2000", false},
+		{"tcp only", "tcp:127.0.0.1:2000 tcp:127.0.0.1:2001", true},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			env := func(string) string { return tt.value }
+			exporter, err := xray.NewExporter(context.Background(), xray.WithEnvironment(env))
+			if tt.wantErr {
+				require.Error(t, err)
+
+				return
+			}
+			require.NoError(t, err)
+			require.NoError(t, exporter.Shutdown(context.Background()))
+		})
+	}
+}
@@ -3,6 +3,8 @@ package lambdaext
 import (
 	"encoding/json"
 	"fmt"
+	"math"
+	"strconv"
 	"time"
 )
 
@@ -18,6 +20,32 @@ type ExtensionName string
 // https://docs.aws.amazon.com/lambda/latest/dg/configuration-versions.html
 type FunctionVersion string
 
+// FunctionVersionLatest is the unpublished version of the function.
+const FunctionVersionLatest FunctionVersion = "$LATEST"
+
+// IsLatest reports whether the version is unpublished $LATEST version.
+func (v FunctionVersion) IsLatest() bool {
+	return v == FunctionVersionLatest
+}
+
+// Int returns the number of the published version and false for $LATEST or malformed values.
+func (v FunctionVersion) Int() (int, bool) {
+	if v == "" {
+		return 0, false
+	}
+	for _, c := range v {
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+	}
+	n, err := strconv.Atoi(string(v))
+	if err != nil || n == 0 {
+		return 0, false
+	}
+
+	return n, true
+}
+
 // InitType describes how Lambda initialized the environment.
 // https://docs.aws.amazon.com/lambda/latest/dg/telemetry-schema-reference.html#InitType
 type InitType string
@@ -55,10 +83,49 @@ func (d *DurationMs) UnmarshalJSON(b []byte) error {
 	return nil
 }
 
+// Duration returns d as time.Duration.
+func (d DurationMs) Duration() time.Duration {
+	return time.Duration(d)
+}
+
+// Milliseconds returns d as a floating point number of milliseconds, the same way it is represented in Lambda API.
+func (d DurationMs) Milliseconds() float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// String returns d formatted as time.Duration for logging.
 func (d DurationMs) String() string {
 	return time.Duration(d).String()
 }
 
+// MarshalJSON encodes d as a time.Duration string for printing. UnmarshalJSON accepts only numeric milliseconds.
 func (d DurationMs) MarshalJSON() ([]byte, error) {
 	return []byte(fmt.Sprintf(`"%s"`, d)), nil
 }
+
+// Int64 is an int64, parsed from JSON number in decimal or scientific notation, e.g. 1.5e9.
+// It is used for byte sizes and counters which can exceed int range on 32-bit platforms.
+type Int64 int64
+
+func (i *Int64) UnmarshalJSON(b []byte) error {
+	var num json.Number
+	if err := json.Unmarshal(b, &num); err != nil {
+		return err
+	}
+	// json.Number also accepts numbers in quoted strings
+	if len(b) > 0 && b[0] == '"' {
+		return fmt.Errorf("invalid integer: %s", b)
+	}
+	if v, err := num.Int64(); err == nil {
+		*i = Int64(v)
+
+		return nil
+	}
+	v, err := num.Float64()
+	if err != nil || v != math.Trunc(v) || v < math.MinInt64 || v >= math.MaxInt64 {
+		return fmt.Errorf("invalid integer: %s", b)
+	}
+	*i = Int64(v)
+
+	return nil
+}
@@ -2,6 +2,7 @@ package lambdaext_test
 
 import (
 	"encoding/json"
+	"math"
 	"testing"
 	"time"
 
@@ -55,3 +56,85 @@ func TestDurationMs_MarshalJSON(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, `"1h2m23.387s"`, string(got))
 }
+
+func TestInt64_UnmarshalJSON(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		json    string
+		want    lambdaext.Int64
+		wantErr bool
+	}{
+		{"16", 16, false},
+		{"-16", -16, false},
+		{"9223372036854775807", math.MaxInt64, false},
+		{"6.442450944e9", 6442450944, false},
+		{"1E3", 1000, false},
+		{"1.5", 0, true},
+		{"1e19", 0, true},
+		{`"16"`, 0, true},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.json, func(t *testing.T) {
+			t.Parallel()
+
+			var got lambdaext.Int64
+			err := json.Unmarshal([]byte(tt.json), &got)
+			if tt.wantErr {
+				require.Error(t, err)
+
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestFunctionVersion(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		version    lambdaext.FunctionVersion
+		wantLatest bool
+		wantInt    int
+		wantOk     bool
+	}{
+		{"$LATEST", true, 0, false},
+		{"12", false, 12, true},
+		{"1", false, 1, true},
+		{"", false, 0, false},
+		{"0", false, 0, false},
+		{"-1", false, 0, false},
+		{"+12", false, 0, false},
+		{"12a", false, 0, false},
+		{"latest", false, 0, false},
+		{"99999999999999999999999", false, 0, false},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(string(tt.version), func(t *testing.T) {
+			t.Parallel()
+			require.Equal(t, tt.wantLatest, tt.version.IsLatest())
+			n, ok := tt.version.Int()
+			require.Equal(t, tt.wantInt, n)
+			require.Equal(t, tt.wantOk, ok)
+		})
+	}
+}
+
+func TestDurationMs_UnmarshalJSONAndHelpers(t *testing.T) {
+	d := lambdaext.DurationMs(0)
+	require.NoError(t, json.Unmarshal([]byte("693.92"), &d))
+
+	require.Equal(t, 693920*time.Microsecond, d.Duration())
+	require.InDelta(t, 693.92, d.Milliseconds(), 1e-9)
+	require.Equal(t, "693.92ms", d.String())
+
+	// MarshalJSON formats the duration for printing, it is not decoded back by UnmarshalJSON
+	got, err := json.Marshal(d)
+	require.NoError(t, err)
+	require.Equal(t, `"693.92ms"`, string(got))
+	require.Error(t, json.Unmarshal(got, &d))
+}